@@ -0,0 +1,309 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+const (
+	authCacheRevalidateTimeout = 30 * time.Second
+	defaultAuthCacheSize       = 10000
+)
+
+// CacheStats contains the statistics of the Authentify cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+type authCacheEntry struct {
+	key        [32]byte
+	elem       *list.Element
+	claims     []string
+	subject    string
+	fetchedAt  time.Time
+	expiresAt  time.Time
+	refreshing bool
+}
+
+// authCache holds the claims returned by Authentify. Entries are fresh
+// for ttl. After that, and for at most maxStale, they are still served
+// while being revalidated in the background. The cache holds at most
+// size entries, and evicts the least recently used one when full.
+type authCache struct {
+	ttl       time.Duration
+	maxStale  time.Duration
+	size      int
+	entries   map[[32]byte]*authCacheEntry
+	order     *list.List
+	lastPurge time.Time
+	epoch     uint64
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	sync.Mutex
+}
+
+func newAuthCache(ttl time.Duration, maxStale time.Duration, size int) *authCache {
+	return &authCache{
+		ttl:       ttl,
+		maxStale:  maxStale,
+		size:      size,
+		entries:   map[[32]byte]*authCacheEntry{},
+		order:     list.New(),
+		lastPurge: time.Now(),
+	}
+}
+
+// get returns the cached claims for the given key if they can be served.
+// revalidate is true if the caller must revalidate the entry.
+func (c *authCache) get(key [32]byte) (claims []string, revalidate bool, ok bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false, false
+	}
+
+	now := time.Now()
+	if c.expired(entry, now) {
+		c.evict(key)
+		c.misses++
+		return nil, false, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(entry.elem)
+	age := now.Sub(entry.fetchedAt)
+
+	if age >= c.ttl && !entry.refreshing {
+		entry.refreshing = true
+		revalidate = true
+	}
+
+	return copyClaims(entry.claims), revalidate, true
+}
+
+// currentEpoch returns the current invalidation epoch. It must be
+// retrieved before fetching the claims given to set.
+func (c *authCache) currentEpoch() uint64 {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.epoch
+}
+
+// set stores the given claims, evicting the least recently used
+// entry if the cache is full. expiresAt is the expiration time of
+// the token, or zero if it does not expire. The claims are dropped
+// if an invalidation happened since the given epoch, as they may
+// have been fetched before it.
+func (c *authCache) set(key [32]byte, claims []string, expiresAt time.Time, epoch uint64) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if epoch != c.epoch {
+		if entry, ok := c.entries[key]; ok {
+			entry.refreshing = false
+		}
+		return
+	}
+
+	now := time.Now()
+
+	entry := &authCacheEntry{
+		key:       key,
+		claims:    claims,
+		subject:   subjectFromClaims(claims),
+		fetchedAt: now,
+		expiresAt: expiresAt,
+	}
+
+	if old, ok := c.entries[key]; ok {
+		entry.elem = old.elem
+		entry.elem.Value = entry
+		c.order.MoveToFront(entry.elem)
+	} else {
+		entry.elem = c.order.PushFront(entry)
+	}
+	c.entries[key] = entry
+
+	if c.order.Len() > c.size {
+		c.evict(c.order.Back().Value.(*authCacheEntry).key)
+	}
+
+	if now.Sub(c.lastPurge) < c.ttl {
+		return
+	}
+
+	c.lastPurge = now
+	for k, entry := range c.entries {
+		if c.expired(entry, now) {
+			c.evict(k)
+		}
+	}
+}
+
+// invalidateBySubject removes all the entries of the given subject,
+// and starts a new epoch so the claims being fetched are not cached.
+func (c *authCache) invalidateBySubject(subject string) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.epoch++
+
+	for k, entry := range c.entries {
+		if entry.subject == subject {
+			c.evict(k)
+		}
+	}
+}
+
+// stats returns the statistics of the cache.
+func (c *authCache) stats() CacheStats {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.entries),
+	}
+}
+
+// expired returns true if the entry can not be served anymore.
+func (c *authCache) expired(entry *authCacheEntry, now time.Time) bool {
+
+	if !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt) {
+		return true
+	}
+
+	return now.Sub(entry.fetchedAt) >= c.ttl+c.maxStale
+}
+
+// evict removes the given entry. The lock must be held.
+func (c *authCache) evict(key [32]byte) {
+	c.order.Remove(c.entries[key].elem)
+	delete(c.entries, key)
+	c.evictions++
+}
+
+// revalidationFailed must be called when a revalidation fails.
+// If the token has been rejected, the entry is removed.
+// Otherwise the entry will be revalidated again by the
+// next call.
+func (c *authCache) revalidationFailed(key [32]byte, rejected bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if rejected {
+		if _, ok := c.entries[key]; ok {
+			c.evict(key)
+		}
+		return
+	}
+
+	if entry, ok := c.entries[key]; ok {
+		entry.refreshing = false
+	}
+}
+
+// CacheStats returns the statistics of the Authentify cache.
+// It returns zero values if the client has been created
+// without OptionAuthentifyCache.
+func (a *Client) CacheStats() CacheStats {
+
+	if a.authCache == nil {
+		return CacheStats{}
+	}
+
+	return a.authCache.stats()
+}
+
+// InvalidateBySubject removes all the cached Authentify results
+// of the given subject, so the next calls with one of its tokens
+// will be validated by midgard. This can be used to immediately
+// stop trusting a compromised identity.
+func (a *Client) InvalidateBySubject(subject string) {
+
+	if a.authCache == nil {
+		return
+	}
+
+	a.authCache.invalidateBySubject(subject)
+}
+
+// revalidate refreshes the cache entry for the given token.
+func (a *Client) revalidate(key [32]byte, token string) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), authCacheRevalidateTimeout)
+	defer cancel()
+
+	epoch := a.authCache.currentEpoch()
+
+	claims, err := a.authentifies.do(ctx, key, func() ([]string, error) {
+		return a.authentify(ctx, token)
+	})
+	if err != nil {
+		a.authCache.revalidationFailed(key, errors.Is(err, ErrUnauthorized{}))
+		return
+	}
+
+	a.authCache.set(key, claims, tokenExpiration(token), epoch)
+}
+
+// subjectFromClaims returns the subject
+// contained in the given normalized claims.
+func subjectFromClaims(claims []string) string {
+
+	for _, claim := range claims {
+		if t, err := verify.ParseTag(claim); err == nil && t.Key == verify.TagKeySubject {
+			return t.Value
+		}
+	}
+
+	return ""
+}
+
+// tokenExpiration returns the expiration time of
+// the given token, or zero if it cannot be found.
+func tokenExpiration(token string) time.Time {
+
+	c := &jwt.StandardClaims{}
+	p := jwt.Parser{}
+
+	if _, _, err := p.ParseUnverified(token, c); err != nil || c.ExpiresAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(c.ExpiresAt, 0)
+}
@@ -0,0 +1,269 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_AuthentifyCache(t *testing.T) {
+
+	Convey("Calling OptionAuthentifyCache with invalid values should make New return an error", t, func() {
+		So(optionError(OptionAuthentifyCache(0, time.Second)), ShouldEqual, "ttl must be greater than 0")
+		So(optionError(OptionAuthentifyCache(time.Second, -1)), ShouldEqual, "maxStale must be positive")
+		So(optionError(OptionAuthentifyCacheSize(0)), ShouldEqual, "size must be greater than 0")
+	})
+
+	Convey("Given I have a client with a cache and a server", t, func() {
+
+		var calls int32
+		var status int32 = http.StatusOK
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			fmt.Fprintf(w, `{"claims": {"realm": "certificate", "sub": "subject", "data": {"call": "%d"}}}`, n)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionAuthentifyCache(time.Minute, time.Minute))
+		key := tokenFingerprint("token")
+
+		claims, err := cl.Authentify(context.Background(), "token")
+		So(err, ShouldBeNil)
+		So(claims, ShouldContain, "@auth:call=1")
+
+		Convey("When I call Authentify again while the entry is fresh", func() {
+
+			claims, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the claims should come from the cache", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldContain, "@auth:call=1")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I call Authentify while the entry is stale", func() {
+
+			cl.authCache.entries[key].fetchedAt = time.Now().Add(-90 * time.Second)
+
+			claims, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the stale claims should be returned", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldContain, "@auth:call=1")
+			})
+
+			Convey("Then the entry should be revalidated in the background", func() {
+				So(func() bool {
+					for i := 0; i < 100; i++ {
+						if c, _, _ := cl.authCache.get(key); len(c) > 0 && c[0] == "@auth:call=2" {
+							return true
+						}
+						time.Sleep(10 * time.Millisecond)
+					}
+					return false
+				}(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I call Authentify while the stale entry has been rejected", func() {
+
+			atomic.StoreInt32(&status, http.StatusUnauthorized)
+			cl.authCache.entries[key].fetchedAt = time.Now().Add(-90 * time.Second)
+
+			_, err := cl.Authentify(context.Background(), "token")
+			So(err, ShouldBeNil)
+
+			Convey("Then the entry should be removed", func() {
+				So(func() bool {
+					for i := 0; i < 100; i++ {
+						if _, _, ok := cl.authCache.get(key); !ok {
+							return true
+						}
+						time.Sleep(10 * time.Millisecond)
+					}
+					return false
+				}(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I call Authentify after max stale", func() {
+
+			cl.authCache.entries[key].fetchedAt = time.Now().Add(-3 * time.Minute)
+
+			claims, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the claims should be fetched again", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldContain, "@auth:call=2")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When I call Authentify after the token expiration", func() {
+
+			cl.authCache.entries[key].expiresAt = time.Now().Add(-time.Second)
+
+			claims, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the claims should be fetched again", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldContain, "@auth:call=2")
+			})
+		})
+	})
+}
+
+func TestClient_AuthentifyCacheStats(t *testing.T) {
+
+	Convey("Given I have a client with a cache and a server", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"claims": {"realm": "certificate", "sub": "subject"}}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionAuthentifyCache(time.Minute, time.Minute))
+
+		_, _ = cl.Authentify(context.Background(), "token1")
+		_, _ = cl.Authentify(context.Background(), "token1")
+		_, _ = cl.Authentify(context.Background(), "token2")
+
+		Convey("When I call CacheStats", func() {
+
+			stats := cl.CacheStats()
+
+			Convey("Then the stats should be correct", func() {
+				So(stats, ShouldResemble, CacheStats{Hits: 1, Misses: 2, Entries: 2})
+			})
+		})
+
+		Convey("When I call InvalidateBySubject with the subject", func() {
+
+			cl.InvalidateBySubject("subject")
+
+			Convey("Then all the entries of the subject should be evicted", func() {
+				So(cl.CacheStats(), ShouldResemble, CacheStats{Hits: 1, Misses: 2, Evictions: 2, Entries: 0})
+			})
+		})
+
+		Convey("When I call InvalidateBySubject with another subject", func() {
+
+			cl.InvalidateBySubject("other")
+
+			Convey("Then no entry should be evicted", func() {
+				So(cl.CacheStats().Entries, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given I have a client with a cache and a slow server", t, func() {
+
+		started := make(chan struct{}, 1)
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+			fmt.Fprintln(w, `{"claims": {"realm": "certificate", "sub": "subject"}}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionAuthentifyCache(time.Minute, time.Minute))
+
+		Convey("When I call InvalidateBySubject while Authentify is in flight", func() {
+
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := cl.Authentify(context.Background(), "token")
+				errCh <- err
+			}()
+
+			<-started
+			cl.InvalidateBySubject("subject")
+			close(release)
+
+			Convey("Then the claims should be returned but not cached", func() {
+				So(<-errCh, ShouldBeNil)
+				So(cl.CacheStats().Entries, ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given I have a client with a cache of 2 entries and a server", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			fmt.Fprintln(w, `{"claims": {"realm": "certificate", "sub": "subject"}}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionAuthentifyCache(time.Minute, time.Minute), OptionAuthentifyCacheSize(2))
+
+		Convey("When I call Authentify with more tokens than the cache can hold", func() {
+
+			for _, token := range []string{"a", "b", "a", "c"} {
+				_, err := cl.Authentify(context.Background(), token)
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then the least recently used entry should have been evicted", func() {
+				So(cl.CacheStats().Entries, ShouldEqual, 2)
+				So(cl.CacheStats().Evictions, ShouldEqual, 1)
+				So(cl.authCache.entries, ShouldContainKey, tokenFingerprint("a"))
+				So(cl.authCache.entries, ShouldContainKey, tokenFingerprint("c"))
+				So(cl.authCache.entries, ShouldNotContainKey, tokenFingerprint("b"))
+				So(atomic.LoadInt32(&calls), ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given I have a client without cache", t, func() {
+
+		cl := NewClient("http://com.com")
+
+		Convey("Then CacheStats should return zero values", func() {
+			cl.InvalidateBySubject("subject")
+			So(cl.CacheStats(), ShouldResemble, CacheStats{})
+		})
+	})
+}
+
+func TestTokenExpiration(t *testing.T) {
+
+	Convey("Given I have a token with an expiration", t, func() {
+
+		exp := time.Now().Add(time.Hour).Unix()
+		token := makeToken(&jwt.StandardClaims{ExpiresAt: exp}, jwt.SigningMethodES256, key(signerKey))
+
+		Convey("Then tokenExpiration should return it", func() {
+			So(tokenExpiration(token).Unix(), ShouldEqual, exp)
+		})
+	})
+
+	Convey("Given I have an invalid token", t, func() {
+
+		Convey("Then tokenExpiration should return zero", func() {
+			So(tokenExpiration("nope").IsZero(), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/midgard-lib/tokenmanager/providers"
+)
+
+const (
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+	awsTimeFormat       = "20060102T150405Z"
+	awsEmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// awsPresignExpiry is how long the presigned request
+	// can be used by midgard.
+	awsPresignExpiry = time.Minute
+)
+
+// awsCredentials are the credentials of an AWS role,
+// as returned by the instance metadata service.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+}
+
+// awsRoleCredentials returns the credentials of
+// the role of the instance.
+func awsRoleCredentials() (awsCredentials, error) {
+
+	c := awsCredentials{}
+
+	data, err := providers.AWSServiceRoleToken()
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// IssueFromAWSIAMRole issues a Midgard jwt from the IAM role of the instance.
+// The temporary credentials of the role are retrieved using the aws magic ip
+// and used to presign an STS GetCallerIdentity request. Only the presigned
+// request is sent to midgard, which calls STS to learn the identity of the
+// caller. If region is empty, the global STS endpoint is used.
+func (a *Client) IssueFromAWSIAMRole(ctx context.Context, region string, validity time.Duration, options ...Option) (string, error) {
+
+	creds, err := awsRoleCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	return a.issueFromAWSIAMCredentials(ctx, creds, region, validity, options...)
+}
+
+func (a *Client) issueFromAWSIAMCredentials(ctx context.Context, creds awsCredentials, region string, validity time.Duration, options ...Option) (string, error) {
+
+	opts := a.issueOptions(options)
+
+	presignedURL, err := presignGetCallerIdentity(creds, region, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{
+		"iamRequestMethod": http.MethodGet,
+		"iamRequestURL":    presignedURL,
+	}
+
+	issueRequest.Realm = gaia.IssueRealmAWSSecurityToken
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.aws.iam")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// presignGetCallerIdentity returns the url of an STS GetCallerIdentity
+// request presigned with the given credentials using AWS signature v4.
+func presignGetCallerIdentity(creds awsCredentials, region string, now time.Time) (string, error) {
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return "", fmt.Errorf("unable to presign sts request: missing aws credentials")
+	}
+
+	host := "sts.amazonaws.com"
+	if region == "" {
+		region = "us-east-1"
+	} else {
+		host = "sts." + region + ".amazonaws.com"
+	}
+
+	now = now.UTC()
+	amzDate := now.Format(awsTimeFormat)
+	scope := now.Format("20060102") + "/" + region + "/sts/aws4_request"
+
+	params := map[string]string{
+		"Action":              "GetCallerIdentity",
+		"Version":             "2011-06-15",
+		"X-Amz-Algorithm":     awsSigningAlgorithm,
+		"X-Amz-Credential":    creds.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       fmt.Sprintf("%d", int(awsPresignExpiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+
+	if creds.Token != "" {
+		params["X-Amz-Security-Token"] = creds.Token
+	}
+
+	query := awsCanonicalQuery(params)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		"/",
+		query,
+		"host:" + host + "\n",
+		"host",
+		awsEmptyPayloadHash,
+	}, "\n")
+
+	signature := awsSignature(creds.SecretAccessKey, now, region, "sts", amzDate, scope, canonicalRequest)
+
+	return "https://" + host + "/?" + query + "&X-Amz-Signature=" + signature, nil
+}
+
+// awsSignature returns the AWS signature v4 of the given canonical request.
+func awsSignature(secretAccessKey string, now time.Time, region string, service string, amzDate string, scope string, canonicalRequest string) string {
+
+	h := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		awsSigningAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(h[:]),
+	}, "\n")
+
+	key := awsHMAC([]byte("AWS4"+secretAccessKey), now.UTC().Format("20060102"))
+	key = awsHMAC(key, region)
+	key = awsHMAC(key, service)
+	key = awsHMAC(key, "aws4_request")
+
+	return hex.EncodeToString(awsHMAC(key, stringToSign))
+}
+
+func awsHMAC(key []byte, data string) []byte {
+
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// awsCanonicalQuery returns the given parameters as a
+// query string sorted by key, as required by AWS.
+func awsCanonicalQuery(params map[string]string) string {
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = awsURIEncode(k) + "=" + awsURIEncode(params[k])
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent encodes everything
+// but the unreserved characters.
+func awsURIEncode(s string) string {
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
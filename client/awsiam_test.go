@@ -0,0 +1,132 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestAWSSignature(t *testing.T) {
+
+	Convey("Given I have the get-vanilla request of the AWS signature v4 test suite", t, func() {
+
+		now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		canonicalRequest := "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" + awsEmptyPayloadHash
+
+		Convey("When I compute its signature", func() {
+
+			signature := awsSignature(
+				"wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				now,
+				"us-east-1",
+				"service",
+				"20150830T123600Z",
+				"20150830/us-east-1/service/aws4_request",
+				canonicalRequest,
+			)
+
+			Convey("Then it should be the expected one", func() {
+				So(signature, ShouldEqual, "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")
+			})
+		})
+	})
+
+	Convey("Encoding a string should only keep the unreserved characters", t, func() {
+		So(awsURIEncode("AKID/20150830/us-east-1/sts/aws4_request"), ShouldEqual, "AKID%2F20150830%2Fus-east-1%2Fsts%2Faws4_request")
+		So(awsURIEncode("a+b=c d~e"), ShouldEqual, "a%2Bb%3Dc%20d~e")
+	})
+}
+
+func TestPresignGetCallerIdentity(t *testing.T) {
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	creds := awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Token: "session/token"}
+
+	Convey("Presigning with the global endpoint should work", t, func() {
+
+		raw, err := presignGetCallerIdentity(creds, "", now)
+		So(err, ShouldBeNil)
+
+		u, err := url.Parse(raw)
+		So(err, ShouldBeNil)
+		So(u.Host, ShouldEqual, "sts.amazonaws.com")
+
+		q := u.Query()
+		So(q.Get("Action"), ShouldEqual, "GetCallerIdentity")
+		So(q.Get("Version"), ShouldEqual, "2011-06-15")
+		So(q.Get("X-Amz-Algorithm"), ShouldEqual, "AWS4-HMAC-SHA256")
+		So(q.Get("X-Amz-Credential"), ShouldEqual, "AKID/20150830/us-east-1/sts/aws4_request")
+		So(q.Get("X-Amz-Date"), ShouldEqual, "20150830T123600Z")
+		So(q.Get("X-Amz-Expires"), ShouldEqual, "60")
+		So(q.Get("X-Amz-SignedHeaders"), ShouldEqual, "host")
+		So(q.Get("X-Amz-Security-Token"), ShouldEqual, "session/token")
+		So(q.Get("X-Amz-Signature"), ShouldHaveLength, 64)
+	})
+
+	Convey("Presigning with a region should use the regional endpoint", t, func() {
+
+		raw, err := presignGetCallerIdentity(creds, "eu-west-1", now)
+		So(err, ShouldBeNil)
+
+		u, _ := url.Parse(raw)
+		So(u.Host, ShouldEqual, "sts.eu-west-1.amazonaws.com")
+		So(u.Query().Get("X-Amz-Credential"), ShouldEqual, "AKID/20150830/eu-west-1/sts/aws4_request")
+	})
+
+	Convey("Presigning without credentials should fail", t, func() {
+		_, err := presignGetCallerIdentity(awsCredentials{}, "", now)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "unable to presign sts request: missing aws credentials")
+	})
+}
+
+func TestClient_issueFromAWSIAMCredentials(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I issue a token from IAM credentials", func() {
+
+			token, err := cl.issueFromAWSIAMCredentials(context.Background(), awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, "", time.Minute)
+
+			Convey("Then only the presigned request should be sent", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(expectedRequest.Realm, ShouldEqual, gaia.IssueRealmAWSSecurityToken)
+				So(expectedRequest.Metadata["iamRequestMethod"], ShouldEqual, http.MethodGet)
+				So(expectedRequest.Metadata["iamRequestURL"], ShouldStartWith, "https://sts.amazonaws.com/?Action=GetCallerIdentity&")
+				So(expectedRequest.Metadata["secretAccessKey"], ShouldBeNil)
+			})
+		})
+	})
+}
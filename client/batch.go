@@ -0,0 +1,88 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A ChildTokenResult contains the result of the
+// issuance of a token for a namespace.
+type ChildTokenResult struct {
+	Token string
+	Err   error
+}
+
+// IssueChildTokens issues from the given token one child token restricted to
+// each of the given namespaces, using the Aporeto identity token realm. At
+// most concurrency tokens are issued at the same time. The given options
+// are applied to all the issue requests. It returns the result of each
+// issuance keyed by namespace, or an error if concurrency is not
+// greater than 0.
+func (a *Client) IssueChildTokens(ctx context.Context, token string, validity time.Duration, namespaces []string, concurrency int, options ...Option) (map[string]ChildTokenResult, error) {
+
+	if concurrency <= 0 {
+		return nil, fmt.Errorf("concurrency must be greater than 0")
+	}
+
+	results := make(map[string]ChildTokenResult, len(namespaces))
+	sem := make(chan struct{}, concurrency)
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, namespace := range namespaces {
+
+		lock.Lock()
+		_, seen := results[namespace]
+		if !seen {
+			results[namespace] = ChildTokenResult{}
+		}
+		lock.Unlock()
+
+		if seen {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			lock.Lock()
+			results[namespace] = ChildTokenResult{Err: ctx.Err()}
+			lock.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(namespace string) {
+
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			opts := append(append([]Option{}, options...), OptRestrictNamespace(namespace))
+			t, err := a.IssueFromAporetoIdentityToken(ctx, token, validity, opts...)
+
+			lock.Lock()
+			results[namespace] = ChildTokenResult{Token: t, Err: err}
+			lock.Unlock()
+		}(namespace)
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
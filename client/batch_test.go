@@ -0,0 +1,92 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_IssueChildTokens(t *testing.T) {
+
+	Convey("Calling IssueChildTokens with an invalid concurrency should return an error", t, func() {
+		results, err := NewClient("http://com.com").IssueChildTokens(context.Background(), "token", time.Hour, nil, 0)
+		So(results, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "concurrency must be greater than 0")
+	})
+
+	Convey("Given I have a client and a server", t, func() {
+
+		var inflight, maxInflight, calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			atomic.AddInt32(&calls, 1)
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+			for {
+				m := atomic.LoadInt32(&maxInflight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInflight, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			issue := gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(issue); err != nil {
+				panic(err)
+			}
+
+			if issue.RestrictedNamespace == "/bad" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `[{"code": 403, "title": "Forbidden", "description": "nope"}]`)
+				return
+			}
+
+			fmt.Fprintf(w, `{"token": "token-%s"}`, issue.RestrictedNamespace)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueChildTokens", func() {
+
+			results, err := cl.IssueChildTokens(context.Background(), "token", time.Hour, []string{"/a", "/b", "/c", "/a", "/bad"}, 2)
+
+			Convey("Then the results should be correct", func() {
+				So(err, ShouldBeNil)
+				So(len(results), ShouldEqual, 4)
+				So(results["/a"], ShouldResemble, ChildTokenResult{Token: "token-/a"})
+				So(results["/b"], ShouldResemble, ChildTokenResult{Token: "token-/b"})
+				So(results["/c"], ShouldResemble, ChildTokenResult{Token: "token-/c"})
+				So(results["/bad"].Err, ShouldNotBeNil)
+			})
+
+			Convey("Then duplicated namespaces should be issued once", func() {
+				So(atomic.LoadInt32(&calls), ShouldEqual, 4)
+			})
+
+			Convey("Then the concurrency should be bounded", func() {
+				So(atomic.LoadInt32(&maxInflight), ShouldBeLessThanOrEqualTo, 2)
+			})
+		})
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"crypto/x509"
+	"sort"
+
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+// SANMapping configures the claim keys used for the
+// subject alternative names of a certificate. An empty
+// key disables the corresponding claims.
+type SANMapping struct {
+	SPIFFEKey string
+	URIKey    string
+	DNSKey    string
+	EmailKey  string
+	IPKey     string
+}
+
+// DefaultSANMapping is the SANMapping used by default.
+var DefaultSANMapping = SANMapping{
+	SPIFFEKey: "spiffeid",
+	URIKey:    "urisan",
+	DNSKey:    "dnssan",
+	EmailKey:  "emailsan",
+	IPKey:     "ipsan",
+}
+
+// CertificateClaims returns the claims tags describing the given
+// certificate, as midgard would for the certificate realm. The
+// subject alternative names are included according to the given
+// mapping. URI SANs using the spiffe scheme are mapped on the
+// SPIFFEKey if set, otherwise on the URIKey.
+func CertificateClaims(cert *x509.Certificate, mapping SANMapping) (claims []string) {
+
+	if cert == nil {
+		return
+	}
+
+	cache := map[string]struct{}{}
+
+	add := func(key string, value string) {
+		if key != "" && value != "" {
+			cache[verify.FormatTag(key, value)] = struct{}{}
+		}
+	}
+
+	add(verify.TagKeyRealm, "certificate")
+	add("commonname", cert.Subject.CommonName)
+	add("serialnumber", cert.SerialNumber.String())
+
+	for _, o := range cert.Subject.Organization {
+		add("organization", o)
+	}
+
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		add("organizationalunit", ou)
+	}
+
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" && mapping.SPIFFEKey != "" {
+			add(mapping.SPIFFEKey, u.String())
+			continue
+		}
+		add(mapping.URIKey, u.String())
+	}
+
+	for _, name := range cert.DNSNames {
+		add(mapping.DNSKey, name)
+	}
+
+	for _, email := range cert.EmailAddresses {
+		add(mapping.EmailKey, email)
+	}
+
+	for _, ip := range cert.IPAddresses {
+		add(mapping.IPKey, ip.String())
+	}
+
+	for key := range cache {
+		claims = append(claims, key)
+	}
+
+	sort.Strings(claims)
+
+	return
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCertificateClaims(t *testing.T) {
+
+	spiffeID, _ := url.Parse("spiffe://acme.com/ns/default/sa/api")
+	webURI, _ := url.Parse("https://acme.com/api")
+
+	c := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject: pkix.Name{
+			CommonName:         "api",
+			Organization:       []string{"acme"},
+			OrganizationalUnit: []string{"dev", "ops"},
+		},
+		URIs:           []*url.URL{spiffeID, webURI},
+		DNSNames:       []string{"api.acme.com"},
+		EmailAddresses: []string{"api@acme.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	Convey("Given I have a certificate with SANs", t, func() {
+
+		Convey("When I call CertificateClaims with the default mapping", func() {
+
+			claims := CertificateClaims(c, DefaultSANMapping)
+
+			Convey("Then the claims should be correct", func() {
+				So(claims, ShouldResemble, []string{
+					"@auth:commonname=api",
+					"@auth:dnssan=api.acme.com",
+					"@auth:emailsan=api@acme.com",
+					"@auth:ipsan=10.0.0.1",
+					"@auth:organization=acme",
+					"@auth:organizationalunit=dev",
+					"@auth:organizationalunit=ops",
+					"@auth:realm=certificate",
+					"@auth:serialnumber=42",
+					"@auth:spiffeid=spiffe://acme.com/ns/default/sa/api",
+					"@auth:urisan=https://acme.com/api",
+				})
+			})
+		})
+
+		Convey("When I call CertificateClaims with a custom mapping", func() {
+
+			claims := CertificateClaims(c, SANMapping{URIKey: "uri"})
+
+			Convey("Then the claims should be correct", func() {
+				So(claims, ShouldResemble, []string{
+					"@auth:commonname=api",
+					"@auth:organization=acme",
+					"@auth:organizationalunit=dev",
+					"@auth:organizationalunit=ops",
+					"@auth:realm=certificate",
+					"@auth:serialnumber=42",
+					"@auth:uri=https://acme.com/api",
+					"@auth:uri=spiffe://acme.com/ns/default/sa/api",
+				})
+			})
+		})
+	})
+
+	Convey("Given I have no certificate", t, func() {
+
+		Convey("Then CertificateClaims should return nil", func() {
+			So(CertificateClaims(nil, DefaultSANMapping), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.aporeto.io/midgard-lib/logger"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// A ClaimsMappingRule rewrites or augments claims.
+//
+// Match is the claim to match, like "@auth:memberof=admins". If it
+// ends with a "*", it matches all the claims starting with the rest
+// of the value. Add contains the claims added when a claim matches,
+// and Replace removes the matching claims from the result.
+type ClaimsMappingRule struct {
+	Match   string   `yaml:"match"`
+	Add     []string `yaml:"add"`
+	Replace bool     `yaml:"replace"`
+}
+
+// ClaimsMapping is the content of a claims mapping file.
+type ClaimsMapping struct {
+	Rules []ClaimsMappingRule `yaml:"rules"`
+}
+
+// ParseClaimsMapping parses the given YAML claims mapping.
+func ParseClaimsMapping(data []byte) (*ClaimsMapping, error) {
+
+	m := &ClaimsMapping{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, fmt.Errorf("unable to parse claims mapping: %s", err)
+	}
+
+	for i, rule := range m.Rules {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("invalid claims mapping rule #%d: match cannot be empty", i)
+		}
+		if len(rule.Add) == 0 && !rule.Replace {
+			return nil, fmt.Errorf("invalid claims mapping rule #%d: rule has no effect", i)
+		}
+	}
+
+	return m, nil
+}
+
+// Apply applies the mapping to the given claims and returns
+// the resulting claims, sorted and deduplicated.
+func (m *ClaimsMapping) Apply(claims []string) []string {
+
+	out := map[string]struct{}{}
+	for _, claim := range claims {
+		out[claim] = struct{}{}
+	}
+
+	for _, rule := range m.Rules {
+		for _, claim := range claims {
+
+			if !rule.matches(claim) {
+				continue
+			}
+
+			if rule.Replace {
+				delete(out, claim)
+			}
+
+			for _, added := range rule.Add {
+				out[added] = struct{}{}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(out))
+	for claim := range out {
+		result = append(result, claim)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func (r ClaimsMappingRule) matches(claim string) bool {
+
+	if strings.HasSuffix(r.Match, "*") {
+		return strings.HasPrefix(claim, strings.TrimSuffix(r.Match, "*"))
+	}
+
+	return claim == r.Match
+}
+
+// A ClaimsMapper applies the claims mapping of a file.
+// Its Run method reloads the file when it changes.
+type ClaimsMapper struct {
+	path    string
+	watcher *FileWatcher
+	mapping *ClaimsMapping
+	logger  logger.Logger
+
+	sync.RWMutex
+}
+
+// NewClaimsMapper returns a new ClaimsMapper using the mapping file at the
+// given path. The file is checked for changes every interval once Run has
+// been called.
+func NewClaimsMapper(path string, interval time.Duration) (*ClaimsMapper, error) {
+
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+
+	m := &ClaimsMapper{
+		path:   path,
+		logger: zaplogger.New(nil),
+	}
+
+	data, err := m.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	// The watcher starts from the loaded content, so a
+	// change made after it was read is not missed.
+	m.watcher = NewFileWatcherWithContent(path, interval, data, m.reloadData)
+
+	return m, nil
+}
+
+// SetLogger sets the Logger used to report the reloads of the
+// mapping file. The default writes to the global zap logger.
+// It must be called before Run.
+func (m *ClaimsMapper) SetLogger(l logger.Logger) {
+
+	if l == nil {
+		panic("logger cannot be nil")
+	}
+
+	m.logger = l
+	m.watcher.SetLogger(l)
+}
+
+// Map applies the current mapping to the given claims.
+func (m *ClaimsMapper) Map(claims []string) []string {
+
+	m.RLock()
+	mapping := m.mapping
+	m.RUnlock()
+
+	return mapping.Apply(claims)
+}
+
+// Reload reloads the mapping file. If the file is invalid,
+// the current mapping is kept and an error is returned.
+func (m *ClaimsMapper) Reload() error {
+
+	_, err := m.reload()
+
+	return err
+}
+
+// reload reloads the mapping file and returns its content.
+func (m *ClaimsMapper) reload() ([]byte, error) {
+
+	data, err := ioutil.ReadFile(m.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read claims mapping file: %s", err)
+	}
+
+	return data, m.load(data)
+}
+
+// Run watches the mapping file and reloads it when it changes
+// until the given context is done.
+func (m *ClaimsMapper) Run(ctx context.Context) {
+
+	m.watcher.Run(ctx)
+}
+
+func (m *ClaimsMapper) reloadData(data []byte) {
+
+	if err := m.load(data); err != nil {
+		m.logger.Error("Unable to reload claims mapping", logger.F("path", m.path), logger.Err(err))
+		return
+	}
+
+	m.logger.Info("Claims mapping reloaded", logger.F("path", m.path))
+}
+
+func (m *ClaimsMapper) load(data []byte) error {
+
+	mapping, err := ParseClaimsMapping(data)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.mapping = mapping
+	m.Unlock()
+
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testClaimsMapping = `
+rules:
+  - match: "@auth:memberof=admins"
+    add:
+      - "@auth:role=admin"
+  - match: "@auth:memberof=dev-*"
+    add:
+      - "@auth:role=developer"
+    replace: true
+`
+
+func TestParseClaimsMapping(t *testing.T) {
+
+	Convey("Given I have a valid mapping", t, func() {
+
+		m, err := ParseClaimsMapping([]byte(testClaimsMapping))
+
+		Convey("Then err should be nil", func() {
+			So(err, ShouldBeNil)
+			So(len(m.Rules), ShouldEqual, 2)
+		})
+
+		Convey("When I apply it", func() {
+
+			claims := m.Apply([]string{
+				"@auth:memberof=admins",
+				"@auth:memberof=dev-api",
+				"@auth:memberof=dev-ui",
+				"@auth:subject=bob",
+			})
+
+			Convey("Then the claims should be mapped", func() {
+				So(claims, ShouldResemble, []string{
+					"@auth:memberof=admins",
+					"@auth:role=admin",
+					"@auth:role=developer",
+					"@auth:subject=bob",
+				})
+			})
+		})
+	})
+
+	Convey("Given I have an invalid mapping", t, func() {
+
+		_, err := ParseClaimsMapping([]byte("rules: nope"))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given I have a mapping with an unknown field", t, func() {
+
+		_, err := ParseClaimsMapping([]byte("rulez: []"))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given I have a mapping with an empty match", t, func() {
+
+		_, err := ParseClaimsMapping([]byte("rules: [{add: [a]}]"))
+
+		Convey("Then err should be correct", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid claims mapping rule #0: match cannot be empty")
+		})
+	})
+
+	Convey("Given I have a mapping with a rule without effect", t, func() {
+
+		_, err := ParseClaimsMapping([]byte("rules: [{match: a}]"))
+
+		Convey("Then err should be correct", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid claims mapping rule #0: rule has no effect")
+		})
+	})
+}
+
+func TestClaimsMapper(t *testing.T) {
+
+	Convey("Given I have a mapping file", t, func() {
+
+		dir, err := ioutil.TempDir("", "claimsmapper")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "mapping.yaml")
+		So(ioutil.WriteFile(path, []byte(testClaimsMapping), 0600), ShouldBeNil)
+
+		Convey("When I create a ClaimsMapper with an invalid interval", func() {
+
+			Convey("Then it should panic", func() {
+				So(func() { _, _ = NewClaimsMapper(path, 0) }, ShouldPanicWith, "interval must be greater than 0")
+			})
+		})
+
+		Convey("When I create a ClaimsMapper with a missing file", func() {
+
+			_, err := NewClaimsMapper(filepath.Join(dir, "nope.yaml"), time.Second)
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I create a ClaimsMapper and run it", func() {
+
+			m, err := NewClaimsMapper(path, 10*time.Millisecond)
+			So(err, ShouldBeNil)
+
+			core, logs := observer.New(zapcore.DebugLevel)
+			m.SetLogger(zaplogger.New(zap.New(core)))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go m.Run(ctx)
+
+			So(m.Map([]string{"@auth:memberof=admins"}), ShouldContain, "@auth:role=admin")
+
+			Convey("When I update the file", func() {
+
+				So(ioutil.WriteFile(path, []byte(`rules: [{match: "@auth:memberof=admins", add: ["@auth:role=root"]}]`), 0600), ShouldBeNil)
+
+				Convey("Then the mapping should be reloaded", func() {
+					So(func() bool {
+						for i := 0; i < 100; i++ {
+							for _, c := range m.Map([]string{"@auth:memberof=admins"}) {
+								if c == "@auth:role=root" {
+									return true
+								}
+							}
+							time.Sleep(10 * time.Millisecond)
+						}
+						return false
+					}(), ShouldBeTrue)
+				})
+			})
+
+			Convey("When I write an invalid file", func() {
+
+				So(ioutil.WriteFile(path, []byte("rules: nope"), 0600), ShouldBeNil)
+				time.Sleep(50 * time.Millisecond)
+
+				Convey("Then the previous mapping should be kept", func() {
+					So(m.Map([]string{"@auth:memberof=admins"}), ShouldContain, "@auth:role=admin")
+				})
+
+				Convey("Then the error should be logged with the configured logger", func() {
+					So(logs.FilterMessage("Unable to reload claims mapping").Len(), ShouldBeGreaterThan, 0)
+				})
+			})
+		})
+	})
+}
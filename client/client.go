@@ -12,37 +12,113 @@
 package midgardclient
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
 	"go.aporeto.io/elemental"
 	"go.aporeto.io/gaia"
+	"go.aporeto.io/gaia/types"
 	"go.aporeto.io/midgard-lib/ldaputils"
+	"go.aporeto.io/midgard-lib/logger"
 	"go.aporeto.io/midgard-lib/tokenmanager/providers"
+	"go.aporeto.io/midgard-lib/verify"
 	"go.aporeto.io/tg/tglib"
 )
 
+// ErrDiscoveryUnsupported is returned by AvailableRealms when the
+// midgard server does not expose realm discovery.
+var ErrDiscoveryUnsupported = errors.New("midgard does not support realm discovery")
+
+// RealmInfo describes an authentication realm enabled on a namespace.
+type RealmInfo struct {
+	Realm     string   `json:"realm"`
+	Providers []string `json:"providers,omitempty"`
+}
+
+// IssueRealmKubernetesServiceAccountToken is the realm used to issue
+// tokens from Kubernetes service account tokens. It is not yet part of
+// the realms defined by gaia.
+const IssueRealmKubernetesServiceAccountToken gaia.IssueRealmValue = "KubernetesServiceAccountToken"
+
+// IssueRealmSPIFFE is the realm used to issue tokens from SPIFFE
+// JWT-SVIDs. It is not yet part of the realms defined by gaia.
+const IssueRealmSPIFFE gaia.IssueRealmValue = "SPIFFE"
+
+// IssueRealmGithubActionsOIDC is the realm used to issue tokens from
+// GitHub Actions OIDC job tokens. It is not yet part of the realms
+// defined by gaia.
+const IssueRealmGithubActionsOIDC gaia.IssueRealmValue = "GithubActionsOIDC"
+
+// IssueRealmAPIKey is the realm used to issue tokens from long-lived
+// API keys. It is not yet part of the realms defined by gaia.
+const IssueRealmAPIKey gaia.IssueRealmValue = "APIKey"
+
+// IssueRealmKerberos is the realm used to issue tokens from Kerberos
+// SPNEGO tokens. It is not yet part of the realms defined by gaia.
+const IssueRealmKerberos gaia.IssueRealmValue = "Kerberos"
+
+// DefaultAPIKeyMetadataKey is the metadata key used by IssueFromAPIKey
+// to send the API key, unless OptAPIKeyMetadataKey is given.
+const DefaultAPIKeyMetadataKey = "apiKey"
+
+const quotaRemainingHeader = "X-Quota-Remaining"
+
+const onBehalfOfMetadataKey = "onBehalfOf"
+
 // A Client allows to interract with a midgard server.
 type Client struct {
 	TrackingType string
 
-	url        string
-	tlsConfig  *tls.Config
-	httpClient *http.Client
+	url            string
+	tlsConfig      *tls.Config
+	httpClient     *http.Client
+	config         clientOpts
+	validityLimits *validityLimits
+	inflight       chan struct{}
+	authentifies   *authentifyGroup
+	authCache      *authCache
+	endpoints      *endpoints
+	defaultOptions []Option
+
+	serverNameClients serverNameClients
+	tlsLock           sync.RWMutex
+
+	msgpackUnsupported      int32
+	gzipRequestsUnsupported int32
+	clockSkew               int64
+}
+
+// New returns a new Client configured with the given options. It returns
+// an error if the given url is not a valid http or https url, if one of the
+// options has been given an invalid value, or if the system certificate
+// pool cannot be loaded while no TLS configuration is given with
+// OptionTLSConfig.
+func New(rawurl string, options ...ClientOption) (*Client, error) {
+
+	if err := validateURL(rawurl); err != nil {
+		return nil, err
+	}
+
+	return newClientWithOptions(rawurl, options...)
 }
 
 // NewClient returns a new Client.
+//
+// Deprecated: NewClient panics on error and is deprecated in favor of New.
 func NewClient(url string) *Client {
 
 	CAPool, err := tglib.SystemCertPool()
@@ -59,77 +135,280 @@ func NewClient(url string) *Client {
 }
 
 // NewClientWithTLS returns a new Client configured with the given x509.CAPool.
+//
+// Deprecated: NewClientWithTLS panics on error and is deprecated in favor of
+// New with OptionTLSConfig.
 func NewClientWithTLS(url string, tlsConfig *tls.Config) *Client {
 
+	return newClient(url, tlsConfig, clientOpts{})
+}
+
+// NewClientWithOptions returns a new Client configured with the given options.
+//
+// Deprecated: NewClientWithOptions panics on error and is deprecated in favor of New.
+func NewClientWithOptions(url string, options ...ClientOption) *Client {
+
+	c, err := newClientWithOptions(url, options...)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return c
+}
+
+func newClientWithOptions(url string, options ...ClientOption) (*Client, error) {
+
+	cfg := clientOpts{}
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+
+	if cfg.tlsConfig != nil {
+		return newClient(url, cfg.tlsConfig, cfg), nil
+	}
+
+	CAPool, err := tglib.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load system cert pool: %s", err)
+	}
+
+	return newClient(url, &tls.Config{RootCAs: CAPool}, cfg), nil
+}
+
+// validateURL returns an error if the given
+// url is not a valid http or https url.
+func validateURL(rawurl string) error {
+
+	if rawurl == "" {
+		return fmt.Errorf("missing midgard url")
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid midgard url '%s': %s", rawurl, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid midgard url '%s': scheme must be http or https", rawurl)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("invalid midgard url '%s': missing host", rawurl)
+	}
+
+	return nil
+}
+
+func newClient(url string, tlsConfig *tls.Config, cfg clientOpts) *Client {
+
 	if url == "" {
 		panic("Missing Midgard URL.")
 	}
 
-	return &Client{
-		url:       url,
-		tlsConfig: tlsConfig,
-		httpClient: &http.Client{
+	var cache *authCache
+	if cfg.authCacheTTL > 0 {
+		cache = newAuthCache(cfg.authCacheTTL, cfg.authCacheMaxStale, cfg.authCacheSize)
+	}
+
+	var inflight chan struct{}
+	if cfg.maxInflight > 0 {
+		inflight = make(chan struct{}, cfg.maxInflight)
+	}
+
+	httpClient := cfg.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{
 			Timeout: 30 * time.Second,
 			Transport: &http.Transport{
 				ForceAttemptHTTP2: true,
-				Proxy:             http.ProxyFromEnvironment,
+				Proxy:             cfg.proxyFunc(),
 				TLSClientConfig:   tlsConfig,
+				DialContext:       cfg.dialContext(),
+
+				ResponseHeaderTimeout: cfg.responseHeaderTimeout,
+				ExpectContinueTimeout: cfg.expectContinueTimeout,
+				TLSHandshakeTimeout:   cfg.tlsHandshakeTimeout,
+
+				MaxIdleConnsPerHost: cfg.maxIdleConnsPerHost,
+				IdleConnTimeout:     cfg.idleConnTimeout,
 			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		},
+			CheckRedirect: cfg.redirectPolicy.checkRedirect,
+		}
+	}
+
+	if cfg.timeout > 0 || (cfg.httpClient != nil && cfg.redirectPolicySet) {
+		c := *httpClient
+		if cfg.timeout > 0 {
+			c.Timeout = cfg.timeout
+		}
+		if cfg.redirectPolicySet {
+			c.CheckRedirect = cfg.redirectPolicy.checkRedirect
+		}
+		httpClient = &c
+	}
+
+	return &Client{
+		url:            url,
+		tlsConfig:      tlsConfig,
+		config:         cfg,
+		validityLimits: newValidityLimits(),
+		inflight:       inflight,
+		authentifies:   newAuthentifyGroup(),
+		authCache:      cache,
+		endpoints:      newEndpoints(append([]string{url}, cfg.failoverURLs...)...),
+		httpClient:     httpClient,
 	}
 }
 
 // Authentify authentifies the information included in the given token and
-// returns a list of tag string containing the claims.
+// returns a list of tag string containing the claims. Concurrent calls
+// made with the same token are coalesced into a single request to midgard.
+// If the client has been created with OptionAuthentifyCache, the claims
+// are served from the cache when possible.
 func (a *Client) Authentify(ctx context.Context, token string) ([]string, error) {
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.authentify")
+	key := tokenFingerprint(token)
+
+	var epoch uint64
+	if a.authCache != nil {
+		epoch = a.authCache.currentEpoch()
+		if claims, revalidate, ok := a.authCache.get(key); ok {
+			if revalidate {
+				go a.revalidate(key, token)
+			}
+			return claims, nil
+		}
+	}
+
+	claims, err := a.authentifies.do(ctx, key, func() ([]string, error) {
+		return a.authentify(ctx, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if a.authCache != nil {
+		a.authCache.set(key, copyClaims(claims), tokenExpiration(token), epoch)
+	}
+
+	return claims, nil
+}
+
+func (a *Client) authentify(ctx context.Context, token string) ([]string, error) {
+
+	claims, err := a.authn(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return NormalizeAuth(claims), nil
+}
+
+// authn sends the given token to midgard and returns the claims
+// it contains once validated.
+func (a *Client) authn(ctx context.Context, token string) (*types.MidgardClaims, error) {
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.authentify")
 	defer span.Finish()
 
-	builder := func() (*http.Request, error) {
+	encoding := a.requestEncoding()
+
+	builder := func(baseURL string) (*http.Request, error) {
 		authn := gaia.NewAuthn()
 		authn.Token = token
-		data, err := json.Marshal(authn)
+		data, err := elemental.Encode(encoding, authn)
 		if err != nil {
 			return nil, err
 		}
-		return http.NewRequest(http.MethodPost, a.url+"/authn", bytes.NewBuffer(data))
+		return newEncodedRequest(http.MethodPost, baseURL+"/authn", encoding, data)
 	}
 
-	resp, err := a.sendRetry(subctx, builder, token)
+	realm := realmFromToken(token)
+	metrics := a.config.clientMetrics()
+	start := time.Now()
+
+	resp, err := a.sendRetry(subctx, a.currentHTTPClient(), builder, []string{token}, realm)
 	if err != nil {
+		metrics.ObserveAuthentify(realm, 0, time.Since(start))
 		return nil, err
 	}
 
+	metrics.ObserveAuthentify(realm, resp.StatusCode, time.Since(start))
+
+	if a.fallbackToJSON(resp, encoding) {
+		return a.authn(ctx, token)
+	}
+
+	defer resp.Body.Close() // nolint: errcheck
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, elemental.NewError("Unauthorized", fmt.Sprintf("Authentication rejected with error: %s", resp.Status), "midgard-lib", http.StatusUnauthorized)
+
+		err := elemental.NewError("Unauthorized", fmt.Sprintf("Authentication rejected with error: %s", resp.Status), "midgard-lib", http.StatusUnauthorized)
+
+		return nil, classifyStatusError(resp.StatusCode, err)
 	}
 
 	auth := gaia.NewAuthn()
 
-	defer resp.Body.Close() // nolint: errcheck
+	if err := decodeResponse(resp, auth); err != nil {
+		return nil, ErrBadResponse{Err: err}
+	}
+
+	if auth.Claims == nil {
+		return nil, ErrUnauthorized{Err: elemental.NewError("Unauthorized", "No claims returned. Token may be invalid", "midgard-lib", http.StatusUnauthorized)}
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(auth); err != nil {
+	if err := verify.CheckRealm(auth.Claims, a.config.allowedRealms...); err != nil {
 		return nil, err
 	}
 
-	if auth.Claims == nil {
-		return nil, elemental.NewError("Unauthorized", "No claims returned. Token may be invalid", "midgard-lib", http.StatusUnauthorized)
+	return auth.Claims, nil
+}
+
+// AvailableRealms returns the authentication realms and their providers
+// that are enabled for the given namespace. This can be used by login
+// interfaces to only present the valid options. If the midgard server
+// does not expose realm discovery, ErrDiscoveryUnsupported is returned.
+func (a *Client) AvailableRealms(ctx context.Context, namespace string) ([]RealmInfo, error) {
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.realms")
+	defer span.Finish()
+
+	builder := func(baseURL string) (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, baseURL+"/realms?namespace="+url.QueryEscape(namespace), nil)
+	}
+
+	resp, err := a.sendRetry(subctx, a.currentHTTPClient(), builder, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() // nolint: errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, ErrDiscoveryUnsupported
+	default:
+		return nil, fmt.Errorf("unable to retrieve available realms: %s", resp.Status)
+	}
+
+	realms := []RealmInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(&realms); err != nil {
+		return nil, fmt.Errorf("unable to decode available realms: %s", err)
 	}
 
-	return NormalizeAuth(auth.Claims), nil
+	return realms, nil
 }
 
 // IssueFromGoogle issues a Midgard jwt from a Google JWT for the given validity duration.
 func (a *Client) IssueFromGoogle(ctx context.Context, googleJWT string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
 	issueRequest.Realm = gaia.IssueRealmGoogle
@@ -138,19 +417,16 @@ func (a *Client) IssueFromGoogle(ctx context.Context, googleJWT string, validity
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.google")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.google")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromCertificate issues a Midgard jwt from a certificate for the given validity duration.
 func (a *Client) IssueFromCertificate(ctx context.Context, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
 	issueRequest.Realm = gaia.IssueRealmCertificate
@@ -158,43 +434,36 @@ func (a *Client) IssueFromCertificate(ctx context.Context, validity time.Duratio
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.certificate")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.certificate")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromLDAP issues a Midgard JWT from an LDAP config for the given validity duration.
 func (a *Client) IssueFromLDAP(ctx context.Context, info *ldaputils.LDAPInfo, namespace string, provider string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = info.ToMap()
+	issueRequest.Metadata["namespace"] = namespace
+	issueRequest.Metadata["provider"] = provider
 	issueRequest.Realm = gaia.IssueRealmLDAP
 	issueRequest.Validity = validity.String()
 
 	applyOptions(issueRequest, opts)
 
-	issueRequest.Metadata = info.ToMap()
-	issueRequest.Metadata["namespace"] = namespace
-	issueRequest.Metadata["provider"] = provider
-
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.ldap")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.ldap")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromVince issues a Midgard jwt from a Vince for the given one time password and validity duration.
 func (a *Client) IssueFromVince(ctx context.Context, account string, password string, otp string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
 	issueRequest.Metadata = map[string]interface{}{"vinceAccount": account, "vincePassword": password, "vinceOTP": otp}
@@ -203,10 +472,10 @@ func (a *Client) IssueFromVince(ctx context.Context, account string, password st
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.vince")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.vince")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromAporetoIdentityToken issues a Midgard jwt from an existing one.
@@ -215,10 +484,7 @@ func (a *Client) IssueFromVince(ctx context.Context, account string, password st
 // without needing the original source of authentication.
 func (a *Client) IssueFromAporetoIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
 	issueRequest.Metadata = map[string]interface{}{"token": token}
@@ -227,39 +493,29 @@ func (a *Client) IssueFromAporetoIdentityToken(ctx context.Context, token string
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.aporetoidentitytoken")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.aporetoidentitytoken")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromAWSSecurityToken issues a Midgard jwt from a security token from amazon.
 // If you don't pass anything, this function will try to retrieve the token using aws magic ip.
 func (a *Client) IssueFromAWSSecurityToken(ctx context.Context, accessKeyID, secretAccessKey, token string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
-	s := &struct {
-		AccessKeyID     string `json:"AccessKeyId"`
-		SecretAccessKey string
-		Token           string
-	}{}
+	s := awsCredentials{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Token:           token,
+	}
 
 	if accessKeyID == "" && secretAccessKey == "" && token == "" {
-		awsToken, err := providers.AWSServiceRoleToken()
-		if err != nil {
-			return "", err
-		}
-		if err := json.Unmarshal([]byte(awsToken), &s); err != nil {
+		var err error
+		if s, err = awsRoleCredentials(); err != nil {
 			return "", err
 		}
-	} else {
-		s.AccessKeyID = accessKeyID
-		s.SecretAccessKey = secretAccessKey
-		s.Token = token
 	}
 
 	issueRequest := gaia.NewIssue()
@@ -274,10 +530,121 @@ func (a *Client) IssueFromAWSSecurityToken(ctx context.Context, accessKeyID, sec
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.aws")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.aws")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// IssueFromKubernetesServiceAccountToken issues a Midgard jwt from a Kubernetes service account
+// token for the given validity duration. If you don't pass a token, the token of the pod is read
+// from the default service account mount path.
+func (a *Client) IssueFromKubernetesServiceAccountToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error) {
+
+	var err error
+
+	if token == "" {
+		token, err = providers.KubernetesServiceAccountToken()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	opts := a.issueOptions(options)
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{"token": token}
+	issueRequest.Realm = IssueRealmKubernetesServiceAccountToken
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.kubernetes")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// IssueFromGithubActionsOIDC issues a Midgard jwt from a GitHub Actions OIDC job token
+// for the given validity duration. If you don't pass a token, the token of the current
+// job is retrieved for the default audience. Use providers.GithubActionsOIDCToken to
+// retrieve it for another audience.
+func (a *Client) IssueFromGithubActionsOIDC(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error) {
+
+	var err error
+
+	if token == "" {
+		token, err = providers.GithubActionsOIDCToken(ctx, "")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	opts := a.issueOptions(options)
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{"token": token}
+	issueRequest.Realm = IssueRealmGithubActionsOIDC
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.githubactions")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// IssueFromAPIKey issues a Midgard jwt from the given API key for the given validity duration.
+// The key is sent in the metadata key DefaultAPIKeyMetadataKey, or the one given with
+// OptAPIKeyMetadataKey.
+func (a *Client) IssueFromAPIKey(ctx context.Context, key string, validity time.Duration, options ...Option) (string, error) {
+
+	if key == "" {
+		return "", fmt.Errorf("missing api key")
+	}
+
+	opts := a.issueOptions(options)
+	if opts.apiKeyMetadataKey == "" {
+		opts.apiKeyMetadataKey = DefaultAPIKeyMetadataKey
+	}
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{opts.apiKeyMetadataKey: key}
+	issueRequest.Realm = IssueRealmAPIKey
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.apikey")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// IssueFromKerberos issues a Midgard jwt from the given SPNEGO token for the given
+// validity duration. The token is sent base64 encoded, as in the Negotiate
+// authorization scheme, and must have been obtained for the service principal
+// of midgard.
+func (a *Client) IssueFromKerberos(ctx context.Context, spnegoToken []byte, validity time.Duration, options ...Option) (string, error) {
+
+	if len(spnegoToken) == 0 {
+		return "", fmt.Errorf("missing spnego token")
+	}
+
+	opts := a.issueOptions(options)
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{"token": base64.StdEncoding.EncodeToString(spnegoToken)}
+	issueRequest.Realm = IssueRealmKerberos
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.kerberos")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromGCPIdentityToken issues a Midgard jwt from a signed GCP identity document for the given validity duration.
@@ -292,10 +659,7 @@ func (a *Client) IssueFromGCPIdentityToken(ctx context.Context, token string, va
 		}
 	}
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
 	issueRequest.Metadata = map[string]interface{}{"token": token}
@@ -304,16 +668,21 @@ func (a *Client) IssueFromGCPIdentityToken(ctx context.Context, token string, va
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.gcp")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.gcp")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromOIDCStep1 issues a Midgard jwt from a OICD provider. This is performing the first step to
 // validate the issue requests and OIDC provider. It will return the OIDC auth endpoint
 func (a *Client) IssueFromOIDCStep1(ctx context.Context, namespace string, provider string, redirectURL string) (string, error) {
 
+	return a.issueFromOIDCStep1(ctx, namespace, provider, redirectURL, "")
+}
+
+func (a *Client) issueFromOIDCStep1(ctx context.Context, namespace string, provider string, redirectURL string, codeChallenge string) (string, error) {
+
 	issueRequest := gaia.NewIssue()
 	issueRequest.Metadata = map[string]interface{}{
 		"namespace":        namespace,
@@ -322,19 +691,31 @@ func (a *Client) IssueFromOIDCStep1(ctx context.Context, namespace string, provi
 	}
 	issueRequest.Realm = gaia.IssueRealmOIDC
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.oidc.step1")
+	if codeChallenge != "" {
+		issueRequest.Metadata["codeChallenge"] = codeChallenge
+		issueRequest.Metadata["codeChallengeMethod"] = pkceMethodS256
+	}
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.oidc.step1")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, a.issueOptions(nil))
 }
 
 // IssueFromOIDCStep2 issues a Midgard jwt from a OICD provider. This is performing the second step to
 // to exchange the code for a Midgard HWT.
 func (a *Client) IssueFromOIDCStep2(ctx context.Context, code string, state string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
+	opts := a.issueOptions(options)
+
+	if err := checkOIDCStep2(code, state, opts); err != nil {
+		return "", err
+	}
+
+	if opts.oidcCodeVerifier != "" {
+		if err := validatePKCEVerifier(opts.oidcCodeVerifier); err != nil {
+			return "", err
+		}
 	}
 
 	issueRequest := gaia.NewIssue()
@@ -345,12 +726,16 @@ func (a *Client) IssueFromOIDCStep2(ctx context.Context, code string, state stri
 	issueRequest.Realm = gaia.IssueRealmOIDC
 	issueRequest.Validity = validity.String()
 
+	if opts.oidcCodeVerifier != "" {
+		issueRequest.Metadata["codeVerifier"] = opts.oidcCodeVerifier
+	}
+
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.oidc.step2")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.oidc.step2")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromSAMLStep1 issues a Midgard jwt from a SAML provider. This is performing the first step to
@@ -365,19 +750,22 @@ func (a *Client) IssueFromSAMLStep1(ctx context.Context, namespace string, provi
 	}
 	issueRequest.Realm = gaia.IssueRealmSAML
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.saml.step1")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.saml.step1")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, a.issueOptions(nil))
 }
 
 // IssueFromSAMLStep2 issues a Midgard jwt from a SAML provider. This is performing the second step to
 // to exchange the code for a Midgard HWT.
 func (a *Client) IssueFromSAMLStep2(ctx context.Context, response string, state string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
+	opts := a.issueOptions(options)
+
+	if len(opts.samlIdPCertificates) > 0 {
+		if err := checkSAMLResponse(response, opts.samlIdPCertificates); err != nil {
+			return "", err
+		}
 	}
 
 	issueRequest := gaia.NewIssue()
@@ -390,29 +778,32 @@ func (a *Client) IssueFromSAMLStep2(ctx context.Context, response string, state
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.saml.step2")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.saml.step2")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
 // IssueFromAzureIdentityToken issues a Midgard jwt from a signed Azure identity document for the given validity duration.
+// If you don't pass a token, it is retrieved from the Metadata Identity Service of the VM, for the identity set with
+// OptAzureIdentity or the system-assigned one.
 func (a *Client) IssueFromAzureIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error) {
 
 	var err error
 
+	opts := a.issueOptions(options)
+
 	if token == "" {
-		token, err = providers.AzureServiceIdentityToken()
+		request := providers.AzureIdentityRequest{}
+		if opts.azureIdentity != nil {
+			request = *opts.azureIdentity
+		}
+		token, err = providers.AzureServiceIdentityTokenFor(request)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
-
 	issueRequest := gaia.NewIssue()
 	issueRequest.Metadata = map[string]interface{}{"token": token}
 	issueRequest.Realm = gaia.IssueRealmAzureIdentityToken
@@ -420,55 +811,204 @@ func (a *Client) IssueFromAzureIdentityToken(ctx context.Context, token string,
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.azure")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.azure")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// Issue sends the given issue request to midgard and returns the issued
+// token. It can be used for realms that do not have a dedicated IssueFromX
+// method yet. The given options override the corresponding fields of the
+// issue request, which is not modified.
+func (a *Client) Issue(ctx context.Context, issue *gaia.Issue, options ...Option) (string, error) {
+
+	if issue == nil {
+		return "", fmt.Errorf("missing issue request")
+	}
+
+	if issue.Realm == "" {
+		return "", fmt.Errorf("missing issue realm")
+	}
+
+	opts := a.issueOptions(options)
+
+	issueRequest := gaia.NewIssue()
+	*issueRequest = *issue
+
+	issueRequest.Metadata = make(map[string]interface{}, len(issue.Metadata))
+	for k, v := range issue.Metadata {
+		issueRequest.Metadata[k] = v
+	}
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue."+strings.ToLower(string(issueRequest.Realm)))
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+func (a *Client) sendRequest(ctx context.Context, issueRequest *gaia.Issue, opts issueOpts) (string, error) {
+
+	if opts.err != nil {
+		return "", opts.err
+	}
+
+	if opts.restrictToCaller {
+
+		networks, err := a.callerNetworks(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		issueRequest.RestrictedNetworks = append(issueRequest.RestrictedNetworks, networks...)
+	}
+
+	jitterValidity(issueRequest, opts.validityJitter)
+	a.validityLimits.clamp(issueRequest)
+
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	token, err := a.postIssue(ctx, issueRequest, opts)
+	if err != nil && a.validityLimits.learn(issueRequest, err) {
+		token, err = a.postIssue(ctx, issueRequest, opts)
+	}
+
+	if err != nil && a.retryTLSHandshake(ctx, issueRequest, err) {
+		token, err = a.postIssue(ctx, issueRequest, opts)
+	}
+
+	if err != nil {
+		return "", redactSecrets(err, issueSecrets(issueRequest, opts)...)
+	}
+
+	if err := a.checkMinValidity(issueRequest, token); err != nil {
+		return "", err
+	}
+
+	return token, nil
 }
 
-func (a *Client) sendRequest(ctx context.Context, issueRequest *gaia.Issue) (string, error) {
+func (a *Client) postIssue(ctx context.Context, issueRequest *gaia.Issue, opts issueOpts) (string, error) {
 
-	buffer := &bytes.Buffer{}
-	if err := json.NewEncoder(buffer).Encode(issueRequest); err != nil {
+	encoding := a.requestEncoding()
+
+	body, err := elemental.Encode(encoding, issueRequest)
+	if err != nil {
 		return "", err
 	}
-	body := buffer.Bytes()
 
-	builder := func() (*http.Request, error) {
+	var signature string
+	if opts.signRequest {
 
-		return http.NewRequest(http.MethodPost, a.url+"/issue", bytes.NewBuffer(body))
+		cert, err := a.signingCertificate(opts)
+		if err != nil {
+			return "", err
+		}
+
+		if signature, err = signBody(body, *cert); err != nil {
+			return "", err
+		}
 	}
 
-	resp, err := a.sendRetry(ctx, builder, "")
+	payload, compressed, err := a.compressRequestBody(body)
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode == http.StatusFound {
-		return resp.Header.Get("Location"), nil
+	builder := func(baseURL string) (*http.Request, error) {
+
+		req, err := newEncodedRequest(http.MethodPost, baseURL+"/issue", encoding, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if compressed {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		for k, v := range opts.headers {
+			req.Header[k] = append([]string{}, v...)
+		}
+
+		if opts.userAgent != "" {
+			req.Header.Set("User-Agent", libraryUserAgent+" "+opts.userAgent)
+		}
+
+		if signature != "" {
+			req.Header.Set(SignatureHeader, signature)
+		}
+
+		return req, nil
+	}
+
+	realm := string(issueRequest.Realm)
+	metrics := a.config.clientMetrics()
+	start := time.Now()
+
+	httpClient, err := a.httpClientFor(opts.serverName)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.clientCertificate != nil {
+		if httpClient, err = httpClientWithCertificate(httpClient, *opts.clientCertificate); err != nil {
+			return "", err
+		}
+		defer httpClient.CloseIdleConnections()
+	}
+
+	resp, err := a.sendRetry(ctx, httpClient, builder, issueSecrets(issueRequest, opts), realm)
+	if err != nil {
+		metrics.ObserveIssue(realm, 0, time.Since(start))
+		return "", err
+	}
+
+	metrics.ObserveIssue(realm, resp.StatusCode, time.Since(start))
+
+	if a.fallbackToUncompressed(resp, compressed) || a.fallbackToJSON(resp, encoding) {
+		return a.postIssue(ctx, issueRequest, opts)
 	}
 
 	defer resp.Body.Close() // nolint: errcheck
 
+	if opts.rateLimitInfoFunc != nil {
+		opts.rateLimitInfoFunc(rateLimitInfoFromResponse(resp.Header, time.Now()))
+	}
+
+	if resp.StatusCode == http.StatusFound {
+		return resp.Header.Get("Location"), nil
+	}
+
 	if resp.StatusCode != 200 {
 
-		// Read the response body
-		data, err := ioutil.ReadAll(resp.Body)
+		// Read the response body, but not more than what
+		// can be captured in a ResponseError.
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(a.config.errorBodyLimit())+1))
 		if err != nil {
-			return "", fmt.Errorf("midgard did not issue a token and client could not read why: %s (statusCode: %d)", err, resp.StatusCode)
+			return "", classifyStatusError(resp.StatusCode, fmt.Errorf("midgard did not issue a token and client could not read why: %s (statusCode: %d)", err, resp.StatusCode))
 		}
 
 		// Try to decode the errors
-		errs, err := elemental.DecodeErrors(data)
+		errs, err := decodeResponseErrors(resp, data)
 		if err != nil {
-			return "", fmt.Errorf("midgard did not issue a token and client could not decode why: %s (statusCode: %d)", err, resp.StatusCode)
+			return "", classifyStatusError(resp.StatusCode, newResponseError(resp.StatusCode, data, a.config.errorBodyLimit(), err))
 		}
 
-		return "", errs
+		return "", classifyStatusError(resp.StatusCode, errs)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(issueRequest); err != nil {
-		return "", err
+	if err := decodeResponse(resp, issueRequest); err != nil {
+		return "", ErrBadResponse{Err: err}
+	}
+
+	if opts.quotaInfoFunc != nil {
+		opts.quotaInfoFunc(quotaInfoFromResponse(issueRequest, resp.Header))
 	}
 
 	return issueRequest.Token, nil
@@ -477,10 +1017,7 @@ func (a *Client) sendRequest(ctx context.Context, issueRequest *gaia.Issue) (str
 // IssueFromPCIdentityToken issues a Midgard jwt from a PCC token.
 func (a *Client) IssueFromPCIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error) {
 
-	opts := issueOpts{}
-	for _, opt := range options {
-		opt(&opts)
-	}
+	opts := a.issueOptions(options)
 
 	issueRequest := gaia.NewIssue()
 	issueRequest.Metadata = map[string]interface{}{"token": token}
@@ -489,86 +1026,233 @@ func (a *Client) IssueFromPCIdentityToken(ctx context.Context, token string, val
 
 	applyOptions(issueRequest, opts)
 
-	span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.issue.pcidentitytoken")
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.pcidentitytoken")
 	defer span.Finish()
 
-	return a.sendRequest(subctx, issueRequest)
+	return a.sendRequest(subctx, issueRequest, opts)
 }
 
-func (a *Client) sendRetry(ctx context.Context, requestBuilder func() (*http.Request, error), token string) (*http.Response, error) {
+func (a *Client) sendRetry(ctx context.Context, httpClient *http.Client, requestBuilder func(baseURL string) (*http.Request, error), secrets []string, realm string) (*http.Response, error) {
 
-	for {
+	a.config.retryBudget.recordRequest()
 
-		span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.client.send")
-		defer span.Finish()
+	for attempt := 1; ; attempt++ {
 
-		request, err := requestBuilder()
-		if err != nil {
-			return nil, err
+		resp, wait, retry, err := a.sendAttempt(ctx, httpClient, requestBuilder, secrets, realm, attempt)
+		if !retry {
+			return resp, err
 		}
 
-		request.Close = true
+		a.config.clientMetrics().ObserveRetry(realm)
+		a.config.log().Debug("Retrying midgard request", logger.F("attempt", attempt), logger.F("wait", wait), logger.Err(err))
 
-		if a.TrackingType != "" {
-			request.Header.Set("X-External-Tracking-Type", a.TrackingType)
+		select {
+		case <-time.After(wait):
+			continue
+		case <-ctx.Done():
+			return nil, ErrUnreachable{Err: err}
 		}
+	}
+}
 
-		if span != nil {
-			if t := span.Tracer(); t != nil {
-				if err = t.Inject(span.Context(), opentracing.TextMap, opentracing.HTTPHeadersCarrier(request.Header)); err != nil {
-					return nil, err
-				}
-			}
+// sendAttempt sends the given attempt of a request in its own span.
+// If the request must be retried, it returns true, the error of the
+// attempt and the delay to wait before the next one.
+func (a *Client) sendAttempt(ctx context.Context, httpClient *http.Client, requestBuilder func(baseURL string) (*http.Request, error), secrets []string, realm string, attempt int) (*http.Response, time.Duration, bool, error) {
+
+	policy := a.config.retryPolicy
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.send")
+	defer span.Finish()
+
+	endpoint := a.endpoints.pick()
+
+	request, err := requestBuilder(endpoint)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	request = request.WithContext(subctx)
+	request.Close = !a.config.keepAlive
+
+	// Headers set by the request builder from
+	// per call options take precedence.
+	for k, v := range a.config.headers {
+		if _, ok := request.Header[k]; !ok {
+			request.Header[k] = append([]string{}, v...)
 		}
+	}
+
+	if request.Header.Get("User-Agent") == "" {
+		request.Header.Set("User-Agent", a.config.userAgent())
+	}
+
+	if a.config.compression {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	if a.TrackingType != "" {
+		request.Header.Set("X-External-Tracking-Type", a.TrackingType)
+	}
 
-		resp, err := a.httpClient.Do(request)
-		if err == nil {
-			return resp, nil
+	if err = a.injectSpan(subctx, span, request.Header); err != nil {
+		return nil, 0, false, err
+	}
+
+	if err = a.acquireInflight(subctx); err != nil {
+		return nil, 0, false, err
+	}
+
+	sent := time.Now()
+	resp, err := httpClient.Do(request)
+
+	// The slot is held until the response body is closed.
+	if err != nil {
+		a.releaseInflight()
+	} else if a.inflight != nil {
+		resp.Body = &inflightBody{ReadCloser: resp.Body, release: a.releaseInflight}
+	}
+
+	if err == nil {
+		a.observeClockSkew(resp.Header, sent, time.Now())
+	}
+
+	if err == nil && a.config.compression {
+		if err := decompressResponse(resp); err != nil {
+			return nil, 0, false, err
 		}
+	}
+
+	if err == nil && resp.StatusCode < 500 {
+		a.endpoints.markUp(endpoint)
+	} else if err == nil {
+		a.endpoints.markDown(endpoint, fmt.Errorf("midgard responded with status code %d", resp.StatusCode))
+	} else {
+		a.endpoints.markDown(endpoint, redactSecrets(err, secrets...))
+	}
+
+	wait := policy.backoff(attempt)
+
+	// There is no need to wait before failing over.
+	failover := (err != nil || resp.StatusCode >= 500) && a.endpoints.hasHealthy(endpoint)
+	if failover {
+		wait = 0
+	}
+
+	if err == nil {
+
+		if !policy.retryableStatus(resp.StatusCode) || policy.exhausted(attempt) {
+			return resp, 0, false, nil
+		}
+
+		if d := retryAfter(resp.Header, time.Now()); d > wait && !failover {
+			wait = d
+		}
+
+		// There is no point waiting if the context
+		// will be done before we can retry.
+		if deadline, ok := subctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, 0, false, nil
+		}
+
+		if !a.config.retryBudget.allowRetry() {
+			return resp, 0, false, nil
+		}
+
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close() // nolint: errcheck
+
+		err = fmt.Errorf("midgard responded with status code %d", resp.StatusCode)
+		if span != nil {
+			span.SetTag("error", true)
+			span.LogFields(log.Error(err))
+		}
+
+	} else {
 
 		if uerr, ok := err.(*url.Error); ok {
 			switch uerr.Err.(type) {
 			case x509.UnknownAuthorityError, x509.CertificateInvalidError, x509.HostnameError:
-				return nil, err
+				return nil, 0, false, ErrUnreachable{Err: redactSecrets(err, secrets...)}
 			}
 		}
 
-		err = snipToken(err, token)
+		// Retrying would perform the same handshake, which would fail
+		// the same way. The caller retries with the latest certificate.
+		if !retryableTransportError(err, realm) {
+			return nil, 0, false, ErrUnreachable{Err: redactSecrets(err, secrets...)}
+		}
+
+		err = redactSecrets(err, secrets...)
 		if span != nil {
 			span.SetTag("error", true)
 			span.LogFields(log.Error(err))
 		}
 
-		select {
-		case <-time.After(3 * time.Second):
-			continue
-		case <-subctx.Done():
-			return nil, err
+		if policy.exhausted(attempt) || !a.config.retryBudget.allowRetry() {
+			return nil, 0, false, ErrUnreachable{Err: err}
 		}
 	}
+
+	return nil, wait, true, err
 }
 
-func applyOptions(issueRequest *gaia.Issue, opts issueOpts) {
+func quotaInfoFromResponse(issue *gaia.Issue, header http.Header) QuotaInfo {
+
+	info := QuotaInfo{
+		Quota:     issue.Quota,
+		Remaining: -1,
+	}
+
+	if v := header.Get(quotaRemainingHeader); v != "" {
+		if remaining, err := strconv.Atoi(v); err == nil {
+			info.Remaining = remaining
+		}
+	}
 
-	issueRequest.Quota = opts.quota
-	issueRequest.Opaque = opts.opaque
-	issueRequest.Audience = opts.audience
-	issueRequest.RestrictedPermissions = opts.restrictedPermissions
-	issueRequest.RestrictedNamespace = opts.restrictedNamespace
-	issueRequest.RestrictedNetworks = opts.restrictedNetworks
+	return info
 }
 
-func snipToken(err error, token string) error {
+// applyOptions sets the fields of the given issue request
+// from the given options. Fields that are not set by the
+// options are left untouched.
+func applyOptions(issueRequest *gaia.Issue, opts issueOpts) {
 
-	if len(token) == 0 || err == nil {
-		return err
+	if opts.quota != 0 {
+		issueRequest.Quota = opts.quota
 	}
 
-	return fmt.Errorf("%s",
-		strings.Replace(
-			err.Error(),
-			token,
-			"[snip]",
-			-1),
-	)
+	if opts.opaque != nil {
+		issueRequest.Opaque = opts.opaque
+	}
+
+	if opts.audience != "" {
+		issueRequest.Audience = opts.audience
+	}
+
+	if opts.restrictedPermissions != nil {
+		issueRequest.RestrictedPermissions = opts.restrictedPermissions
+	}
+
+	if opts.restrictedNamespace != "" {
+		issueRequest.RestrictedNamespace = opts.restrictedNamespace
+	}
+
+	if opts.restrictedNetworks != nil {
+		issueRequest.RestrictedNetworks = opts.restrictedNetworks
+	}
+
+	if (len(opts.metadata) > 0 || opts.onBehalfOf != "") && issueRequest.Metadata == nil {
+		issueRequest.Metadata = make(map[string]interface{}, len(opts.metadata)+1)
+	}
+
+	if opts.onBehalfOf != "" {
+		issueRequest.Metadata[onBehalfOfMetadataKey] = opts.onBehalfOf
+	}
+
+	for k, v := range opts.metadata {
+		if _, ok := issueRequest.Metadata[k]; !ok {
+			issueRequest.Metadata[k] = v
+		}
+	}
 }
@@ -0,0 +1,653 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/midgard-lib/logger"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+)
+
+type clientOpts struct {
+	localAddr            *net.TCPAddr
+	network              string
+	dial                 func(context.Context, string, string) (net.Conn, error)
+	resolver             *net.Resolver
+	maxInflight          int
+	inflightQueueTimeout time.Duration
+	retryBudget          *RetryBudget
+	retryPolicy          *RetryPolicy
+	authCacheTTL         time.Duration
+	authCacheMaxStale    time.Duration
+	authCacheSize        int
+	maxErrorBody         int
+	publicIPLookupURL    string
+	appUserAgent         string
+	allowedRealms        []string
+	httpClient           *http.Client
+	timeout              time.Duration
+	tlsConfig            *tls.Config
+	headers              http.Header
+	metrics              ClientMetrics
+	tracer               opentracing.Tracer
+	spanTracer           SpanTracer
+	logger               logger.Logger
+	encoding             elemental.EncodingType
+	compression          bool
+
+	requestCompression        bool
+	requestCompressionMinSize int
+
+	responseHeaderTimeout time.Duration
+	expectContinueTimeout time.Duration
+	tlsHandshakeTimeout   time.Duration
+
+	proxy func(*http.Request) (*url.URL, error)
+
+	failoverURLs      []string
+	redirectPolicy    RedirectPolicy
+	redirectPolicySet bool
+
+	keepAlive           bool
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+
+	minValidity       float64
+	shortValidityFunc func(*ShortValidityError)
+
+	err error
+}
+
+// A ClientOption is the type of various options
+// you can pass to NewClientWithOptions.
+type ClientOption func(*clientOpts)
+
+// errorOption returns a ClientOption recording the given
+// error, which is then returned by New. It is used by the
+// options given an invalid value, so a bad configuration
+// does not crash the program embedding the client.
+func errorOption(err error) ClientOption {
+
+	return func(opts *clientOpts) {
+		if opts.err == nil {
+			opts.err = err
+		}
+	}
+}
+
+// OptionLocalAddr sets the local IP address the client
+// will use to connect to midgard. This is useful when midgard
+// ACLs are keyed to a specific egress interface. New returns an
+// error if the given address is not a valid IP address.
+func OptionLocalAddr(addr string) ClientOption {
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return errorOption(fmt.Errorf("invalid local address '%s'", addr))
+	}
+
+	return func(opts *clientOpts) {
+		opts.localAddr = &net.TCPAddr{IP: ip}
+	}
+}
+
+// OptionForceIPv4 forces the client to connect
+// to midgard using IPv4 only.
+func OptionForceIPv4() ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.network = "tcp4"
+	}
+}
+
+// OptionForceIPv6 forces the client to connect
+// to midgard using IPv6 only.
+func OptionForceIPv6() ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.network = "tcp6"
+	}
+}
+
+// OptionDialContext sets the function used to open the connections
+// to midgard, for instance to discover its address using SRV records
+// or to dial through a SOCKS tunnel. The network forced by OptionForceIPv4
+// or OptionForceIPv6 is given to the function, but OptionLocalAddr and
+// OptionResolver have no effect.
+func OptionDialContext(dial func(ctx context.Context, network string, addr string) (net.Conn, error)) ClientOption {
+
+	if dial == nil {
+		return errorOption(errors.New("dial cannot be nil"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.dial = dial
+	}
+}
+
+// OptionResolver sets the DNS resolver used to resolve
+// the address of midgard. The default uses the system one.
+func OptionResolver(resolver *net.Resolver) ClientOption {
+
+	if resolver == nil {
+		return errorOption(errors.New("resolver cannot be nil"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.resolver = resolver
+	}
+}
+
+// OptionMaxInflight limits the number of concurrent requests the
+// client sends to midgard. Additional requests wait for a slot for
+// at most the given queue timeout before failing with
+// ErrMaxInflightReached. A queue timeout of 0 makes them wait until
+// their context is done.
+func OptionMaxInflight(n int, queueTimeout time.Duration) ClientOption {
+
+	if n <= 0 {
+		return errorOption(errors.New("max inflight must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.maxInflight = n
+		opts.inflightQueueTimeout = queueTimeout
+	}
+}
+
+// OptionRetryBudget makes the client consult the given RetryBudget
+// before retrying a failed request. Pass the same RetryBudget to all
+// the clients that should share it.
+func OptionRetryBudget(budget *RetryBudget) ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.retryBudget = budget
+	}
+}
+
+// OptionRetryPolicy makes the client retry the requests that failed
+// with a network error, a 5xx or a 429 response according to the given
+// RetryPolicy. Without it, only network errors are retried, every 3
+// seconds, until the context is done.
+func OptionRetryPolicy(policy RetryPolicy) ClientOption {
+
+	if err := policy.validate(); err != nil {
+		return errorOption(err)
+	}
+
+	return func(opts *clientOpts) {
+		opts.retryPolicy = &policy
+	}
+}
+
+// OptionMinValidity makes the client reject the tokens whose validity is
+// shorter than the given fraction of the requested one, returning a
+// *ShortValidityError. The validity compared is the one sent to midgard,
+// after jitter and clamping to the known maximal validity. If f is not nil,
+// it is called with the error, so the downgrades can be reported.
+func OptionMinValidity(fraction float64, f func(*ShortValidityError)) ClientOption {
+
+	if fraction <= 0 || fraction > 1 {
+		return errorOption(errors.New("min validity fraction must be greater than 0 and at most 1"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.minValidity = fraction
+		opts.shortValidityFunc = f
+	}
+}
+
+// OptionMetrics makes the client report the latency, the status code
+// and the retries of its requests to midgard to the given ClientMetrics.
+func OptionMetrics(metrics ClientMetrics) ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.metrics = metrics
+	}
+}
+
+// OptionTracer sets the tracer used to create the spans of the client,
+// instead of the global opentracing tracer. The trace context is
+// propagated to midgard in the headers of every request. To use
+// OpenTelemetry, see OptionSpanTracer.
+func OptionTracer(tracer opentracing.Tracer) ClientOption {
+
+	if tracer == nil {
+		return errorOption(errors.New("tracer cannot be nil"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.tracer = tracer
+	}
+}
+
+// OptionSpanTracer sets the SpanTracer used to create the spans of the
+// client and to propagate the trace context to midgard, like an adapter
+// of an OpenTelemetry tracer provider and propagator. It takes
+// precedence over OptionTracer.
+func OptionSpanTracer(tracer SpanTracer) ClientOption {
+
+	if tracer == nil {
+		return errorOption(errors.New("span tracer cannot be nil"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.spanTracer = tracer
+	}
+}
+
+// OptionLogger sets the Logger used to report the errors happening
+// in the background, like retries and token renewals. The default
+// writes to the global zap logger. The messages are redacted with
+// the DefaultRedactor.
+func OptionLogger(l logger.Logger) ClientOption {
+
+	if l == nil {
+		return errorOption(errors.New("logger cannot be nil"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.logger = l
+	}
+}
+
+// log returns the Logger to use.
+func (o clientOpts) log() logger.Logger {
+
+	if o.logger == nil {
+		return DefaultRedactor.Logger(zaplogger.New(nil))
+	}
+
+	return DefaultRedactor.Logger(o.logger)
+}
+
+// OptionEncoding sets the encoding of the Authentify and issue requests
+// sent to midgard, which can be elemental.EncodingTypeJSON, the default,
+// or elemental.EncodingTypeMSGPACK. msgpack is cheaper to encode and
+// decode. If midgard does not support it, the client falls back to json.
+// New returns an error for any other encoding.
+func OptionEncoding(encoding elemental.EncodingType) ClientOption {
+
+	if encoding != elemental.EncodingTypeJSON && encoding != elemental.EncodingTypeMSGPACK {
+		return errorOption(fmt.Errorf("unsupported encoding '%s'", encoding))
+	}
+
+	return func(opts *clientOpts) {
+		opts.encoding = encoding
+	}
+}
+
+// OptionCompression makes the client ask midgard for gzip or deflate
+// compressed responses and transparently decompress them. This reduces
+// the bandwidth used to fetch large claim sets over WAN links, whatever
+// the http.Client set by OptionHTTPClient.
+func OptionCompression() ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.compression = true
+	}
+}
+
+// OptionRequestCompression makes the client compress with gzip the
+// bodies of the issue requests of at least minSize bytes, like the ones
+// carrying LDAP metadata or SAML responses. If midgard rejects them with
+// a 415, the request is sent again uncompressed, as are the next ones.
+func OptionRequestCompression(minSize int) ClientOption {
+
+	if minSize < 0 {
+		return errorOption(errors.New("min size must be positive"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.requestCompression = true
+		opts.requestCompressionMinSize = minSize
+	}
+}
+
+// OptionAuthentifyCache caches the claims returned by Authentify for the
+// given ttl. Once the ttl is over, cached claims are still returned for at
+// most maxStale while they are revalidated in the background, so a slow
+// midgard does not impact the callers. Claims are never served after the
+// expiration of their token. The cache holds at most 10000 entries by
+// default, which can be changed with OptionAuthentifyCacheSize.
+func OptionAuthentifyCache(ttl time.Duration, maxStale time.Duration) ClientOption {
+
+	if ttl <= 0 {
+		return errorOption(errors.New("ttl must be greater than 0"))
+	}
+
+	if maxStale < 0 {
+		return errorOption(errors.New("maxStale must be positive"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.authCacheTTL = ttl
+		opts.authCacheMaxStale = maxStale
+		if opts.authCacheSize == 0 {
+			opts.authCacheSize = defaultAuthCacheSize
+		}
+	}
+}
+
+// OptionAuthentifyCacheSize sets the maximum number of entries of the
+// cache enabled by OptionAuthentifyCache. When the cache is full, the
+// least recently used entry is evicted.
+func OptionAuthentifyCacheSize(size int) ClientOption {
+
+	if size <= 0 {
+		return errorOption(errors.New("size must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.authCacheSize = size
+	}
+}
+
+// OptionPublicIPLookupURL sets the url of an endpoint returning the public
+// IP address of the caller as plain text, like https://api.ipify.org. It is
+// used by OptRestrictToCallerNetwork when no network is explicitly given.
+// The lookup goes through the same http client as the midgard requests.
+// New returns an error if the given url is not a valid http or https url.
+func OptionPublicIPLookupURL(u string) ClientOption {
+
+	pu, err := url.Parse(u)
+	if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+		return errorOption(fmt.Errorf("invalid public ip lookup url '%s'", u))
+	}
+
+	return func(opts *clientOpts) {
+		opts.publicIPLookupURL = u
+	}
+}
+
+// OptionErrorBodyLimit sets the maximum number of bytes of an
+// error body read from midgard, and so captured in the Detail of a
+// ResponseError. An error body larger than that cannot be decoded.
+// The default is 4KB.
+func OptionErrorBodyLimit(n int) ClientOption {
+
+	if n <= 0 {
+		return errorOption(errors.New("error body limit must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.maxErrorBody = n
+	}
+}
+
+// errorBodyLimit returns the maximum size of a captured error body.
+func (o clientOpts) errorBodyLimit() int {
+
+	if o.maxErrorBody == 0 {
+		return defaultErrorBodyLimit
+	}
+
+	return o.maxErrorBody
+}
+
+// OptionUserAgent appends the given application name and version
+// to the User-Agent sent to midgard, which always contains the
+// version of this library. For instance, OptionUserAgent("apoctl", "1.2.3")
+// gives "midgard-lib/v1.10.0 apoctl/1.2.3".
+func OptionUserAgent(app string, version string) ClientOption {
+
+	if app == "" {
+		return errorOption(errors.New("app cannot be empty"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.appUserAgent = app
+		if version != "" {
+			opts.appUserAgent += "/" + version
+		}
+	}
+}
+
+// OptionAllowedRealms makes Authentify reject the tokens that have not
+// been issued from one of the given realms with a verify.ErrRealmNotAllowed.
+// For instance, this can be used to reject LDAP tokens on admin APIs.
+func OptionAllowedRealms(realms ...string) ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.allowedRealms = append([]string{}, realms...)
+	}
+}
+
+// OptionHTTPClient sets the http.Client used to send the requests.
+// When it is set, the options configuring the default transport,
+// like OptionLocalAddr, are ignored.
+func OptionHTTPClient(client *http.Client) ClientOption {
+
+	if client == nil {
+		return errorOption(errors.New("client cannot be nil"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.httpClient = client
+	}
+}
+
+// OptionTimeout sets the timeout of the requests sent to midgard.
+// The default is 30s.
+func OptionTimeout(timeout time.Duration) ClientOption {
+
+	if timeout <= 0 {
+		return errorOption(errors.New("timeout must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.timeout = timeout
+	}
+}
+
+// OptionResponseHeaderTimeout sets the maximum time to wait for the
+// response headers of midgard once the request has been written. This
+// protects against load balancers holding connections open without
+// answering. The default only relies on the overall request timeout.
+func OptionResponseHeaderTimeout(timeout time.Duration) ClientOption {
+
+	if timeout <= 0 {
+		return errorOption(errors.New("response header timeout must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.responseHeaderTimeout = timeout
+	}
+}
+
+// OptionExpectContinueTimeout sets the maximum time to wait for the
+// first response headers of midgard after writing the request headers
+// of a request sending "Expect: 100-continue". The default sends the
+// body immediately.
+func OptionExpectContinueTimeout(timeout time.Duration) ClientOption {
+
+	if timeout <= 0 {
+		return errorOption(errors.New("expect continue timeout must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.expectContinueTimeout = timeout
+	}
+}
+
+// OptionTLSHandshakeTimeout sets the maximum time to wait for the
+// TLS handshake with midgard. The default only relies on the overall
+// request timeout.
+func OptionTLSHandshakeTimeout(timeout time.Duration) ClientOption {
+
+	if timeout <= 0 {
+		return errorOption(errors.New("tls handshake timeout must be greater than 0"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.tlsHandshakeTimeout = timeout
+	}
+}
+
+// OptionProxy sets the proxy used to reach midgard, instead of the one
+// configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables. Requests to hosts matching one of the noProxy rules are
+// sent directly. Like in NO_PROXY, a rule can be "*", an IP address, a
+// CIDR, or a domain name matching itself and its subdomains, or only
+// its subdomains if prefixed by ".". IP addresses and domain names can
+// be followed by a port. New returns an error if the proxy url or one
+// of the rules is invalid.
+func OptionProxy(proxyURL string, noProxy ...string) ClientOption {
+
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errorOption(fmt.Errorf("invalid proxy url '%s'", proxyURL))
+	}
+
+	rules := make([]noProxyRule, len(noProxy))
+	for i, rule := range noProxy {
+		if rules[i], err = parseNoProxyRule(rule); err != nil {
+			return errorOption(err)
+		}
+	}
+
+	return func(opts *clientOpts) {
+		opts.proxy = newProxyFunc(u, rules)
+	}
+}
+
+// OptionFailoverURLs sets the urls of other midgard endpoints, for
+// instance in other regions, to fail over to when the previous ones
+// are unreachable or respond with a 5xx. Failing endpoints are avoided
+// for a cooldown growing with their consecutive failures, and requests
+// go back to the preferred endpoints once they are healthy again.
+// The health of the endpoints is returned by Client.EndpointsHealth.
+// New returns an error if one of the urls is invalid.
+func OptionFailoverURLs(urls ...string) ClientOption {
+
+	for _, u := range urls {
+		if err := validateURL(u); err != nil {
+			return errorOption(err)
+		}
+	}
+
+	return func(opts *clientOpts) {
+		opts.failoverURLs = append([]string{}, urls...)
+	}
+}
+
+// OptionRedirectPolicy sets how the client follows the redirects
+// returned by midgard. By default, redirects are never followed.
+// Like OptionTimeout, it also applies to the client given
+// with OptionHTTPClient.
+func OptionRedirectPolicy(policy RedirectPolicy) ClientOption {
+
+	if err := policy.validate(); err != nil {
+		return errorOption(err)
+	}
+
+	return func(opts *clientOpts) {
+		opts.redirectPolicy = policy
+		opts.redirectPolicySet = true
+	}
+}
+
+// OptionKeepAlive keeps the connections to midgard open to reuse them
+// for the next requests, keeping at most maxIdleConnsPerHost of them idle
+// for at most idleConnTimeout, or without time limit if 0. By default, the
+// connections are closed after each request, which causes a lot of churn
+// under load. The default transport already attempts HTTP/2.
+func OptionKeepAlive(maxIdleConnsPerHost int, idleConnTimeout time.Duration) ClientOption {
+
+	if maxIdleConnsPerHost <= 0 {
+		return errorOption(errors.New("max idle connections per host must be greater than 0"))
+	}
+
+	if idleConnTimeout < 0 {
+		return errorOption(errors.New("idle connection timeout must be positive"))
+	}
+
+	return func(opts *clientOpts) {
+		opts.keepAlive = true
+		opts.maxIdleConnsPerHost = maxIdleConnsPerHost
+		opts.idleConnTimeout = idleConnTimeout
+	}
+}
+
+// OptionTLSConfig sets the TLS configuration used to connect to midgard.
+// The default uses the system certificate pool.
+func OptionTLSConfig(tlsConfig *tls.Config) ClientOption {
+
+	return func(opts *clientOpts) {
+		opts.tlsConfig = tlsConfig
+	}
+}
+
+// OptionHeader adds a header sent with every request to midgard.
+func OptionHeader(key string, value string) ClientOption {
+
+	return func(opts *clientOpts) {
+		if opts.headers == nil {
+			opts.headers = http.Header{}
+		}
+		opts.headers.Add(key, value)
+	}
+}
+
+// proxyFunc returns the proxy function to use in the client transport.
+func (o clientOpts) proxyFunc() func(*http.Request) (*url.URL, error) {
+
+	if o.proxy == nil {
+		return http.ProxyFromEnvironment
+	}
+
+	return o.proxy
+}
+
+// dialContext returns the dial function to use in the client transport.
+// It returns nil if the default one can be used.
+func (o clientOpts) dialContext() func(context.Context, string, string) (net.Conn, error) {
+
+	if o.localAddr == nil && o.network == "" && o.dial == nil && o.resolver == nil {
+		return nil
+	}
+
+	dial := o.dial
+	if dial == nil {
+
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  o.resolver,
+		}
+
+		if o.localAddr != nil {
+			dialer.LocalAddr = o.localAddr
+		}
+
+		dial = dialer.DialContext
+	}
+
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+
+		if o.network != "" {
+			network = o.network
+		}
+
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/midgard-lib/logger"
+)
+
+// optionError returns the message of the error
+// returned by New with the given option.
+func optionError(option ClientOption) string {
+
+	_, err := New("https://midgard.com", option)
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+func TestClient_Options(t *testing.T) {
+
+	c := clientOpts{}
+
+	Convey("Calling OptionLocalAddr should work", t, func() {
+		OptionLocalAddr("127.0.0.1")(&c)
+		So(c.localAddr.IP.String(), ShouldEqual, "127.0.0.1")
+	})
+
+	Convey("Calling New with OptionLocalAddr and an invalid address should return an error", t, func() {
+		cl, err := New("https://midgard.com", OptionLocalAddr("not-an-ip"))
+		So(cl, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid local address 'not-an-ip'")
+	})
+
+	Convey("Calling OptionForceIPv4 should work", t, func() {
+		OptionForceIPv4()(&c)
+		So(c.network, ShouldEqual, "tcp4")
+	})
+
+	Convey("Calling OptionForceIPv6 should work", t, func() {
+		OptionForceIPv6()(&c)
+		So(c.network, ShouldEqual, "tcp6")
+	})
+
+	Convey("Calling OptionDialContext or OptionResolver with nil values should make New return an error", t, func() {
+		So(optionError(OptionDialContext(nil)), ShouldEqual, "dial cannot be nil")
+		So(optionError(OptionResolver(nil)), ShouldEqual, "resolver cannot be nil")
+	})
+
+	Convey("Calling OptionKeepAlive should work", t, func() {
+		OptionKeepAlive(10, time.Minute)(&c)
+		So(c.keepAlive, ShouldBeTrue)
+		So(c.maxIdleConnsPerHost, ShouldEqual, 10)
+		So(c.idleConnTimeout, ShouldEqual, time.Minute)
+	})
+
+	Convey("Calling OptionKeepAlive with invalid values should make New return an error", t, func() {
+		So(optionError(OptionKeepAlive(0, time.Minute)), ShouldEqual, "max idle connections per host must be greater than 0")
+		So(optionError(OptionKeepAlive(1, -time.Minute)), ShouldEqual, "idle connection timeout must be positive")
+	})
+
+	Convey("Calling OptionHTTPClient should work", t, func() {
+		hc := &http.Client{}
+		OptionHTTPClient(hc)(&c)
+		So(c.httpClient, ShouldEqual, hc)
+	})
+
+	Convey("Calling OptionHTTPClient with a nil client should make New return an error", t, func() {
+		So(optionError(OptionHTTPClient(nil)), ShouldEqual, "client cannot be nil")
+	})
+
+	Convey("Calling OptionTimeout should work", t, func() {
+		OptionTimeout(time.Second)(&c)
+		So(c.timeout, ShouldEqual, time.Second)
+	})
+
+	Convey("Calling OptionTimeout with an invalid timeout should make New return an error", t, func() {
+		So(optionError(OptionTimeout(0)), ShouldEqual, "timeout must be greater than 0")
+	})
+
+	Convey("Calling the transport timeout options should work", t, func() {
+		OptionResponseHeaderTimeout(time.Second)(&c)
+		OptionExpectContinueTimeout(2 * time.Second)(&c)
+		OptionTLSHandshakeTimeout(3 * time.Second)(&c)
+		So(c.responseHeaderTimeout, ShouldEqual, time.Second)
+		So(c.expectContinueTimeout, ShouldEqual, 2*time.Second)
+		So(c.tlsHandshakeTimeout, ShouldEqual, 3*time.Second)
+	})
+
+	Convey("Calling the transport timeout options with invalid timeouts should make New return an error", t, func() {
+		So(optionError(OptionResponseHeaderTimeout(0)), ShouldEqual, "response header timeout must be greater than 0")
+		So(optionError(OptionExpectContinueTimeout(-1)), ShouldEqual, "expect continue timeout must be greater than 0")
+		So(optionError(OptionTLSHandshakeTimeout(0)), ShouldEqual, "tls handshake timeout must be greater than 0")
+	})
+
+	Convey("Calling OptionLogger should work", t, func() {
+		So(c.log(), ShouldNotBeNil)
+		l := logger.Nop()
+		OptionLogger(l)(&c)
+		So(c.logger, ShouldResemble, l)
+		So(c.log(), ShouldResemble, redactingLogger{logger: l, redactor: DefaultRedactor})
+	})
+
+	Convey("Calling OptionLogger with a nil logger should make New return an error", t, func() {
+		So(optionError(OptionLogger(nil)), ShouldEqual, "logger cannot be nil")
+	})
+
+	Convey("Calling OptionTracer with a nil tracer should make New return an error", t, func() {
+		So(optionError(OptionTracer(nil)), ShouldEqual, "tracer cannot be nil")
+	})
+
+	Convey("Calling OptionTLSConfig should work", t, func() {
+		tc := &tls.Config{}
+		OptionTLSConfig(tc)(&c)
+		So(c.tlsConfig, ShouldEqual, tc)
+	})
+
+	Convey("Calling OptionHeader should work", t, func() {
+		OptionHeader("X-A", "a")(&c)
+		OptionHeader("X-A", "b")(&c)
+		So(c.headers["X-A"], ShouldResemble, []string{"a", "b"})
+	})
+}
+
+func TestClient_NewClientWithOptions(t *testing.T) {
+
+	Convey("Given I create a new Client without options", t, func() {
+
+		cl := NewClientWithOptions("http://com.com")
+
+		Convey("Then client should be correctly initialized", func() {
+			So(cl, ShouldNotBeNil)
+			So(cl.url, ShouldEqual, "http://com.com")
+			So(cl.tlsConfig.RootCAs, ShouldNotBeNil)
+		})
+
+		Convey("Then the default dialer should be used", func() {
+			So(cl.httpClient.Transport.(*http.Transport).DialContext, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I have a server not sending response headers and a client with a response header timeout", t, func() {
+
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer ts.Close()
+		defer close(release)
+
+		cl := NewClientWithOptions(
+			ts.URL,
+			OptionResponseHeaderTimeout(50*time.Millisecond),
+			OptionExpectContinueTimeout(time.Second),
+			OptionTLSHandshakeTimeout(2*time.Second),
+			OptionRetryPolicy(RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond}),
+		)
+
+		Convey("Then the transport should be correctly initialized", func() {
+			tr := cl.httpClient.Transport.(*http.Transport)
+			So(tr.ResponseHeaderTimeout, ShouldEqual, 50*time.Millisecond)
+			So(tr.ExpectContinueTimeout, ShouldEqual, time.Second)
+			So(tr.TLSHandshakeTimeout, ShouldEqual, 2*time.Second)
+		})
+
+		Convey("When I call IssueFromCertificate", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromCertificate(ctx, time.Minute)
+
+			Convey("Then it should fail before the context deadline", func() {
+				So(err, ShouldNotBeNil)
+				So(ctx.Err(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a server and a client with a tracer", t, func() {
+
+		var header http.Header
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		tracer := mocktracer.New()
+		cl := NewClientWithOptions(ts.URL, OptionTracer(tracer))
+
+		Convey("When I call IssueFromVince", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the spans should be recorded by the tracer", func() {
+				So(err, ShouldBeNil)
+
+				spans := tracer.FinishedSpans()
+				So(len(spans), ShouldEqual, 2)
+				So(spans[0].OperationName, ShouldEqual, "midgardlib.client.send")
+				So(spans[1].OperationName, ShouldEqual, "midgardlib.client.issue.vince")
+				So(spans[0].ParentID, ShouldEqual, spans[1].SpanContext.SpanID)
+			})
+
+			Convey("Then the trace context should be propagated to midgard", func() {
+				So(header.Get("Mockpfx-Ids-Traceid"), ShouldEqual, fmt.Sprintf("%d", tracer.FinishedSpans()[0].SpanContext.TraceID))
+			})
+		})
+	})
+
+	Convey("Given I have a server failing once and a client with a tracer", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		tracer := mocktracer.New()
+		cl := NewClientWithOptions(ts.URL,
+			OptionTracer(tracer),
+			OptionRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: 20 * time.Millisecond}),
+		)
+
+		Convey("When I call IssueFromVince", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then each attempt should have its own span finished before the next one", func() {
+				So(err, ShouldBeNil)
+
+				spans := tracer.FinishedSpans()
+				So(len(spans), ShouldEqual, 3)
+				So(spans[0].OperationName, ShouldEqual, "midgardlib.client.send")
+				So(spans[1].OperationName, ShouldEqual, "midgardlib.client.send")
+				So(spans[0].FinishTime, ShouldHappenBefore, spans[1].StartTime)
+			})
+		})
+	})
+
+	Convey("Given I create a new Client with a missing URL", t, func() {
+
+		Convey("Then it should panic", func() {
+			So(func() { NewClientWithOptions("") }, ShouldPanic)
+		})
+	})
+
+	Convey("Given I have a server and a client with a local address and IPv4 forced", t, func() {
+
+		var remoteAddr string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remoteAddr = r.RemoteAddr
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionLocalAddr("127.0.0.1"), OptionForceIPv4())
+
+		Convey("When I call IssueFromCertificate", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromCertificate(ctx, time.Minute)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+			})
+
+			Convey("Then the request should come from the local address", func() {
+				host, _, _ := net.SplitHostPort(remoteAddr)
+				So(host, ShouldEqual, "127.0.0.1")
+			})
+		})
+	})
+
+	Convey("Given I have a server and a client with a custom http client, timeout, TLS config and headers", t, func() {
+
+		var header http.Header
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		hc := &http.Client{Timeout: time.Minute}
+		tc := &tls.Config{ServerName: "midgard"}
+
+		cl := NewClientWithOptions(
+			ts.URL,
+			OptionHTTPClient(hc),
+			OptionTimeout(5*time.Second),
+			OptionTLSConfig(tc),
+			OptionHeader("X-Tenant", "acme"),
+		)
+
+		Convey("Then the client should be correctly initialized", func() {
+			So(cl.tlsConfig, ShouldEqual, tc)
+			So(cl.httpClient.Timeout, ShouldEqual, 5*time.Second)
+			So(hc.Timeout, ShouldEqual, time.Minute)
+		})
+
+		Convey("When I call IssueFromCertificate", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromCertificate(ctx, time.Minute)
+
+			Convey("Then the request should have the custom headers", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(header.Get("X-Tenant"), ShouldEqual, "acme")
+			})
+		})
+	})
+}
+
+func TestClient_KeepAlive(t *testing.T) {
+
+	Convey("Given I have a server recording the client connections", t, func() {
+
+		conns := map[string]struct{}{}
+		var lock sync.Mutex
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			conns[r.RemoteAddr] = struct{}{}
+			lock.Unlock()
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		issue := func(cl *Client) {
+			for i := 0; i < 3; i++ {
+				_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+				So(err, ShouldBeNil)
+			}
+		}
+
+		Convey("When I send requests with a client keeping connections alive", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionKeepAlive(2, time.Minute))
+			issue(cl)
+
+			Convey("Then the transport should be correctly initialized", func() {
+				tr := cl.httpClient.Transport.(*http.Transport)
+				So(tr.MaxIdleConnsPerHost, ShouldEqual, 2)
+				So(tr.IdleConnTimeout, ShouldEqual, time.Minute)
+			})
+
+			Convey("Then a single connection should have been used", func() {
+				So(len(conns), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I send requests with a default client", func() {
+
+			issue(NewClientWithOptions(ts.URL))
+
+			Convey("Then a connection should have been used per request", func() {
+				So(len(conns), ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestClient_DialContext(t *testing.T) {
+
+	Convey("Given I have a server and a client with a custom dial function", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		var dialed, dialedNetwork string
+		cl := NewClientWithOptions(
+			"http://midgard.invalid",
+			OptionForceIPv4(),
+			OptionDialContext(func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				dialed, dialedNetwork = addr, network
+				return (&net.Dialer{}).DialContext(ctx, "tcp", ts.Listener.Addr().String())
+			}),
+		)
+
+		Convey("When I issue a token", func() {
+
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the request should have been sent through the dial function", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(dialed, ShouldEqual, "midgard.invalid:80")
+				So(dialedNetwork, ShouldEqual, "tcp4")
+			})
+		})
+	})
+
+	Convey("Given I have a client with a custom resolver", t, func() {
+
+		cl := NewClientWithOptions(
+			"http://midgard.invalid",
+			OptionRetryPolicy(RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond}),
+			OptionResolver(&net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+					return nil, fmt.Errorf("custom resolver")
+				},
+			}),
+		)
+
+		Convey("When I issue a token", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the resolver should have been used", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "custom resolver")
+			})
+		})
+	})
+}
@@ -26,6 +26,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"go.aporeto.io/gaia"
 	"go.aporeto.io/midgard-lib/ldaputils"
+	"go.aporeto.io/midgard-lib/verify"
 )
 
 func TestClient_NewClient(t *testing.T) {
@@ -51,6 +52,46 @@ func TestClient_NewClient(t *testing.T) {
 	})
 }
 
+func TestClient_New(t *testing.T) {
+
+	Convey("Given I create a new Client with a valid URL", t, func() {
+
+		cl, err := New("https://com.com", OptionTLSConfig(&tls.Config{}))
+
+		Convey("Then client should be correctly initialized", func() {
+			So(err, ShouldBeNil)
+			So(cl, ShouldNotBeNil)
+			So(cl.url, ShouldEqual, "https://com.com")
+		})
+	})
+
+	Convey("Given I create a new Client with invalid URLs", t, func() {
+
+		Convey("Then it should return an error", func() {
+
+			_, err := New("")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "missing midgard url")
+
+			_, err = New("com.com")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid midgard url 'com.com': scheme must be http or https")
+
+			_, err = New("ftp://com.com")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid midgard url 'ftp://com.com': scheme must be http or https")
+
+			_, err = New("https://")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid midgard url 'https://': missing host")
+
+			_, err = New("https://com.com/%zz")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "invalid midgard url 'https://com.com/%zz': ")
+		})
+	})
+}
+
 func TestClient_Authentify(t *testing.T) {
 
 	Convey("Given I have a Client and some valid http header", t, func() {
@@ -189,6 +230,89 @@ func TestClient_Authentify(t *testing.T) {
 	})
 }
 
+func TestClient_AvailableRealms(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		var expectedNamespace string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expectedNamespace = r.URL.Query().Get("namespace")
+			fmt.Fprintln(w, `[{"realm": "OIDC", "providers": ["okta"]}, {"realm": "Certificate"}]`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call AvailableRealms", func() {
+
+			realms, err := cl.AvailableRealms(context.Background(), "/acme")
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the namespace should have been sent", func() {
+				So(expectedNamespace, ShouldEqual, "/acme")
+			})
+
+			Convey("Then the realms should be correct", func() {
+				So(realms, ShouldResemble, []RealmInfo{
+					{Realm: "OIDC", Providers: []string{"okta"}},
+					{Realm: "Certificate"},
+				})
+			})
+		})
+	})
+
+	Convey("Given I have a client and a server that does not support discovery", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "not found", http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call AvailableRealms", func() {
+
+			realms, err := cl.AvailableRealms(context.Background(), "/acme")
+
+			Convey("Then err should be ErrDiscoveryUnsupported", func() {
+				So(err, ShouldEqual, ErrDiscoveryUnsupported)
+			})
+
+			Convey("Then realms should be nil", func() {
+				So(realms, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a client and a server that returns an error", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", http.StatusForbidden)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call AvailableRealms", func() {
+
+			realms, err := cl.AvailableRealms(context.Background(), "/acme")
+
+			Convey("Then err should be correct", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to retrieve available realms: 403 Forbidden")
+			})
+
+			Convey("Then realms should be nil", func() {
+				So(realms, ShouldBeNil)
+			})
+		})
+	})
+}
+
 func TestClient_IssueFromGoogle(t *testing.T) {
 
 	Convey("Given I have a client and a fake working server", t, func() {
@@ -490,6 +614,211 @@ func TestClient_IssueFromGCPIdentityToken(t *testing.T) {
 	})
 }
 
+func TestClient_IssueFromKubernetesServiceAccountToken(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "kubernetesserviceaccounttoken","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromKubernetesServiceAccountToken", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromKubernetesServiceAccountToken(ctx, "sa-token", 1*time.Minute,
+				OptQuota(1),
+				OptRestrictNamespace("/ns1"),
+				OptRestrictPermissions([]string{"@auth:role=toto"}),
+				OptRestrictNetworks([]string{"127.0.0.0/8"}),
+			)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "KubernetesServiceAccountToken")
+				So(expectedRequest.Metadata["token"], ShouldEqual, "sa-token")
+				So(expectedRequest.RestrictedPermissions, ShouldResemble, []string{"@auth:role=toto"})
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+				So(expectedRequest.RestrictedNetworks, ShouldResemble, []string{"127.0.0.0/8"})
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+	})
+}
+
+func TestClient_IssueFromGithubActionsOIDC(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "githubactionsoidc","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromGithubActionsOIDC", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromGithubActionsOIDC(ctx, "job-token", 1*time.Minute,
+				OptRestrictNamespace("/ns1"),
+				OptRestrictPermissions([]string{"@auth:role=toto"}),
+			)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "GithubActionsOIDC")
+				So(expectedRequest.Metadata["token"], ShouldEqual, "job-token")
+				So(expectedRequest.RestrictedPermissions, ShouldResemble, []string{"@auth:role=toto"})
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+	})
+}
+
+func TestClient_IssueFromAPIKey(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expectedRequest = gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "apikey","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromAPIKey", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromAPIKey(ctx, "the-key", 1*time.Minute, OptRestrictNamespace("/ns1"))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "APIKey")
+				So(expectedRequest.Metadata, ShouldResemble, map[string]interface{}{"apiKey": "the-key"})
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+
+		Convey("When I call IssueFromAPIKey with another metadata key", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromAPIKey(ctx, "the-key", 1*time.Minute, OptAPIKeyMetadataKey("key"))
+
+			Convey("Then the key should be sent with it", func() {
+				So(err, ShouldBeNil)
+				So(expectedRequest.Metadata, ShouldResemble, map[string]interface{}{"key": "the-key"})
+			})
+		})
+
+		Convey("When I call IssueFromAPIKey without key", func() {
+
+			_, err := cl.IssueFromAPIKey(context.Background(), "", 1*time.Minute)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing api key")
+			})
+		})
+	})
+}
+
+func TestClient_IssueFromKerberos(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "kerberos","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromKerberos", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromKerberos(ctx, []byte{0x60, 0x82, 0x01}, 1*time.Minute, OptRestrictNamespace("/ns1"))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "Kerberos")
+				So(expectedRequest.Metadata["token"], ShouldEqual, "YIIB")
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+
+		Convey("When I call IssueFromKerberos without token", func() {
+
+			_, err := cl.IssueFromKerberos(context.Background(), nil, 1*time.Minute)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing spnego token")
+			})
+		})
+	})
+}
+
 func TestClient_IssueFromAzureIdentityToken(t *testing.T) {
 
 	Convey("Given I have a client and a fake working server", t, func() {
@@ -790,7 +1119,7 @@ func TestClient_sendRequest(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 			defer cancel()
 
-			jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"})
+			jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"}, issueOpts{})
 
 			Convey("Then err should be nil", func() {
 				So(err, ShouldBeNil)
@@ -809,7 +1138,7 @@ func TestClient_sendRequest(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
 
-		jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"})
+		jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"}, issueOpts{})
 
 		Convey("Then err should not be nil", func() {
 			So(err, ShouldNotBeNil)
@@ -839,7 +1168,7 @@ func TestClient_sendRequest(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 			defer cancel()
 
-			jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"})
+			jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"}, issueOpts{})
 
 			Convey("Then err should not be nil", func() {
 				So(err, ShouldNotBeNil)
@@ -867,7 +1196,7 @@ func TestClient_sendRequest(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 			defer cancel()
 
-			jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"})
+			jwt, err := cl.sendRequest(ctx, &gaia.Issue{Realm: "test"}, issueOpts{})
 
 			Convey("Then err should not be nil", func() {
 				So(err, ShouldNotBeNil)
@@ -880,6 +1209,58 @@ func TestClient_sendRequest(t *testing.T) {
 	})
 }
 
+func TestClient_OptQuotaInfo(t *testing.T) {
+
+	Convey("Given I have a client and a server returning quota information", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Quota-Remaining", "9")
+			fmt.Fprintln(w, `{"quota": 10, "token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromCertificate with OptQuotaInfo", func() {
+
+			var info QuotaInfo
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute, OptQuota(10), OptQuotaInfo(func(i QuotaInfo) { info = i }))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the quota information should be correct", func() {
+				So(info, ShouldResemble, QuotaInfo{Quota: 10, Remaining: 9})
+			})
+		})
+	})
+
+	Convey("Given I have a client and a server returning no remaining quota", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"quota": 3, "token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromCertificate with OptQuotaInfo", func() {
+
+			var info QuotaInfo
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute, OptQuotaInfo(func(i QuotaInfo) { info = i }))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the remaining quota should be unknown", func() {
+				So(info, ShouldResemble, QuotaInfo{Quota: 3, Remaining: -1})
+			})
+		})
+	})
+}
+
 func TestTokenUtils_Snip(t *testing.T) {
 
 	Convey("Given have a token and and error containing the token", t, func() {
@@ -887,9 +1268,9 @@ func TestTokenUtils_Snip(t *testing.T) {
 		token := "token"
 		err := errors.New("your token is token")
 
-		Convey("When I call snipToken", func() {
+		Convey("When I call redactSecrets", func() {
 
-			e := snipToken(err, token)
+			e := redactSecrets(err, token)
 
 			Convey("Then err should have the reference to token snipped", func() {
 				So(e.Error(), ShouldEqual, "your [snip] is [snip]")
@@ -902,9 +1283,9 @@ func TestTokenUtils_Snip(t *testing.T) {
 		token := "token"
 		err := errors.New("your secret is secret")
 
-		Convey("When I call snipToken", func() {
+		Convey("When I call redactSecrets", func() {
 
-			e := snipToken(err, token)
+			e := redactSecrets(err, token)
 
 			Convey("Then err should have the reference to token snipped", func() {
 				So(e.Error(), ShouldEqual, "your secret is secret")
@@ -916,9 +1297,9 @@ func TestTokenUtils_Snip(t *testing.T) {
 
 		token := "token"
 
-		Convey("When I call snipToken", func() {
+		Convey("When I call redactSecrets", func() {
 
-			e := snipToken(nil, token)
+			e := redactSecrets(nil, token)
 
 			Convey("Then err should be nil", func() {
 				So(e, ShouldBeNil)
@@ -973,3 +1354,111 @@ func TestClient_IssueFromPCIdentityToken(t *testing.T) {
 		})
 	})
 }
+
+func TestClient_AuthentifyAllowedRealms(t *testing.T) {
+
+	Convey("Given I have a client allowing only certificates and a server returning LDAP claims", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"claims": {"realm": "LDAP", "sub": "bob"}}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I call Authentify with a client allowing only certificates", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionAllowedRealms("certificate"))
+			claims, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then err should be ErrRealmNotAllowed", func() {
+				So(err, ShouldResemble, verify.ErrRealmNotAllowed{Realm: "LDAP"})
+				So(claims, ShouldBeNil)
+			})
+		})
+
+		Convey("When I call Authentify with a client allowing LDAP", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionAllowedRealms("certificate", "ldap"))
+			claims, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldResemble, []string{"@auth:subject=bob"})
+			})
+		})
+	})
+}
+
+func TestClient_Issue(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call Issue with a custom realm", func() {
+
+			issue := gaia.NewIssue()
+			issue.Realm = "NewRealm"
+			issue.Validity = "10m"
+			issue.Metadata = map[string]interface{}{"key": "value"}
+			issue.RestrictedNamespace = "/ns1"
+
+			token, err := cl.Issue(context.Background(), issue,
+				OptQuota(1),
+				OptRestrictNetworks([]string{"127.0.0.0/8"}),
+				OptMetadata("extra", "value"),
+			)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "NewRealm")
+				So(expectedRequest.Validity, ShouldEqual, "10m")
+				So(expectedRequest.Metadata, ShouldResemble, map[string]interface{}{"key": "value", "extra": "value"})
+				So(expectedRequest.Quota, ShouldEqual, 1)
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+				So(expectedRequest.RestrictedNetworks, ShouldResemble, []string{"127.0.0.0/8"})
+			})
+
+			Convey("Then the given issue request should not be modified", func() {
+				So(issue.Metadata, ShouldResemble, map[string]interface{}{"key": "value"})
+				So(issue.Quota, ShouldEqual, 0)
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+
+		Convey("When I call Issue without realm", func() {
+
+			_, err := cl.Issue(context.Background(), gaia.NewIssue())
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing issue realm")
+			})
+		})
+
+		Convey("When I call Issue without issue request", func() {
+
+			_, err := cl.Issue(context.Background(), nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing issue request")
+			})
+		})
+	})
+}
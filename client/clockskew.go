@@ -0,0 +1,78 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.aporeto.io/midgard-lib/logger"
+)
+
+// clockSkewWarningThreshold is the clock skew above
+// which a warning is logged.
+const clockSkewWarningThreshold = time.Minute
+
+// ClockSkew returns the difference between the clock of midgard and
+// the local one, measured from the Date header of the last midgard
+// response. It is positive if the local clock is late. It returns 0
+// until a response with a Date header is received.
+//
+// As the Date header has a resolution of one second, so does the
+// measure. It can be given to verify.Verifier.SetLeewayFunc and
+// tokenmanager.Transport.SetClockSkewFunc to compensate the skew.
+func (a *Client) ClockSkew() time.Duration {
+
+	return time.Duration(atomic.LoadInt64(&a.clockSkew))
+}
+
+// observeClockSkew records the clock skew measured from the given
+// response headers, for a request sent at sent and whose response
+// was received at received.
+func (a *Client) observeClockSkew(header http.Header, sent time.Time, received time.Time) {
+
+	skew, _, ok := clockSkew(header, sent, received)
+	if !ok {
+		return
+	}
+
+	old := time.Duration(atomic.SwapInt64(&a.clockSkew, int64(skew)))
+	if abs(old) < clockSkewWarningThreshold && abs(skew) >= clockSkewWarningThreshold {
+		a.config.log().Warn("Local clock is skewed compared to midgard", logger.F("skew", skew))
+	}
+}
+
+// clockSkew returns the clock skew computed from the Date header of a
+// response, assuming midgard generated it halfway between sent and
+// received, and the time of midgard. It returns false if there is no
+// valid Date header.
+func clockSkew(header http.Header, sent time.Time, received time.Time) (time.Duration, time.Time, bool) {
+
+	serverTime, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	local := sent.Add(received.Sub(sent) / 2)
+
+	return serverTime.Sub(local).Round(time.Second), serverTime, true
+}
+
+func abs(d time.Duration) time.Duration {
+
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
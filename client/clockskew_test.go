@@ -0,0 +1,73 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_clockSkew(t *testing.T) {
+
+	Convey("Given I have a request sent at a given time", t, func() {
+
+		sent := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+
+		Convey("Then the skew should be computed from the middle of the request", func() {
+			skew, serverTime, ok := clockSkew(http.Header{"Date": []string{"Wed, 21 Oct 2015 07:30:01 GMT"}}, sent, sent.Add(2*time.Second))
+			So(ok, ShouldBeTrue)
+			So(skew, ShouldEqual, 2*time.Minute)
+			So(serverTime.Equal(sent.Add(2*time.Minute+time.Second)), ShouldBeTrue)
+		})
+
+		Convey("Then a missing or invalid Date header should be ignored", func() {
+			_, _, ok := clockSkew(http.Header{}, sent, sent)
+			So(ok, ShouldBeFalse)
+			_, _, ok = clockSkew(http.Header{"Date": []string{"yesterday"}}, sent, sent)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestClient_ClockSkew(t *testing.T) {
+
+	Convey("Given I have a server whose clock is 10 minutes ahead", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("Then the skew should be 0 before any request", func() {
+			So(cl.ClockSkew(), ShouldEqual, 0)
+		})
+
+		Convey("When I issue a token", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the skew should have been measured", func() {
+				So(err, ShouldBeNil)
+				So(cl.ClockSkew(), ShouldBeBetweenOrEqual, 10*time.Minute-2*time.Second, 10*time.Minute+2*time.Second)
+			})
+		})
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+)
+
+type authentifyCall struct {
+	done     chan struct{}
+	claims   []string
+	err      error
+	canceled bool
+}
+
+// authentifyGroup coalesces concurrent Authentify
+// calls made with the same token.
+type authentifyGroup struct {
+	calls map[[32]byte]*authentifyCall
+	sync.Mutex
+}
+
+func newAuthentifyGroup() *authentifyGroup {
+	return &authentifyGroup{
+		calls: map[[32]byte]*authentifyCall{},
+	}
+}
+
+// do calls f unless a call for the same key is already in flight,
+// in which case it waits for its result. If the in flight call
+// failed because the context of its caller was done, the waiting
+// callers whose context is still alive try again instead of
+// returning an error that does not concern them.
+func (g *authentifyGroup) do(ctx context.Context, key [32]byte, f func() ([]string, error)) ([]string, error) {
+
+	for {
+		g.Lock()
+		call, ok := g.calls[key]
+		if !ok {
+			break
+		}
+		g.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if call.canceled && ctx.Err() == nil {
+			continue
+		}
+
+		return copyClaims(call.claims), call.err
+	}
+
+	call := &authentifyCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.Unlock()
+
+	call.claims, call.err = f()
+	call.canceled = call.err != nil && ctx.Err() != nil
+	close(call.done)
+
+	g.Lock()
+	delete(g.calls, key)
+	g.Unlock()
+
+	return call.claims, call.err
+}
+
+// tokenFingerprint returns the key used to identify a token
+// without keeping it in memory.
+func tokenFingerprint(token string) [32]byte {
+	return sha256.Sum256([]byte(token))
+}
+
+func copyClaims(claims []string) []string {
+
+	if claims == nil {
+		return nil
+	}
+
+	out := make([]string, len(claims))
+	copy(out, claims)
+
+	return out
+}
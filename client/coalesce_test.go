@@ -0,0 +1,161 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_AuthentifyCoalescing(t *testing.T) {
+
+	Convey("Given I have a client and a slow server", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintln(w, `{"claims": {"realm": "realm", "sub": "subject", "data": {"d1": "v1"}}}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call Authentify concurrently with the same token", func() {
+
+			results := make([][]string, 10)
+			errs := make([]error, 10)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], errs[i] = cl.Authentify(context.Background(), "token")
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("Then midgard should have been called once", func() {
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+
+			Convey("Then all callers should have the claims", func() {
+				for i := 0; i < 10; i++ {
+					So(errs[i], ShouldBeNil)
+					So(results[i], ShouldResemble, results[0])
+				}
+				So(len(results[0]), ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When I call Authentify concurrently with different tokens", func() {
+
+			var wg sync.WaitGroup
+			for _, token := range []string{"a", "b"} {
+				wg.Add(1)
+				go func(token string) {
+					defer wg.Done()
+					_, _ = cl.Authentify(context.Background(), token)
+				}(token)
+			}
+			wg.Wait()
+
+			Convey("Then midgard should have been called for each token", func() {
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given I have a call in flight", t, func() {
+
+		g := newAuthentifyGroup()
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go g.do(context.Background(), tokenFingerprint("token"), func() ([]string, error) { // nolint: errcheck
+			close(started)
+			<-release
+			return nil, nil
+		})
+		<-started
+
+		Convey("When a waiter context is done", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := g.do(ctx, tokenFingerprint("token"), func() ([]string, error) { panic("should not be called") })
+			close(release)
+
+			Convey("Then the waiter should get the context error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given I have a call in flight whose caller gives up", t, func() {
+
+		g := newAuthentifyGroup()
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		leaderErr := make(chan error, 1)
+		go func() {
+			_, err := g.do(ctx, tokenFingerprint("token"), func() ([]string, error) {
+				close(started)
+				<-release
+				return nil, ctx.Err()
+			})
+			leaderErr <- err
+		}()
+		<-started
+
+		Convey("When a waiter with a live context is waiting for it", func() {
+
+			var calls int32
+			waiterClaims := make(chan []string, 1)
+			waiterErr := make(chan error, 1)
+			go func() {
+				claims, err := g.do(context.Background(), tokenFingerprint("token"), func() ([]string, error) {
+					atomic.AddInt32(&calls, 1)
+					return []string{"sub=subject"}, nil
+				})
+				waiterClaims <- claims
+				waiterErr <- err
+			}()
+
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+			close(release)
+
+			Convey("Then the caller should get its context error", func() {
+				So(<-leaderErr, ShouldEqual, context.Canceled)
+			})
+
+			Convey("Then the waiter should retry and get the claims", func() {
+				So(<-waiterErr, ShouldBeNil)
+				So(<-waiterClaims, ShouldResemble, []string{"sub=subject"})
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// acceptEncoding is the Accept-Encoding sent
+// when OptionCompression is set.
+const acceptEncoding = "gzip, deflate"
+
+// decompressedBody closes both the decompressor
+// and the original response body.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+
+	err := b.ReadCloser.Close()
+	if berr := b.body.Close(); err == nil {
+		err = berr
+	}
+
+	return err
+}
+
+// decompressResponse replaces the body of the given response
+// by its decompressed content, according to its Content-Encoding.
+func decompressResponse(resp *http.Response) error {
+
+	var r io.ReadCloser
+	var err error
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		r, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		r, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+
+	switch err {
+	case nil:
+		resp.Body = &decompressedBody{ReadCloser: r, body: resp.Body}
+	case io.EOF:
+		resp.Body.Close() // nolint: errcheck
+		resp.Body = ioutil.NopCloser(strings.NewReader(""))
+	default:
+		resp.Body.Close() // nolint: errcheck
+		return fmt.Errorf("unable to decompress response: %s", err)
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return nil
+}
+
+// compressRequestBody returns the given request body compressed with
+// gzip if OptionRequestCompression is set, the body is large enough and
+// midgard did not reject compressed requests. It returns true if the
+// body has been compressed.
+func (a *Client) compressRequestBody(body []byte) ([]byte, bool, error) {
+
+	if !a.config.requestCompression || len(body) < a.config.requestCompressionMinSize || atomic.LoadInt32(&a.gzipRequestsUnsupported) == 1 {
+		return body, false, nil
+	}
+
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+
+	if _, err := w.Write(body); err != nil {
+		return nil, false, fmt.Errorf("unable to compress request: %s", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, false, fmt.Errorf("unable to compress request: %s", err)
+	}
+
+	return buf.Bytes(), true, nil
+}
+
+// fallbackToUncompressed returns true if the given response means
+// that midgard does not support the compressed request that was sent.
+// In that case, the response is closed and the following requests are
+// sent uncompressed.
+func (a *Client) fallbackToUncompressed(resp *http.Response, compressed bool) bool {
+
+	if !compressed || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return false
+	}
+
+	resp.Body.Close() // nolint: errcheck
+
+	if atomic.CompareAndSwapInt32(&a.gzipRequestsUnsupported, 0, 1) {
+		a.config.log().Warn("Midgard does not support compressed requests, falling back to uncompressed requests")
+	}
+
+	return true
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_Compression(t *testing.T) {
+
+	const payload = `{"claims": {"realm": "certificate", "sub": "subject", "data": {"org": "acme"}}}`
+
+	compressed := func(encoding string) []byte {
+		buf := &bytes.Buffer{}
+		var w io.WriteCloser
+		if encoding == "gzip" {
+			w = gzip.NewWriter(buf)
+		} else {
+			w = zlib.NewWriter(buf)
+		}
+		w.Write([]byte(payload)) // nolint: errcheck
+		w.Close()                // nolint: errcheck
+		return buf.Bytes()
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+
+		encoding := encoding
+
+		Convey("Given I have a server sending "+encoding+" responses and a client with compression", t, func() {
+
+			var acceptEncoding string
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Encoding", encoding)
+				w.Write(compressed(encoding)) // nolint: errcheck
+			}))
+			defer ts.Close()
+
+			cl := NewClientWithOptions(ts.URL, OptionCompression())
+
+			Convey("When I call Authentify", func() {
+
+				claims, err := cl.Authentify(context.Background(), "token")
+
+				Convey("Then the response should have been decompressed", func() {
+					So(err, ShouldBeNil)
+					So(acceptEncoding, ShouldEqual, "gzip, deflate")
+					So(claims, ShouldResemble, []string{"@auth:org=acme", "@auth:subject=subject"})
+				})
+			})
+		})
+	}
+
+	Convey("Given I have a server sending an invalid gzip response and a client with compression", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte("not gzip")) // nolint: errcheck
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionCompression())
+
+		Convey("When I issue a token", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to decompress response: ")
+			})
+		})
+	})
+
+	Convey("Given I have an empty gzip response", t, func() {
+
+		resp := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{"gzip"}},
+			Body:   ioutil.NopCloser(strings.NewReader("")),
+		}
+
+		Convey("When I decompress it", func() {
+
+			err := decompressResponse(resp)
+
+			Convey("Then the body should be empty", func() {
+				So(err, ShouldBeNil)
+				data, _ := ioutil.ReadAll(resp.Body)
+				So(len(data), ShouldEqual, 0)
+				So(resp.Header.Get("Content-Encoding"), ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given I have an uncompressed response", t, func() {
+
+		resp := &http.Response{
+			Header: http.Header{},
+			Body:   ioutil.NopCloser(strings.NewReader("hello")),
+		}
+
+		Convey("When I decompress it", func() {
+
+			err := decompressResponse(resp)
+
+			Convey("Then the body should be unchanged", func() {
+				So(err, ShouldBeNil)
+				data, _ := ioutil.ReadAll(resp.Body)
+				So(string(data), ShouldEqual, "hello")
+				So(resp.Uncompressed, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestClient_RequestCompression(t *testing.T) {
+
+	Convey("Calling OptionRequestCompression with an invalid size should make New return an error", t, func() {
+		So(optionError(OptionRequestCompression(-1)), ShouldEqual, "min size must be positive")
+	})
+
+	Convey("Given I have a server accepting compressed requests", t, func() {
+
+		var encodings []string
+		var bodies []string
+		var reject bool
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			encodings = append(encodings, r.Header.Get("Content-Encoding"))
+
+			if r.Header.Get("Content-Encoding") == "gzip" && reject {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+
+			var body io.Reader = r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					panic(err)
+				}
+				body = gr
+			}
+
+			data, _ := ioutil.ReadAll(body)
+			bodies = append(bodies, string(data))
+
+			w.Write([]byte(`{"token": "yeay!"}`)) // nolint: errcheck
+		}))
+		defer ts.Close()
+
+		Convey("When I issue a token with request compression", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionRequestCompression(0))
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the request should have been compressed", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(encodings, ShouldResemble, []string{"gzip"})
+				So(bodies[0], ShouldContainSubstring, `"account"`)
+			})
+		})
+
+		Convey("When I issue a token smaller than the min size", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionRequestCompression(1<<20))
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the request should not have been compressed", func() {
+				So(err, ShouldBeNil)
+				So(encodings, ShouldResemble, []string{""})
+			})
+		})
+
+		Convey("When I issue tokens to a server rejecting compressed requests", func() {
+
+			reject = true
+			cl := NewClientWithOptions(ts.URL, OptionRequestCompression(0))
+
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+			So(err, ShouldBeNil)
+			So(token, ShouldEqual, "yeay!")
+
+			_, err = cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should have fallen back to uncompressed requests", func() {
+				So(encodings, ShouldResemble, []string{"gzip", "", ""})
+			})
+		})
+	})
+}
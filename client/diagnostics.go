@@ -0,0 +1,260 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.aporeto.io/midgard-lib/tokens"
+)
+
+// Diagnostics is the content of the bundle returned by DiagnosticsBundle.
+type Diagnostics struct {
+	Time         time.Time             `json:"time"`
+	UserAgent    string                `json:"userAgent"`
+	URL          string                `json:"url"`
+	DNS          DiagnosticsDNS        `json:"dns"`
+	Connectivity DiagnosticsConnection `json:"connectivity"`
+	TLS          *DiagnosticsTLS       `json:"tls,omitempty"`
+	ClockSkew    *DiagnosticsClockSkew `json:"clockSkew,omitempty"`
+	Token        *DiagnosticsTokenInfo `json:"token,omitempty"`
+}
+
+// DiagnosticsDNS holds the result of the resolution of the midgard host.
+type DiagnosticsDNS struct {
+	Host      string   `json:"host"`
+	Addresses []string `json:"addresses,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// DiagnosticsConnection holds the result of a request sent to midgard.
+type DiagnosticsConnection struct {
+	StatusCode int           `json:"statusCode,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// DiagnosticsTLS holds the certificate chain presented by midgard
+// and the result of its validation against the configured CAs.
+type DiagnosticsTLS struct {
+	Version     uint16                   `json:"version"`
+	Chain       []DiagnosticsCertificate `json:"chain"`
+	VerifyError string                   `json:"verifyError,omitempty"`
+}
+
+// DiagnosticsCertificate describes a certificate of a chain.
+type DiagnosticsCertificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// DiagnosticsClockSkew holds the estimated difference between the
+// clock of midgard and the local one, from the Date header of its
+// response. As the Date header has a resolution of one second, so
+// does the estimation.
+type DiagnosticsClockSkew struct {
+	Skew       time.Duration `json:"skew"`
+	ServerTime time.Time     `json:"serverTime"`
+}
+
+// DiagnosticsTokenInfo holds the redacted description of a token.
+type DiagnosticsTokenInfo struct {
+	Description string `json:"description,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DiagnosticsBundle checks the connectivity to midgard and returns a JSON
+// document that can be attached to support tickets. It contains the DNS
+// resolution of midgard, the result of a request sent to it, the TLS chain
+// it presented validated against the configured CAs, and an estimation of
+// the clock skew. If token is not empty, its redacted description is added.
+// The token itself, the credentials and the headers are never included.
+func (a *Client) DiagnosticsBundle(ctx context.Context, token string) ([]byte, error) {
+
+	d := a.diagnose(ctx, token)
+
+	return json.MarshalIndent(d, "", "  ")
+}
+
+func (a *Client) diagnose(ctx context.Context, token string) *Diagnostics {
+
+	d := &Diagnostics{
+		Time:      time.Now().UTC(),
+		UserAgent: a.config.userAgent(),
+	}
+
+	u, err := url.Parse(a.endpoints.pick())
+	if err != nil {
+		d.URL = "<invalid>"
+		d.Connectivity.Error = err.Error()
+		return d
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	d.URL = u.String()
+	d.DNS.Host = u.Hostname()
+
+	resolver := a.config.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	if addrs, err := resolver.LookupHost(ctx, d.DNS.Host); err != nil {
+		d.DNS.Error = err.Error()
+	} else {
+		d.DNS.Addresses = addrs
+	}
+
+	req, err := http.NewRequest(http.MethodGet, d.URL, nil)
+	if err != nil {
+		d.Connectivity.Error = err.Error()
+		return d
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", d.UserAgent)
+
+	start := time.Now()
+	resp, err := a.currentHTTPClient().Do(req)
+	d.Connectivity.Latency = time.Since(start)
+
+	if err != nil {
+		d.Connectivity.Error = redactSecrets(err, token).Error()
+
+		// The chain is still reported when the
+		// handshake fails, for instance on an
+		// unknown authority.
+		if u.Scheme == "https" {
+			if state, err := a.handshakeTLS(ctx, u); err == nil {
+				d.TLS = a.diagnoseTLS(state, u.Hostname())
+			}
+		}
+	} else {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close() // nolint: errcheck
+
+		d.Connectivity.StatusCode = resp.StatusCode
+		d.TLS = a.diagnoseTLS(resp.TLS, u.Hostname())
+
+		if skew, serverTime, ok := clockSkew(resp.Header, start, start.Add(d.Connectivity.Latency)); ok {
+			d.ClockSkew = &DiagnosticsClockSkew{
+				ServerTime: serverTime.UTC(),
+				Skew:       skew,
+			}
+		}
+	}
+
+	if token != "" {
+		d.Token = &DiagnosticsTokenInfo{}
+		if desc, err := tokens.Format(token, tokens.FormatOptions{Redact: true}); err != nil {
+			d.Token.Error = err.Error()
+		} else {
+			d.Token.Description = desc
+		}
+	}
+
+	return d
+}
+
+// handshakeTLS performs a TLS handshake with the host of the given
+// url without verifying its chain, so it can be reported even if
+// it is not trusted.
+func (a *Client) handshakeTLS(ctx context.Context, u *url.URL) (*tls.ConnectionState, error) {
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint: errcheck
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{}
+	if c := a.currentTLSConfig(); c != nil {
+		tlsConfig = c.Clone()
+	}
+	tlsConfig.ServerName = u.Hostname()
+	tlsConfig.InsecureSkipVerify = true // #nosec: the chain is verified by diagnoseTLS
+	tlsConfig.VerifyPeerCertificate = nil
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+
+	return &state, nil
+}
+
+// diagnoseTLS returns the TLS chain of the given connection
+// state, validated against the configured CAs.
+func (a *Client) diagnoseTLS(state *tls.ConnectionState, host string) *DiagnosticsTLS {
+
+	if state == nil {
+		return nil
+	}
+
+	info := &DiagnosticsTLS{
+		Version: state.Version,
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, DiagnosticsCertificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return info
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+	}
+
+	if tlsConfig := a.currentTLSConfig(); tlsConfig != nil {
+		opts.Roots = tlsConfig.RootCAs
+	}
+
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	if _, err := state.PeerCertificates[0].Verify(opts); err != nil {
+		info.VerifyError = err.Error()
+	}
+
+	return info
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"go.aporeto.io/elemental"
+)
+
+// requestEncoding returns the encoding to use for the request bodies.
+func (a *Client) requestEncoding() elemental.EncodingType {
+
+	if a.config.encoding == elemental.EncodingTypeMSGPACK && atomic.LoadInt32(&a.msgpackUnsupported) == 0 {
+		return elemental.EncodingTypeMSGPACK
+	}
+
+	return elemental.EncodingTypeJSON
+}
+
+// fallbackToJSON returns true if the given response means that
+// midgard does not support the msgpack request that was sent.
+// In that case, the response is closed and json is used for
+// the following requests.
+func (a *Client) fallbackToJSON(resp *http.Response, encoding elemental.EncodingType) bool {
+
+	if encoding != elemental.EncodingTypeMSGPACK || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return false
+	}
+
+	resp.Body.Close() // nolint: errcheck
+
+	if atomic.CompareAndSwapInt32(&a.msgpackUnsupported, 0, 1) {
+		a.config.log().Warn("Midgard does not support msgpack, falling back to json")
+	}
+
+	return true
+}
+
+// newEncodedRequest returns a new request with the given body
+// encoded with the given encoding.
+func newEncodedRequest(method string, url string, encoding elemental.EncodingType, body []byte) (*http.Request, error) {
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", string(encoding))
+	req.Header.Set("Accept", string(encoding))
+
+	return req, nil
+}
+
+// responseEncoding returns the encoding of the given response body.
+func responseEncoding(resp *http.Response) elemental.EncodingType {
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), string(elemental.EncodingTypeMSGPACK)) {
+		return elemental.EncodingTypeMSGPACK
+	}
+
+	return elemental.EncodingTypeJSON
+}
+
+// decodeResponse decodes the body of the given response into dest.
+func decodeResponse(resp *http.Response, dest interface{}) error {
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return elemental.Decode(responseEncoding(resp), data, dest)
+}
+
+// decodeResponseErrors decodes the given body of the given response
+// as a list of elemental errors.
+func decodeResponseErrors(resp *http.Response, data []byte) (elemental.Errors, error) {
+
+	if responseEncoding(resp) == elemental.EncodingTypeJSON {
+		return elemental.DecodeErrors(data)
+	}
+
+	errs := []elemental.Error{}
+	if err := elemental.Decode(elemental.EncodingTypeMSGPACK, data, &errs); err != nil {
+		return nil, err
+	}
+
+	return elemental.Errors(errs), nil
+}
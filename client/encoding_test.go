@@ -0,0 +1,162 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestClient_Encoding(t *testing.T) {
+
+	Convey("Calling New with OptionEncoding and an unsupported encoding should return an error", t, func() {
+		cl, err := New("https://midgard.com", OptionEncoding("application/xml"))
+		So(cl, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "unsupported encoding 'application/xml'")
+	})
+
+	Convey("Given I have a server supporting msgpack and a client using it", t, func() {
+
+		var msgpackRequests int32
+		var failing int32
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			encoding := elemental.EncodingType(r.Header.Get("Content-Type"))
+			if encoding == elemental.EncodingTypeMSGPACK {
+				atomic.AddInt32(&msgpackRequests, 1)
+			}
+
+			body, _ := ioutil.ReadAll(r.Body)
+
+			var out interface{}
+			switch r.URL.Path {
+
+			case "/issue":
+				issue := gaia.NewIssue()
+				if err := elemental.Decode(encoding, body, issue); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				issue.Token = "token-for-" + string(issue.Realm)
+				out = issue
+
+			case "/authn":
+				authn := gaia.NewAuthn()
+				if err := elemental.Decode(encoding, body, authn); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				authn.Claims = &types.MidgardClaims{Data: map[string]string{"token": authn.Token}}
+				out = authn
+			}
+
+			status := http.StatusOK
+			if atomic.LoadInt32(&failing) == 1 {
+				status = http.StatusForbidden
+				out = []elemental.Error{elemental.NewError("Forbidden", "nope", "midgard", http.StatusForbidden)}
+			}
+
+			data, _ := elemental.Encode(encoding, out)
+			w.Header().Set("Content-Type", string(encoding))
+			w.WriteHeader(status)
+			w.Write(data) // nolint: errcheck
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionEncoding(elemental.EncodingTypeMSGPACK))
+
+		Convey("When I issue a token", func() {
+
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the request and the response should use msgpack", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "token-for-"+string(gaia.IssueRealmVince))
+				So(atomic.LoadInt32(&msgpackRequests), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I authentify a token", func() {
+
+			claims, err := cl.Authentify(context.Background(), "abc")
+
+			Convey("Then the request and the response should use msgpack", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldResemble, []string{"@auth:token=abc"})
+				So(atomic.LoadInt32(&msgpackRequests), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When midgard returns errors", func() {
+
+			atomic.StoreInt32(&failing, 1)
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the msgpack errors should be decoded", func() {
+				var errs elemental.Errors
+				So(errors.As(err, &errs), ShouldBeTrue)
+				So(errs.Code(), ShouldEqual, http.StatusForbidden)
+				So(errors.Is(err, ErrForbidden{}), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given I have a server not supporting msgpack and a client using it", t, func() {
+
+		var msgpackRequests int32
+		var jsonRequests int32
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if r.Header.Get("Content-Type") == string(elemental.EncodingTypeMSGPACK) {
+				atomic.AddInt32(&msgpackRequests, 1)
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+
+			atomic.AddInt32(&jsonRequests, 1)
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.Write([]byte(`{"token": "yeay!"}`)) // nolint: errcheck
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionEncoding(elemental.EncodingTypeMSGPACK))
+
+		Convey("When I issue two tokens", func() {
+
+			token1, err1 := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+			token2, err2 := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the client should have fallen back to json", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(token1, ShouldEqual, "yeay!")
+				So(token2, ShouldEqual, "yeay!")
+				So(atomic.LoadInt32(&msgpackRequests), ShouldEqual, 1)
+				So(atomic.LoadInt32(&jsonRequests), ShouldEqual, 2)
+			})
+		})
+	})
+}
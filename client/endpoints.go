@@ -0,0 +1,172 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// endpointMinCooldown is the time an endpoint is
+	// considered down after its first failure.
+	endpointMinCooldown = 5 * time.Second
+
+	// endpointMaxCooldown caps the time an endpoint is considered
+	// down. The cooldown doubles on each consecutive failure.
+	endpointMaxCooldown = 5 * time.Minute
+)
+
+// EndpointHealth describes the health of a midgard endpoint.
+type EndpointHealth struct {
+	URL                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	DownUntil           time.Time `json:"downUntil"`
+	LastError           string    `json:"lastError,omitempty"`
+}
+
+type endpoint struct {
+	url       string
+	failures  int
+	downUntil time.Time
+	lastError string
+}
+
+// endpoints tracks the health of the midgard endpoints. Requests are
+// sent to the first healthy endpoint in order, so failover urls are
+// only used while the preferred ones are unreachable.
+type endpoints struct {
+	list []*endpoint
+
+	sync.Mutex
+}
+
+func newEndpoints(urls ...string) *endpoints {
+
+	e := &endpoints{list: make([]*endpoint, len(urls))}
+	for i, u := range urls {
+		e.list[i] = &endpoint{url: u}
+	}
+
+	return e
+}
+
+// pick returns the url of the first healthy endpoint, or
+// of the one that will be healthy first if they are all down.
+func (e *endpoints) pick() string {
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := time.Now()
+	best := e.list[0]
+
+	for _, ep := range e.list {
+
+		if !now.Before(ep.downUntil) {
+			return ep.url
+		}
+
+		if ep.downUntil.Before(best.downUntil) {
+			best = ep
+		}
+	}
+
+	return best.url
+}
+
+// hasHealthy returns true if an endpoint
+// other than the given one is healthy.
+func (e *endpoints) hasHealthy(except string) bool {
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := time.Now()
+	for _, ep := range e.list {
+		if ep.url != except && !now.Before(ep.downUntil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markDown records a failure of the endpoint with the given url.
+func (e *endpoints) markDown(url string, err error) {
+
+	e.Lock()
+	defer e.Unlock()
+
+	for _, ep := range e.list {
+
+		if ep.url != url {
+			continue
+		}
+
+		cooldown := endpointMinCooldown
+		for i := 0; i < ep.failures && cooldown < endpointMaxCooldown; i++ {
+			cooldown *= 2
+		}
+		if cooldown > endpointMaxCooldown {
+			cooldown = endpointMaxCooldown
+		}
+
+		ep.failures++
+		ep.downUntil = time.Now().Add(cooldown)
+		ep.lastError = err.Error()
+	}
+}
+
+// markUp records a success of the endpoint with the given url.
+func (e *endpoints) markUp(url string) {
+
+	e.Lock()
+	defer e.Unlock()
+
+	for _, ep := range e.list {
+		if ep.url == url {
+			ep.failures = 0
+			ep.downUntil = time.Time{}
+			ep.lastError = ""
+		}
+	}
+}
+
+// health returns the health of the endpoints.
+func (e *endpoints) health() []EndpointHealth {
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := time.Now()
+	out := make([]EndpointHealth, len(e.list))
+	for i, ep := range e.list {
+		out[i] = EndpointHealth{
+			URL:                 ep.url,
+			Healthy:             !now.Before(ep.downUntil),
+			ConsecutiveFailures: ep.failures,
+			DownUntil:           ep.downUntil,
+			LastError:           ep.lastError,
+		}
+	}
+
+	return out
+}
+
+// EndpointsHealth returns the health of the midgard url and of the
+// failover urls given with OptionFailoverURLs, in order of preference.
+func (a *Client) EndpointsHealth() []EndpointHealth {
+
+	return a.endpoints.health()
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_endpoints(t *testing.T) {
+
+	Convey("Given I have two endpoints", t, func() {
+
+		e := newEndpoints("a", "b")
+
+		Convey("Then the first one should be picked", func() {
+			So(e.pick(), ShouldEqual, "a")
+			So(e.hasHealthy("a"), ShouldBeTrue)
+		})
+
+		Convey("When the first one fails", func() {
+
+			e.markDown("a", fmt.Errorf("boom"))
+
+			Convey("Then the second one should be picked", func() {
+				So(e.pick(), ShouldEqual, "b")
+				So(e.hasHealthy("b"), ShouldBeFalse)
+			})
+
+			Convey("Then the health should be correct", func() {
+				h := e.health()
+				So(h[0].Healthy, ShouldBeFalse)
+				So(h[0].ConsecutiveFailures, ShouldEqual, 1)
+				So(h[0].LastError, ShouldEqual, "boom")
+				So(h[0].DownUntil, ShouldHappenWithin, time.Second, time.Now().Add(endpointMinCooldown))
+				So(h[1].Healthy, ShouldBeTrue)
+			})
+
+			Convey("When it fails again", func() {
+
+				e.markDown("a", fmt.Errorf("boom"))
+
+				Convey("Then the cooldown should have doubled", func() {
+					So(e.health()[0].DownUntil, ShouldHappenWithin, time.Second, time.Now().Add(2*endpointMinCooldown))
+				})
+			})
+
+			Convey("When it fails many times", func() {
+
+				for i := 0; i < 100; i++ {
+					e.markDown("a", fmt.Errorf("boom"))
+				}
+
+				Convey("Then the cooldown should be capped", func() {
+					So(e.health()[0].DownUntil, ShouldHappenWithin, time.Second, time.Now().Add(endpointMaxCooldown))
+				})
+			})
+
+			Convey("When the second one fails too", func() {
+
+				e.markDown("b", fmt.Errorf("boom"))
+
+				Convey("Then the one healthy first should be picked", func() {
+					So(e.pick(), ShouldEqual, "a")
+				})
+			})
+
+			Convey("When the first one succeeds again", func() {
+
+				e.markUp("a")
+
+				Convey("Then it should be picked again", func() {
+					So(e.pick(), ShouldEqual, "a")
+					So(e.health()[0], ShouldResemble, EndpointHealth{URL: "a", Healthy: true})
+				})
+			})
+		})
+	})
+}
+
+func TestClient_OptionFailoverURLs(t *testing.T) {
+
+	Convey("Calling New with OptionFailoverURLs and an invalid url should return an error", t, func() {
+		cl, err := New("https://a.com", OptionFailoverURLs("https://b.com", "b.com"))
+		So(cl, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid midgard url 'b.com': scheme must be http or https")
+	})
+
+	Convey("Given I have an unreachable midgard and a failover one", t, func() {
+
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		down.Close()
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(down.URL, OptionFailoverURLs(ts.URL))
+
+		Convey("When I issue a token", func() {
+
+			start := time.Now()
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then it should have failed over without waiting", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(time.Since(start), ShouldBeLessThan, legacyRetryInterval)
+			})
+
+			Convey("Then the health of the endpoints should be correct", func() {
+				h := cl.EndpointsHealth()
+				So(len(h), ShouldEqual, 2)
+				So(h[0].URL, ShouldEqual, down.URL)
+				So(h[0].Healthy, ShouldBeFalse)
+				So(h[0].LastError, ShouldNotBeEmpty)
+				So(h[1].Healthy, ShouldBeTrue)
+			})
+
+			Convey("When I issue another token", func() {
+
+				_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+				Convey("Then it should have been sent to the failover directly", func() {
+					So(err, ShouldBeNil)
+					So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+					So(cl.EndpointsHealth()[0].ConsecutiveFailures, ShouldEqual, 1)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import "net/http"
+
+// The error types below classify the errors returned when issuing tokens
+// and by Authentify. They wrap the underlying error, which is still
+// available with errors.As, redacted if its message contained a secret,
+// and keep its message. The class of an error can be checked with
+// errors.Is, like errors.Is(err, ErrUnauthorized{}).
+
+// ErrUnauthorized is returned when midgard rejects the credentials
+// or the token with a 401.
+type ErrUnauthorized struct {
+	Err error
+}
+
+func (e ErrUnauthorized) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e ErrUnauthorized) Unwrap() error { return e.Err }
+
+// Is returns true if the target is an ErrUnauthorized.
+func (e ErrUnauthorized) Is(target error) bool {
+	_, ok := target.(ErrUnauthorized)
+	return ok
+}
+
+// ErrForbidden is returned when midgard denies the request with a 403.
+type ErrForbidden struct {
+	Err error
+}
+
+func (e ErrForbidden) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e ErrForbidden) Unwrap() error { return e.Err }
+
+// Is returns true if the target is an ErrForbidden.
+func (e ErrForbidden) Is(target error) bool {
+	_, ok := target.(ErrForbidden)
+	return ok
+}
+
+// ErrUnreachable is returned when midgard could not be reached, or
+// only responded with server errors until the retries were exhausted
+// or the context was done.
+type ErrUnreachable struct {
+	Err error
+}
+
+func (e ErrUnreachable) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e ErrUnreachable) Unwrap() error { return e.Err }
+
+// Is returns true if the target is an ErrUnreachable.
+func (e ErrUnreachable) Is(target error) bool {
+	_, ok := target.(ErrUnreachable)
+	return ok
+}
+
+// ErrBadResponse is returned when the response of midgard cannot be
+// decoded, like an HTML page returned by a proxy instead of the errors
+// of midgard.
+type ErrBadResponse struct {
+	Err error
+}
+
+func (e ErrBadResponse) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e ErrBadResponse) Unwrap() error { return e.Err }
+
+// Is returns true if the target is an ErrBadResponse.
+func (e ErrBadResponse) Is(target error) bool {
+	_, ok := target.(ErrBadResponse)
+	return ok
+}
+
+// classifyStatusError wraps the given error returned for a response
+// with the given status code in the matching error type. Errors that
+// do not belong to any class are returned as is.
+func classifyStatusError(statusCode int, err error) error {
+
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return ErrUnauthorized{Err: err}
+	case statusCode == http.StatusForbidden:
+		return ErrForbidden{Err: err}
+	case statusCode >= 500:
+		return ErrUnreachable{Err: err}
+	}
+
+	if _, ok := err.(*ResponseError); ok {
+		return ErrBadResponse{Err: err}
+	}
+
+	return err
+}
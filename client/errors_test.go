@@ -0,0 +1,179 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/elemental"
+)
+
+func TestClient_TypedErrors(t *testing.T) {
+
+	Convey("Given I have a server returning the status I want", t, func() {
+
+		var status int
+		var body string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond}))
+
+		Convey("When midgard rejects the credentials", func() {
+
+			status = http.StatusUnauthorized
+			body = `[{"code": 401, "title": "Unauthorized", "description": "bad password", "subject": "midgard"}]`
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "hunter2", "", time.Minute)
+
+			Convey("Then the error should be an ErrUnauthorized wrapping the midgard errors", func() {
+				So(errors.Is(err, ErrUnauthorized{}), ShouldBeTrue)
+				So(errors.Is(err, ErrForbidden{}), ShouldBeFalse)
+
+				var errs elemental.Errors
+				So(errors.As(err, &errs), ShouldBeTrue)
+				So(errs.Code(), ShouldEqual, http.StatusUnauthorized)
+				So(err.Error(), ShouldEqual, errs.Error())
+			})
+		})
+
+		Convey("When midgard denies the request", func() {
+
+			status = http.StatusForbidden
+			body = `[{"code": 403, "title": "Forbidden", "description": "nope", "subject": "midgard"}]`
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "hunter2", "", time.Minute)
+
+			Convey("Then the error should be an ErrForbidden", func() {
+				So(errors.Is(err, ErrForbidden{}), ShouldBeTrue)
+			})
+		})
+
+		Convey("When midgard returns another error", func() {
+
+			status = http.StatusBadRequest
+			body = `[{"code": 400, "title": "Bad Request", "description": "nope", "subject": "midgard"}]`
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "hunter2", "", time.Minute)
+
+			Convey("Then the error should be returned as is", func() {
+				_, ok := err.(elemental.Errors)
+				So(ok, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a proxy returns a page that cannot be decoded", func() {
+
+			status = http.StatusNotFound
+			body = `<html>not found</html>`
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "hunter2", "", time.Minute)
+
+			Convey("Then the error should be an ErrBadResponse", func() {
+				So(errors.Is(err, ErrBadResponse{}), ShouldBeTrue)
+
+				var rerr *ResponseError
+				So(errors.As(err, &rerr), ShouldBeTrue)
+				So(rerr.StatusCode, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When midgard returns a token that cannot be decoded", func() {
+
+			status = http.StatusOK
+			body = `not json`
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "hunter2", "", time.Minute)
+
+			Convey("Then the error should be an ErrBadResponse", func() {
+				So(errors.Is(err, ErrBadResponse{}), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I authentify a token that midgard rejects", func() {
+
+			status = http.StatusUnauthorized
+
+			_, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the error should be an ErrUnauthorized", func() {
+				So(errors.Is(err, ErrUnauthorized{}), ShouldBeTrue)
+				So(err.Error(), ShouldContainSubstring, "Authentication rejected with error: 401 Unauthorized")
+			})
+		})
+
+		Convey("When I authentify a token and midgard rate limits it", func() {
+
+			status = http.StatusTooManyRequests
+
+			_, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the error should not be an ErrUnauthorized", func() {
+				So(err, ShouldNotBeNil)
+				So(errors.Is(err, ErrUnauthorized{}), ShouldBeFalse)
+				So(err.Error(), ShouldContainSubstring, "429 Too Many Requests")
+			})
+		})
+
+		Convey("When I authentify a token and midgard fails", func() {
+
+			status = http.StatusServiceUnavailable
+
+			_, err := cl.Authentify(context.Background(), "token")
+
+			Convey("Then the error should be an ErrUnreachable", func() {
+				So(errors.Is(err, ErrUnreachable{}), ShouldBeTrue)
+				So(errors.Is(err, ErrUnauthorized{}), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given I have a server that is not reachable", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond}))
+
+		Convey("When I call IssueFromVince", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "hunter2", "", time.Minute)
+
+			Convey("Then the error should be an ErrUnreachable", func() {
+				So(errors.Is(err, ErrUnreachable{}), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I call Authentify and the context is done", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, err := NewClient(ts.URL).Authentify(ctx, "token")
+
+			Convey("Then the error should be an ErrUnreachable", func() {
+				So(errors.Is(err, ErrUnreachable{}), ShouldBeTrue)
+				So(err.Error(), ShouldContainSubstring, "connection refused")
+			})
+		})
+	})
+}
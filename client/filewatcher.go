@@ -0,0 +1,128 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+
+	"go.aporeto.io/midgard-lib/logger"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+)
+
+// A FileWatcher polls a file and calls a function when its content
+// changes. Changes are detected by comparing the checksum of the
+// content, so they are seen even on filesystems that do not support
+// change notifications or do not update modification times, like
+// some container filesystems or network mounts. This can be used to
+// propagate the rotation of credential or token files.
+type FileWatcher struct {
+	path     string
+	interval time.Duration
+	onChange func([]byte)
+	checksum [32]byte
+	logger   logger.Logger
+}
+
+// NewFileWatcher returns a new FileWatcher that will check the file at the
+// given path every interval and call onChange with the new content when it
+// changes. The current content of the file is considered as already known.
+func NewFileWatcher(path string, interval time.Duration, onChange func([]byte)) *FileWatcher {
+
+	w := newFileWatcher(path, interval, onChange)
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		w.checksum = sha256.Sum256(data)
+	}
+
+	return w
+}
+
+// NewFileWatcherWithContent works like NewFileWatcher, but the given content,
+// usually the one already loaded by the caller, is considered as the known
+// one. Unlike with NewFileWatcher, a change made after the caller read the
+// file cannot be missed.
+func NewFileWatcherWithContent(path string, interval time.Duration, content []byte, onChange func([]byte)) *FileWatcher {
+
+	w := newFileWatcher(path, interval, onChange)
+	w.checksum = sha256.Sum256(content)
+
+	return w
+}
+
+func newFileWatcher(path string, interval time.Duration, onChange func([]byte)) *FileWatcher {
+
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+
+	if onChange == nil {
+		panic("onChange cannot be nil")
+	}
+
+	return &FileWatcher{
+		path:     path,
+		interval: interval,
+		onChange: onChange,
+		logger:   zaplogger.New(nil),
+	}
+}
+
+// SetLogger sets the Logger used to report the errors reading
+// the file. The default writes to the global zap logger. It
+// must be called before Run.
+func (w *FileWatcher) SetLogger(l logger.Logger) {
+
+	if l == nil {
+		panic("logger cannot be nil")
+	}
+
+	w.logger = l
+}
+
+// Run watches the file until the given context is done.
+func (w *FileWatcher) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ticker.C:
+			w.check()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check calls onChange if the content of the file changed.
+func (w *FileWatcher) check() {
+
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		w.logger.Debug("Unable to read watched file", logger.F("path", w.path), logger.Err(err))
+		return
+	}
+
+	checksum := sha256.Sum256(data)
+	if checksum == w.checksum {
+		return
+	}
+
+	w.checksum = checksum
+	w.onChange(data)
+}
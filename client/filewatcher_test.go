@@ -0,0 +1,114 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileWatcher(t *testing.T) {
+
+	Convey("Calling NewFileWatcher with invalid values should panic", t, func() {
+		So(func() { NewFileWatcher("path", 0, func([]byte) {}) }, ShouldPanicWith, "interval must be greater than 0")
+		So(func() { NewFileWatcher("path", time.Second, nil) }, ShouldPanicWith, "onChange cannot be nil")
+		So(func() { NewFileWatcher("path", time.Second, func([]byte) {}).SetLogger(nil) }, ShouldPanicWith, "logger cannot be nil")
+		So(func() { NewFileWatcherWithContent("path", 0, nil, func([]byte) {}) }, ShouldPanicWith, "interval must be greater than 0")
+	})
+
+	Convey("Given I have a file changed after its content was loaded", t, func() {
+
+		dir, err := ioutil.TempDir("", "filewatcher")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "token")
+		So(ioutil.WriteFile(path, []byte("token-2"), 0600), ShouldBeNil)
+
+		changes := make(chan []byte, 10)
+		w := NewFileWatcherWithContent(path, 10*time.Millisecond, []byte("token-1"), func(data []byte) { changes <- data })
+
+		Convey("When I check the file", func() {
+
+			w.check()
+
+			Convey("Then onChange should be called with the new content", func() {
+				So(len(changes), ShouldEqual, 1)
+				So(string(<-changes), ShouldEqual, "token-2")
+			})
+		})
+	})
+
+	Convey("Given I have a watched file", t, func() {
+
+		dir, err := ioutil.TempDir("", "filewatcher")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "token")
+		So(ioutil.WriteFile(path, []byte("token-1"), 0600), ShouldBeNil)
+		info, _ := os.Stat(path)
+
+		changes := make(chan []byte, 10)
+		w := NewFileWatcher(path, 10*time.Millisecond, func(data []byte) { changes <- data })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go w.Run(ctx)
+
+		Convey("When the file does not change", func() {
+
+			time.Sleep(50 * time.Millisecond)
+
+			Convey("Then onChange should not be called", func() {
+				So(len(changes), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the content changes without changing size nor modification time", func() {
+
+			So(ioutil.WriteFile(path, []byte("token-2"), 0600), ShouldBeNil)
+			So(os.Chtimes(path, info.ModTime(), info.ModTime()), ShouldBeNil)
+
+			Convey("Then onChange should be called with the new content", func() {
+				select {
+				case data := <-changes:
+					So(string(data), ShouldEqual, "token-2")
+				case <-time.After(time.Second):
+					So("no change detected", ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("When the file is temporarily removed", func() {
+
+			So(os.Remove(path), ShouldBeNil)
+			time.Sleep(30 * time.Millisecond)
+			So(ioutil.WriteFile(path, []byte("token-3"), 0600), ShouldBeNil)
+
+			Convey("Then onChange should be called once it is back", func() {
+				select {
+				case data := <-changes:
+					So(string(data), ShouldEqual, "token-3")
+				case <-time.After(time.Second):
+					So("no change detected", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrMaxInflightReached is returned when a request could not be
+// sent because the maximum number of concurrent in-flight requests
+// set by OptionMaxInflight was reached for longer than the queue
+// timeout.
+var ErrMaxInflightReached = errors.New("maximum number of in-flight requests reached")
+
+// acquireInflight waits for an in-flight slot to be available.
+func (a *Client) acquireInflight(ctx context.Context) error {
+
+	if a.inflight == nil {
+		return nil
+	}
+
+	select {
+	case a.inflight <- struct{}{}:
+		return nil
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if a.config.inflightQueueTimeout > 0 {
+		timer := time.NewTimer(a.config.inflightQueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case a.inflight <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrMaxInflightReached
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseInflight releases an in-flight slot.
+func (a *Client) releaseInflight() {
+
+	if a.inflight == nil {
+		return
+	}
+
+	<-a.inflight
+}
+
+// inflightBody releases the in-flight slot of a
+// request when its response body is closed.
+type inflightBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *inflightBody) Close() error {
+
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
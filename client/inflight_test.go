@@ -0,0 +1,127 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_MaxInflight(t *testing.T) {
+
+	Convey("Calling OptionMaxInflight with an invalid value should make New return an error", t, func() {
+		So(optionError(OptionMaxInflight(0, time.Second)), ShouldEqual, "max inflight must be greater than 0")
+	})
+
+	Convey("Given I have a client limited to 1 inflight request and a slow server", t, func() {
+
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+		defer close(release)
+
+		cl := NewClientWithOptions(ts.URL, OptionMaxInflight(1, 50*time.Millisecond))
+		clNoTimeout := NewClientWithOptions(ts.URL, OptionMaxInflight(1, 0))
+
+		go cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)          // nolint: errcheck
+		go clNoTimeout.IssueFromVince(context.Background(), "account", "password", "", time.Minute) // nolint: errcheck
+
+		// Wait for the first requests to hold the slots.
+		for len(cl.inflight) == 0 || len(clNoTimeout.inflight) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		Convey("When I send another request", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then err should be ErrMaxInflightReached", func() {
+				So(err, ShouldEqual, ErrMaxInflightReached)
+			})
+		})
+
+		Convey("When I send another request with a context that expires first", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := clNoTimeout.IssueFromVince(ctx, "account", "password", "", time.Minute)
+
+			Convey("Then err should be the context error", func() {
+				So(err, ShouldNotBeNil)
+				So(err, ShouldNotEqual, ErrMaxInflightReached)
+			})
+		})
+	})
+
+	Convey("Given I have a client limited to 1 inflight request and a server sending a slow body", t, func() {
+
+		sent := make(chan struct{})
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"token": `)
+			w.(http.Flusher).Flush()
+			close(sent)
+			<-release
+			fmt.Fprintln(w, `"yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionMaxInflight(1, 50*time.Millisecond))
+
+		done := make(chan error)
+		go func() {
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+			done <- err
+		}()
+
+		<-sent
+		time.Sleep(20 * time.Millisecond)
+
+		Convey("When I send another request while the first body is read", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			close(release)
+			ferr := <-done
+
+			Convey("Then err should be ErrMaxInflightReached", func() {
+				So(err, ShouldEqual, ErrMaxInflightReached)
+			})
+
+			Convey("Then the slot should be released once the first body is closed", func() {
+				So(ferr, ShouldBeNil)
+				So(len(cl.inflight), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given I have a client without inflight limit", t, func() {
+
+		cl := NewClientWithOptions("http://com.com")
+
+		Convey("Then acquiring a slot should always work", func() {
+			So(cl.inflight, ShouldBeNil)
+			So(cl.acquireInflight(context.Background()), ShouldBeNil)
+			cl.releaseInflight()
+		})
+	})
+}
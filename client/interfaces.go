@@ -0,0 +1,80 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/midgard-lib/ldaputils"
+)
+
+// An Authenticator authentifies tokens.
+type Authenticator interface {
+	Authentify(ctx context.Context, token string) ([]string, error)
+}
+
+// An Issuer issues tokens from the various midgard realms.
+type Issuer interface {
+	IssueFromGoogle(ctx context.Context, googleJWT string, validity time.Duration, options ...Option) (string, error)
+	IssueFromCertificate(ctx context.Context, validity time.Duration, options ...Option) (string, error)
+	IssueFromLDAP(ctx context.Context, info *ldaputils.LDAPInfo, namespace string, provider string, validity time.Duration, options ...Option) (string, error)
+	IssueFromVince(ctx context.Context, account string, password string, otp string, validity time.Duration, options ...Option) (string, error)
+	IssueFromAporetoIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+	IssueFromAWSSecurityToken(ctx context.Context, accessKeyID, secretAccessKey, token string, validity time.Duration, options ...Option) (string, error)
+	IssueFromGCPIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+	IssueFromOIDCStep1(ctx context.Context, namespace string, provider string, redirectURL string) (string, error)
+	IssueFromOIDCStep2(ctx context.Context, code string, state string, validity time.Duration, options ...Option) (string, error)
+	IssueFromSAMLStep1(ctx context.Context, namespace string, provider string, redirectURL string) (string, error)
+	IssueFromSAMLStep2(ctx context.Context, response string, state string, validity time.Duration, options ...Option) (string, error)
+	IssueFromAzureIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+	IssueFromPCIdentityToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+}
+
+// An AuthenticatorIssuer is both an Authenticator and an Issuer.
+// It is implemented by Client, and can be used by consumers
+// to replace the Client by a mock in their tests.
+type AuthenticatorIssuer interface {
+	Authenticator
+	Issuer
+}
+
+// An ExtendedIssuer is an Issuer that also supports the realms
+// and flows added after Issuer was defined. Issuer is left
+// unchanged so its existing implementations keep compiling.
+// It is implemented by Client and by the mock Client.
+type ExtendedIssuer interface {
+	Issuer
+	IssueFromOIDCStep1WithStore(ctx context.Context, store OIDCStateStore, namespace string, provider string, redirectURL string) (string, error)
+	IssueFromOIDCStep2WithStore(ctx context.Context, store OIDCStateStore, code string, state string, validity time.Duration, options ...Option) (string, OIDCState, error)
+	RenewToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+	Issue(ctx context.Context, issue *gaia.Issue, options ...Option) (string, error)
+	IssueFromAWSIAMRole(ctx context.Context, region string, validity time.Duration, options ...Option) (string, error)
+	IssueFromKubernetesServiceAccountToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+	IssueFromSPIFFEX509SVID(ctx context.Context, svid tls.Certificate, validity time.Duration, options ...Option) (string, error)
+	IssueFromSPIFFEJWTSVID(ctx context.Context, svid string, validity time.Duration, options ...Option) (string, error)
+	IssueFromGithubActionsOIDC(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error)
+	IssueFromOAuth2ClientCredentials(ctx context.Context, tokenURL string, clientID string, clientSecret string, scopes []string, validity time.Duration, options ...Option) (string, error)
+	IssueFromAPIKey(ctx context.Context, key string, validity time.Duration, options ...Option) (string, error)
+	IssueFromKerberos(ctx context.Context, spnegoToken []byte, validity time.Duration, options ...Option) (string, error)
+	IssueFromOIDCDeviceCodeStart(ctx context.Context, namespace string, provider string) (*OIDCDeviceCode, error)
+	IssueFromOIDCDeviceCodePoll(ctx context.Context, code *OIDCDeviceCode, validity time.Duration, options ...Option) (string, error)
+	IssueFromOIDCStep1WithPKCE(ctx context.Context, namespace string, provider string, redirectURL string) (string, string, error)
+	IssueFromSAMLIdPInitiated(ctx context.Context, namespace string, provider string, response string, validity time.Duration, options ...Option) (string, error)
+}
+
+var (
+	_ AuthenticatorIssuer = (*Client)(nil)
+	_ ExtendedIssuer      = (*Client)(nil)
+)
@@ -0,0 +1,73 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+// TokenInfo contains the claims of a token validated by midgard.
+type TokenInfo struct {
+	Realm        string
+	Subject      string
+	Audiences    []string
+	Data         map[string]string
+	ExpiresAt    time.Time
+	Restrictions TokenRestrictions
+}
+
+// Introspect authentifies the given token and returns its claims
+// as a TokenInfo, rather than the flattened tags returned by
+// Authentify. The restrictions are read from the token once
+// midgard has validated it.
+func (a *Client) Introspect(ctx context.Context, token string) (*TokenInfo, error) {
+
+	claims, err := a.authn(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TokenInfo{
+		Realm:   claims.Realm,
+		Subject: claims.Subject,
+		Data:    make(map[string]string, len(claims.Data)),
+	}
+
+	for k, v := range claims.Data {
+		info.Data[k] = v
+	}
+
+	if claims.ExpiresAt != 0 {
+		info.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+
+	c := &restrictedClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, c); err == nil {
+
+		if c.Restrictions != nil {
+			info.Restrictions = *c.Restrictions
+		}
+
+		// Midgard may not return the audience along with the claims.
+		if claims.Audience == "" {
+			claims.Audience = c.Audience
+		}
+	}
+
+	info.Audiences = verify.Audiences(claims.Audience)
+
+	return info, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_Introspect(t *testing.T) {
+
+	Convey("Given I have a server validating tokens", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{
+                "claims": {
+                   "data": {
+                       "commonName": "superadmin",
+                       "organization": "aporeto.com"
+                   },
+                   "exp": 1475083201,
+                   "realm": "certificate",
+                   "sub": "10237207344299343489"
+               }
+            }`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I introspect a restricted token", func() {
+
+			token := makeToken(
+				jwt.MapClaims{
+					"aud": "api,ui",
+					"restrictions": map[string]interface{}{
+						"namespace": "/a/b",
+						"perms":     []string{"@auth:role=viewer"},
+						"networks":  []string{"10.0.0.0/8"},
+					},
+				},
+				jwt.SigningMethodHS256,
+				[]byte("secret"),
+			)
+
+			info, err := cl.Introspect(context.Background(), token)
+
+			Convey("Then I should get the typed claims", func() {
+				So(err, ShouldBeNil)
+				So(info.Realm, ShouldEqual, "certificate")
+				So(info.Subject, ShouldEqual, "10237207344299343489")
+				So(info.Audiences, ShouldResemble, []string{"api", "ui"})
+				So(info.Data, ShouldResemble, map[string]string{"commonName": "superadmin", "organization": "aporeto.com"})
+				So(info.ExpiresAt, ShouldEqual, time.Unix(1475083201, 0))
+				So(info.Restrictions, ShouldResemble, TokenRestrictions{
+					Namespace:   "/a/b",
+					Permissions: []string{"@auth:role=viewer"},
+					Networks:    []string{"10.0.0.0/8"},
+				})
+			})
+		})
+
+		Convey("When I introspect an opaque token", func() {
+
+			info, err := cl.Introspect(context.Background(), "thetoken")
+
+			Convey("Then I should get the typed claims without restrictions", func() {
+				So(err, ShouldBeNil)
+				So(info.Realm, ShouldEqual, "certificate")
+				So(info.Restrictions, ShouldResemble, TokenRestrictions{})
+				So(info.Audiences, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a server rejecting tokens", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I introspect a token", func() {
+
+			info, err := cl.Introspect(context.Background(), "thetoken")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(info, ShouldBeNil)
+			})
+		})
+	})
+}
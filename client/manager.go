@@ -18,9 +18,8 @@ import (
 	"os"
 	"time"
 
-	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
-	"go.uber.org/zap"
+	"go.aporeto.io/midgard-lib/logger"
 )
 
 // A TokenManager issues an renew tokens periodically.
@@ -63,21 +62,21 @@ func (m *TokenManager) Run(ctx context.Context, tokenCh chan string) {
 				break
 			}
 
-			span, subctx := opentracing.StartSpanFromContext(ctx, "midgardlib.tokenmanager.renew")
+			span, subctx := m.client.startSpan(ctx, "midgardlib.tokenmanager.renew")
 
 			token, err := m.Issue(subctx)
 			if err != nil {
 				span.SetTag("error", true)
 				span.LogFields(log.Error(err))
 				span.Finish()
-				zap.L().Error("Unable to renew Midgard token", zap.Error(err))
+				m.client.config.log().Error("Unable to renew Midgard token", logger.Err(err))
 				break
 			}
 
 			tokenCh <- token
 
 			nextRefresh = now.Add(m.validity / 2)
-			zap.L().Info("Midgard token renewed")
+			m.client.config.log().Info("Midgard token renewed")
 			span.Finish()
 
 		case <-ctx.Done():
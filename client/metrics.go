@@ -0,0 +1,67 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"time"
+
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+// ClientMetrics receives the measurements of the requests sent by the
+// client to midgard. It can be implemented on top of any metrics system,
+// for instance using prometheus histograms and counters labeled by realm.
+// The methods are called synchronously and must be safe for concurrent use.
+type ClientMetrics interface {
+
+	// ObserveAuthentify is called after each authentication request with
+	// the realm of the token, the status code of the response, or 0 if no
+	// response was received, and the time spent waiting for it. Claims
+	// served from the cache set by OptionAuthentifyCache are not observed.
+	ObserveAuthentify(realm string, statusCode int, duration time.Duration)
+
+	// ObserveIssue is called after each issue request with the requested
+	// realm, the status code of the response, or 0 if no response was
+	// received, and the time spent waiting for it.
+	ObserveIssue(realm string, statusCode int, duration time.Duration)
+
+	// ObserveRetry is called each time a request to the given realm
+	// is about to be retried.
+	ObserveRetry(realm string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveAuthentify(string, int, time.Duration) {}
+func (nopMetrics) ObserveIssue(string, int, time.Duration)      {}
+func (nopMetrics) ObserveRetry(string)                          {}
+
+func (o clientOpts) clientMetrics() ClientMetrics {
+
+	if o.metrics == nil {
+		return nopMetrics{}
+	}
+
+	return o.metrics
+}
+
+// realmFromToken returns the realm of the given token,
+// or an empty string if it cannot be decoded.
+func realmFromToken(token string) string {
+
+	c, err := verify.UnsecureClaims(token)
+	if err != nil {
+		return ""
+	}
+
+	return c.Realm
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+type observation struct {
+	operation  string
+	realm      string
+	statusCode int
+}
+
+type recordingMetrics struct {
+	observations []observation
+	sync.Mutex
+}
+
+func (m *recordingMetrics) ObserveAuthentify(realm string, statusCode int, duration time.Duration) {
+	m.Lock()
+	m.observations = append(m.observations, observation{"authentify", realm, statusCode})
+	m.Unlock()
+}
+
+func (m *recordingMetrics) ObserveIssue(realm string, statusCode int, duration time.Duration) {
+	m.Lock()
+	m.observations = append(m.observations, observation{"issue", realm, statusCode})
+	m.Unlock()
+}
+
+func (m *recordingMetrics) ObserveRetry(realm string) {
+	m.Lock()
+	m.observations = append(m.observations, observation{"retry", realm, 0})
+	m.Unlock()
+}
+
+func TestClient_Metrics(t *testing.T) {
+
+	Convey("Given I have a client with metrics and a server failing once", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.URL.Path == "/authn" {
+				fmt.Fprintln(w, `{"claims": {"realm": "vince", "sub": "subject"}}`)
+				return
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		m := &recordingMetrics{}
+		cl := NewClientWithOptions(
+			ts.URL,
+			OptionMetrics(m),
+			OptionRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+		)
+
+		Convey("When I issue a token", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the retry and the issue should be observed", func() {
+				So(err, ShouldBeNil)
+				So(m.observations, ShouldResemble, []observation{
+					{"retry", "Vince", 0},
+					{"issue", "Vince", http.StatusOK},
+				})
+			})
+		})
+
+		Convey("When I authentify a token", func() {
+
+			token := makeToken(&types.MidgardClaims{Realm: "Vince"}, jwt.SigningMethodHS256, []byte("secret"))
+			_, err := cl.Authentify(context.Background(), token)
+
+			Convey("Then the authentify should be observed with the realm of the token", func() {
+				So(err, ShouldBeNil)
+				So(m.observations, ShouldResemble, []observation{
+					{"retry", "Vince", 0},
+					{"authentify", "Vince", http.StatusOK},
+				})
+			})
+		})
+	})
+
+	Convey("Given I have a client with metrics and an unreachable server", t, func() {
+
+		m := &recordingMetrics{}
+		cl := NewClientWithOptions(
+			"http://127.0.0.1:1",
+			OptionMetrics(m),
+			OptionRetryPolicy(RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond}),
+		)
+
+		Convey("When I authentify an invalid token", func() {
+
+			_, err := cl.Authentify(context.Background(), "not-a-token")
+
+			Convey("Then it should be observed without realm nor status code", func() {
+				So(err, ShouldNotBeNil)
+				So(m.observations, ShouldResemble, []observation{
+					{"authentify", "", 0},
+				})
+			})
+		})
+	})
+
+	Convey("Given I have a client without metrics", t, func() {
+
+		cl := NewClientWithOptions("http://com.com")
+
+		Convey("Then the metrics should be a no-op", func() {
+			So(cl.config.clientMetrics(), ShouldResemble, nopMetrics{})
+		})
+	})
+}
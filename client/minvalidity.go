@@ -0,0 +1,79 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/gaia"
+)
+
+// A ShortValidityError is returned when midgard issues a token whose
+// validity is much shorter than the requested one, as configured with
+// OptionMinValidity. It usually indicates a misconfiguration of the realm.
+type ShortValidityError struct {
+	Realm     string
+	Requested time.Duration
+	Actual    time.Duration
+}
+
+// Error implements the error interface.
+func (e *ShortValidityError) Error() string {
+	return fmt.Sprintf("token issued from realm %s is valid for %s instead of the requested %s", e.Realm, e.Actual, e.Requested)
+}
+
+// checkMinValidity returns a *ShortValidityError if the validity of the
+// given token is shorter than the configured fraction of the validity of
+// the issue request. Tokens that cannot be parsed are not checked.
+func (a *Client) checkMinValidity(issueRequest *gaia.Issue, token string) error {
+
+	if a.config.minValidity == 0 || issueRequest.Validity == "" {
+		return nil
+	}
+
+	requested, err := time.ParseDuration(issueRequest.Validity)
+	if err != nil || requested <= 0 {
+		return nil
+	}
+
+	claims := &jwt.StandardClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, claims); err != nil || claims.ExpiresAt == 0 {
+		return nil
+	}
+
+	// Use the issue time of the token when there is one,
+	// so the check does not depend on the local clock.
+	var actual time.Duration
+	if claims.IssuedAt != 0 {
+		actual = time.Unix(claims.ExpiresAt, 0).Sub(time.Unix(claims.IssuedAt, 0))
+	} else {
+		actual = time.Unix(claims.ExpiresAt, 0).Sub(time.Now().Add(a.ClockSkew()))
+	}
+
+	if float64(actual) >= a.config.minValidity*float64(requested) {
+		return nil
+	}
+
+	e := &ShortValidityError{
+		Realm:     string(issueRequest.Realm),
+		Requested: requested,
+		Actual:    actual,
+	}
+
+	if a.config.shortValidityFunc != nil {
+		a.config.shortValidityFunc(e)
+	}
+
+	return e
+}
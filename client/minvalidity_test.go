@@ -0,0 +1,120 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_MinValidity(t *testing.T) {
+
+	Convey("Calling OptionMinValidity with invalid fractions should make New return an error", t, func() {
+		So(optionError(OptionMinValidity(0, nil)), ShouldEqual, "min validity fraction must be greater than 0 and at most 1")
+		So(optionError(OptionMinValidity(1.1, nil)), ShouldEqual, "min validity fraction must be greater than 0 and at most 1")
+	})
+
+	makeToken := func(validity time.Duration) string {
+		now := time.Now()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(validity).Unix(),
+		}).SignedString([]byte("secret"))
+		if err != nil {
+			panic(err)
+		}
+		return token
+	}
+
+	Convey("Given I have a fake server issuing tokens valid for 5 minutes", t, func() {
+
+		token := makeToken(5 * time.Minute)
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"data": "","realm": "Vince","token": "%s"}`, token)
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var reported *ShortValidityError
+		cl := NewClientWithOptions(ts.URL, OptionMinValidity(0.5, func(e *ShortValidityError) { reported = e }))
+
+		Convey("When I request a token valid for 1 hour", func() {
+
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Hour)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "token issued from realm Vince is valid for 5m0s instead of the requested 1h0m0s")
+				serr, ok := err.(*ShortValidityError)
+				So(ok, ShouldBeTrue)
+				So(serr.Requested, ShouldEqual, time.Hour)
+				So(serr.Actual, ShouldEqual, 5*time.Minute)
+			})
+
+			Convey("Then the callback should have been called", func() {
+				So(reported, ShouldNotBeNil)
+				So(reported.Realm, ShouldEqual, "Vince")
+			})
+		})
+
+		Convey("When I request a token valid for 6 minutes", func() {
+
+			t, err := cl.IssueFromVince(ctx, "account", "password", "", 6*time.Minute)
+
+			Convey("Then it should be accepted", func() {
+				So(err, ShouldBeNil)
+				So(t, ShouldEqual, token)
+				So(reported, ShouldBeNil)
+			})
+		})
+
+		Convey("When I request a token valid for 1 hour without the option", func() {
+
+			t, err := NewClient(ts.URL).IssueFromVince(ctx, "account", "password", "", time.Hour)
+
+			Convey("Then it should be accepted", func() {
+				So(err, ShouldBeNil)
+				So(t, ShouldEqual, token)
+			})
+		})
+	})
+
+	Convey("Given I have a fake server issuing opaque tokens", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"data": "","realm": "vince","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionMinValidity(1, nil))
+
+		Convey("When I request a token", func() {
+
+			t, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Hour)
+
+			Convey("Then it should not be checked", func() {
+				So(err, ShouldBeNil)
+				So(t, ShouldEqual, "yeay!")
+			})
+		})
+	})
+}
@@ -0,0 +1,455 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.aporeto.io/gaia"
+	midgardclient "go.aporeto.io/midgard-lib/client"
+	"go.aporeto.io/midgard-lib/ldaputils"
+)
+
+// A Client is a mock implementation of midgardclient.AuthenticatorIssuer
+// and midgardclient.ExtendedIssuer. Set the function of each method your
+// test needs. Calling a method whose function is not set returns an error.
+// The number of calls to each method is recorded and can be retrieved
+// with Calls.
+type Client struct {
+	AuthentifyFunc                             func(ctx context.Context, token string) ([]string, error)
+	IssueFromGoogleFunc                        func(ctx context.Context, googleJWT string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromCertificateFunc                   func(ctx context.Context, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromLDAPFunc                          func(ctx context.Context, info *ldaputils.LDAPInfo, namespace string, provider string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromVinceFunc                         func(ctx context.Context, account string, password string, otp string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromAporetoIdentityTokenFunc          func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromAWSSecurityTokenFunc              func(ctx context.Context, accessKeyID, secretAccessKey, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromGCPIdentityTokenFunc              func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromOIDCStep1Func                     func(ctx context.Context, namespace string, provider string, redirectURL string) (string, error)
+	IssueFromOIDCStep2Func                     func(ctx context.Context, code string, state string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromSAMLStep1Func                     func(ctx context.Context, namespace string, provider string, redirectURL string) (string, error)
+	IssueFromSAMLStep2Func                     func(ctx context.Context, response string, state string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromAzureIdentityTokenFunc            func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromPCIdentityTokenFunc               func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromOIDCStep1WithStoreFunc            func(ctx context.Context, store midgardclient.OIDCStateStore, namespace string, provider string, redirectURL string) (string, error)
+	IssueFromOIDCStep2WithStoreFunc            func(ctx context.Context, store midgardclient.OIDCStateStore, code string, state string, validity time.Duration, options ...midgardclient.Option) (string, midgardclient.OIDCState, error)
+	RenewTokenFunc                             func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFunc                                  func(ctx context.Context, issue *gaia.Issue, options ...midgardclient.Option) (string, error)
+	IssueFromAWSIAMRoleFunc                    func(ctx context.Context, region string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromKubernetesServiceAccountTokenFunc func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromSPIFFEX509SVIDFunc                func(ctx context.Context, svid tls.Certificate, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromSPIFFEJWTSVIDFunc                 func(ctx context.Context, svid string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromGithubActionsOIDCFunc             func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromOAuth2ClientCredentialsFunc       func(ctx context.Context, tokenURL string, clientID string, clientSecret string, scopes []string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromAPIKeyFunc                        func(ctx context.Context, key string, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromKerberosFunc                      func(ctx context.Context, spnegoToken []byte, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromOIDCDeviceCodeStartFunc           func(ctx context.Context, namespace string, provider string) (*midgardclient.OIDCDeviceCode, error)
+	IssueFromOIDCDeviceCodePollFunc            func(ctx context.Context, code *midgardclient.OIDCDeviceCode, validity time.Duration, options ...midgardclient.Option) (string, error)
+	IssueFromOIDCStep1WithPKCEFunc             func(ctx context.Context, namespace string, provider string, redirectURL string) (string, string, error)
+	IssueFromSAMLIdPInitiatedFunc              func(ctx context.Context, namespace string, provider string, response string, validity time.Duration, options ...midgardclient.Option) (string, error)
+
+	calls map[string]int
+	sync.Mutex
+}
+
+var (
+	_ midgardclient.AuthenticatorIssuer = (*Client)(nil)
+	_ midgardclient.ExtendedIssuer      = (*Client)(nil)
+)
+
+// Calls returns the number of times the given method has been called.
+func (c *Client) Calls(method string) int {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.calls[method]
+}
+
+func (c *Client) record(method string) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+
+	c.calls[method]++
+}
+
+func notMocked(method string) error {
+	return fmt.Errorf("mock: %s is not mocked", method)
+}
+
+// Authentify calls AuthentifyFunc.
+func (c *Client) Authentify(ctx context.Context, token string) ([]string, error) {
+
+	c.record("Authentify")
+
+	if c.AuthentifyFunc == nil {
+		return nil, notMocked("Authentify")
+	}
+
+	return c.AuthentifyFunc(ctx, token)
+}
+
+// IssueFromGoogle calls IssueFromGoogleFunc.
+func (c *Client) IssueFromGoogle(ctx context.Context, googleJWT string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromGoogle")
+
+	if c.IssueFromGoogleFunc == nil {
+		return "", notMocked("IssueFromGoogle")
+	}
+
+	return c.IssueFromGoogleFunc(ctx, googleJWT, validity, options...)
+}
+
+// IssueFromCertificate calls IssueFromCertificateFunc.
+func (c *Client) IssueFromCertificate(ctx context.Context, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromCertificate")
+
+	if c.IssueFromCertificateFunc == nil {
+		return "", notMocked("IssueFromCertificate")
+	}
+
+	return c.IssueFromCertificateFunc(ctx, validity, options...)
+}
+
+// IssueFromLDAP calls IssueFromLDAPFunc.
+func (c *Client) IssueFromLDAP(ctx context.Context, info *ldaputils.LDAPInfo, namespace string, provider string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromLDAP")
+
+	if c.IssueFromLDAPFunc == nil {
+		return "", notMocked("IssueFromLDAP")
+	}
+
+	return c.IssueFromLDAPFunc(ctx, info, namespace, provider, validity, options...)
+}
+
+// IssueFromVince calls IssueFromVinceFunc.
+func (c *Client) IssueFromVince(ctx context.Context, account string, password string, otp string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromVince")
+
+	if c.IssueFromVinceFunc == nil {
+		return "", notMocked("IssueFromVince")
+	}
+
+	return c.IssueFromVinceFunc(ctx, account, password, otp, validity, options...)
+}
+
+// IssueFromAporetoIdentityToken calls IssueFromAporetoIdentityTokenFunc.
+func (c *Client) IssueFromAporetoIdentityToken(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromAporetoIdentityToken")
+
+	if c.IssueFromAporetoIdentityTokenFunc == nil {
+		return "", notMocked("IssueFromAporetoIdentityToken")
+	}
+
+	return c.IssueFromAporetoIdentityTokenFunc(ctx, token, validity, options...)
+}
+
+// IssueFromAWSSecurityToken calls IssueFromAWSSecurityTokenFunc.
+func (c *Client) IssueFromAWSSecurityToken(ctx context.Context, accessKeyID, secretAccessKey, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromAWSSecurityToken")
+
+	if c.IssueFromAWSSecurityTokenFunc == nil {
+		return "", notMocked("IssueFromAWSSecurityToken")
+	}
+
+	return c.IssueFromAWSSecurityTokenFunc(ctx, accessKeyID, secretAccessKey, token, validity, options...)
+}
+
+// IssueFromGCPIdentityToken calls IssueFromGCPIdentityTokenFunc.
+func (c *Client) IssueFromGCPIdentityToken(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromGCPIdentityToken")
+
+	if c.IssueFromGCPIdentityTokenFunc == nil {
+		return "", notMocked("IssueFromGCPIdentityToken")
+	}
+
+	return c.IssueFromGCPIdentityTokenFunc(ctx, token, validity, options...)
+}
+
+// IssueFromOIDCStep1 calls IssueFromOIDCStep1Func.
+func (c *Client) IssueFromOIDCStep1(ctx context.Context, namespace string, provider string, redirectURL string) (string, error) {
+
+	c.record("IssueFromOIDCStep1")
+
+	if c.IssueFromOIDCStep1Func == nil {
+		return "", notMocked("IssueFromOIDCStep1")
+	}
+
+	return c.IssueFromOIDCStep1Func(ctx, namespace, provider, redirectURL)
+}
+
+// IssueFromOIDCStep2 calls IssueFromOIDCStep2Func.
+func (c *Client) IssueFromOIDCStep2(ctx context.Context, code string, state string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromOIDCStep2")
+
+	if c.IssueFromOIDCStep2Func == nil {
+		return "", notMocked("IssueFromOIDCStep2")
+	}
+
+	return c.IssueFromOIDCStep2Func(ctx, code, state, validity, options...)
+}
+
+// IssueFromSAMLStep1 calls IssueFromSAMLStep1Func.
+func (c *Client) IssueFromSAMLStep1(ctx context.Context, namespace string, provider string, redirectURL string) (string, error) {
+
+	c.record("IssueFromSAMLStep1")
+
+	if c.IssueFromSAMLStep1Func == nil {
+		return "", notMocked("IssueFromSAMLStep1")
+	}
+
+	return c.IssueFromSAMLStep1Func(ctx, namespace, provider, redirectURL)
+}
+
+// IssueFromSAMLStep2 calls IssueFromSAMLStep2Func.
+func (c *Client) IssueFromSAMLStep2(ctx context.Context, response string, state string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromSAMLStep2")
+
+	if c.IssueFromSAMLStep2Func == nil {
+		return "", notMocked("IssueFromSAMLStep2")
+	}
+
+	return c.IssueFromSAMLStep2Func(ctx, response, state, validity, options...)
+}
+
+// IssueFromAzureIdentityToken calls IssueFromAzureIdentityTokenFunc.
+func (c *Client) IssueFromAzureIdentityToken(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromAzureIdentityToken")
+
+	if c.IssueFromAzureIdentityTokenFunc == nil {
+		return "", notMocked("IssueFromAzureIdentityToken")
+	}
+
+	return c.IssueFromAzureIdentityTokenFunc(ctx, token, validity, options...)
+}
+
+// IssueFromPCIdentityToken calls IssueFromPCIdentityTokenFunc.
+func (c *Client) IssueFromPCIdentityToken(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromPCIdentityToken")
+
+	if c.IssueFromPCIdentityTokenFunc == nil {
+		return "", notMocked("IssueFromPCIdentityToken")
+	}
+
+	return c.IssueFromPCIdentityTokenFunc(ctx, token, validity, options...)
+}
+
+// IssueFromOIDCStep1WithStore calls IssueFromOIDCStep1WithStoreFunc.
+func (c *Client) IssueFromOIDCStep1WithStore(ctx context.Context, store midgardclient.OIDCStateStore, namespace string, provider string, redirectURL string) (string, error) {
+
+	c.record("IssueFromOIDCStep1WithStore")
+
+	if c.IssueFromOIDCStep1WithStoreFunc == nil {
+		return "", notMocked("IssueFromOIDCStep1WithStore")
+	}
+
+	return c.IssueFromOIDCStep1WithStoreFunc(ctx, store, namespace, provider, redirectURL)
+}
+
+// IssueFromOIDCStep2WithStore calls IssueFromOIDCStep2WithStoreFunc.
+func (c *Client) IssueFromOIDCStep2WithStore(ctx context.Context, store midgardclient.OIDCStateStore, code string, state string, validity time.Duration, options ...midgardclient.Option) (string, midgardclient.OIDCState, error) {
+
+	c.record("IssueFromOIDCStep2WithStore")
+
+	if c.IssueFromOIDCStep2WithStoreFunc == nil {
+		return "", midgardclient.OIDCState{}, notMocked("IssueFromOIDCStep2WithStore")
+	}
+
+	return c.IssueFromOIDCStep2WithStoreFunc(ctx, store, code, state, validity, options...)
+}
+
+// RenewToken calls RenewTokenFunc.
+func (c *Client) RenewToken(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("RenewToken")
+
+	if c.RenewTokenFunc == nil {
+		return "", notMocked("RenewToken")
+	}
+
+	return c.RenewTokenFunc(ctx, token, validity, options...)
+}
+
+// Issue calls IssueFunc.
+func (c *Client) Issue(ctx context.Context, issue *gaia.Issue, options ...midgardclient.Option) (string, error) {
+
+	c.record("Issue")
+
+	if c.IssueFunc == nil {
+		return "", notMocked("Issue")
+	}
+
+	return c.IssueFunc(ctx, issue, options...)
+}
+
+// IssueFromAWSIAMRole calls IssueFromAWSIAMRoleFunc.
+func (c *Client) IssueFromAWSIAMRole(ctx context.Context, region string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromAWSIAMRole")
+
+	if c.IssueFromAWSIAMRoleFunc == nil {
+		return "", notMocked("IssueFromAWSIAMRole")
+	}
+
+	return c.IssueFromAWSIAMRoleFunc(ctx, region, validity, options...)
+}
+
+// IssueFromKubernetesServiceAccountToken calls IssueFromKubernetesServiceAccountTokenFunc.
+func (c *Client) IssueFromKubernetesServiceAccountToken(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromKubernetesServiceAccountToken")
+
+	if c.IssueFromKubernetesServiceAccountTokenFunc == nil {
+		return "", notMocked("IssueFromKubernetesServiceAccountToken")
+	}
+
+	return c.IssueFromKubernetesServiceAccountTokenFunc(ctx, token, validity, options...)
+}
+
+// IssueFromSPIFFEX509SVID calls IssueFromSPIFFEX509SVIDFunc.
+func (c *Client) IssueFromSPIFFEX509SVID(ctx context.Context, svid tls.Certificate, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromSPIFFEX509SVID")
+
+	if c.IssueFromSPIFFEX509SVIDFunc == nil {
+		return "", notMocked("IssueFromSPIFFEX509SVID")
+	}
+
+	return c.IssueFromSPIFFEX509SVIDFunc(ctx, svid, validity, options...)
+}
+
+// IssueFromSPIFFEJWTSVID calls IssueFromSPIFFEJWTSVIDFunc.
+func (c *Client) IssueFromSPIFFEJWTSVID(ctx context.Context, svid string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromSPIFFEJWTSVID")
+
+	if c.IssueFromSPIFFEJWTSVIDFunc == nil {
+		return "", notMocked("IssueFromSPIFFEJWTSVID")
+	}
+
+	return c.IssueFromSPIFFEJWTSVIDFunc(ctx, svid, validity, options...)
+}
+
+// IssueFromGithubActionsOIDC calls IssueFromGithubActionsOIDCFunc.
+func (c *Client) IssueFromGithubActionsOIDC(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromGithubActionsOIDC")
+
+	if c.IssueFromGithubActionsOIDCFunc == nil {
+		return "", notMocked("IssueFromGithubActionsOIDC")
+	}
+
+	return c.IssueFromGithubActionsOIDCFunc(ctx, token, validity, options...)
+}
+
+// IssueFromOAuth2ClientCredentials calls IssueFromOAuth2ClientCredentialsFunc.
+func (c *Client) IssueFromOAuth2ClientCredentials(ctx context.Context, tokenURL string, clientID string, clientSecret string, scopes []string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromOAuth2ClientCredentials")
+
+	if c.IssueFromOAuth2ClientCredentialsFunc == nil {
+		return "", notMocked("IssueFromOAuth2ClientCredentials")
+	}
+
+	return c.IssueFromOAuth2ClientCredentialsFunc(ctx, tokenURL, clientID, clientSecret, scopes, validity, options...)
+}
+
+// IssueFromAPIKey calls IssueFromAPIKeyFunc.
+func (c *Client) IssueFromAPIKey(ctx context.Context, key string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromAPIKey")
+
+	if c.IssueFromAPIKeyFunc == nil {
+		return "", notMocked("IssueFromAPIKey")
+	}
+
+	return c.IssueFromAPIKeyFunc(ctx, key, validity, options...)
+}
+
+// IssueFromKerberos calls IssueFromKerberosFunc.
+func (c *Client) IssueFromKerberos(ctx context.Context, spnegoToken []byte, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromKerberos")
+
+	if c.IssueFromKerberosFunc == nil {
+		return "", notMocked("IssueFromKerberos")
+	}
+
+	return c.IssueFromKerberosFunc(ctx, spnegoToken, validity, options...)
+}
+
+// IssueFromOIDCDeviceCodeStart calls IssueFromOIDCDeviceCodeStartFunc.
+func (c *Client) IssueFromOIDCDeviceCodeStart(ctx context.Context, namespace string, provider string) (*midgardclient.OIDCDeviceCode, error) {
+
+	c.record("IssueFromOIDCDeviceCodeStart")
+
+	if c.IssueFromOIDCDeviceCodeStartFunc == nil {
+		return nil, notMocked("IssueFromOIDCDeviceCodeStart")
+	}
+
+	return c.IssueFromOIDCDeviceCodeStartFunc(ctx, namespace, provider)
+}
+
+// IssueFromOIDCDeviceCodePoll calls IssueFromOIDCDeviceCodePollFunc.
+func (c *Client) IssueFromOIDCDeviceCodePoll(ctx context.Context, code *midgardclient.OIDCDeviceCode, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromOIDCDeviceCodePoll")
+
+	if c.IssueFromOIDCDeviceCodePollFunc == nil {
+		return "", notMocked("IssueFromOIDCDeviceCodePoll")
+	}
+
+	return c.IssueFromOIDCDeviceCodePollFunc(ctx, code, validity, options...)
+}
+
+// IssueFromOIDCStep1WithPKCE calls IssueFromOIDCStep1WithPKCEFunc.
+func (c *Client) IssueFromOIDCStep1WithPKCE(ctx context.Context, namespace string, provider string, redirectURL string) (string, string, error) {
+
+	c.record("IssueFromOIDCStep1WithPKCE")
+
+	if c.IssueFromOIDCStep1WithPKCEFunc == nil {
+		return "", "", notMocked("IssueFromOIDCStep1WithPKCE")
+	}
+
+	return c.IssueFromOIDCStep1WithPKCEFunc(ctx, namespace, provider, redirectURL)
+}
+
+// IssueFromSAMLIdPInitiated calls IssueFromSAMLIdPInitiatedFunc.
+func (c *Client) IssueFromSAMLIdPInitiated(ctx context.Context, namespace string, provider string, response string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+
+	c.record("IssueFromSAMLIdPInitiated")
+
+	if c.IssueFromSAMLIdPInitiatedFunc == nil {
+		return "", notMocked("IssueFromSAMLIdPInitiated")
+	}
+
+	return c.IssueFromSAMLIdPInitiatedFunc(ctx, namespace, provider, response, validity, options...)
+}
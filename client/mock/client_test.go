@@ -0,0 +1,83 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	midgardclient "go.aporeto.io/midgard-lib/client"
+)
+
+func TestClient(t *testing.T) {
+
+	Convey("Given I have a mock client", t, func() {
+
+		c := &Client{
+			AuthentifyFunc: func(ctx context.Context, token string) ([]string, error) {
+				return []string{"@auth:subject=" + token}, nil
+			},
+			IssueFromCertificateFunc: func(ctx context.Context, validity time.Duration, options ...midgardclient.Option) (string, error) {
+				return "token", nil
+			},
+		}
+
+		var ai midgardclient.AuthenticatorIssuer = c
+
+		Convey("When I call a mocked method", func() {
+
+			claims, err := ai.Authentify(context.Background(), "bob")
+
+			Convey("Then the mock should be called", func() {
+				So(err, ShouldBeNil)
+				So(claims, ShouldResemble, []string{"@auth:subject=bob"})
+				So(c.Calls("Authentify"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I call a mocked issue method", func() {
+
+			token, err := ai.IssueFromCertificate(context.Background(), time.Hour)
+
+			Convey("Then the mock should be called", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "token")
+				So(c.Calls("IssueFromCertificate"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I call a method that is not mocked through the ExtendedIssuer interface", func() {
+
+			var i midgardclient.ExtendedIssuer = c
+			_, err := i.RenewToken(context.Background(), "token", time.Hour)
+
+			Convey("Then err should be correct", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "mock: RenewToken is not mocked")
+				So(c.Calls("RenewToken"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I call a method that is not mocked", func() {
+
+			_, err := ai.IssueFromVince(context.Background(), "a", "p", "", time.Hour)
+
+			Convey("Then err should be correct", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "mock: IssueFromVince is not mocked")
+				So(c.Calls("IssueFromVince"), ShouldEqual, 1)
+			})
+		})
+	})
+}
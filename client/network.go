@@ -0,0 +1,108 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// maxPublicIPBody is the maximum size of the body
+// returned by the public IP lookup endpoint.
+const maxPublicIPBody = 256
+
+// callerNetworks returns the networks the token should be restricted to
+// when OptRestrictToCallerNetwork is used. If no network was explicitly
+// given, the public address of the caller is looked up using the endpoint
+// set by OptionPublicIPLookupURL.
+func (a *Client) callerNetworks(ctx context.Context, opts issueOpts) ([]string, error) {
+
+	if len(opts.callerNetworks) == 0 {
+
+		n, err := a.publicNetwork(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine caller network: %s", err)
+		}
+
+		return []string{n}, nil
+	}
+
+	out := make([]string, len(opts.callerNetworks))
+	for i, n := range opts.callerNetworks {
+
+		if ip := net.ParseIP(n); ip != nil {
+			out[i] = ipToNetwork(ip)
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid caller network '%s': %s", n, err)
+		}
+
+		out[i] = ipnet.String()
+	}
+
+	return out, nil
+}
+
+// publicNetwork returns the single host network of the public address
+// of the caller, as returned by the public IP lookup endpoint. The
+// request goes through the http client used to reach midgard, so
+// it uses the same proxy and dialer.
+func (a *Client) publicNetwork(ctx context.Context) (string, error) {
+
+	if a.config.publicIPLookupURL == "" {
+		return "", fmt.Errorf("no network given and no public ip lookup url set with OptionPublicIPLookupURL")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, a.config.publicIPLookupURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := a.currentHTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("public ip lookup failed: %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPublicIPBody))
+	if err != nil {
+		return "", err
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(data)))
+	if ip == nil {
+		return "", fmt.Errorf("public ip lookup returned an invalid address")
+	}
+
+	return ipToNetwork(ip), nil
+}
+
+func ipToNetwork(ip net.IP) string {
+
+	if ip.To4() != nil {
+		return (&net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}).String()
+}
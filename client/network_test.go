@@ -0,0 +1,182 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestNetwork_callerNetworks(t *testing.T) {
+
+	cl := NewClient("http://127.0.0.1:4443")
+
+	Convey("Given I have explicit networks", t, func() {
+
+		opts := issueOpts{callerNetworks: []string{"1.2.3.4", "10.0.0.1/8", "::1"}}
+
+		Convey("When I call callerNetworks", func() {
+
+			networks, err := cl.callerNetworks(context.Background(), opts)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then networks should be correct", func() {
+				So(networks, ShouldResemble, []string{"1.2.3.4/32", "10.0.0.0/8", "::1/128"})
+			})
+		})
+	})
+
+	Convey("Given I have an invalid network", t, func() {
+
+		opts := issueOpts{callerNetworks: []string{"not-a-network"}}
+
+		Convey("When I call callerNetworks", func() {
+
+			networks, err := cl.callerNetworks(context.Background(), opts)
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then networks should be nil", func() {
+				So(networks, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have no explicit network and no public ip lookup url", t, func() {
+
+		Convey("When I call callerNetworks", func() {
+
+			networks, err := cl.callerNetworks(context.Background(), issueOpts{})
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to determine caller network: no network given and no public ip lookup url set with OptionPublicIPLookupURL")
+			})
+
+			Convey("Then networks should be nil", func() {
+				So(networks, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have no explicit network and a public ip lookup endpoint", t, func() {
+
+		body := "203.0.113.7\n"
+		lookup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		defer lookup.Close()
+
+		cl := NewClientWithOptions("http://127.0.0.1:4443", OptionPublicIPLookupURL(lookup.URL))
+
+		Convey("When I call callerNetworks", func() {
+
+			networks, err := cl.callerNetworks(context.Background(), issueOpts{})
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then networks should be the public address", func() {
+				So(networks, ShouldResemble, []string{"203.0.113.7/32"})
+			})
+		})
+
+		Convey("When the endpoint returns an invalid address", func() {
+
+			body = "<html>nope</html>"
+			networks, err := cl.callerNetworks(context.Background(), issueOpts{})
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then networks should be nil", func() {
+				So(networks, ShouldBeNil)
+			})
+		})
+
+		Convey("When the context is canceled", func() {
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := cl.callerNetworks(ctx, issueOpts{})
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Calling New with OptionPublicIPLookupURL and an invalid url should return an error", t, func() {
+		cl, err := New("https://midgard.com", OptionPublicIPLookupURL("api.ipify.org"))
+		So(cl, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid public ip lookup url 'api.ipify.org'")
+	})
+}
+
+func TestNetwork_OptRestrictToCallerNetwork(t *testing.T) {
+
+	Convey("Given I have a client, a public ip lookup endpoint and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		lookup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "203.0.113.7")
+		}))
+		defer lookup.Close()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionPublicIPLookupURL(lookup.URL))
+
+		Convey("When I call IssueFromCertificate with OptRestrictToCallerNetwork", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromCertificate(ctx, time.Minute,
+				OptRestrictNetworks([]string{"10.0.0.0/8"}),
+				OptRestrictToCallerNetwork(),
+			)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the caller network should have been added", func() {
+				So(expectedRequest.RestrictedNetworks, ShouldResemble, []string{"10.0.0.0/8", "203.0.113.7/32"})
+			})
+		})
+	})
+}
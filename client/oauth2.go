@@ -0,0 +1,124 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.aporeto.io/gaia"
+)
+
+// IssueFromOAuth2ClientCredentials issues a Midgard jwt for the given validity duration
+// from the access token obtained by performing the OAuth2 client credentials grant
+// against the given token URL. The access token is then sent to the OIDC realm.
+// The token URL is reached with the HTTP client of the Client, so its TLS
+// configuration and proxy settings apply.
+func (a *Client) IssueFromOAuth2ClientCredentials(ctx context.Context, tokenURL string, clientID string, clientSecret string, scopes []string, validity time.Duration, options ...Option) (string, error) {
+
+	opts := a.issueOptions(options)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.oauth2")
+	defer span.Finish()
+
+	accessToken, err := fetchOAuth2ClientCredentialsToken(subctx, a.currentHTTPClient(), tokenURL, clientID, clientSecret, scopes)
+	if err != nil {
+		return "", err
+	}
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{"token": accessToken}
+	issueRequest.Realm = gaia.IssueRealmOIDC
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// fetchOAuth2ClientCredentialsToken performs the OAuth2 client credentials
+// grant described in RFC 6749 section 4.4 and returns the access token.
+func fetchOAuth2ClientCredentialsToken(ctx context.Context, httpClient *http.Client, tokenURL string, clientID string, clientSecret string, scopes []string) (string, error) {
+
+	if tokenURL == "" {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: missing token url")
+	}
+
+	if clientID == "" {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: missing client id")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: %s", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// RFC 6749 section 2.3.1 requires the credentials to be form encoded
+	// before being used as the basic authentication username and password.
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: %s", err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: %s", err)
+	}
+
+	token := struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("unable to retrieve oauth2 token: unexpected status code %d", resp.StatusCode)
+		}
+		return "", fmt.Errorf("unable to retrieve oauth2 token: unable to decode response: %s", err)
+	}
+
+	if token.Error != "" {
+		if token.ErrorDescription != "" {
+			return "", fmt.Errorf("unable to retrieve oauth2 token: %s: %s", token.Error, token.ErrorDescription)
+		}
+		return "", fmt.Errorf("unable to retrieve oauth2 token: %s", token.Error)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: unexpected status code %d", resp.StatusCode)
+	}
+
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("unable to retrieve oauth2 token: empty access token")
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_IssueFromOAuth2ClientCredentials(t *testing.T) {
+
+	Convey("Given I have a fake oauth2 server trusted by the client and a fake working midgard server", t, func() {
+
+		var form map[string][]string
+		var username, password string
+
+		oauth := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				panic(err)
+			}
+			form = r.PostForm
+			username, password, _ = r.BasicAuth()
+			fmt.Fprintln(w, `{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600}`)
+		}))
+		defer oauth.Close()
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "oidc","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(oauth.Certificate())
+
+		cl := NewClientWithTLS(ts.URL, &tls.Config{RootCAs: pool})
+
+		Convey("When I call IssueFromOAuth2ClientCredentials", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromOAuth2ClientCredentials(ctx, oauth.URL, "client:id", "s3cr&t", []string{"a", "b"}, 1*time.Minute,
+				OptRestrictNamespace("/ns1"),
+			)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the oauth2 request should be correct", func() {
+				So(form["grant_type"], ShouldResemble, []string{"client_credentials"})
+				So(form["scope"], ShouldResemble, []string{"a b"})
+				So(username, ShouldEqual, "client%3Aid")
+				So(password, ShouldEqual, "s3cr%26t")
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "OIDC")
+				So(expectedRequest.Metadata["token"], ShouldEqual, "access-token")
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+	})
+}
+
+func TestOAuth2_fetchOAuth2ClientCredentialsToken(t *testing.T) {
+
+	Convey("Given I have a fake oauth2 server returning an error", t, func() {
+
+		oauth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"error": "invalid_client", "error_description": "unknown client"}`)
+		}))
+		defer oauth.Close()
+
+		Convey("When I fetch a token", func() {
+
+			_, err := fetchOAuth2ClientCredentialsToken(context.Background(), http.DefaultClient, oauth.URL, "id", "secret", nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to retrieve oauth2 token: invalid_client: unknown client")
+			})
+		})
+	})
+
+	Convey("Given I have a fake oauth2 server returning a non json error", t, func() {
+
+		oauth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintln(w, `<html>bad gateway</html>`)
+		}))
+		defer oauth.Close()
+
+		Convey("When I fetch a token", func() {
+
+			_, err := fetchOAuth2ClientCredentialsToken(context.Background(), http.DefaultClient, oauth.URL, "id", "secret", nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to retrieve oauth2 token: unexpected status code 502")
+			})
+		})
+	})
+
+	Convey("Given I have a fake oauth2 server returning no access token", t, func() {
+
+		var form map[string][]string
+
+		oauth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				panic(err)
+			}
+			form = r.PostForm
+			fmt.Fprintln(w, `{"token_type": "Bearer"}`)
+		}))
+		defer oauth.Close()
+
+		Convey("When I fetch a token", func() {
+
+			_, err := fetchOAuth2ClientCredentialsToken(context.Background(), http.DefaultClient, oauth.URL, "id", "secret", nil)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to retrieve oauth2 token: empty access token")
+			})
+
+			Convey("Then no scope should have been requested", func() {
+				So(form, ShouldNotContainKey, "scope")
+			})
+		})
+	})
+
+	Convey("Given I fetch a token without token url", t, func() {
+
+		_, err := fetchOAuth2ClientCredentialsToken(context.Background(), http.DefaultClient, "", "id", "secret", nil)
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unable to retrieve oauth2 token: missing token url")
+		})
+	})
+
+	Convey("Given I fetch a token without client id", t, func() {
+
+		_, err := fetchOAuth2ClientCredentialsToken(context.Background(), http.DefaultClient, "http://127.0.0.1", "", "secret", nil)
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unable to retrieve oauth2 token: missing client id")
+		})
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+type idTokenClaims struct {
+	Nonce string `json:"nonce"`
+	jwt.StandardClaims
+}
+
+// checkOIDCStep2 checks the parameters returned by the OIDC provider
+// according to the given options, before they are sent to midgard.
+func checkOIDCStep2(code string, state string, opts issueOpts) error {
+
+	if !opts.oidcCheckState && !opts.oidcCheckIDToken {
+		return nil
+	}
+
+	if opts.oidcCheckState && opts.oidcState == "" {
+		return fmt.Errorf("unable to check oidc response: expected state is empty")
+	}
+
+	if code == "" {
+		return fmt.Errorf("invalid oidc response: missing code")
+	}
+
+	if opts.oidcCheckState && state != opts.oidcState {
+		return fmt.Errorf("invalid oidc response: state does not match the expected state")
+	}
+
+	if !opts.oidcCheckIDToken {
+		return nil
+	}
+
+	if opts.oidcIDToken == "" {
+		return fmt.Errorf("invalid oidc response: missing id token")
+	}
+
+	c := &idTokenClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(opts.oidcIDToken, c); err != nil {
+		return fmt.Errorf("invalid oidc response: unable to decode id token: %s", redactSecrets(err, opts.oidcIDToken))
+	}
+
+	if c.ExpiresAt != 0 && !time.Now().Before(time.Unix(c.ExpiresAt, 0)) {
+		return fmt.Errorf("invalid oidc response: id token expired at %s", time.Unix(c.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+
+	if opts.oidcNonce != "" && c.Nonce != opts.oidcNonce {
+		if c.Nonce == "" {
+			return fmt.Errorf("invalid oidc response: id token has no nonce")
+		}
+		return fmt.Errorf("invalid oidc response: id token nonce does not match the nonce of the flow")
+	}
+
+	return nil
+}
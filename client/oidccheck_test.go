@@ -0,0 +1,165 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_OIDCStep2Checks(t *testing.T) {
+
+	Convey("Given I have a server", t, func() {
+
+		var called bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+		ctx := context.Background()
+
+		idToken := func(nonce string, exp time.Time) string {
+			return makeToken(
+				jwt.MapClaims{"nonce": nonce, "exp": exp.Unix()},
+				jwt.SigningMethodHS256,
+				[]byte("secret"),
+			)
+		}
+
+		Convey("When the state and id token match", func() {
+
+			token, err := cl.IssueFromOIDCStep2(ctx, "code", "state", time.Minute,
+				OptOIDCState("state"),
+				OptOIDCIDToken(idToken("nonce", time.Now().Add(time.Hour)), "nonce"),
+			)
+
+			Convey("Then it should be sent to midgard", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(called, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the state does not match", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "other", time.Minute, OptOIDCState("state"))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: state does not match the expected state")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the expected state is empty", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "", time.Minute, OptOIDCState(""))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to check oidc response: expected state is empty")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the id token is missing", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "state", time.Minute, OptOIDCIDToken("", "nonce"))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: missing id token")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the code is missing", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "", "state", time.Minute, OptOIDCState("state"))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: missing code")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the id token nonce does not match", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "state", time.Minute, OptOIDCIDToken(idToken("other", time.Now().Add(time.Hour)), "nonce"))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: id token nonce does not match the nonce of the flow")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the id token has no nonce", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "state", time.Minute, OptOIDCIDToken(idToken("", time.Now().Add(time.Hour)), "nonce"))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: id token has no nonce")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the id token has expired", func() {
+
+			exp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "state", time.Minute, OptOIDCIDToken(idToken("nonce", exp), ""))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: id token expired at 2020-01-01T00:00:00Z")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the id token cannot be decoded", func() {
+
+			_, err := cl.IssueFromOIDCStep2(ctx, "code", "state", time.Minute, OptOIDCIDToken("garbage", ""))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "invalid oidc response: unable to decode id token: ")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I use a store and the id token nonce does not match the stored one", func() {
+
+			store := NewMemoryOIDCStateStore(time.Minute)
+			So(store.Put(ctx, "state", OIDCState{Nonce: "nonce", Created: time.Now()}), ShouldBeNil)
+
+			_, _, err := cl.IssueFromOIDCStep2WithStore(ctx, store, "code", "state", time.Minute, OptOIDCIDToken(idToken("other", time.Now().Add(time.Hour)), ""))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid oidc response: id token nonce does not match the nonce of the flow")
+				So(called, ShouldBeFalse)
+			})
+		})
+	})
+}
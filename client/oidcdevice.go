@@ -0,0 +1,190 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+)
+
+const (
+	deviceCodeDefaultInterval = 5 * time.Second
+
+	deviceCodeAuthorizationPending = "authorization_pending"
+	deviceCodeSlowDown             = "slow_down"
+)
+
+// deviceCodeSlowDownIncrement is the time added to the polling
+// interval when midgard asks to slow down, as defined by RFC 8628.
+var deviceCodeSlowDownIncrement = 5 * time.Second
+
+// An OIDCDeviceCode holds the device authorization returned by
+// IssueFromOIDCDeviceCodeStart. The user must visit the verification
+// URI from another device and enter the user code, while the device
+// polls midgard with IssueFromOIDCDeviceCodePoll.
+type OIDCDeviceCode struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresAt               time.Time
+	Interval                time.Duration
+}
+
+// IssueFromOIDCDeviceCodeStart starts the OIDC device authorization grant
+// flow described in RFC 8628 with the given provider. Midgard returns the
+// device authorization response of the provider in the data of the issue
+// response.
+func (a *Client) IssueFromOIDCDeviceCodeStart(ctx context.Context, namespace string, provider string) (*OIDCDeviceCode, error) {
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{
+		"namespace":        namespace,
+		"OIDCProviderName": provider,
+		"flow":             "device",
+	}
+	issueRequest.Realm = gaia.IssueRealmOIDC
+	issueRequest.Validity = ""
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.oidc.device.start")
+	defer span.Finish()
+
+	if _, err := a.sendRequest(subctx, issueRequest, a.issueOptions(nil)); err != nil {
+		return nil, err
+	}
+
+	resp := struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}{}
+
+	if err := json.Unmarshal([]byte(issueRequest.Data), &resp); err != nil {
+		return nil, fmt.Errorf("unable to start device code flow: invalid device authorization: %s", err)
+	}
+
+	if resp.DeviceCode == "" || resp.UserCode == "" || resp.VerificationURI == "" {
+		return nil, fmt.Errorf("unable to start device code flow: incomplete device authorization")
+	}
+
+	code := &OIDCDeviceCode{
+		DeviceCode:              resp.DeviceCode,
+		UserCode:                resp.UserCode,
+		VerificationURI:         resp.VerificationURI,
+		VerificationURIComplete: resp.VerificationURIComplete,
+		Interval:                time.Duration(resp.Interval) * time.Second,
+	}
+
+	if resp.ExpiresIn > 0 {
+		code.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+
+	if code.Interval <= 0 {
+		code.Interval = deviceCodeDefaultInterval
+	}
+
+	return code, nil
+}
+
+// IssueFromOIDCDeviceCodePoll polls midgard with the given device code until
+// the user completes the authorization and returns a Midgard jwt for the given
+// validity duration. While the authorization is pending, midgard returns an error
+// with the RFC 8628 error code as description or in the "error" key of its data.
+// It returns an error if the user denies the authorization, the device code
+// expires or the context is canceled.
+func (a *Client) IssueFromOIDCDeviceCodePoll(ctx context.Context, code *OIDCDeviceCode, validity time.Duration, options ...Option) (string, error) {
+
+	if code == nil || code.DeviceCode == "" {
+		return "", fmt.Errorf("missing device code")
+	}
+
+	opts := a.issueOptions(options)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.oidc.device.poll")
+	defer span.Finish()
+
+	interval := code.Interval
+	if interval <= 0 {
+		interval = deviceCodeDefaultInterval
+	}
+
+	for {
+
+		if !code.ExpiresAt.IsZero() && time.Now().After(code.ExpiresAt) {
+			return "", fmt.Errorf("unable to complete device code flow: device code has expired")
+		}
+
+		issueRequest := gaia.NewIssue()
+		issueRequest.Metadata = map[string]interface{}{
+			"deviceCode": code.DeviceCode,
+		}
+		issueRequest.Realm = gaia.IssueRealmOIDC
+		issueRequest.Validity = validity.String()
+
+		applyOptions(issueRequest, opts)
+
+		token, err := a.sendRequest(subctx, issueRequest, opts)
+		if err == nil {
+			return token, nil
+		}
+
+		switch deviceCodeError(err) {
+		case deviceCodeAuthorizationPending:
+		case deviceCodeSlowDown:
+			interval += deviceCodeSlowDownIncrement
+		default:
+			return "", err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-subctx.Done():
+			timer.Stop()
+			return "", subctx.Err()
+		}
+	}
+}
+
+// deviceCodeError returns the RFC 8628 polling error code
+// carried by the given error returned by midgard, if any.
+func deviceCodeError(err error) string {
+
+	var errs elemental.Errors
+	if !errors.As(err, &errs) {
+		return ""
+	}
+
+	for _, e := range errs {
+
+		if data, ok := e.Data.(map[string]interface{}); ok {
+			if s, ok := data["error"].(string); ok && (s == deviceCodeAuthorizationPending || s == deviceCodeSlowDown) {
+				return s
+			}
+		}
+
+		if e.Description == deviceCodeAuthorizationPending || e.Description == deviceCodeSlowDown {
+			return e.Description
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_IssueFromOIDCDeviceCode(t *testing.T) {
+
+	Convey("Given I have a fake midgard server supporting the device code flow", t, func() {
+
+		var lock sync.Mutex
+		var requests []*gaia.Issue
+		pending := []string{
+			`[{"code": 400, "title": "Pending", "description": "authorization_pending", "subject": "midgard"}]`,
+			`[{"code": 400, "title": "Pending", "description": "pending", "subject": "midgard", "data": {"error": "slow_down"}}]`,
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			req := gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				panic(err)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			requests = append(requests, req)
+
+			if req.Metadata["flow"] == "device" {
+				data, _ := json.Marshal(`{"device_code": "dc", "user_code": "ABCD-EFGH", "verification_uri": "https://idp/device", "expires_in": 600, "interval": 2}`)
+				fmt.Fprintf(w, `{"realm": "OIDC", "data": %s}`, data)
+				return
+			}
+
+			if req.Metadata["deviceCode"] == "denied-device-code" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `[{"code": 403, "title": "Denied", "description": "access_denied", "subject": "midgard"}]`)
+				return
+			}
+
+			if len(pending) > 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, pending[0])
+				pending = pending[1:]
+				return
+			}
+
+			fmt.Fprintln(w, `{"realm": "OIDC", "token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I start the flow", func() {
+
+			code, err := cl.IssueFromOIDCDeviceCodeStart(context.Background(), "/ns", "idp")
+
+			Convey("Then I should get the device authorization", func() {
+				So(err, ShouldBeNil)
+				So(code.DeviceCode, ShouldEqual, "dc")
+				So(code.UserCode, ShouldEqual, "ABCD-EFGH")
+				So(code.VerificationURI, ShouldEqual, "https://idp/device")
+				So(code.Interval, ShouldEqual, 2*time.Second)
+				So(code.ExpiresAt, ShouldHappenWithin, 10*time.Minute+time.Second, time.Now())
+			})
+
+			Convey("Then the request should be correct", func() {
+				So(requests[0].Realm, ShouldEqual, "OIDC")
+				So(requests[0].Metadata["namespace"], ShouldEqual, "/ns")
+				So(requests[0].Metadata["OIDCProviderName"], ShouldEqual, "idp")
+			})
+
+			Convey("When I poll until the authorization completes", func() {
+
+				old := deviceCodeSlowDownIncrement
+				deviceCodeSlowDownIncrement = 10 * time.Millisecond
+				defer func() { deviceCodeSlowDownIncrement = old }()
+
+				code.Interval = 10 * time.Millisecond
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				token, err := cl.IssueFromOIDCDeviceCodePoll(ctx, code, time.Hour, OptRestrictNamespace("/ns/a"))
+
+				Convey("Then I should get the token", func() {
+					So(err, ShouldBeNil)
+					So(token, ShouldEqual, "yeay!")
+					So(requests, ShouldHaveLength, 4)
+					So(requests[3].Metadata["deviceCode"], ShouldEqual, "dc")
+					So(requests[3].RestrictedNamespace, ShouldEqual, "/ns/a")
+					So(requests[3].Validity, ShouldEqual, "1h0m0s")
+				})
+			})
+		})
+
+		Convey("When I poll with a denied device code", func() {
+
+			_, err := cl.IssueFromOIDCDeviceCodePoll(context.Background(), &OIDCDeviceCode{DeviceCode: "denied-device-code"}, time.Hour)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "access_denied")
+			})
+		})
+
+		Convey("When I poll with an expired device code", func() {
+
+			_, err := cl.IssueFromOIDCDeviceCodePoll(context.Background(), &OIDCDeviceCode{DeviceCode: "dc", ExpiresAt: time.Now().Add(-time.Second)}, time.Hour)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to complete device code flow: device code has expired")
+			})
+		})
+
+		Convey("When I poll and the context is canceled", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, err := cl.IssueFromOIDCDeviceCodePoll(ctx, &OIDCDeviceCode{DeviceCode: "dc", Interval: time.Minute}, time.Hour)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "context deadline exceeded")
+			})
+		})
+
+		Convey("When I poll without device code", func() {
+
+			_, err := cl.IssueFromOIDCDeviceCodePoll(context.Background(), nil, time.Hour)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing device code")
+			})
+		})
+	})
+
+	Convey("Given I have a fake midgard server not supporting the device code flow", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"realm": "OIDC", "data": "{}"}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I start the flow", func() {
+
+			_, err := NewClient(ts.URL).IssueFromOIDCDeviceCodeStart(context.Background(), "/ns", "idp")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to start device code flow: incomplete device authorization")
+			})
+		})
+	})
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrOIDCStateNotFound is returned by an OIDCStateStore when the
+// given state is unknown, has expired or has already been used.
+var ErrOIDCStateNotFound = errors.New("unknown or expired oidc state")
+
+// An OIDCState holds what is known about an OIDC flow
+// between IssueFromOIDCStep1 and IssueFromOIDCStep2.
+type OIDCState struct {
+	Namespace   string    `json:"namespace"`
+	Provider    string    `json:"provider"`
+	RedirectURL string    `json:"redirectURL"`
+	Nonce       string    `json:"nonce,omitempty"`
+	Verifier    string    `json:"verifier,omitempty"`
+	Created     time.Time `json:"created"`
+}
+
+// An OIDCStateStore correlates the state of the first step of
+// an OIDC flow with the second one. Web backends running several
+// replicas should use a shared implementation, for instance backed
+// by a database, so the two steps can be handled by different ones.
+type OIDCStateStore interface {
+
+	// Put stores the given OIDC state.
+	Put(ctx context.Context, state string, s OIDCState) error
+
+	// Take returns and deletes the given OIDC state. It returns
+	// ErrOIDCStateNotFound if it is unknown or has expired.
+	Take(ctx context.Context, state string) (OIDCState, error)
+}
+
+// A MemoryOIDCStateStore is an in-memory OIDCStateStore. The
+// states expire after a ttl and are purged while storing new ones.
+type MemoryOIDCStateStore struct {
+	ttl       time.Duration
+	states    map[string]OIDCState
+	lastPurge time.Time
+
+	sync.Mutex
+}
+
+// NewMemoryOIDCStateStore returns a new MemoryOIDCStateStore
+// keeping the states for the given ttl.
+func NewMemoryOIDCStateStore(ttl time.Duration) *MemoryOIDCStateStore {
+
+	if ttl <= 0 {
+		panic("ttl must be greater than 0")
+	}
+
+	return &MemoryOIDCStateStore{
+		ttl:       ttl,
+		states:    map[string]OIDCState{},
+		lastPurge: time.Now(),
+	}
+}
+
+// Put implements the OIDCStateStore interface.
+func (m *MemoryOIDCStateStore) Put(ctx context.Context, state string, s OIDCState) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	m.states[state] = s
+
+	if now.Sub(m.lastPurge) < m.ttl {
+		return nil
+	}
+
+	m.lastPurge = now
+	for k, s := range m.states {
+		if now.Sub(s.Created) >= m.ttl {
+			delete(m.states, k)
+		}
+	}
+
+	return nil
+}
+
+// Take implements the OIDCStateStore interface.
+func (m *MemoryOIDCStateStore) Take(ctx context.Context, state string) (OIDCState, error) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.states[state]
+	if !ok {
+		return OIDCState{}, ErrOIDCStateNotFound
+	}
+
+	delete(m.states, state)
+
+	if time.Since(s.Created) >= m.ttl {
+		return OIDCState{}, ErrOIDCStateNotFound
+	}
+
+	return s, nil
+}
+
+// IssueFromOIDCStep1WithStore performs IssueFromOIDCStep1WithPKCE and
+// stores the state of the returned OIDC auth endpoint in the given store,
+// with the provider, the redirect url, the nonce and the PKCE code verifier
+// of the flow.
+func (a *Client) IssueFromOIDCStep1WithStore(ctx context.Context, store OIDCStateStore, namespace string, provider string, redirectURL string) (string, error) {
+
+	authURL, verifier, err := a.IssueFromOIDCStep1WithPKCE(ctx, namespace, provider, redirectURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse oidc auth endpoint: %s", err)
+	}
+
+	q := u.Query()
+	state := q.Get("state")
+	if state == "" {
+		return "", fmt.Errorf("missing state in oidc auth endpoint")
+	}
+
+	s := OIDCState{
+		Namespace:   namespace,
+		Provider:    provider,
+		RedirectURL: redirectURL,
+		Nonce:       q.Get("nonce"),
+		Verifier:    verifier,
+		Created:     time.Now(),
+	}
+
+	if err := store.Put(ctx, state, s); err != nil {
+		return "", fmt.Errorf("unable to store oidc state: %s", err)
+	}
+
+	return authURL, nil
+}
+
+// IssueFromOIDCStep2WithStore takes the given state from the store and
+// performs IssueFromOIDCStep2. It returns ErrOIDCStateNotFound without
+// calling midgard if the state was not stored by IssueFromOIDCStep1WithStore
+// or has expired. Otherwise, it also returns the stored OIDC state. When
+// OptOIDCIDToken is given without nonce, the stored nonce is checked. The
+// stored PKCE code verifier is sent unless OptOIDCCodeVerifier is given.
+func (a *Client) IssueFromOIDCStep2WithStore(ctx context.Context, store OIDCStateStore, code string, state string, validity time.Duration, options ...Option) (string, OIDCState, error) {
+
+	s, err := store.Take(ctx, state)
+	if err != nil {
+		return "", OIDCState{}, err
+	}
+
+	opts := a.issueOptions(options)
+
+	// Do not write into the backing array of the caller.
+	options = append([]Option{}, options...)
+
+	if opts.oidcCheckIDToken && opts.oidcNonce == "" {
+		options = append(options, func(opts *issueOpts) { opts.oidcNonce = s.Nonce })
+	}
+
+	if opts.oidcCodeVerifier == "" && s.Verifier != "" {
+		options = append(options, OptOIDCCodeVerifier(s.Verifier))
+	}
+
+	token, err := a.IssueFromOIDCStep2(ctx, code, state, validity, options...)
+	if err != nil {
+		return "", s, err
+	}
+
+	return token, s, nil
+}
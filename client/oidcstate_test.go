@@ -0,0 +1,160 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestMemoryOIDCStateStore(t *testing.T) {
+
+	Convey("Calling NewMemoryOIDCStateStore with an invalid ttl should panic", t, func() {
+		So(func() { NewMemoryOIDCStateStore(0) }, ShouldPanicWith, "ttl must be greater than 0")
+	})
+
+	Convey("Given I have a memory store", t, func() {
+
+		ctx := context.Background()
+		store := NewMemoryOIDCStateStore(time.Minute)
+
+		Convey("When I put and take a state", func() {
+
+			s := OIDCState{Provider: "google", Created: time.Now()}
+			So(store.Put(ctx, "state", s), ShouldBeNil)
+
+			out, err := store.Take(ctx, "state")
+
+			Convey("Then I should get it once", func() {
+				So(err, ShouldBeNil)
+				So(out, ShouldResemble, s)
+
+				_, err = store.Take(ctx, "state")
+				So(err, ShouldEqual, ErrOIDCStateNotFound)
+			})
+		})
+
+		Convey("When I take an expired state", func() {
+
+			So(store.Put(ctx, "state", OIDCState{Created: time.Now().Add(-time.Hour)}), ShouldBeNil)
+
+			_, err := store.Take(ctx, "state")
+
+			Convey("Then it should not be found", func() {
+				So(err, ShouldEqual, ErrOIDCStateNotFound)
+			})
+		})
+
+		Convey("When I put a state after the ttl", func() {
+
+			So(store.Put(ctx, "old", OIDCState{Created: time.Now().Add(-time.Hour)}), ShouldBeNil)
+			store.lastPurge = time.Now().Add(-time.Hour)
+			So(store.Put(ctx, "new", OIDCState{Created: time.Now()}), ShouldBeNil)
+
+			Convey("Then the expired states should have been purged", func() {
+				So(len(store.states), ShouldEqual, 1)
+				So(store.states, ShouldContainKey, "new")
+			})
+		})
+	})
+}
+
+func TestClient_OIDCWithStore(t *testing.T) {
+
+	Convey("Given I have a midgard server handling OIDC", t, func() {
+
+		var step2 int32
+		var challenge, codeVerifier interface{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			issue := gaia.NewIssue()
+			_ = json.NewDecoder(r.Body).Decode(issue)
+
+			if _, ok := issue.Metadata["code"]; ok {
+				atomic.AddInt32(&step2, 1)
+				codeVerifier = issue.Metadata["codeVerifier"]
+				fmt.Fprintln(w, `{"token": "yeay!"}`)
+				return
+			}
+
+			challenge = issue.Metadata["codeChallenge"]
+			w.Header().Set("Location", "https://idp.com/auth?state=abc&nonce=xyz")
+			w.WriteHeader(http.StatusFound)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+		store := NewMemoryOIDCStateStore(time.Minute)
+
+		Convey("When I perform the first step", func() {
+
+			authURL, err := cl.IssueFromOIDCStep1WithStore(context.Background(), store, "/ns", "google", "https://app.com/cb")
+
+			Convey("Then the state should have been stored", func() {
+				So(err, ShouldBeNil)
+				So(authURL, ShouldEqual, "https://idp.com/auth?state=abc&nonce=xyz")
+				So(store.states["abc"].Provider, ShouldEqual, "google")
+				So(store.states["abc"].Namespace, ShouldEqual, "/ns")
+				So(store.states["abc"].RedirectURL, ShouldEqual, "https://app.com/cb")
+				So(store.states["abc"].Nonce, ShouldEqual, "xyz")
+				So(validatePKCEVerifier(store.states["abc"].Verifier), ShouldBeNil)
+				So(challenge, ShouldEqual, pkceChallenge(store.states["abc"].Verifier))
+			})
+
+			Convey("When I perform the second step", func() {
+
+				verifier := store.states["abc"].Verifier
+				token, s, err := cl.IssueFromOIDCStep2WithStore(context.Background(), store, "code", "abc", time.Minute)
+
+				Convey("Then it should work", func() {
+					So(err, ShouldBeNil)
+					So(token, ShouldEqual, "yeay!")
+					So(s.Provider, ShouldEqual, "google")
+					So(codeVerifier, ShouldEqual, verifier)
+					So(atomic.LoadInt32(&step2), ShouldEqual, 1)
+				})
+			})
+
+			Convey("When I perform the second step with options having spare capacity", func() {
+
+				options := make([]Option, 1, 2)
+				options[0] = OptQuota(1)
+
+				_, _, err := cl.IssueFromOIDCStep2WithStore(context.Background(), store, "code", "abc", time.Minute, options...)
+
+				Convey("Then the options of the caller should not have been modified", func() {
+					So(err, ShouldBeNil)
+					So(options[:2][1], ShouldBeNil)
+				})
+			})
+
+			Convey("When I perform the second step with an unknown state", func() {
+
+				_, _, err := cl.IssueFromOIDCStep2WithStore(context.Background(), store, "code", "nope", time.Minute)
+
+				Convey("Then it should fail without calling midgard", func() {
+					So(err, ShouldEqual, ErrOIDCStateNotFound)
+					So(atomic.LoadInt32(&step2), ShouldEqual, 0)
+				})
+			})
+		})
+	})
+}
@@ -11,6 +11,17 @@
 
 package midgardclient
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.aporeto.io/midgard-lib/tokenmanager/providers"
+)
+
 type issueOpts struct {
 	quota                 int
 	opaque                map[string]string
@@ -18,12 +29,49 @@ type issueOpts struct {
 	restrictedNamespace   string
 	restrictedPermissions []string
 	restrictedNetworks    []string
+	signRequest           bool
+	restrictToCaller      bool
+	callerNetworks        []string
+	quotaInfoFunc         func(QuotaInfo)
+	rateLimitInfoFunc     func(RateLimitInfo)
+	timeout               time.Duration
+	headers               http.Header
+	userAgent             string
+	validityJitter        float64
+	keepRestrictions      bool
+	serverName            string
+	samlIdPCertificates   []*x509.Certificate
+	oidcState             string
+	oidcCheckState        bool
+	oidcIDToken           string
+	oidcCheckIDToken      bool
+	oidcNonce             string
+	oidcCodeVerifier      string
+	metadata              map[string]interface{}
+	clientCertificate     *tls.Certificate
+	apiKeyMetadataKey     string
+	azureIdentity         *providers.AzureIdentityRequest
+	onBehalfOf            string
+
+	err error
 }
 
 // An Option is the type of various options
 // You can add the issue requests.
 type Option func(*issueOpts)
 
+// errorOpt returns an Option recording the given error, which
+// is then returned by the issue call. It is used by the options
+// given values that can come from configuration or user input.
+func errorOpt(err error) Option {
+
+	return func(opts *issueOpts) {
+		if opts.err == nil {
+			opts.err = err
+		}
+	}
+}
+
 // OptQuota sets the maximum time the issued token
 // can be used.
 func OptQuota(quota int) Option {
@@ -37,6 +85,110 @@ func OptQuota(quota int) Option {
 	}
 }
 
+// QuotaInfo holds the quota information returned
+// by midgard after issuing a quota limited token.
+type QuotaInfo struct {
+
+	// Quota is the number of times the token can be used.
+	// Zero means the token is not quota limited.
+	Quota int
+
+	// Remaining is the number of uses left on the quota,
+	// if midgard returned it. Otherwise, it is set to -1.
+	Remaining int
+}
+
+// OptQuotaInfo registers a function that will be called with
+// the quota information returned by midgard after a successful
+// issuance.
+func OptQuotaInfo(f func(QuotaInfo)) Option {
+
+	return func(opts *issueOpts) {
+		opts.quotaInfoFunc = f
+	}
+}
+
+// OptRateLimitInfo registers a function that will be called with
+// the rate limit information returned by midgard in response to the
+// issue request, whether it succeeded or not.
+func OptRateLimitInfo(f func(RateLimitInfo)) Option {
+
+	return func(opts *issueOpts) {
+		opts.rateLimitInfoFunc = f
+	}
+}
+
+// OptValidityJitter randomly reduces the requested validity by up to the
+// given fraction of it, between 0 and 1. This spreads the renewals of the
+// agents deployed at the same time, so they do not all hit midgard at once.
+// For instance, with a fraction of 0.1, a validity of 1h becomes a random
+// validity between 54m and 1h.
+func OptValidityJitter(fraction float64) Option {
+
+	if fraction < 0 || fraction >= 1 {
+		panic("validity jitter must be between 0 and 1")
+	}
+
+	return func(opts *issueOpts) {
+		opts.validityJitter = fraction
+	}
+}
+
+// OptServerName sets the TLS server name sent to midgard and used to
+// verify its certificate, for instance when midgard is reached through
+// an IP address or an internal name not present in its certificate.
+func OptServerName(name string) Option {
+
+	if name == "" {
+		panic("server name cannot be empty")
+	}
+
+	return func(opts *issueOpts) {
+		opts.serverName = name
+	}
+}
+
+// OptTimeout sets the maximum time the issue call can take, retries
+// included. As it is applied to the context of the call, it can only
+// shorten the timeout set on the client.
+func OptTimeout(timeout time.Duration) Option {
+
+	if timeout <= 0 {
+		panic("timeout must be greater than 0")
+	}
+
+	return func(opts *issueOpts) {
+		opts.timeout = timeout
+	}
+}
+
+// OptHeader adds a header sent with the issue request. It takes
+// precedence over the headers set on the client with OptionHeader.
+func OptHeader(key string, value string) Option {
+
+	return func(opts *issueOpts) {
+		if opts.headers == nil {
+			opts.headers = http.Header{}
+		}
+		opts.headers.Add(key, value)
+	}
+}
+
+// OptUserAgent replaces the application part of the User-Agent
+// set on the client with OptionUserAgent for the issue request.
+// For instance, OptUserAgent("apoctl/1.2.3") gives
+// "midgard-lib/v1.10.0 apoctl/1.2.3".
+func OptUserAgent(userAgent string) Option {
+
+	if userAgent == "" {
+		panic("userAgent cannot be empty")
+	}
+
+	return func(opts *issueOpts) {
+		opts.userAgent = userAgent
+	}
+}
+
 // OptOpaque passes opaque data that will be
 // included in the JWT.
 func OptOpaque(opaque map[string]string) Option {
@@ -46,9 +198,75 @@ func OptOpaque(opaque map[string]string) Option {
 	}
 }
 
-// OptAudience passes the requested audience for the token.
-// Using OptAudience is deprecated. Switch to OptLimitAuthz. (TODO: Find real mapping as OptLimitAuthz does not exist)
-func OptAudience(audience string) Option {
+// OptOpaqueValue adds a single opaque key/value pair that
+// will be included in the JWT. It can be combined with
+// OptOpaque.
+func OptOpaqueValue(key string, value string) Option {
+
+	return func(opts *issueOpts) {
+		opaque := make(map[string]string, len(opts.opaque)+1)
+		for k, v := range opts.opaque {
+			opaque[k] = v
+		}
+		opaque[key] = value
+		opts.opaque = opaque
+	}
+}
+
+// OptMetadata adds the given key and value to the metadata of the
+// issue request, to pass data supported by newer midgard versions.
+// The metadata set by the IssueFromX methods takes precedence.
+func OptMetadata(key string, value interface{}) Option {
+
+	if key == "" {
+		panic("metadata key cannot be empty")
+	}
+
+	return func(opts *issueOpts) {
+		metadata := make(map[string]interface{}, len(opts.metadata)+1)
+		for k, v := range opts.metadata {
+			metadata[k] = v
+		}
+		metadata[key] = value
+		opts.metadata = metadata
+	}
+}
+
+// OptImpersonate asks for a token issued on behalf of the given subject
+// instead of the identity of the caller, for instance by a provisioning
+// controller minting tokens for the agents it manages. The subject is sent
+// in the onBehalfOf metadata. It is only supported by the realms allowing
+// delegated issuance, and midgard checks that the caller is authorized to
+// impersonate the subject.
+func OptImpersonate(subject string) Option {
+
+	if subject == "" {
+		panic("impersonated subject cannot be empty")
+	}
+
+	return func(opts *issueOpts) {
+		opts.onBehalfOf = subject
+	}
+}
+
+// OptAudience asks for a token restricted to the given audiences.
+// Multiple audiences are sent as a comma separated list, which is
+// the format checked by verify.Verifier.VerifyAudience. The issue
+// call returns an error if no audience is given, or if one of them
+// is empty or contains a comma.
+func OptAudience(audiences ...string) Option {
+
+	if len(audiences) == 0 {
+		return errorOpt(fmt.Errorf("at least one audience must be given"))
+	}
+
+	for _, aud := range audiences {
+		if aud == "" || strings.Contains(aud, ",") {
+			return errorOpt(fmt.Errorf("invalid audience '%s'", aud))
+		}
+	}
+
+	audience := strings.Join(audiences, ",")
 
 	return func(opts *issueOpts) {
 		opts.audience = audience
@@ -78,3 +296,119 @@ func OptRestrictNetworks(networks []string) Option {
 		opts.restrictedNetworks = networks
 	}
 }
+
+// OptKeepRestrictions makes RenewToken request the namespace, permissions
+// and networks restrictions of the renewed token for the new one. The
+// restrictions given with the other options take precedence.
+func OptKeepRestrictions() Option {
+
+	return func(opts *issueOpts) {
+		opts.keepRestrictions = true
+	}
+}
+
+// OptSignRequest signs the issue request body with the client
+// certificate key and sends it as a detached JWS in the
+// SignatureHeader header. This provides integrity and proof of
+// origin when the request goes through TLS terminating proxies.
+func OptSignRequest() Option {
+
+	return func(opts *issueOpts) {
+		opts.signRequest = true
+	}
+}
+
+// OptRestrictToCallerNetwork asks for a token restricted to the network
+// of the caller. If no network is given, the public address of the caller
+// is looked up using the endpoint set by OptionPublicIPLookupURL, and the
+// issuance fails if none has been set.
+func OptRestrictToCallerNetwork(networks ...string) Option {
+
+	return func(opts *issueOpts) {
+		opts.restrictToCaller = true
+		opts.callerNetworks = networks
+	}
+}
+
+// OptSAMLIdPCertificates makes IssueFromSAMLStep2 check the SAMLResponse
+// locally before sending it to midgard. The response must have a success
+// status and be signed with one of the given identity provider certificates,
+// otherwise an error describing the problem is returned. The signature itself
+// is not verified locally: midgard remains responsible for it.
+func OptSAMLIdPCertificates(certs ...*x509.Certificate) Option {
+
+	if len(certs) == 0 {
+		panic("at least one certificate must be given")
+	}
+
+	for _, cert := range certs {
+		if cert == nil {
+			panic("certificate cannot be nil")
+		}
+	}
+
+	return func(opts *issueOpts) {
+		opts.samlIdPCertificates = certs
+	}
+}
+
+// OptOIDCState makes IssueFromOIDCStep2 check locally that the
+// state returned by the provider is the given one, which must be
+// the state of the auth endpoint returned by IssueFromOIDCStep1.
+// IssueFromOIDCStep2 returns an error if it is empty.
+func OptOIDCState(state string) Option {
+
+	return func(opts *issueOpts) {
+		opts.oidcState = state
+		opts.oidcCheckState = true
+	}
+}
+
+// OptOIDCIDToken makes IssueFromOIDCStep2 check locally the ID token
+// returned by the provider alongside the code, in flows returning one.
+// The ID token must not be expired and, if the given nonce is not empty,
+// its nonce must match. Its signature is not verified locally.
+// IssueFromOIDCStep2WithStore uses the stored nonce if none is given.
+// IssueFromOIDCStep2 returns an error if the ID token is empty.
+func OptOIDCIDToken(idToken string, nonce string) Option {
+
+	return func(opts *issueOpts) {
+		opts.oidcIDToken = idToken
+		opts.oidcNonce = nonce
+		opts.oidcCheckIDToken = true
+	}
+}
+
+// OptOIDCCodeVerifier makes IssueFromOIDCStep2 send the given PKCE
+// code verifier, which must be the one returned by
+// IssueFromOIDCStep1WithPKCE, so midgard can redeem the code.
+// IssueFromOIDCStep2 returns an error if it is malformed.
+func OptOIDCCodeVerifier(verifier string) Option {
+
+	return func(opts *issueOpts) {
+		opts.oidcCodeVerifier = verifier
+	}
+}
+
+// OptAPIKeyMetadataKey sets the metadata key used by IssueFromAPIKey
+// to send the API key, when midgard expects another one than apiKey.
+func OptAPIKeyMetadataKey(key string) Option {
+
+	if key == "" {
+		panic("api key metadata key cannot be empty")
+	}
+
+	return func(opts *issueOpts) {
+		opts.apiKeyMetadataKey = key
+	}
+}
+
+// OptAzureIdentity sets the managed identity token IssueFromAzureIdentityToken
+// retrieves when it is not given a token, to use a user-assigned identity, a
+// custom resource or another api version of the Metadata Identity Service.
+func OptAzureIdentity(request providers.AzureIdentityRequest) Option {
+
+	return func(opts *issueOpts) {
+		opts.azureIdentity = &request
+	}
+}
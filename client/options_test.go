@@ -12,9 +12,18 @@
 package midgardclient
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/midgard-lib/ldaputils"
+	"go.aporeto.io/midgard-lib/tokenmanager/providers"
 )
 
 func TestBahamut_Options(t *testing.T) {
@@ -35,16 +44,120 @@ func TestBahamut_Options(t *testing.T) {
 		So(func() { OptQuota(-1)(&c) }, ShouldPanicWith, "quota must be a positive number")
 	})
 
+	Convey("Calling OptValidityJitter should work", t, func() {
+		OptValidityJitter(0.1)(&c)
+		So(c.validityJitter, ShouldEqual, 0.1)
+	})
+
+	Convey("Calling OptValidityJitter with invalid values should panic", t, func() {
+		So(func() { OptValidityJitter(-0.1) }, ShouldPanicWith, "validity jitter must be between 0 and 1")
+		So(func() { OptValidityJitter(1) }, ShouldPanicWith, "validity jitter must be between 0 and 1")
+	})
+
 	Convey("Calling OptOpaque should work", t, func() {
 		OptOpaque(map[string]string{"a": "b"})(&c)
 		So(c.opaque, ShouldResemble, map[string]string{"a": "b"})
 	})
 
+	Convey("Calling OptOpaqueValue should work", t, func() {
+		OptOpaqueValue("c", "d")(&c)
+		So(c.opaque, ShouldResemble, map[string]string{"a": "b", "c": "d"})
+	})
+
+	Convey("Calling OptOpaqueValue on empty options should work", t, func() {
+		c := issueOpts{}
+		OptOpaqueValue("c", "d")(&c)
+		So(c.opaque, ShouldResemble, map[string]string{"c": "d"})
+	})
+
+	Convey("Calling OptMetadata should work", t, func() {
+		OptMetadata("a", "b")(&c)
+		OptMetadata("c", 42)(&c)
+		So(c.metadata, ShouldResemble, map[string]interface{}{"a": "b", "c": 42})
+	})
+
+	Convey("Calling OptMetadata with an empty key should panic", t, func() {
+		So(func() { OptMetadata("", "b") }, ShouldPanicWith, "metadata key cannot be empty")
+	})
+
+	Convey("Calling OptAPIKeyMetadataKey should work", t, func() {
+		OptAPIKeyMetadataKey("key")(&c)
+		So(c.apiKeyMetadataKey, ShouldEqual, "key")
+	})
+
+	Convey("Calling OptAPIKeyMetadataKey with an empty key should panic", t, func() {
+		So(func() { OptAPIKeyMetadataKey("") }, ShouldPanicWith, "api key metadata key cannot be empty")
+	})
+
+	Convey("Calling OptImpersonate should work", t, func() {
+		OptImpersonate("agent-1")(&c)
+		So(c.onBehalfOf, ShouldEqual, "agent-1")
+	})
+
+	Convey("Calling OptImpersonate with an empty subject should panic", t, func() {
+		So(func() { OptImpersonate("") }, ShouldPanicWith, "impersonated subject cannot be empty")
+	})
+
+	Convey("Calling OptOIDCCodeVerifier should work", t, func() {
+		OptOIDCCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")(&c)
+		So(c.oidcCodeVerifier, ShouldEqual, "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	})
+
+	Convey("Calling OptAzureIdentity should work", t, func() {
+		OptAzureIdentity(providers.AzureIdentityRequest{ClientID: "id", Resource: "api://midgard"})(&c)
+		So(c.azureIdentity, ShouldResemble, &providers.AzureIdentityRequest{ClientID: "id", Resource: "api://midgard"})
+	})
+
 	Convey("Calling OptAudience should work", t, func() {
 		OptAudience("audience")(&c)
 		So(c.audience, ShouldResemble, "audience")
 	})
 
+	Convey("Calling OptAudience with multiple audiences should work", t, func() {
+		OptAudience("a", "b")(&c)
+		So(c.audience, ShouldEqual, "a,b")
+	})
+
+	Convey("Calling OptAudience without audience should record an error", t, func() {
+		o := issueOpts{}
+		OptAudience()(&o)
+		So(o.err, ShouldNotBeNil)
+		So(o.err.Error(), ShouldEqual, "at least one audience must be given")
+	})
+
+	Convey("Calling OptAudience with an invalid audience should record an error", t, func() {
+		o := issueOpts{}
+		OptAudience("a", "")(&o)
+		So(o.err.Error(), ShouldEqual, "invalid audience ''")
+
+		o = issueOpts{}
+		OptAudience("a,b")(&o)
+		So(o.err.Error(), ShouldEqual, "invalid audience 'a,b'")
+	})
+
+	Convey("Given I have a client and an invalid audience", t, func() {
+
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I issue a token with it", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute, OptAudience(""))
+
+			Convey("Then the issue call should fail without sending the request", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid audience ''")
+				So(calls, ShouldEqual, 0)
+			})
+		})
+	})
+
 	Convey("Calling OptRestrictNamespace should work", t, func() {
 		OptRestrictNamespace("/ns")(&c)
 		So(c.restrictedNamespace, ShouldEqual, "/ns")
@@ -59,4 +172,196 @@ func TestBahamut_Options(t *testing.T) {
 		OptRestrictNetworks([]string{"1.0.0.0/8", "2.0.0.0/8"})(&c)
 		So(c.restrictedNetworks, ShouldResemble, []string{"1.0.0.0/8", "2.0.0.0/8"})
 	})
+
+	Convey("Calling OptSignRequest should work", t, func() {
+		OptSignRequest()(&c)
+		So(c.signRequest, ShouldBeTrue)
+	})
+
+	Convey("Calling OptRestrictToCallerNetwork should work", t, func() {
+		OptRestrictToCallerNetwork("1.2.3.4")(&c)
+		So(c.restrictToCaller, ShouldBeTrue)
+		So(c.callerNetworks, ShouldResemble, []string{"1.2.3.4"})
+	})
+
+	Convey("Calling OptQuotaInfo should work", t, func() {
+		OptQuotaInfo(func(QuotaInfo) {})(&c)
+		So(c.quotaInfoFunc, ShouldNotBeNil)
+	})
+
+	Convey("Calling OptTimeout should work", t, func() {
+		OptTimeout(time.Second)(&c)
+		So(c.timeout, ShouldEqual, time.Second)
+	})
+
+	Convey("Calling OptTimeout with an invalid timeout should panic", t, func() {
+		So(func() { OptTimeout(0) }, ShouldPanicWith, "timeout must be greater than 0")
+	})
+
+	Convey("Calling OptHeader should work", t, func() {
+		OptHeader("X-A", "a")(&c)
+		OptHeader("X-A", "b")(&c)
+		So(c.headers["X-A"], ShouldResemble, []string{"a", "b"})
+	})
+
+	Convey("Calling OptUserAgent should work", t, func() {
+		OptUserAgent("apoctl/1.2.3")(&c)
+		So(c.userAgent, ShouldEqual, "apoctl/1.2.3")
+	})
+
+	Convey("Calling OptUserAgent with an empty user agent should panic", t, func() {
+		So(func() { OptUserAgent("") }, ShouldPanicWith, "userAgent cannot be empty")
+	})
+}
+
+func TestClient_PerCallOptions(t *testing.T) {
+
+	Convey("Given I have a server and a client with default headers and user agent", t, func() {
+
+		var header http.Header
+		release := make(chan struct{})
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			if r.Header.Get("X-Slow") != "" {
+				<-release
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+		defer close(release)
+
+		cl := NewClientWithOptions(
+			ts.URL,
+			OptionHeader("X-Tenant", "acme"),
+			OptionHeader("X-Team", "red"),
+			OptionUserAgent("app", "1.0.0"),
+		)
+
+		Convey("When I issue a token with per call headers and user agent", func() {
+
+			_, err := cl.IssueFromVince(
+				context.Background(), "account", "password", "", time.Minute,
+				OptHeader("X-Tenant", "other"),
+				OptUserAgent("job/2.0.0"),
+			)
+
+			Convey("Then the per call values should take precedence", func() {
+				So(err, ShouldBeNil)
+				So(header.Get("X-Tenant"), ShouldEqual, "other")
+				So(header.Get("X-Team"), ShouldEqual, "red")
+				So(header.Get("User-Agent"), ShouldEqual, libraryUserAgent+" job/2.0.0")
+			})
+		})
+
+		Convey("When I issue a token without per call options", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the client values should be used", func() {
+				So(err, ShouldBeNil)
+				So(header.Get("X-Tenant"), ShouldEqual, "acme")
+				So(header.Get("User-Agent"), ShouldEqual, libraryUserAgent+" app/1.0.0")
+			})
+		})
+
+		Convey("When I issue a token with a timeout shorter than the response time", func() {
+
+			start := time.Now()
+			_, err := cl.IssueFromVince(
+				context.Background(), "account", "password", "", time.Minute,
+				OptHeader("X-Slow", "1"),
+				OptTimeout(50*time.Millisecond),
+			)
+
+			Convey("Then it should fail after the timeout", func() {
+				So(err, ShouldNotBeNil)
+				So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+			})
+		})
+	})
+}
+
+func TestClient_OptMetadata(t *testing.T) {
+
+	Convey("Given I have a server", t, func() {
+
+		var issue *gaia.Issue
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			issue = gaia.NewIssue()
+			_ = json.NewDecoder(r.Body).Decode(issue)
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I issue a token with additional metadata", func() {
+
+			_, err := cl.IssueFromAporetoIdentityToken(context.Background(), "thetoken", time.Minute,
+				OptMetadata("token", "other"),
+				OptMetadata("extra", "value"),
+			)
+
+			Convey("Then the metadata should be added without overriding the realm ones", func() {
+				So(err, ShouldBeNil)
+				So(issue.Metadata["token"], ShouldEqual, "thetoken")
+				So(issue.Metadata["extra"], ShouldEqual, "value")
+			})
+		})
+
+		Convey("When I issue a token from LDAP with additional metadata and opaque data", func() {
+
+			_, err := cl.IssueFromLDAP(context.Background(), &ldaputils.LDAPInfo{Username: "user"}, "/ns", "ldap", time.Minute,
+				OptMetadata("provider", "other"),
+				OptMetadata("extra", "value"),
+				OptOpaque(map[string]string{"k": "v"}),
+			)
+
+			Convey("Then the metadata should be added without overriding the realm ones", func() {
+				So(err, ShouldBeNil)
+				So(issue.Metadata["provider"], ShouldEqual, "ldap")
+				So(issue.Metadata["username"], ShouldEqual, "user")
+				So(issue.Metadata["extra"], ShouldEqual, "value")
+				So(issue.Opaque, ShouldResemble, map[string]string{"k": "v"})
+			})
+		})
+
+		Convey("When I issue a token on behalf of another subject", func() {
+
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute,
+				OptMetadata("onBehalfOf", "other"),
+				OptImpersonate("agent-1"),
+			)
+
+			Convey("Then the impersonated subject should be sent", func() {
+				So(err, ShouldBeNil)
+				So(issue.Metadata["onBehalfOf"], ShouldEqual, "agent-1")
+			})
+		})
+
+		Convey("When I issue a token from LDAP on behalf of another subject", func() {
+
+			_, err := cl.IssueFromLDAP(context.Background(), &ldaputils.LDAPInfo{Username: "user"}, "/ns", "ldap", time.Minute,
+				OptImpersonate("agent-1"),
+			)
+
+			Convey("Then the impersonated subject should be sent along the LDAP metadata", func() {
+				So(err, ShouldBeNil)
+				So(issue.Metadata["onBehalfOf"], ShouldEqual, "agent-1")
+				So(issue.Metadata["username"], ShouldEqual, "user")
+				So(issue.Metadata["namespace"], ShouldEqual, "/ns")
+			})
+		})
+
+		Convey("When I issue a token without impersonation", func() {
+
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute)
+
+			Convey("Then no metadata should be sent", func() {
+				So(err, ShouldBeNil)
+				So(issue.Metadata, ShouldBeEmpty)
+			})
+		})
+	})
 }
@@ -0,0 +1,82 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// PingInfo holds the result of a Ping.
+type PingInfo struct {
+	URL           string
+	StatusCode    int
+	Latency       time.Duration
+	ServerVersion string
+}
+
+// Ping sends a single request to midgard, without retrying, and returns
+// how long it took to get the response and the server version from its
+// Server header, if any. It returns an error if midgard is unreachable
+// or responds with a 5xx, so it can be used in readiness probes.
+func (a *Client) Ping(ctx context.Context) (PingInfo, error) {
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.ping")
+	defer span.Finish()
+
+	endpoint := a.endpoints.pick()
+	info := PingInfo{URL: endpoint}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return info, err
+	}
+	req = req.WithContext(subctx)
+	req.Close = !a.config.keepAlive
+
+	for k, v := range a.config.headers {
+		req.Header[k] = append([]string{}, v...)
+	}
+	req.Header.Set("User-Agent", a.config.userAgent())
+
+	start := time.Now()
+	resp, err := a.currentHTTPClient().Do(req)
+	info.Latency = time.Since(start)
+
+	if err != nil {
+		err = redactSecrets(err)
+		a.endpoints.markDown(endpoint, err)
+		return info, fmt.Errorf("unable to reach midgard: %s", err)
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close() // nolint: errcheck
+
+	a.observeClockSkew(resp.Header, start, start.Add(info.Latency))
+
+	info.StatusCode = resp.StatusCode
+	info.ServerVersion = resp.Header.Get("Server")
+
+	if resp.StatusCode >= 500 {
+		err = fmt.Errorf("midgard responded with status code %d", resp.StatusCode)
+		a.endpoints.markDown(endpoint, err)
+		return info, err
+	}
+
+	a.endpoints.markUp(endpoint)
+
+	return info, nil
+}
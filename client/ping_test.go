@@ -0,0 +1,84 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_Ping(t *testing.T) {
+
+	Convey("Given I have a midgard server", t, func() {
+
+		var status int32 = http.StatusNotFound
+		var userAgent string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.Header.Get("User-Agent")
+			w.Header().Set("Server", "midgard/1.2.3")
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionUserAgent("app", "1.0"))
+
+		Convey("When I ping it", func() {
+
+			info, err := cl.Ping(context.Background())
+
+			Convey("Then it should work", func() {
+				So(err, ShouldBeNil)
+				So(info.URL, ShouldEqual, ts.URL)
+				So(info.StatusCode, ShouldEqual, http.StatusNotFound)
+				So(info.ServerVersion, ShouldEqual, "midgard/1.2.3")
+				So(info.Latency, ShouldBeGreaterThan, 0)
+				So(userAgent, ShouldEndWith, "app/1.0")
+			})
+		})
+
+		Convey("When I ping it while it is failing", func() {
+
+			atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+			info, err := cl.Ping(context.Background())
+
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "midgard responded with status code 503")
+				So(info.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+				So(cl.EndpointsHealth()[0].Healthy, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given I have an unreachable midgard server", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I ping it", func() {
+
+			_, err := cl.Ping(context.Background())
+
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to reach midgard: ")
+			})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+const pkceMethodS256 = "S256"
+
+// IssueFromOIDCStep1WithPKCE performs IssueFromOIDCStep1 with a Proof Key
+// for Code Exchange, as described in RFC 7636, for public clients that
+// cannot keep a client secret. It returns the OIDC auth endpoint and the
+// code verifier, which must be kept until the second step and given to
+// IssueFromOIDCStep2 with OptOIDCCodeVerifier. Only the S256 challenge is
+// sent to midgard.
+func (a *Client) IssueFromOIDCStep1WithPKCE(ctx context.Context, namespace string, provider string, redirectURL string) (string, string, error) {
+
+	verifier, err := newPKCEVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := a.issueFromOIDCStep1(ctx, namespace, provider, redirectURL, pkceChallenge(verifier))
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, verifier, nil
+}
+
+// newPKCEVerifier returns a new random code verifier. It encodes
+// 32 random bytes, which gives the 43 characters recommended by
+// RFC 7636.
+func newPKCEVerifier() (string, error) {
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate pkce code verifier: %s", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge returns the S256 code challenge of the given verifier.
+func pkceChallenge(verifier string) string {
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validatePKCEVerifier returns an error if the given code verifier
+// is not between 43 and 128 unreserved characters, as required by
+// RFC 7636.
+func validatePKCEVerifier(verifier string) error {
+
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return fmt.Errorf("pkce code verifier must be between 43 and 128 characters")
+	}
+
+	for _, c := range verifier {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return fmt.Errorf("pkce code verifier contains invalid character '%c'", c)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_pkceChallenge(t *testing.T) {
+
+	Convey("Given I have the verifier of RFC 7636 appendix B", t, func() {
+
+		verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+		Convey("Then the challenge should be correct", func() {
+			So(pkceChallenge(verifier), ShouldEqual, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+		})
+	})
+
+	Convey("Given I generate a verifier", t, func() {
+
+		verifier, err := newPKCEVerifier()
+
+		Convey("Then it should be valid", func() {
+			So(err, ShouldBeNil)
+			So(verifier, ShouldHaveLength, 43)
+			So(validatePKCEVerifier(verifier), ShouldBeNil)
+		})
+	})
+}
+
+func TestClient_IssueFromOIDCWithPKCE(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expectedRequest = gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+
+			if expectedRequest.Metadata["code"] == nil {
+				w.Header().Set("Location", "http://laba")
+				w.WriteHeader(http.StatusFound)
+				return
+			}
+
+			fmt.Fprintln(w, `{"data": "","realm": "oidc","token": "token"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromOIDCStep1WithPKCE", func() {
+
+			authURL, verifier, err := cl.IssueFromOIDCStep1WithPKCE(context.Background(), "aporeto", "okta", "http://ici")
+
+			Convey("Then the auth endpoint and verifier should be returned", func() {
+				So(err, ShouldBeNil)
+				So(authURL, ShouldEqual, "http://laba")
+				So(validatePKCEVerifier(verifier), ShouldBeNil)
+			})
+
+			Convey("Then the challenge should have been sent", func() {
+				So(expectedRequest.Metadata["codeChallenge"], ShouldEqual, pkceChallenge(verifier))
+				So(expectedRequest.Metadata["codeChallengeMethod"], ShouldEqual, "S256")
+				So(expectedRequest.Metadata, ShouldNotContainKey, "codeVerifier")
+			})
+
+			Convey("When I call IssueFromOIDCStep2 with the verifier", func() {
+
+				token, err := cl.IssueFromOIDCStep2(context.Background(), "code", "state", time.Minute, OptOIDCCodeVerifier(verifier))
+
+				Convey("Then the verifier should have been sent", func() {
+					So(err, ShouldBeNil)
+					So(token, ShouldEqual, "token")
+					So(expectedRequest.Metadata["codeVerifier"], ShouldEqual, verifier)
+					So(expectedRequest.Metadata, ShouldNotContainKey, "codeChallenge")
+				})
+			})
+		})
+
+		Convey("When I call IssueFromOIDCStep1", func() {
+
+			_, err := cl.IssueFromOIDCStep1(context.Background(), "aporeto", "okta", "http://ici")
+
+			Convey("Then no challenge should have been sent", func() {
+				So(err, ShouldBeNil)
+				So(expectedRequest.Metadata, ShouldNotContainKey, "codeChallenge")
+				So(expectedRequest.Metadata, ShouldNotContainKey, "codeChallengeMethod")
+			})
+		})
+
+		Convey("When I call IssueFromOIDCStep2 with an invalid verifier", func() {
+
+			_, err1 := cl.IssueFromOIDCStep2(context.Background(), "code", "state", time.Minute, OptOIDCCodeVerifier("short"))
+			_, err2 := cl.IssueFromOIDCStep2(context.Background(), "code", "state", time.Minute, OptOIDCCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjX+"))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err1, ShouldNotBeNil)
+				So(err1.Error(), ShouldEqual, "pkce code verifier must be between 43 and 128 characters")
+				So(err2, ShouldNotBeNil)
+				So(err2.Error(), ShouldEqual, "pkce code verifier contains invalid character '+'")
+				So(expectedRequest.Metadata, ShouldNotContainKey, "code")
+			})
+		})
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A noProxyRule is a parsed NO_PROXY entry.
+type noProxyRule struct {
+	all    bool
+	ipnet  *net.IPNet
+	ip     net.IP
+	domain string
+	exact  bool
+	port   string
+}
+
+// parseNoProxyRule parses a NO_PROXY entry. It can be "*", an IP
+// address, a CIDR, or a domain name optionally prefixed by "." or
+// "*." to only match its subdomains. IP addresses and domain names
+// can be followed by a port.
+func parseNoProxyRule(rule string) (noProxyRule, error) {
+
+	rule = strings.ToLower(strings.TrimSpace(rule))
+
+	if rule == "" {
+		return noProxyRule{}, fmt.Errorf("empty no proxy rule")
+	}
+
+	if rule == "*" {
+		return noProxyRule{all: true}, nil
+	}
+
+	if _, ipnet, err := net.ParseCIDR(rule); err == nil {
+		return noProxyRule{ipnet: ipnet}, nil
+	}
+
+	host, port := rule, ""
+	if h, p, err := net.SplitHostPort(rule); err == nil {
+		host, port = h, p
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return noProxyRule{ip: ip, port: port}, nil
+	}
+
+	if strings.HasPrefix(host, "*.") {
+		host = host[1:]
+	}
+
+	r := noProxyRule{domain: host, exact: !strings.HasPrefix(host, "."), port: port}
+	if strings.Trim(r.domain, ".") == "" || strings.ContainsAny(r.domain, "/*") {
+		return noProxyRule{}, fmt.Errorf("invalid no proxy rule '%s'", rule)
+	}
+
+	return r, nil
+}
+
+// matches returns true if the given host and port match the rule.
+func (r noProxyRule) matches(host string, port string) bool {
+
+	if r.all {
+		return true
+	}
+
+	if r.port != "" && r.port != port {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	switch {
+
+	case r.ipnet != nil:
+		return ip != nil && r.ipnet.Contains(ip)
+
+	case r.ip != nil:
+		return ip != nil && r.ip.Equal(ip)
+
+	case ip != nil:
+		return false
+
+	case r.exact:
+		return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+
+	default:
+		return strings.HasSuffix(host, r.domain)
+	}
+}
+
+// newProxyFunc returns a function returning the given proxy URL for
+// all requests except the ones matching the given no proxy rules.
+func newProxyFunc(proxyURL *url.URL, rules []noProxyRule) func(*http.Request) (*url.URL, error) {
+
+	return func(req *http.Request) (*url.URL, error) {
+
+		host := strings.ToLower(req.URL.Hostname())
+		port := req.URL.Port()
+		if port == "" {
+			port = "443"
+			if req.URL.Scheme == "http" {
+				port = "80"
+			}
+		}
+
+		for _, r := range rules {
+			if r.matches(host, port) {
+				return nil, nil
+			}
+		}
+
+		return proxyURL, nil
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_noProxyRules(t *testing.T) {
+
+	Convey("Given I have some no proxy rules", t, func() {
+
+		matches := func(rule string, rawurl string) bool {
+			r, err := parseNoProxyRule(rule)
+			So(err, ShouldBeNil)
+			u, _ := url.Parse(rawurl)
+			p, _ := newProxyFunc(&url.URL{Scheme: "http", Host: "proxy:3128"}, []noProxyRule{r})(&http.Request{URL: u})
+			return p == nil
+		}
+
+		Convey("Then they should match like NO_PROXY", func() {
+			So(matches("*", "https://midgard.com"), ShouldBeTrue)
+			So(matches("midgard.com", "https://midgard.com"), ShouldBeTrue)
+			So(matches("midgard.com", "https://api.MIDGARD.com"), ShouldBeTrue)
+			So(matches("midgard.com", "https://notmidgard.com"), ShouldBeFalse)
+			So(matches(".midgard.com", "https://midgard.com"), ShouldBeFalse)
+			So(matches(".midgard.com", "https://api.midgard.com"), ShouldBeTrue)
+			So(matches("*.midgard.com", "https://api.midgard.com"), ShouldBeTrue)
+			So(matches("midgard.com:443", "https://midgard.com"), ShouldBeTrue)
+			So(matches("midgard.com:443", "http://midgard.com"), ShouldBeFalse)
+			So(matches("midgard.com:8443", "https://midgard.com:8443"), ShouldBeTrue)
+			So(matches("10.0.0.0/8", "https://10.1.2.3"), ShouldBeTrue)
+			So(matches("10.0.0.0/8", "https://11.1.2.3"), ShouldBeFalse)
+			So(matches("10.0.0.0/8", "https://midgard.com"), ShouldBeFalse)
+			So(matches("10.1.2.3", "https://10.1.2.3"), ShouldBeTrue)
+			So(matches("::1", "https://[::1]:443"), ShouldBeTrue)
+			So(matches("10.1.2.3", "https://10.1.2.4"), ShouldBeFalse)
+			So(matches("midgard.com", "https://10.1.2.3"), ShouldBeFalse)
+		})
+
+		Convey("Then invalid rules should be rejected", func() {
+			_, err := parseNoProxyRule(" ")
+			So(err, ShouldNotBeNil)
+			_, err = parseNoProxyRule(".")
+			So(err, ShouldNotBeNil)
+			_, err = parseNoProxyRule("a/b")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestClient_OptionProxy(t *testing.T) {
+
+	Convey("Calling New with OptionProxy and invalid values should return an error", t, func() {
+
+		cl, err := New("https://midgard.com", OptionProxy("proxy:3128"))
+		So(cl, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid proxy url 'proxy:3128'")
+
+		cl, err = New("https://midgard.com", OptionProxy("http://proxy:3128", "a/b"))
+		So(cl, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid no proxy rule 'a/b'")
+	})
+
+	Convey("Given I have a proxy and a midgard server", t, func() {
+
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.Host
+			fmt.Fprintln(w, `{"token": "proxied"}`)
+		}))
+		defer proxy.Close()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"token": "direct"}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I issue a token through the proxy", func() {
+
+			cl := NewClientWithOptions("http://midgard.example.com", OptionProxy(proxy.URL))
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the request should have been sent to the proxy", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "proxied")
+				So(proxied, ShouldEqual, "midgard.example.com")
+			})
+		})
+
+		Convey("When I issue a token to a host excluded from the proxy", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionProxy(proxy.URL, "example.com", "127.0.0.0/8"))
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then the request should have been sent directly", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "direct")
+				So(proxied, ShouldBeEmpty)
+			})
+		})
+	})
+}
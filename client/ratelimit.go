@@ -0,0 +1,74 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimitInfo holds the rate limit information
+// returned by midgard in response to a request.
+type RateLimitInfo struct {
+
+	// Limit is the number of requests allowed in the current
+	// window, if midgard returned it. Otherwise, it is set to -1.
+	Limit int
+
+	// Remaining is the number of requests left in the current
+	// window, if midgard returned it. Otherwise, it is set to -1.
+	Remaining int
+
+	// Reset is the time left before the current window
+	// ends, if midgard returned it.
+	Reset time.Duration
+
+	// RetryAfter is the time midgard asked to wait
+	// before sending a new request, if any.
+	RetryAfter time.Duration
+}
+
+// Limited returns true if midgard asked to slow down.
+func (i RateLimitInfo) Limited() bool {
+
+	return i.Remaining == 0 || i.RetryAfter > 0
+}
+
+func rateLimitInfoFromResponse(header http.Header, now time.Time) RateLimitInfo {
+
+	info := RateLimitInfo{
+		Limit:      -1,
+		Remaining:  -1,
+		RetryAfter: retryAfter(header, now),
+	}
+
+	if v, err := strconv.Atoi(header.Get(rateLimitLimitHeader)); err == nil {
+		info.Limit = v
+	}
+
+	if v, err := strconv.Atoi(header.Get(rateLimitRemainingHeader)); err == nil {
+		info.Remaining = v
+	}
+
+	if v, err := strconv.Atoi(header.Get(rateLimitResetHeader)); err == nil && v > 0 {
+		info.Reset = time.Duration(v) * time.Second
+	}
+
+	return info
+}
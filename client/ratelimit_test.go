@@ -0,0 +1,75 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimitInfo(t *testing.T) {
+
+	Convey("Given I have headers without rate limit information", t, func() {
+
+		info := rateLimitInfoFromResponse(http.Header{}, time.Now())
+
+		Convey("Then the info should be unknown", func() {
+			So(info, ShouldResemble, RateLimitInfo{Limit: -1, Remaining: -1})
+			So(info.Limited(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given I have headers with rate limit information", t, func() {
+
+		h := http.Header{}
+		h.Set("X-RateLimit-Limit", "100")
+		h.Set("X-RateLimit-Remaining", "0")
+		h.Set("X-RateLimit-Reset", "30")
+		info := rateLimitInfoFromResponse(h, time.Now())
+
+		Convey("Then the info should be correct", func() {
+			So(info, ShouldResemble, RateLimitInfo{Limit: 100, Remaining: 0, Reset: 30 * time.Second})
+			So(info.Limited(), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given I have a server returning rate limit headers", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Limit", "10")
+			w.Header().Set("X-RateLimit-Remaining", "9")
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I issue a token with OptRateLimitInfo", func() {
+
+			var info RateLimitInfo
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute, OptRateLimitInfo(func(i RateLimitInfo) { info = i }))
+
+			Convey("Then the rate limit info should be reported", func() {
+				So(err, ShouldBeNil)
+				So(info.Limit, ShouldEqual, 10)
+				So(info.Remaining, ShouldEqual, 9)
+				So(info.Limited(), ShouldBeFalse)
+			})
+		})
+	})
+}
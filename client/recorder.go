@@ -0,0 +1,337 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// recordedSensitiveHeaders are the headers whose values are never recorded.
+var recordedSensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	SignatureHeader,
+}
+
+// A RecordedMessage is the recorded header and body of a request or a response.
+// BodyBase64 is only set by hand, for binary bodies served by a Replayer, as a
+// Recorder refuses to record the bodies it cannot redact.
+type RecordedMessage struct {
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"bodyBase64,omitempty"`
+}
+
+// A RecordedExchange is a request and its response, as recorded by a Recorder.
+type RecordedExchange struct {
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	StatusCode int             `json:"statusCode"`
+	Request    RecordedMessage `json:"request"`
+	Response   RecordedMessage `json:"response"`
+}
+
+// A Recorder is an http.RoundTripper recording the requests sent to
+// midgard and their responses, so they can be served back by a Replayer
+// in tests. Sensitive headers are dropped, the tokens, data and secret
+// metadata of the JSON bodies are replaced by a placeholder, and the
+// bodies are then redacted using the DefaultRedactor. A body that cannot
+// be redacted, like a msgpack or compressed one, makes the request fail,
+// so use OptionEncoding with elemental.EncodingTypeJSON and no
+// compression to record.
+type Recorder struct {
+	next      http.RoundTripper
+	redactor  *Redactor
+	exchanges []RecordedExchange
+
+	sync.RWMutex
+}
+
+// NewRecorder returns a new Recorder sending the requests using the
+// given http.RoundTripper. If it is nil, http.DefaultTransport is used.
+func NewRecorder(next http.RoundTripper) *Recorder {
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Recorder{
+		next:     next,
+		redactor: DefaultRedactor,
+	}
+}
+
+// SetRedactor sets the Redactor used to redact the recorded bodies.
+func (r *Recorder) SetRedactor(redactor *Redactor) {
+
+	if redactor == nil {
+		panic("redactor cannot be nil")
+	}
+
+	r.Lock()
+	r.redactor = redactor
+	r.Unlock()
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	var reqBody []byte
+	if req.Body != nil {
+
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close() // nolint: errcheck
+
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	recordedReq, err := r.record(req.Header, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record %s %s: request %s", req.Method, req.URL.Path, err)
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close() // nolint: errcheck
+	if err != nil {
+		return nil, err
+	}
+
+	recordedResp, err := r.record(resp.Header, respBody)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record %s %s: response %s", req.Method, req.URL.Path, err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	u := *req.URL
+	if q := u.Query(); q.Get("token") != "" {
+		q.Set("token", redactedPlaceholder)
+		u.RawQuery = q.Encode()
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.exchanges = append(r.exchanges, RecordedExchange{
+		Method:     req.Method,
+		URL:        r.redactor.Redact(u.String()),
+		StatusCode: resp.StatusCode,
+		Request:    recordedReq,
+		Response:   recordedResp,
+	})
+
+	return resp, nil
+}
+
+// Exchanges returns a copy of the exchanges recorded so far.
+func (r *Recorder) Exchanges() []RecordedExchange {
+
+	r.Lock()
+	defer r.Unlock()
+
+	return append([]RecordedExchange{}, r.exchanges...)
+}
+
+// Save writes the exchanges recorded so far to the given file, to be
+// loaded with LoadReplayer.
+func (r *Recorder) Save(path string) error {
+
+	data, err := json.MarshalIndent(r.Exchanges(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to save recorded exchanges: %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to save recorded exchanges: %s", err)
+	}
+
+	return nil
+}
+
+func (r *Recorder) record(header http.Header, body []byte) (RecordedMessage, error) {
+
+	m := RecordedMessage{
+		Header: header.Clone(),
+	}
+
+	for _, k := range recordedSensitiveHeaders {
+		if _, ok := m.Header[k]; ok {
+			m.Header[k] = []string{redactedPlaceholder}
+		}
+	}
+
+	if len(body) == 0 {
+		return m, nil
+	}
+
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return m, fmt.Errorf("body cannot be redacted: %s encoded", enc)
+	}
+
+	if strings.Contains(header.Get("Content-Type"), "msgpack") || !utf8.Valid(body) {
+		return m, fmt.Errorf("body cannot be redacted: not json")
+	}
+
+	r.RLock()
+	redactor := r.redactor
+	r.RUnlock()
+
+	m.Body = redactor.Redact(string(redactRecordedJSON(body)))
+
+	return m, nil
+}
+
+// redactRecordedJSON replaces the token, the data and the secret
+// metadata of the given JSON issue or authn body by a placeholder.
+// A body that is not a JSON object, like an error page, is returned
+// as is.
+func redactRecordedJSON(body []byte) []byte {
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+
+	redactRecordedKeys(doc, "token", "data")
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		redactRecordedKeys(metadata, secretMetadataKeys...)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+
+	return data
+}
+
+func redactRecordedKeys(doc map[string]interface{}, keys ...string) {
+
+	for _, k := range keys {
+		if v, ok := doc[k].(string); ok && v != "" {
+			doc[k] = redactedPlaceholder
+		}
+	}
+}
+
+// A Replayer is an http.RoundTripper serving back the exchanges recorded
+// by a Recorder, in the order they were recorded. Each request must match
+// the method and the URL path and query of the next exchange.
+type Replayer struct {
+	exchanges []RecordedExchange
+
+	sync.Mutex
+}
+
+// NewReplayer returns a new Replayer serving the given exchanges.
+func NewReplayer(exchanges []RecordedExchange) *Replayer {
+
+	return &Replayer{
+		exchanges: append([]RecordedExchange{}, exchanges...),
+	}
+}
+
+// LoadReplayer returns a new Replayer serving the exchanges saved
+// in the given file by Recorder.Save.
+func LoadReplayer(path string) (*Replayer, error) {
+
+	data, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to load recorded exchanges: %s", err)
+	}
+
+	var exchanges []RecordedExchange
+	if err := json.Unmarshal(data, &exchanges); err != nil {
+		return nil, fmt.Errorf("unable to load recorded exchanges: %s", err)
+	}
+
+	return NewReplayer(exchanges), nil
+}
+
+// Remaining returns the number of exchanges not yet replayed.
+func (r *Replayer) Remaining() int {
+
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.exchanges)
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if req.Body != nil {
+		req.Body.Close() // nolint: errcheck
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.exchanges) == 0 {
+		return nil, fmt.Errorf("unable to replay %s %s: no more recorded exchanges", req.Method, req.URL.RequestURI())
+	}
+
+	e := r.exchanges[0]
+
+	recordedReq, err := http.NewRequest(e.Method, e.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to replay %s %s: invalid recorded url: %s", req.Method, req.URL.RequestURI(), err)
+	}
+
+	if e.Method != req.Method || recordedReq.URL.RequestURI() != req.URL.RequestURI() {
+		return nil, fmt.Errorf("unable to replay %s %s: expected %s %s", req.Method, req.URL.RequestURI(), e.Method, recordedReq.URL.RequestURI())
+	}
+
+	body := []byte(e.Response.Body)
+	if e.Response.BodyBase64 {
+		if body, err = base64.StdEncoding.DecodeString(e.Response.Body); err != nil {
+			return nil, fmt.Errorf("unable to replay %s %s: invalid recorded body: %s", req.Method, req.URL.RequestURI(), err)
+		}
+	}
+
+	r.exchanges = r.exchanges[1:]
+
+	header := e.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
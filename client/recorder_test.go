@@ -0,0 +1,248 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/elemental"
+)
+
+func TestRecorder(t *testing.T) {
+
+	Convey("Calling SetRedactor with nil should panic", t, func() {
+		So(func() { NewRecorder(nil).SetRedactor(nil) }, ShouldPanicWith, "redactor cannot be nil")
+	})
+
+	Convey("Given I have a recorder in front of a fake working server", t, func() {
+
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"data": "","realm": "apikey","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		recorder := NewRecorder(nil)
+
+		cl := NewClientWithOptions(ts.URL,
+			OptionEncoding(elemental.EncodingTypeJSON),
+			OptionHTTPClient(&http.Client{Transport: recorder}),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		token, err := cl.IssueFromAPIKey(ctx, "the-key", 1*time.Minute, OptHeader("Authorization", "Bearer secret"))
+		So(err, ShouldBeNil)
+		So(token, ShouldEqual, "yeay!")
+
+		Convey("Then the exchange should have been recorded and redacted", func() {
+
+			exchanges := recorder.Exchanges()
+			So(exchanges, ShouldHaveLength, 1)
+			So(exchanges[0].Method, ShouldEqual, http.MethodPost)
+			So(exchanges[0].URL, ShouldEqual, ts.URL+"/issue")
+			So(exchanges[0].StatusCode, ShouldEqual, http.StatusOK)
+			So(exchanges[0].Request.Header.Get("Authorization"), ShouldEqual, "[snip]")
+			So(exchanges[0].Request.Body, ShouldContainSubstring, `"apiKey":"[snip]"`)
+			So(exchanges[0].Request.Body, ShouldNotContainSubstring, "the-key")
+			So(exchanges[0].Response.Body, ShouldContainSubstring, `"token":"[snip]"`)
+			So(exchanges[0].Response.Body, ShouldNotContainSubstring, "yeay!")
+		})
+
+		Convey("When I save and replay the exchanges", func() {
+
+			dir, err := ioutil.TempDir("", "recorder")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir) // nolint: errcheck
+
+			path := filepath.Join(dir, "exchanges.json")
+			So(recorder.Save(path), ShouldBeNil)
+
+			replayer, err := LoadReplayer(path)
+			So(err, ShouldBeNil)
+
+			replayed := NewClientWithOptions("https://midgard.com",
+				OptionEncoding(elemental.EncodingTypeJSON),
+				OptionHTTPClient(&http.Client{Transport: replayer}),
+			)
+
+			token, err := replayed.IssueFromAPIKey(ctx, "another-key", 1*time.Minute)
+
+			Convey("Then the redacted response should be served back", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "[snip]")
+				So(calls, ShouldEqual, 1)
+				So(replayer.Remaining(), ShouldEqual, 0)
+			})
+
+			Convey("Then the next request should fail", func() {
+				_, err := replayer.RoundTrip(httptest.NewRequest(http.MethodGet, "https://midgard.com/issue", nil))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to replay GET /issue: no more recorded exchanges")
+			})
+		})
+	})
+}
+
+func TestRecorder_Redaction(t *testing.T) {
+
+	Convey("Given I have a recorder in front of a fake working server", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"data": "some-data","realm": "vince","token": "the-jwt"}`)
+		}))
+		defer ts.Close()
+
+		recorder := NewRecorder(nil)
+
+		cl := NewClientWithOptions(ts.URL,
+			OptionEncoding(elemental.EncodingTypeJSON),
+			OptionHTTPClient(&http.Client{Transport: recorder}),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		Convey("When I issue a token from vince", func() {
+
+			_, err := cl.IssueFromVince(ctx, "account", "the-password", "the-otp", 1*time.Minute)
+			So(err, ShouldBeNil)
+
+			Convey("Then the secrets should not be recorded", func() {
+				exchanges := recorder.Exchanges()
+				So(exchanges, ShouldHaveLength, 1)
+				So(exchanges[0].Request.Body, ShouldContainSubstring, `"vincePassword":"[snip]"`)
+				So(exchanges[0].Request.Body, ShouldContainSubstring, `"vinceOTP":"[snip]"`)
+				So(exchanges[0].Request.Body, ShouldContainSubstring, `"vinceAccount":"account"`)
+				So(exchanges[0].Response.Body, ShouldNotContainSubstring, "the-jwt")
+				So(exchanges[0].Response.Body, ShouldNotContainSubstring, "some-data")
+			})
+		})
+
+		Convey("When I authentify a token", func() {
+
+			_, _ = cl.Authentify(ctx, "the-jwt")
+
+			Convey("Then the token should not be recorded", func() {
+				exchanges := recorder.Exchanges()
+				So(exchanges, ShouldHaveLength, 1)
+				So(exchanges[0].URL, ShouldNotContainSubstring, "the-jwt")
+				So(exchanges[0].Request.Body, ShouldNotContainSubstring, "the-jwt")
+				So(exchanges[0].Response.Body, ShouldNotContainSubstring, "the-jwt")
+			})
+		})
+	})
+
+	Convey("Given I have a recorder in front of a server answering msgpack", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/msgpack")
+			_, _ = w.Write([]byte{0x81, 0xa5})
+		}))
+		defer ts.Close()
+
+		recorder := NewRecorder(nil)
+
+		Convey("When I send a request through it", func() {
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/issue", nil)
+			So(err, ShouldBeNil)
+
+			_, err = recorder.RoundTrip(req)
+
+			Convey("Then it should refuse to record the response", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to record GET /issue: response body cannot be redacted: not json")
+				So(recorder.Exchanges(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I send a msgpack request through it", func() {
+
+			req := httptest.NewRequest(http.MethodPost, ts.URL+"/issue", strings.NewReader("\x81"))
+			req.Header.Set("Content-Type", "application/msgpack")
+			_, err := recorder.RoundTrip(req)
+
+			Convey("Then it should refuse to record the request", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to record POST /issue: request body cannot be redacted: not json")
+			})
+		})
+	})
+}
+
+func TestReplayer(t *testing.T) {
+
+	Convey("Given I have a replayer", t, func() {
+
+		replayer := NewReplayer([]RecordedExchange{
+			{
+				Method:     http.MethodGet,
+				URL:        "https://midgard.com/authn?token=a",
+				StatusCode: http.StatusUnauthorized,
+				Response: RecordedMessage{
+					Header:     http.Header{"Content-Type": []string{"application/msgpack"}},
+					Body:       "AQI=",
+					BodyBase64: true,
+				},
+			},
+		})
+
+		Convey("When I send the expected request to another host", func() {
+
+			resp, err := replayer.RoundTrip(httptest.NewRequest(http.MethodGet, "http://127.0.0.1:4443/authn?token=a", nil))
+
+			Convey("Then it should be served back", func() {
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+				So(resp.Header.Get("Content-Type"), ShouldEqual, "application/msgpack")
+				data, _ := ioutil.ReadAll(resp.Body)
+				So(data, ShouldResemble, []byte{1, 2})
+			})
+		})
+
+		Convey("When I send an unexpected request", func() {
+
+			_, err := replayer.RoundTrip(httptest.NewRequest(http.MethodPost, "https://midgard.com/issue", strings.NewReader("{}")))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to replay POST /issue: expected GET /authn?token=a")
+				So(replayer.Remaining(), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given I load a replayer from a missing file", t, func() {
+
+		_, err := LoadReplayer(filepath.Join(os.TempDir(), "does-not-exist.json"))
+
+		Convey("Then it should fail", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unable to load recorded exchanges: ")
+		})
+	})
+}
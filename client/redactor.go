@@ -0,0 +1,292 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/midgard-lib/ldaputils"
+	"go.aporeto.io/midgard-lib/logger"
+)
+
+const redactedPlaceholder = "[snip]"
+
+// privateKeyPattern matches PEM encoded private keys, like
+// the key of app credentials.
+var privateKeyPattern = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+// secretMetadataKeys are the keys of the metadata of the issue
+// requests holding secrets, like passwords or tokens.
+var secretMetadataKeys = []string{
+	ldaputils.LDAPPasswordKey,
+	ldaputils.LDAPBindPasswordKey,
+	"vincePassword",
+	"vinceOTP",
+	"secretAccessKey",
+	"token",
+	"code",
+	"codeVerifier",
+	"deviceCode",
+	"SAMLResponse",
+	DefaultAPIKeyMetadataKey,
+}
+
+// DefaultRedactor is the Redactor used by the clients to scrub
+// secrets from the errors they return and the messages they log.
+// It redacts PEM encoded private keys. Applications can add their
+// own keywords and patterns to it.
+var DefaultRedactor = newDefaultRedactor()
+
+func newDefaultRedactor() *Redactor {
+
+	r := NewRedactor()
+	r.AddPatterns(privateKeyPattern)
+
+	return r
+}
+
+// A Redactor scrubs secrets from strings and errors using
+// a list of keywords and regular expressions.
+type Redactor struct {
+	keywords []string
+	patterns []*regexp.Regexp
+
+	sync.RWMutex
+}
+
+// NewRedactor returns a new empty Redactor.
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+// AddKeywords adds the given literal secrets to the Redactor.
+func (r *Redactor) AddKeywords(keywords ...string) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	for _, k := range keywords {
+		if k != "" {
+			r.keywords = append(r.keywords, k)
+		}
+	}
+}
+
+// AddPatterns adds the given regular expressions to the Redactor.
+// Every match will be redacted.
+func (r *Redactor) AddPatterns(patterns ...*regexp.Regexp) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.patterns = append(r.patterns, patterns...)
+}
+
+// Redact returns the given string with all known secrets and the
+// given additional secrets replaced by a placeholder.
+func (r *Redactor) Redact(s string, secrets ...string) string {
+
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, redactedPlaceholder, -1)
+		}
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, k := range r.keywords {
+		s = strings.Replace(s, k, redactedPlaceholder, -1)
+	}
+
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, redactedPlaceholder)
+	}
+
+	return s
+}
+
+// RedactError returns an error with a redacted message. If the
+// message contains no secret, the original error is returned.
+// Otherwise, a redacted copy of the error types of this package,
+// like ErrUnauthorized, and of the elemental errors returned by
+// midgard is returned, so they can still be retrieved with
+// errors.As. Other errors holding the secret cannot be retrieved
+// with errors.As, but errors.Is still matches them.
+func (r *Redactor) RedactError(err error, secrets ...string) error {
+
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	redacted := r.Redact(msg, secrets...)
+	if redacted == msg {
+		return err
+	}
+
+	if c := r.redactedCopy(err, secrets); c.Error() == r.Redact(c.Error(), secrets...) {
+		return c
+	}
+
+	return redactedError{msg: redacted, err: err}
+}
+
+// redactedCopy returns a copy of the given error whose known
+// types are kept and whose messages are redacted.
+func (r *Redactor) redactedCopy(err error, secrets []string) error {
+
+	switch e := err.(type) {
+
+	case ErrUnauthorized:
+		return ErrUnauthorized{Err: r.redactedCopy(e.Err, secrets)}
+
+	case ErrForbidden:
+		return ErrForbidden{Err: r.redactedCopy(e.Err, secrets)}
+
+	case ErrUnreachable:
+		return ErrUnreachable{Err: r.redactedCopy(e.Err, secrets)}
+
+	case ErrBadResponse:
+		return ErrBadResponse{Err: r.redactedCopy(e.Err, secrets)}
+
+	case *ResponseError:
+		c := *e
+		c.Detail = r.Redact(c.Detail, secrets...)
+		if c.Err != nil {
+			c.Err = r.redactedCopy(c.Err, secrets)
+		}
+		return &c
+
+	case elemental.Errors:
+		c := make(elemental.Errors, len(e))
+		for i, ee := range e {
+			c[i] = r.redactedElementalError(ee, secrets)
+		}
+		return c
+
+	case elemental.Error:
+		return r.redactedElementalError(e, secrets)
+	}
+
+	msg := err.Error()
+	if redacted := r.Redact(msg, secrets...); redacted != msg {
+		return redactedError{msg: redacted, err: err}
+	}
+
+	return err
+}
+
+func (r *Redactor) redactedElementalError(e elemental.Error, secrets []string) elemental.Error {
+
+	e.Title = r.Redact(e.Title, secrets...)
+	e.Description = r.Redact(e.Description, secrets...)
+	e.Subject = r.Redact(e.Subject, secrets...)
+
+	return e
+}
+
+// Logger returns a logger.Logger redacting the messages and the
+// string and error fields before passing them to the given one.
+func (r *Redactor) Logger(l logger.Logger) logger.Logger {
+
+	return redactingLogger{logger: l, redactor: r}
+}
+
+// A redactedError is an error whose message has been redacted.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+// Is reports whether the original error matches the target.
+func (e redactedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// A redactingLogger is a logger.Logger redacting secrets.
+type redactingLogger struct {
+	logger   logger.Logger
+	redactor *Redactor
+}
+
+func (l redactingLogger) Debug(msg string, fields ...logger.Field) {
+	l.logger.Debug(l.redactor.Redact(msg), l.redactFields(fields)...)
+}
+
+func (l redactingLogger) Info(msg string, fields ...logger.Field) {
+	l.logger.Info(l.redactor.Redact(msg), l.redactFields(fields)...)
+}
+
+func (l redactingLogger) Warn(msg string, fields ...logger.Field) {
+	l.logger.Warn(l.redactor.Redact(msg), l.redactFields(fields)...)
+}
+
+func (l redactingLogger) Error(msg string, fields ...logger.Field) {
+	l.logger.Error(l.redactor.Redact(msg), l.redactFields(fields)...)
+}
+
+func (l redactingLogger) redactFields(fields []logger.Field) []logger.Field {
+
+	out := make([]logger.Field, len(fields))
+
+	for i, f := range fields {
+		switch v := f.Value.(type) {
+		case error:
+			f.Value = l.redactor.RedactError(v)
+		case string:
+			f.Value = l.redactor.Redact(v)
+		}
+		out[i] = f
+	}
+
+	return out
+}
+
+// issueSecrets returns the secrets contained in the
+// metadata of the given issue request, and its data
+// for the Google realm, which holds the Google JWT.
+func issueSecrets(issueRequest *gaia.Issue, opts issueOpts) []string {
+
+	keys := secretMetadataKeys
+	if opts.apiKeyMetadataKey != "" {
+		keys = append([]string{opts.apiKeyMetadataKey}, keys...)
+	}
+
+	var secrets []string
+	if issueRequest.Realm == gaia.IssueRealmGoogle && issueRequest.Data != "" {
+		secrets = append(secrets, issueRequest.Data)
+	}
+	for _, k := range keys {
+		if v, ok := issueRequest.Metadata[k].(string); ok && v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+
+	return secrets
+}
+
+// redactSecrets redacts the given secrets and the ones
+// known by the DefaultRedactor from the given error.
+func redactSecrets(err error, secrets ...string) error {
+
+	return DefaultRedactor.RedactError(err, secrets...)
+}
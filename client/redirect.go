@@ -0,0 +1,58 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"errors"
+	"net/http"
+)
+
+// A RedirectPolicy configures how the client follows the redirects
+// returned by midgard. When a redirect is not followed, the redirect
+// response itself is returned, so the steps of the OIDC and SAML flows
+// return its Location. The zero value never follows redirects, which is
+// the default.
+type RedirectPolicy struct {
+
+	// MaxRedirects is the maximum number of redirects
+	// followed. 0 means redirects are never followed.
+	MaxRedirects int
+
+	// SameHostOnly prevents following redirects
+	// to another host than the one of midgard.
+	SameHostOnly bool
+}
+
+// validate returns an error if the policy is invalid.
+func (p RedirectPolicy) validate() error {
+
+	if p.MaxRedirects < 0 {
+		return errors.New("max redirects must be positive")
+	}
+
+	return nil
+}
+
+// checkRedirect implements the CheckRedirect
+// function of http.Client for the policy.
+func (p RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+
+	if len(via) > p.MaxRedirects {
+		return http.ErrUseLastResponse
+	}
+
+	if p.SameHostOnly && req.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_RedirectPolicy(t *testing.T) {
+
+	Convey("Calling OptionRedirectPolicy with invalid values should make New return an error", t, func() {
+		So(optionError(OptionRedirectPolicy(RedirectPolicy{MaxRedirects: -1})), ShouldEqual, "max redirects must be positive")
+	})
+
+	Convey("Given I have a midgard server redirecting to itself and to another host", t, func() {
+
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"token": "other"}`)
+		}))
+		defer other.Close()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/issue":
+				http.Redirect(w, r, "/first", http.StatusFound)
+			case "/first":
+				http.Redirect(w, r, "/second", http.StatusFound)
+			case "/second":
+				http.Redirect(w, r, other.URL+"/third", http.StatusFound)
+			}
+		}))
+		defer ts.Close()
+
+		issue := func(options ...ClientOption) string {
+			token, err := NewClientWithOptions(ts.URL, options...).IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+			So(err, ShouldBeNil)
+			return token
+		}
+
+		Convey("Then the redirects should not be followed by default", func() {
+			So(issue(), ShouldEqual, "/first")
+		})
+
+		Convey("Then the redirects should be followed up to the max", func() {
+			So(issue(OptionRedirectPolicy(RedirectPolicy{MaxRedirects: 1})), ShouldEqual, "/second")
+			So(issue(OptionRedirectPolicy(RedirectPolicy{MaxRedirects: 3})), ShouldEqual, "other")
+		})
+
+		Convey("Then the redirects to other hosts should not be followed if restricted", func() {
+			So(issue(OptionRedirectPolicy(RedirectPolicy{MaxRedirects: 3, SameHostOnly: true})), ShouldEqual, other.URL+"/third")
+		})
+
+		Convey("Then the policy should apply to a custom http client", func() {
+			So(issue(OptionHTTPClient(&http.Client{}), OptionRedirectPolicy(RedirectPolicy{})), ShouldEqual, "/first")
+		})
+	})
+}
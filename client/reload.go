@@ -0,0 +1,156 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"go.aporeto.io/midgard-lib/logger"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+)
+
+// A ReloadFunc loads new configuration, like credentials read from
+// a file, without applying it. It returns a function applying it,
+// which cannot fail.
+type ReloadFunc func() (apply func(), err error)
+
+type reloadEntry struct {
+	name string
+	f    ReloadFunc
+}
+
+// A Reloader reloads configuration when Reload is called or when
+// the process receives SIGHUP. All the registered ReloadFuncs are
+// called first, and the new configuration is only applied if all
+// of them succeed, so the components are never left with a mix of
+// old and new configuration.
+type Reloader struct {
+	entries []reloadEntry
+	logger  logger.Logger
+
+	sync.Mutex
+}
+
+// NewReloader returns a new Reloader.
+func NewReloader() *Reloader {
+
+	return &Reloader{
+		logger: zaplogger.New(nil),
+	}
+}
+
+// SetLogger sets the Logger used to report the reloads
+// triggered by SIGHUP. The default writes to the global
+// zap logger. It must be called before Run.
+func (r *Reloader) SetLogger(l logger.Logger) {
+
+	if l == nil {
+		panic("logger cannot be nil")
+	}
+
+	r.logger = l
+}
+
+// Register registers the given ReloadFunc under the given name,
+// which is used in errors.
+func (r *Reloader) Register(name string, f ReloadFunc) {
+
+	if f == nil {
+		panic("reload func cannot be nil")
+	}
+
+	r.Lock()
+	r.entries = append(r.entries, reloadEntry{name: name, f: f})
+	r.Unlock()
+}
+
+// Reload calls all the registered ReloadFuncs, then applies the
+// new configuration if all of them succeeded. Otherwise, nothing
+// is applied and the first error is returned.
+func (r *Reloader) Reload() error {
+
+	r.Lock()
+	defer r.Unlock()
+
+	applies := make([]func(), 0, len(r.entries))
+
+	for _, e := range r.entries {
+
+		apply, err := e.f()
+		if err != nil {
+			return fmt.Errorf("unable to reload %s: %s", e.name, err)
+		}
+
+		applies = append(applies, apply)
+	}
+
+	for _, apply := range applies {
+		apply()
+	}
+
+	return nil
+}
+
+// Run calls Reload every time the process receives
+// SIGHUP, until the given context is done.
+func (r *Reloader) Run(ctx context.Context) {
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+
+		case <-ch:
+			if err := r.Reload(); err != nil {
+				r.logger.Error("Unable to reload configuration", logger.Err(err))
+				break
+			}
+			r.logger.Info("Configuration reloaded")
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CredentialsReloadFunc returns a ReloadFunc reading the app
+// credentials at the given path and setting the resulting TLS
+// configuration on the given client.
+func CredentialsReloadFunc(cl *Client, path string) ReloadFunc {
+
+	if cl == nil {
+		panic("client cannot be nil")
+	}
+
+	return func() (func(), error) {
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read credentials: %s", err)
+		}
+
+		_, tlsConfig, err := ParseCredentials(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return cl.prepareTLSConfig(tlsConfig)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_SetTLSConfig(t *testing.T) {
+
+	Convey("Given I have a client", t, func() {
+
+		cl := NewClientWithOptions("https://midgard.com")
+		before := cl.currentHTTPClient()
+		_, _ = cl.httpClientFor("example.com")
+
+		Convey("When I set a new TLS config", func() {
+
+			tlsConfig := &tls.Config{ServerName: "midgard.com"}
+			err := cl.SetTLSConfig(tlsConfig)
+
+			Convey("Then the new config should be used", func() {
+				So(err, ShouldBeNil)
+				So(cl.currentTLSConfig(), ShouldEqual, tlsConfig)
+				So(cl.currentHTTPClient(), ShouldNotEqual, before)
+				So(cl.currentHTTPClient().Transport.(*http.Transport).TLSClientConfig, ShouldEqual, tlsConfig)
+				So(cl.serverNameClients.clients, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a client with a custom round tripper", t, func() {
+
+		cl := NewClientWithOptions("https://midgard.com", OptionHTTPClient(&http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, fmt.Errorf("boom") }),
+		}))
+
+		Convey("When I set a new TLS config", func() {
+
+			err := cl.SetTLSConfig(&tls.Config{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to set tls config: unsupported transport midgardclient.roundTripperFunc")
+			})
+		})
+	})
+}
+
+func TestReloader(t *testing.T) {
+
+	Convey("Calling Register with a nil func should panic", t, func() {
+		So(func() { NewReloader().Register("a", nil) }, ShouldPanicWith, "reload func cannot be nil")
+	})
+
+	Convey("Given I have a reloader", t, func() {
+
+		r := NewReloader()
+
+		var applied []string
+		register := func(name string, err error) {
+			r.Register(name, func() (func(), error) {
+				if err != nil {
+					return nil, err
+				}
+				return func() { applied = append(applied, name) }, nil
+			})
+		}
+
+		Convey("When all the reload funcs succeed", func() {
+
+			register("a", nil)
+			register("b", nil)
+
+			err := r.Reload()
+
+			Convey("Then all of them should be applied", func() {
+				So(err, ShouldBeNil)
+				So(applied, ShouldResemble, []string{"a", "b"})
+			})
+		})
+
+		Convey("When one of the reload funcs fails", func() {
+
+			register("a", nil)
+			register("b", fmt.Errorf("boom"))
+
+			err := r.Reload()
+
+			Convey("Then none of them should be applied", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to reload b: boom")
+				So(applied, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the process receives SIGHUP", func() {
+
+			reloaded := make(chan struct{}, 1)
+			r.Register("a", func() (func(), error) {
+				return func() { reloaded <- struct{}{} }, nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan struct{})
+			go func() {
+				r.Run(ctx)
+				close(done)
+			}()
+
+			// Give Run the time to register the signal handler.
+			time.Sleep(100 * time.Millisecond)
+			So(syscall.Kill(os.Getpid(), syscall.SIGHUP), ShouldBeNil)
+
+			Convey("Then it should reload", func() {
+				select {
+				case <-reloaded:
+				case <-time.After(5 * time.Second):
+					So("not reloaded", ShouldBeEmpty)
+				}
+				cancel()
+				<-done
+			})
+		})
+	})
+}
+
+func TestCredentialsReloadFunc(t *testing.T) {
+
+	Convey("Calling CredentialsReloadFunc without client should panic", t, func() {
+		So(func() { CredentialsReloadFunc(nil, "path") }, ShouldPanicWith, "client cannot be nil")
+	})
+
+	Convey("Given I have a client and a credentials file", t, func() {
+
+		certPEM, err := ioutil.ReadFile("./fixtures/client-cert.pem")
+		So(err, ShouldBeNil)
+		keyPEM, err := ioutil.ReadFile("./fixtures/client-key.pem")
+		So(err, ShouldBeNil)
+
+		data, err := json.Marshal(&gaia.Credential{
+			Certificate:          base64.StdEncoding.EncodeToString(certPEM),
+			CertificateKey:       base64.StdEncoding.EncodeToString(keyPEM),
+			CertificateAuthority: base64.StdEncoding.EncodeToString(certPEM),
+		})
+		So(err, ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "credentials")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "creds.json")
+		So(ioutil.WriteFile(path, data, 0600), ShouldBeNil)
+
+		cl := NewClientWithOptions("https://midgard.com")
+		r := NewReloader()
+		r.Register("credentials", CredentialsReloadFunc(cl, path))
+
+		Convey("When I reload", func() {
+
+			err := r.Reload()
+
+			Convey("Then the client should use the new credentials", func() {
+				So(err, ShouldBeNil)
+				So(cl.currentTLSConfig(), ShouldNotBeNil)
+				So(cl.currentTLSConfig().Certificates, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When I reload an invalid credentials file", func() {
+
+			So(ioutil.WriteFile(path, []byte("nope"), 0600), ShouldBeNil)
+			before := cl.currentHTTPClient()
+
+			err := r.Reload()
+
+			Convey("Then the client should keep its configuration", func() {
+				So(err, ShouldNotBeNil)
+				So(cl.currentHTTPClient(), ShouldEqual, before)
+			})
+		})
+	})
+}
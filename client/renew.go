@@ -0,0 +1,72 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TokenRestrictions are the restrictions of a token.
+type TokenRestrictions struct {
+	Namespace   string   `json:"namespace"`
+	Permissions []string `json:"perms"`
+	Networks    []string `json:"networks"`
+}
+
+type restrictedClaims struct {
+	Restrictions *TokenRestrictions `json:"restrictions,omitempty"`
+	jwt.StandardClaims
+}
+
+// RenewToken issues a new token with the given validity from the given
+// token, using the AporetoIdentityToken realm. It returns an error without
+// calling midgard if the token has already expired. Use OptKeepRestrictions
+// to request the restrictions of the given token for the new one.
+func (a *Client) RenewToken(ctx context.Context, token string, validity time.Duration, options ...Option) (string, error) {
+
+	c := &restrictedClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, c); err != nil {
+		return "", fmt.Errorf("unable to renew token: %s", redactSecrets(err, token))
+	}
+
+	if c.ExpiresAt != 0 && !time.Now().Before(time.Unix(c.ExpiresAt, 0)) {
+		return "", fmt.Errorf("unable to renew token: token has expired")
+	}
+
+	opts := a.issueOptions(options)
+
+	if opts.keepRestrictions && c.Restrictions != nil {
+
+		// Restrictions given explicitly take precedence.
+		kept := []Option{}
+
+		if c.Restrictions.Namespace != "" {
+			kept = append(kept, OptRestrictNamespace(c.Restrictions.Namespace))
+		}
+
+		if len(c.Restrictions.Permissions) > 0 {
+			kept = append(kept, OptRestrictPermissions(c.Restrictions.Permissions))
+		}
+
+		if len(c.Restrictions.Networks) > 0 {
+			kept = append(kept, OptRestrictNetworks(c.Restrictions.Networks))
+		}
+
+		options = append(kept, options...)
+	}
+
+	return a.IssueFromAporetoIdentityToken(ctx, token, validity, options...)
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_RenewToken(t *testing.T) {
+
+	Convey("Given I have a server and a restricted token", t, func() {
+
+		var issue *gaia.Issue
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			issue = gaia.NewIssue()
+			_ = json.NewDecoder(r.Body).Decode(issue)
+			fmt.Fprintln(w, `{"token": "renewed"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		token := makeToken(
+			jwt.MapClaims{
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"restrictions": map[string]interface{}{
+					"namespace": "/a/b",
+					"perms":     []string{"@auth:role=viewer"},
+					"networks":  []string{"10.0.0.0/8"},
+				},
+			},
+			jwt.SigningMethodHS256,
+			[]byte("secret"),
+		)
+
+		Convey("When I renew it", func() {
+
+			renewed, err := cl.RenewToken(context.Background(), token, time.Hour)
+
+			Convey("Then it should be issued from the token without restrictions", func() {
+				So(err, ShouldBeNil)
+				So(renewed, ShouldEqual, "renewed")
+				So(issue.Realm, ShouldEqual, gaia.IssueRealmAporetoIdentityToken)
+				So(issue.Metadata["token"], ShouldEqual, token)
+				So(issue.Validity, ShouldEqual, "1h0m0s")
+				So(issue.RestrictedNamespace, ShouldBeEmpty)
+				So(issue.RestrictedPermissions, ShouldBeEmpty)
+				So(issue.RestrictedNetworks, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I renew it keeping its restrictions", func() {
+
+			_, err := cl.RenewToken(context.Background(), token, time.Hour, OptKeepRestrictions())
+
+			Convey("Then the restrictions should have been requested", func() {
+				So(err, ShouldBeNil)
+				So(issue.RestrictedNamespace, ShouldEqual, "/a/b")
+				So(issue.RestrictedPermissions, ShouldResemble, []string{"@auth:role=viewer"})
+				So(issue.RestrictedNetworks, ShouldResemble, []string{"10.0.0.0/8"})
+			})
+		})
+
+		Convey("When I renew it keeping its restrictions and restricting the namespace", func() {
+
+			_, err := cl.RenewToken(context.Background(), token, time.Hour, OptRestrictNamespace("/a/b/c"), OptKeepRestrictions())
+
+			Convey("Then the given restriction should take precedence", func() {
+				So(err, ShouldBeNil)
+				So(issue.RestrictedNamespace, ShouldEqual, "/a/b/c")
+				So(issue.RestrictedNetworks, ShouldResemble, []string{"10.0.0.0/8"})
+			})
+		})
+
+		Convey("When I renew an expired token", func() {
+
+			expired := makeToken(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, jwt.SigningMethodHS256, []byte("secret"))
+			_, err := cl.RenewToken(context.Background(), expired, time.Hour)
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to renew token: token has expired")
+				So(issue, ShouldBeNil)
+			})
+		})
+
+		Convey("When I renew an invalid token", func() {
+
+			_, err := cl.RenewToken(context.Background(), "not-a-token", time.Hour)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to renew token: ")
+				So(issue, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// defaultErrorBodyLimit is the default maximum size of
+// an error body captured in a ResponseError.
+const defaultErrorBodyLimit = 4 * 1024
+
+// A ResponseError is returned when midgard responds with an error
+// that cannot be decoded, like an HTML page returned by a proxy
+// or a plain text message returned by a load balancer.
+type ResponseError struct {
+
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Detail contains the beginning of the response body.
+	Detail string
+
+	// Truncated is true if Detail does not contain
+	// the full response body.
+	Truncated bool
+
+	// Err is the error that occurred while decoding the body.
+	Err error
+}
+
+// newResponseError returns a new ResponseError capturing at
+// most limit bytes of the given body.
+func newResponseError(statusCode int, body []byte, limit int, err error) *ResponseError {
+
+	e := &ResponseError{
+		StatusCode: statusCode,
+		Err:        err,
+	}
+
+	if len(body) > limit {
+		body = body[:limit]
+		// do not cut a multi byte character. Only the last
+		// rune can be incomplete: non UTF-8 bodies are kept.
+		for i := 1; i < utf8.UTFMax && i <= len(body); i++ {
+			if !utf8.RuneStart(body[len(body)-i]) {
+				continue
+			}
+			if !utf8.FullRune(body[len(body)-i:]) {
+				body = body[:len(body)-i]
+			}
+			break
+		}
+		e.Truncated = true
+	}
+
+	e.Detail = string(body)
+
+	return e
+}
+
+func (e *ResponseError) Error() string {
+
+	detail := e.Detail
+	if e.Truncated {
+		detail += "..."
+	}
+
+	return fmt.Sprintf("midgard did not issue a token and client could not decode why: %s (statusCode: %d, body: %q)", e.Err, e.StatusCode, detail)
+}
+
+// Unwrap returns the decoding error.
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
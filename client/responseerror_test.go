@@ -0,0 +1,143 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResponseError(t *testing.T) {
+
+	Convey("Given I have a body smaller than the limit", t, func() {
+
+		err := newResponseError(502, []byte("bad gateway"), 20, errors.New("oops"))
+
+		Convey("Then the error should be correct", func() {
+			So(err.Detail, ShouldEqual, "bad gateway")
+			So(err.Truncated, ShouldBeFalse)
+			So(err.Error(), ShouldEqual, `midgard did not issue a token and client could not decode why: oops (statusCode: 502, body: "bad gateway")`)
+			So(errors.Unwrap(err).Error(), ShouldEqual, "oops")
+		})
+	})
+
+	Convey("Given I have a body larger than the limit", t, func() {
+
+		err := newResponseError(502, []byte("<html>bad gateway</html>"), 6, errors.New("oops"))
+
+		Convey("Then the detail should be truncated", func() {
+			So(err.Detail, ShouldEqual, "<html>")
+			So(err.Truncated, ShouldBeTrue)
+			So(err.Error(), ShouldEqual, `midgard did not issue a token and client could not decode why: oops (statusCode: 502, body: "<html>...")`)
+		})
+	})
+
+	Convey("Given I have a body cut in the middle of a character", t, func() {
+
+		err := newResponseError(502, []byte("aé"), 2, errors.New("oops"))
+
+		Convey("Then the detail should be valid utf8", func() {
+			So(err.Detail, ShouldEqual, "a")
+		})
+	})
+
+	Convey("Given I have a latin-1 body larger than the limit", t, func() {
+
+		err := newResponseError(502, []byte("caf\xe9 cr\xe8me br\xfbl\xe9e"), 12, errors.New("oops"))
+
+		Convey("Then the detail should keep the body up to the limit", func() {
+			So(err.Detail, ShouldEqual, "caf\xe9 cr\xe8me b")
+			So(err.Truncated, ShouldBeTrue)
+		})
+	})
+}
+
+func TestClient_ResponseError(t *testing.T) {
+
+	Convey("Given I have a client and a proxy returning html", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, "<html><body>502 Bad Gateway</body></html>")
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionErrorBodyLimit(12))
+
+		Convey("When I call IssueFromVince", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute)
+
+			Convey("Then err should be a ResponseError", func() {
+				So(err, ShouldNotBeNil)
+				var rerr *ResponseError
+				So(errors.As(err, &rerr), ShouldBeTrue)
+				So(errors.Is(err, ErrUnreachable{}), ShouldBeTrue)
+				So(rerr.StatusCode, ShouldEqual, http.StatusBadGateway)
+				So(rerr.Detail, ShouldEqual, "<html><body>")
+				So(rerr.Truncated, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given I have a client and a proxy returning an endless body", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			chunk := []byte(strings.Repeat("x", 1024))
+			for {
+				if _, err := w.Write(chunk); err != nil {
+					return
+				}
+				select {
+				case <-r.Context().Done():
+					return
+				default:
+				}
+			}
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionErrorBodyLimit(12))
+
+		Convey("When I call IssueFromVince", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute)
+
+			Convey("Then err should be a truncated ResponseError", func() {
+				So(ctx.Err(), ShouldBeNil)
+				var rerr *ResponseError
+				So(errors.As(err, &rerr), ShouldBeTrue)
+				So(rerr.Detail, ShouldEqual, "xxxxxxxxxxxx")
+				So(rerr.Truncated, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Calling OptionErrorBodyLimit with an invalid value should make New return an error", t, func() {
+		So(optionError(OptionErrorBodyLimit(0)), ShouldEqual, "error body limit must be greater than 0")
+	})
+}
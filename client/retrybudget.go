@@ -0,0 +1,108 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"sync"
+	"time"
+)
+
+// A RetryBudget limits the proportion of requests that can be retried
+// over a time window. A single RetryBudget can be shared by all the
+// clients of a process using OptionRetryBudget, so a midgard brownout
+// does not get amplified by every client retrying at the same time.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	window     time.Duration
+
+	windowStart time.Time
+	requests    int
+	retries     int
+
+	sync.Mutex
+}
+
+// NewRetryBudget returns a new RetryBudget allowing at most the given
+// ratio of requests to be retried during each window. minRetries
+// retries are always allowed during a window, so low traffic clients
+// can still retry.
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+
+	if ratio < 0 || ratio > 1 {
+		panic("ratio must be between 0 and 1")
+	}
+
+	if minRetries < 0 {
+		panic("minRetries must be positive")
+	}
+
+	if window <= 0 {
+		panic("window must be greater than 0")
+	}
+
+	return &RetryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		window:     window,
+	}
+}
+
+// recordRequest records a new request.
+func (b *RetryBudget) recordRequest() {
+
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.rotate()
+	b.requests++
+}
+
+// allowRetry returns true if a retry is allowed,
+// and records it if that is the case.
+func (b *RetryBudget) allowRetry() bool {
+
+	if b == nil {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.rotate()
+
+	if b.retries >= b.minRetries && float64(b.retries+1) > b.ratio*float64(b.requests) {
+		return false
+	}
+
+	b.retries++
+
+	return true
+}
+
+// rotate resets the counters when the current window is over.
+// The lock must be held.
+func (b *RetryBudget) rotate() {
+
+	now := time.Now()
+	if now.Sub(b.windowStart) < b.window {
+		return
+	}
+
+	b.windowStart = now
+	b.requests = 0
+	b.retries = 0
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryBudget(t *testing.T) {
+
+	Convey("Calling NewRetryBudget with invalid values should panic", t, func() {
+		So(func() { NewRetryBudget(2, 0, time.Second) }, ShouldPanicWith, "ratio must be between 0 and 1")
+		So(func() { NewRetryBudget(0.2, -1, time.Second) }, ShouldPanicWith, "minRetries must be positive")
+		So(func() { NewRetryBudget(0.2, 0, 0) }, ShouldPanicWith, "window must be greater than 0")
+	})
+
+	Convey("Given I have a retry budget of 20% with 1 minimum retry", t, func() {
+
+		b := NewRetryBudget(0.2, 1, time.Hour)
+
+		Convey("When I have sent a single request", func() {
+
+			b.recordRequest()
+
+			Convey("Then only the minimum retries should be allowed", func() {
+				So(b.allowRetry(), ShouldBeTrue)
+				So(b.allowRetry(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When I have sent 10 requests", func() {
+
+			for i := 0; i < 10; i++ {
+				b.recordRequest()
+			}
+
+			Convey("Then 2 retries should be allowed", func() {
+				So(b.allowRetry(), ShouldBeTrue)
+				So(b.allowRetry(), ShouldBeTrue)
+				So(b.allowRetry(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the window is over", func() {
+
+			b.recordRequest()
+			b.allowRetry()
+			b.windowStart = time.Now().Add(-2 * time.Hour)
+
+			Convey("Then the budget should be reset", func() {
+				So(b.allowRetry(), ShouldBeTrue)
+				So(b.requests, ShouldEqual, 0)
+				So(b.retries, ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given I have a nil retry budget", t, func() {
+
+		var b *RetryBudget
+
+		Convey("Then retries should always be allowed", func() {
+			b.recordRequest()
+			So(b.allowRetry(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestClient_RetryBudget(t *testing.T) {
+
+	Convey("Given I have a client with an empty retry budget and an unreachable server", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionRetryBudget(NewRetryBudget(0, 0, time.Hour)))
+
+		Convey("When I call IssueFromVince", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute)
+
+			Convey("Then err should be returned without retrying", func() {
+				So(err, ShouldNotBeNil)
+				So(ctx.Err(), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// legacyRetryInterval is the interval between retries of requests
+// that failed with a network error when no RetryPolicy is set.
+const legacyRetryInterval = 3 * time.Second
+
+// A RetryPolicy configures how the client retries the requests
+// that failed with a network error, a 5xx or a 429 response.
+type RetryPolicy struct {
+
+	// MaxAttempts is the maximum number of times a request is sent,
+	// including the first one. 0 means it is retried until the
+	// context is done.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry.
+	// It is doubled after each attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the time to wait between two attempts.
+	// 0 means no cap.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of the backoff, between 0 and 1, that
+	// is randomly removed from it, so clients restarted together do
+	// not retry in lockstep.
+	Jitter float64
+}
+
+// validate returns an error if the policy is invalid.
+func (p RetryPolicy) validate() error {
+
+	if p.MaxAttempts < 0 {
+		return errors.New("max attempts must be positive")
+	}
+
+	if p.InitialBackoff <= 0 {
+		return errors.New("initial backoff must be greater than 0")
+	}
+
+	if p.MaxBackoff != 0 && p.MaxBackoff < p.InitialBackoff {
+		return errors.New("max backoff must be greater than initial backoff")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// exhausted returns true if no attempt is left after the given one.
+// A nil policy never exhausts, to keep the legacy behavior.
+func (p *RetryPolicy) exhausted(attempt int) bool {
+
+	if p == nil || p.MaxAttempts == 0 {
+		return false
+	}
+
+	return attempt >= p.MaxAttempts
+}
+
+// retryableStatus returns true if a response with the given status
+// code should be retried. A nil policy never retries responses.
+func (p *RetryPolicy) retryableStatus(code int) bool {
+
+	if p == nil {
+		return false
+	}
+
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns the time to wait after the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+
+	if p == nil {
+		return legacyRetryInterval
+	}
+
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		if (p.MaxBackoff != 0 && d >= p.MaxBackoff) || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+
+	if p.MaxBackoff != 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// retryAfter returns the delay requested by the Retry-After header
+// of the given response, expressed either in seconds or as an HTTP
+// date relative to now. It returns 0 if there is none.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		if s < 0 {
+			return 0
+		}
+		return time.Duration(s) * time.Second
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil || !t.After(now) {
+		return 0
+	}
+
+	return t.Sub(now)
+}
@@ -0,0 +1,236 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryPolicy_Option(t *testing.T) {
+
+	Convey("Calling OptionRetryPolicy with invalid values should make New return an error", t, func() {
+		So(optionError(OptionRetryPolicy(RetryPolicy{MaxAttempts: -1, InitialBackoff: time.Second})), ShouldEqual, "max attempts must be positive")
+		So(optionError(OptionRetryPolicy(RetryPolicy{})), ShouldEqual, "initial backoff must be greater than 0")
+		So(optionError(OptionRetryPolicy(RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Millisecond})), ShouldEqual, "max backoff must be greater than initial backoff")
+		So(optionError(OptionRetryPolicy(RetryPolicy{InitialBackoff: time.Second, Jitter: 2})), ShouldEqual, "jitter must be between 0 and 1")
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+
+	Convey("Given I have a nil policy", t, func() {
+
+		var p *RetryPolicy
+
+		Convey("Then it should keep the legacy behavior", func() {
+			So(p.backoff(1), ShouldEqual, legacyRetryInterval)
+			So(p.backoff(10), ShouldEqual, legacyRetryInterval)
+			So(p.exhausted(100), ShouldBeFalse)
+			So(p.retryableStatus(http.StatusServiceUnavailable), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given I have a policy without jitter", t, func() {
+
+		p := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+		Convey("Then the backoff should double up to the max", func() {
+			So(p.backoff(1), ShouldEqual, time.Second)
+			So(p.backoff(2), ShouldEqual, 2*time.Second)
+			So(p.backoff(3), ShouldEqual, 4*time.Second)
+			So(p.backoff(4), ShouldEqual, 5*time.Second)
+			So(p.backoff(1000), ShouldEqual, 5*time.Second)
+		})
+
+		Convey("Then it should be exhausted after the max attempts", func() {
+			So(p.exhausted(2), ShouldBeFalse)
+			So(p.exhausted(3), ShouldBeTrue)
+		})
+
+		Convey("Then it should retry 5xx and 429 only", func() {
+			So(p.retryableStatus(http.StatusInternalServerError), ShouldBeTrue)
+			So(p.retryableStatus(http.StatusBadGateway), ShouldBeTrue)
+			So(p.retryableStatus(http.StatusTooManyRequests), ShouldBeTrue)
+			So(p.retryableStatus(http.StatusForbidden), ShouldBeFalse)
+			So(p.retryableStatus(http.StatusOK), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given I have a policy without max backoff", t, func() {
+
+		p := &RetryPolicy{InitialBackoff: time.Second}
+
+		Convey("Then the backoff should not overflow", func() {
+			So(p.backoff(1000), ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Given I have a policy with jitter", t, func() {
+
+		p := &RetryPolicy{InitialBackoff: time.Second, Jitter: 0.5}
+
+		Convey("Then the backoff should be reduced by at most the jitter", func() {
+			for i := 0; i < 100; i++ {
+				d := p.backoff(1)
+				So(d, ShouldBeGreaterThan, 500*time.Millisecond)
+				So(d, ShouldBeLessThanOrEqualTo, time.Second)
+			}
+		})
+	})
+
+	Convey("Given I have headers with a Retry-After", t, func() {
+
+		now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+
+		Convey("Then retryAfter should parse seconds and HTTP dates", func() {
+			So(retryAfter(http.Header{"Retry-After": []string{"2"}}, now), ShouldEqual, 2*time.Second)
+			So(retryAfter(http.Header{"Retry-After": []string{"-2"}}, now), ShouldEqual, 0)
+			So(retryAfter(http.Header{"Retry-After": []string{"Wed, 21 Oct 2015 07:28:30 GMT"}}, now), ShouldEqual, 30*time.Second)
+			So(retryAfter(http.Header{"Retry-After": []string{"Wed, 21 Oct 2015 07:27:00 GMT"}}, now), ShouldEqual, 0)
+			So(retryAfter(http.Header{"Retry-After": []string{"soon"}}, now), ShouldEqual, 0)
+			So(retryAfter(http.Header{}, now), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestRetryPolicy_Send(t *testing.T) {
+
+	Convey("Given I have a server failing twice with a 503 then succeeding", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I issue a token with a retry policy", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}))
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then it should eventually succeed", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When I issue a token with a retry policy allowing too few attempts", func() {
+
+			cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then it should return the last response error", func() {
+				So(err, ShouldNotBeNil)
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When I issue a token without retry policy", func() {
+
+			cl := NewClientWithOptions(ts.URL)
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then it should not retry", func() {
+				So(err, ShouldNotBeNil)
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given I have a server rate limiting with a Retry-After", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+
+		Convey("When I issue a token", func() {
+
+			start := time.Now()
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then it should have waited for the Retry-After", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+				So(time.Since(start), ShouldBeGreaterThanOrEqualTo, time.Second)
+			})
+		})
+
+		Convey("When I issue a token with a context shorter than the Retry-After", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			var info RateLimitInfo
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute, OptRateLimitInfo(func(i RateLimitInfo) { info = i }))
+
+			Convey("Then it should return the rate limit error without waiting", func() {
+				var rerr *ResponseError
+				So(errors.As(err, &rerr), ShouldBeTrue)
+				So(rerr.StatusCode, ShouldEqual, http.StatusTooManyRequests)
+				So(ctx.Err(), ShouldBeNil)
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+				So(info.RetryAfter, ShouldEqual, time.Second)
+				So(info.Limited(), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given I have a retry policy and an exhausted retry budget", t, func() {
+
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(
+			ts.URL,
+			OptionRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}),
+			OptionRetryBudget(NewRetryBudget(0, 0, time.Minute)),
+		)
+
+		Convey("When I issue a token", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute)
+
+			Convey("Then it should not retry", func() {
+				So(err, ShouldNotBeNil)
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+	})
+}
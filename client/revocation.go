@@ -0,0 +1,161 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// ErrRevocationUnsupported is returned by Revoke and CheckRevocation
+// when the midgard server does not expose token revocation.
+var ErrRevocationUnsupported = errors.New("midgard does not support token revocation")
+
+type revocation struct {
+	TokenID        string     `json:"tokenID"`
+	ExpirationDate *time.Time `json:"expirationDate,omitempty"`
+}
+
+// Revoke revokes the given token, so midgard will not authentify it
+// anymore. The token is used to authorize its own revocation, so a
+// leaked token can be revoked without any other credentials. The
+// token must have an ID. Revoking a token that is already revoked
+// is not an error.
+func (a *Client) Revoke(ctx context.Context, token string) error {
+
+	c := &jwt.StandardClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, c); err != nil {
+		return fmt.Errorf("unable to revoke token: %s", redactSecrets(err, token))
+	}
+
+	if c.Id == "" {
+		return fmt.Errorf("unable to revoke token: missing token id")
+	}
+
+	r := revocation{TokenID: c.Id}
+	if c.ExpiresAt != 0 {
+		exp := time.Unix(c.ExpiresAt, 0).UTC()
+		r.ExpirationDate = &exp
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.revoke")
+	defer span.Finish()
+
+	builder := func(baseURL string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, baseURL+"/revocations", bytes.NewBuffer(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	}
+
+	resp, err := a.sendRetry(subctx, a.currentHTTPClient(), builder, []string{token}, "")
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close() // nolint: errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusConflict:
+		return nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return ErrRevocationUnsupported
+	default:
+		return fmt.Errorf("unable to revoke token: %s", resp.Status)
+	}
+}
+
+// CheckRevocation returns true if the token with the given ID
+// has been revoked. As midgard responds with a 404 for tokens that
+// are not revoked, the revocations endpoint is then probed and
+// ErrRevocationUnsupported is returned if it does not exist, so a
+// midgard without revocation support never reports tokens as valid.
+func (a *Client) CheckRevocation(ctx context.Context, tokenID string) (bool, error) {
+
+	if tokenID == "" {
+		return false, fmt.Errorf("unable to check revocation: missing token id")
+	}
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.revocation")
+	defer span.Finish()
+
+	builder := func(baseURL string) (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, baseURL+"/revocations/"+url.PathEscape(tokenID), nil)
+	}
+
+	resp, err := a.sendRetry(subctx, a.currentHTTPClient(), builder, nil, "")
+	if err != nil {
+		return false, err
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close() // nolint: errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		if err := a.probeRevocations(subctx); err != nil {
+			return false, err
+		}
+		return false, nil
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return false, ErrRevocationUnsupported
+	default:
+		return false, fmt.Errorf("unable to check revocation: %s", resp.Status)
+	}
+}
+
+// probeRevocations returns ErrRevocationUnsupported if
+// midgard does not expose the revocations endpoint.
+func (a *Client) probeRevocations(ctx context.Context) error {
+
+	builder := func(baseURL string) (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, baseURL+"/revocations", nil)
+	}
+
+	resp, err := a.sendRetry(ctx, a.currentHTTPClient(), builder, nil, "")
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close() // nolint: errcheck
+
+	// A 405 means the endpoint exists
+	// but does not support HEAD requests.
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusNotImplemented:
+		return ErrRevocationUnsupported
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_Revoke(t *testing.T) {
+
+	exp := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	token := makeToken(jwt.StandardClaims{Id: "xyz", ExpiresAt: exp.Unix()}, jwt.SigningMethodHS256, []byte("secret"))
+
+	Convey("Given I have a server supporting revocation", t, func() {
+
+		var req *http.Request
+		var body revocation
+		status := http.StatusOK
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req = r
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(status)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I revoke a token", func() {
+
+			err := cl.Revoke(context.Background(), token)
+
+			Convey("Then the revocation should have been sent", func() {
+				So(err, ShouldBeNil)
+				So(req.Method, ShouldEqual, http.MethodPost)
+				So(req.URL.Path, ShouldEqual, "/revocations")
+				So(req.Header.Get("Authorization"), ShouldEqual, "Bearer "+token)
+				So(body.TokenID, ShouldEqual, "xyz")
+				So(body.ExpirationDate.Equal(exp), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I revoke a token that is already revoked", func() {
+
+			status = http.StatusConflict
+			err := cl.Revoke(context.Background(), token)
+
+			Convey("Then it should work", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When midgard rejects the revocation", func() {
+
+			status = http.StatusForbidden
+			err := cl.Revoke(context.Background(), token)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to revoke token: 403 Forbidden")
+			})
+		})
+
+		Convey("When midgard does not support revocation", func() {
+
+			status = http.StatusNotFound
+			err := cl.Revoke(context.Background(), token)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrRevocationUnsupported)
+			})
+		})
+
+		Convey("When I revoke a token without id", func() {
+
+			err := cl.Revoke(context.Background(), makeToken(jwt.StandardClaims{}, jwt.SigningMethodHS256, []byte("secret")))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to revoke token: missing token id")
+				So(req, ShouldBeNil)
+			})
+		})
+
+		Convey("When I revoke an invalid token", func() {
+
+			err := cl.Revoke(context.Background(), "not-a-token")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(req, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestClient_CheckRevocation(t *testing.T) {
+
+	Convey("Given I have a server supporting revocation", t, func() {
+
+		var path string
+		status := http.StatusOK
+		probeStatus := http.StatusMethodNotAllowed
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/revocations" {
+				w.WriteHeader(probeStatus)
+				return
+			}
+			path = r.URL.Path
+			w.WriteHeader(status)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+
+		Convey("When I check a revoked token", func() {
+
+			revoked, err := cl.CheckRevocation(context.Background(), "xyz")
+
+			Convey("Then it should be revoked", func() {
+				So(err, ShouldBeNil)
+				So(revoked, ShouldBeTrue)
+				So(path, ShouldEqual, "/revocations/xyz")
+			})
+		})
+
+		Convey("When I check a token that is not revoked", func() {
+
+			status = http.StatusNotFound
+			revoked, err := cl.CheckRevocation(context.Background(), "xyz")
+
+			Convey("Then it should not be revoked", func() {
+				So(err, ShouldBeNil)
+				So(revoked, ShouldBeFalse)
+			})
+		})
+
+		Convey("When midgard has no revocations endpoint", func() {
+
+			status = http.StatusNotFound
+			probeStatus = http.StatusNotFound
+			revoked, err := cl.CheckRevocation(context.Background(), "xyz")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrRevocationUnsupported)
+				So(revoked, ShouldBeFalse)
+			})
+		})
+
+		Convey("When midgard does not support revocation", func() {
+
+			status = http.StatusNotImplemented
+			_, err := cl.CheckRevocation(context.Background(), "xyz")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrRevocationUnsupported)
+			})
+		})
+
+		Convey("When I check an empty token id", func() {
+
+			_, err := cl.CheckRevocation(context.Background(), "")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to check revocation: missing token id")
+			})
+		})
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.aporeto.io/gaia"
+)
+
+const (
+	xmldsigNamespace  = "http://www.w3.org/2000/09/xmldsig#"
+	samlpNamespace    = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlStatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+)
+
+// IssueFromSAMLIdPInitiated issues a Midgard jwt for the given validity duration
+// from an unsolicited SAMLResponse, posted by an identity provider that only
+// supports IdP-initiated SSO. As there is no prior IssueFromSAMLStep1 and no
+// relay state, the namespace and the name of the SAML provider must be given.
+// OptSAMLIdPCertificates can be used to check the response locally.
+func (a *Client) IssueFromSAMLIdPInitiated(ctx context.Context, namespace string, provider string, response string, validity time.Duration, options ...Option) (string, error) {
+
+	opts := a.issueOptions(options)
+
+	if len(opts.samlIdPCertificates) > 0 {
+		if err := checkSAMLResponse(response, opts.samlIdPCertificates); err != nil {
+			return "", err
+		}
+	}
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{
+		"namespace":        namespace,
+		"SAMLProviderName": provider,
+		"SAMLResponse":     response,
+	}
+	issueRequest.Realm = gaia.IssueRealmSAML
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.saml.idpinitiated")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// checkSAMLResponse checks that the given base64 encoded SAMLResponse
+// has a success status and is signed with one of the given certificates.
+// The signature itself is not verified: it is only checked that the
+// certificate embedded in the signature is one of the given ones.
+func checkSAMLResponse(response string, certs []*x509.Certificate) error {
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(response))
+	if err != nil {
+		return fmt.Errorf("invalid saml response: unable to decode base64: %s", err)
+	}
+
+	var (
+		status       string
+		signed       bool
+		signerCerts  [][]byte
+		inSignature  int
+		inCert       bool
+		certData     strings.Builder
+		decoder      = xml.NewDecoder(bytes.NewReader(data))
+		seenElements bool
+	)
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid saml response: unable to parse xml: %s", err)
+		}
+
+		switch t := tok.(type) {
+
+		case xml.StartElement:
+			seenElements = true
+
+			switch {
+			case t.Name.Space == xmldsigNamespace && t.Name.Local == "Signature":
+				signed = true
+				inSignature++
+			case inSignature > 0 && t.Name.Local == "X509Certificate":
+				inCert = true
+				certData.Reset()
+			case t.Name.Space == samlpNamespace && t.Name.Local == "StatusCode" && status == "":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "Value" {
+						status = attr.Value
+					}
+				}
+			}
+
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == xmldsigNamespace && t.Name.Local == "Signature":
+				inSignature--
+			case inCert && t.Name.Local == "X509Certificate":
+				inCert = false
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certData.String()), ""))
+				if err != nil {
+					return fmt.Errorf("invalid saml response: unable to decode signature certificate: %s", err)
+				}
+				signerCerts = append(signerCerts, der)
+			}
+
+		case xml.CharData:
+			if inCert {
+				certData.Write(t)
+			}
+		}
+	}
+
+	if !seenElements {
+		return fmt.Errorf("invalid saml response: no xml content")
+	}
+
+	if status != "" && status != samlStatusSuccess {
+		return fmt.Errorf("invalid saml response: identity provider returned status '%s'", status)
+	}
+
+	if !signed {
+		return fmt.Errorf("invalid saml response: response is not signed")
+	}
+
+	if len(signerCerts) == 0 {
+		return fmt.Errorf("invalid saml response: signature does not contain the signer certificate")
+	}
+
+	for _, der := range signerCerts {
+		for _, cert := range certs {
+			if bytes.Equal(der, cert.Raw) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("invalid saml response: signed by a certificate that is not one of the identity provider certificates")
+}
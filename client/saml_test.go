@@ -0,0 +1,203 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func makeSAMLResponse(status string, signerCert []byte) string {
+
+	signature := ""
+	if signerCert != nil {
+		signature = fmt.Sprintf(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+  <ds:SignatureValue>c2ln</ds:SignatureValue>
+  <ds:KeyInfo><ds:X509Data><ds:X509Certificate>
+    %s
+  </ds:X509Certificate></ds:X509Data></ds:KeyInfo>
+</ds:Signature>`, base64.StdEncoding.EncodeToString(signerCert))
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+%s
+<samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>
+</samlp:Response>`, signature, status)))
+}
+
+func TestClient_OptSAMLIdPCertificates(t *testing.T) {
+
+	Convey("Calling OptSAMLIdPCertificates without certificate should panic", t, func() {
+		So(func() { OptSAMLIdPCertificates() }, ShouldPanicWith, "at least one certificate must be given")
+		So(func() { OptSAMLIdPCertificates(nil) }, ShouldPanicWith, "certificate cannot be nil")
+	})
+
+	Convey("Given I have a server and the certificates of an identity provider", t, func() {
+
+		var called bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithOptions(ts.URL)
+		idp := &x509.Certificate{Raw: []byte("idp-cert")}
+		other := &x509.Certificate{Raw: []byte("other-cert")}
+
+		issue := func(response string) (string, error) {
+			return cl.IssueFromSAMLStep2(context.Background(), response, "state", time.Minute, OptSAMLIdPCertificates(other, idp))
+		}
+
+		Convey("When I send a response signed by the identity provider", func() {
+
+			token, err := issue(makeSAMLResponse(samlStatusSuccess, idp.Raw))
+
+			Convey("Then it should be sent to midgard", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(called, ShouldBeTrue)
+			})
+		})
+
+		Convey("When I send a response signed by another certificate", func() {
+
+			_, err := issue(makeSAMLResponse(samlStatusSuccess, []byte("unknown-cert")))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid saml response: signed by a certificate that is not one of the identity provider certificates")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I send a response that is not signed", func() {
+
+			_, err := issue(makeSAMLResponse(samlStatusSuccess, nil))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid saml response: response is not signed")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I send a response with a failure status", func() {
+
+			_, err := issue(makeSAMLResponse("urn:oasis:names:tc:SAML:2.0:status:Requester", idp.Raw))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid saml response: identity provider returned status 'urn:oasis:names:tc:SAML:2.0:status:Requester'")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I send a response that is not base64", func() {
+
+			_, err := issue("not base64!")
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "invalid saml response: unable to decode base64: ")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I send a response that is not xml", func() {
+
+			_, err := issue(base64.StdEncoding.EncodeToString([]byte("<samlp:Response>")))
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "invalid saml response: unable to parse xml: ")
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I send a response without the option", func() {
+
+			_, err := cl.IssueFromSAMLStep2(context.Background(), "anything", "state", time.Minute)
+
+			Convey("Then it should be sent to midgard", func() {
+				So(err, ShouldBeNil)
+				So(called, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestClient_IssueFromSAMLIdPInitiated(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		var expectedRequest *gaia.Issue
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expectedRequest = gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"realm": "SAML", "token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+		idp := &x509.Certificate{Raw: []byte("idp-cert")}
+
+		Convey("When I send an unsolicited response", func() {
+
+			response := makeSAMLResponse(samlStatusSuccess, idp.Raw)
+			token, err := cl.IssueFromSAMLIdPInitiated(context.Background(), "/ns", "okta", response, time.Minute,
+				OptSAMLIdPCertificates(idp),
+				OptRestrictNamespace("/ns/a"),
+			)
+
+			Convey("Then the token should be issued", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "SAML")
+				So(expectedRequest.Validity, ShouldEqual, "1m0s")
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns/a")
+				So(expectedRequest.Metadata["namespace"], ShouldEqual, "/ns")
+				So(expectedRequest.Metadata["SAMLProviderName"], ShouldEqual, "okta")
+				So(expectedRequest.Metadata["SAMLResponse"], ShouldEqual, response)
+				So(expectedRequest.Metadata, ShouldNotContainKey, "relayState")
+			})
+		})
+
+		Convey("When I send a response signed by another certificate", func() {
+
+			_, err := cl.IssueFromSAMLIdPInitiated(context.Background(), "/ns", "okta", makeSAMLResponse(samlStatusSuccess, []byte("other")), time.Minute,
+				OptSAMLIdPCertificates(idp),
+			)
+
+			Convey("Then it should fail without calling midgard", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid saml response: signed by a certificate that is not one of the identity provider certificates")
+				So(expectedRequest, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"reflect"
+	"strings"
+
+	"go.aporeto.io/gaia"
+)
+
+// CredentialSchema returns the JSON schema of the app credential
+// accepted by ParseCredentials. It is generated from the gaia.Credential
+// structure.
+func CredentialSchema() map[string]interface{} {
+
+	t := reflect.TypeOf(gaia.Credential{})
+
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		switch name {
+
+		// These are the ones CredsToTLSConfig needs.
+		case "certificate", "certificateAuthority", "certificateKey":
+			properties[name] = map[string]interface{}{
+				"type":            "string",
+				"minLength":       1,
+				"contentEncoding": "base64",
+			}
+			required = append(required, name)
+
+		default:
+			properties[name] = map[string]interface{}{
+				"type": "string",
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "Credential",
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// ValidateCredential validates the given JSON encoded app credential.
+// It returns an error if ParseCredentials would not accept it.
+func ValidateCredential(data []byte) error {
+
+	_, _, err := ParseCredentials(data)
+
+	return err
+}
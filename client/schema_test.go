@@ -0,0 +1,97 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestSchema_CredentialSchema(t *testing.T) {
+
+	Convey("Given I retrieve the credential schema", t, func() {
+
+		s := CredentialSchema()
+
+		Convey("Then it should be encodable", func() {
+			_, err := json.Marshal(s)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Then it should require the certificates", func() {
+			So(s["required"], ShouldResemble, []string{"certificate", "certificateAuthority", "certificateKey"})
+		})
+
+		Convey("Then it should describe all the fields", func() {
+			properties := s["properties"].(map[string]interface{})
+			So(properties, ShouldContainKey, "APIURL")
+			So(properties, ShouldContainKey, "namespace")
+			So(properties["certificate"].(map[string]interface{})["contentEncoding"], ShouldEqual, "base64")
+		})
+	})
+}
+
+func TestSchema_ValidateCredential(t *testing.T) {
+
+	Convey("Given I have a valid app credential", t, func() {
+
+		certPEM, err := ioutil.ReadFile("./fixtures/client-cert.pem")
+		So(err, ShouldBeNil)
+		keyPEM, err := ioutil.ReadFile("./fixtures/client-key.pem")
+		So(err, ShouldBeNil)
+
+		creds := &gaia.Credential{
+			APIURL:               "https://api.aporeto.com",
+			Namespace:            "/a",
+			Certificate:          base64.StdEncoding.EncodeToString(certPEM),
+			CertificateKey:       base64.StdEncoding.EncodeToString(keyPEM),
+			CertificateAuthority: base64.StdEncoding.EncodeToString(certPEM),
+		}
+
+		Convey("When I validate it", func() {
+
+			data, _ := json.Marshal(creds)
+			err := ValidateCredential(data)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I validate it with an invalid key", func() {
+
+			creds.CertificateKey = "not base64"
+			data, _ := json.Marshal(creds)
+			err := ValidateCredential(data)
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to derive tls config from creds: unable to decode key: ")
+			})
+		})
+	})
+
+	Convey("Given I validate invalid json", t, func() {
+
+		err := ValidateCredential([]byte("nope"))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unable to decode app credential: ")
+		})
+	})
+}
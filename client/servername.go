@@ -0,0 +1,71 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// serverNameClients holds the http clients derived from the client
+// one to use a given TLS server name, so their connections are reused.
+type serverNameClients struct {
+	clients map[string]*http.Client
+
+	sync.Mutex
+}
+
+// httpClientFor returns the http client to use to reach midgard
+// with the given TLS server name, or the default one if it is empty.
+func (a *Client) httpClientFor(serverName string) (*http.Client, error) {
+
+	if serverName == "" {
+		return a.currentHTTPClient(), nil
+	}
+
+	a.serverNameClients.Lock()
+	defer a.serverNameClients.Unlock()
+
+	base := a.currentHTTPClient()
+
+	if c, ok := a.serverNameClients.clients[serverName]; ok {
+		return c, nil
+	}
+
+	rt := base.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unable to set tls server name: unsupported transport %T", rt)
+	}
+
+	tr = tr.Clone()
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	tr.TLSClientConfig.ServerName = serverName
+
+	c := *base
+	c.Transport = tr
+
+	if a.serverNameClients.clients == nil {
+		a.serverNameClients.clients = map[string]*http.Client{}
+	}
+	a.serverNameClients.clients[serverName] = &c
+
+	return &c, nil
+}
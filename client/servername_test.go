@@ -0,0 +1,100 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestClient_OptServerName(t *testing.T) {
+
+	Convey("Calling OptServerName with an empty name should panic", t, func() {
+		So(func() { OptServerName("") }, ShouldPanicWith, "server name cannot be empty")
+	})
+
+	Convey("Given I have a TLS server with a certificate for example.com", t, func() {
+
+		var serverName string
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serverName = r.TLS.ServerName
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ts.Certificate())
+
+		cl := NewClientWithOptions(ts.URL, OptionTLSConfig(&tls.Config{RootCAs: pool}))
+
+		Convey("When I issue a token with the server name example.com", func() {
+
+			token, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute, OptServerName("example.com"))
+
+			Convey("Then it should work", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(serverName, ShouldEqual, "example.com")
+			})
+
+			Convey("Then the derived client should be reused", func() {
+				c1, _ := cl.httpClientFor("example.com")
+				c2, _ := cl.httpClientFor("example.com")
+				So(c1, ShouldEqual, c2)
+				So(c1, ShouldNotEqual, cl.httpClient)
+				So(cl.httpClient.Transport.(*http.Transport).TLSClientConfig.ServerName, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I issue a token with a server name not in the certificate", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute, OptServerName("other.com"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "other.com")
+			})
+		})
+	})
+
+	Convey("Given I have a client with a custom round tripper", t, func() {
+
+		cl := NewClientWithOptions("https://midgard.com", OptionHTTPClient(&http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, fmt.Errorf("boom") }),
+		}))
+
+		Convey("When I issue a token with a server name", func() {
+
+			_, err := cl.IssueFromVince(context.Background(), "account", "password", "", time.Minute, OptServerName("example.com"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to set tls server name: unsupported transport")
+			})
+		})
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SignatureHeader is the header holding the detached JWS
+// of the request body when OptSignRequest is used.
+const SignatureHeader = "X-Aporeto-Request-Signature"
+
+// signBody returns a detached JWS (RFC 7515, appendix F) of the given
+// body, signed with the given certificate key. The certificate chain is
+// included in the x5c header so the server can verify the origin.
+func signBody(body []byte, cert tls.Certificate) (string, error) {
+
+	if len(cert.Certificate) == 0 {
+		return "", fmt.Errorf("certificate is empty")
+	}
+
+	var method jwt.SigningMethod
+	switch k := cert.PrivateKey.(type) {
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return "", fmt.Errorf("unsupported elliptic curve: %s", k.Curve.Params().Name)
+		}
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	default:
+		return "", fmt.Errorf("unsupported private key type: %T", cert.PrivateKey)
+	}
+
+	x5c := make([]string, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		x5c[i] = base64.StdEncoding.EncodeToString(der)
+	}
+
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": method.Alg(),
+		"x5c": x5c,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encodedHeader := jwt.EncodeSegment(header)
+
+	sig, err := method.Sign(encodedHeader+"."+jwt.EncodeSegment(body), cert.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign request: %s", err)
+	}
+
+	return encodedHeader + ".." + sig, nil
+}
+
+// signingCertificate returns the client certificate presented with
+// the request: the one given by the options, like the SPIFFE X509-SVID,
+// the one returned by GetClientCertificate, or the first configured one.
+func (a *Client) signingCertificate(opts issueOpts) (*tls.Certificate, error) {
+
+	if opts.clientCertificate != nil {
+		return opts.clientCertificate, nil
+	}
+
+	tlsConfig := a.currentTLSConfig()
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("unable to sign request: no client certificate configured")
+	}
+
+	if tlsConfig.GetClientCertificate != nil {
+		cert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to sign request: %s", err)
+		}
+		if cert != nil && len(cert.Certificate) > 0 {
+			return cert, nil
+		}
+	}
+
+	if len(tlsConfig.Certificates) == 0 {
+		return nil, fmt.Errorf("unable to sign request: no client certificate configured")
+	}
+
+	return &tlsConfig.Certificates[0], nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func verifyDetachedSignature(signature string, body []byte, pub *ecdsa.PublicKey) error {
+
+	parts := strings.Split(signature, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return fmt.Errorf("not a detached jws")
+	}
+
+	return jwt.SigningMethodES256.Verify(parts[0]+"."+jwt.EncodeSegment(body), parts[2], pub)
+}
+
+func TestSignature_signBody(t *testing.T) {
+
+	Convey("Given I have a certificate", t, func() {
+
+		cert, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		if err != nil {
+			panic(err)
+		}
+
+		Convey("When I call signBody", func() {
+
+			sig, err := signBody([]byte("hello"), cert)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the signature should be valid", func() {
+				So(verifyDetachedSignature(sig, []byte("hello"), cert.PrivateKey.(*ecdsa.PrivateKey).Public().(*ecdsa.PublicKey)), ShouldBeNil)
+			})
+
+			Convey("Then the signature should not be valid for another body", func() {
+				So(verifyDetachedSignature(sig, []byte("bye"), cert.PrivateKey.(*ecdsa.PrivateKey).Public().(*ecdsa.PublicKey)), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have an empty certificate", t, func() {
+
+		Convey("When I call signBody", func() {
+
+			sig, err := signBody([]byte("hello"), tls.Certificate{})
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "certificate is empty")
+			})
+
+			Convey("Then sig should be empty", func() {
+				So(sig, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestSignature_OptSignRequest(t *testing.T) {
+
+	Convey("Given I have a client with a certificate and a fake working server", t, func() {
+
+		cert, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		if err != nil {
+			panic(err)
+		}
+
+		var receivedSig string
+		var receivedBody []byte
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedSig = r.Header.Get(SignatureHeader)
+			receivedBody, _ = ioutil.ReadAll(r.Body)
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithTLS(ts.URL, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+		Convey("When I call IssueFromCertificate with OptSignRequest", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromCertificate(ctx, time.Minute, OptSignRequest())
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+			})
+
+			Convey("Then the body signature should be valid", func() {
+				So(verifyDetachedSignature(receivedSig, receivedBody, cert.PrivateKey.(*ecdsa.PrivateKey).Public().(*ecdsa.PublicKey)), ShouldBeNil)
+			})
+		})
+
+		Convey("When I call IssueFromCertificate without OptSignRequest", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			_, err := cl.IssueFromCertificate(ctx, time.Minute)
+
+			Convey("Then no signature should have been sent", func() {
+				So(err, ShouldBeNil)
+				So(receivedSig, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given I have a client getting its certificate dynamically and a fake working server", t, func() {
+
+		cert, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		if err != nil {
+			panic(err)
+		}
+
+		var receivedSig string
+		var receivedBody []byte
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedSig = r.Header.Get(SignatureHeader)
+			receivedBody, _ = ioutil.ReadAll(r.Body)
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithTLS(ts.URL, &tls.Config{
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &cert, nil },
+		})
+
+		Convey("When I call IssueFromCertificate with OptSignRequest", func() {
+
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute, OptSignRequest())
+
+			Convey("Then the body should have been signed with the returned certificate", func() {
+				So(err, ShouldBeNil)
+				So(verifyDetachedSignature(receivedSig, receivedBody, cert.PrivateKey.(*ecdsa.PrivateKey).Public().(*ecdsa.PublicKey)), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a client without certificate and a fake working server", t, func() {
+
+		svid, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		if err != nil {
+			panic(err)
+		}
+
+		var receivedSig string
+		var receivedBody []byte
+
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedSig = r.Header.Get(SignatureHeader)
+			receivedBody, _ = ioutil.ReadAll(r.Body)
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClientWithTLS(ts.URL, &tls.Config{InsecureSkipVerify: true}) // #nosec
+
+		Convey("When I call IssueFromSPIFFEX509SVID with OptSignRequest", func() {
+
+			_, err := cl.IssueFromSPIFFEX509SVID(context.Background(), svid, time.Minute, OptSignRequest())
+
+			Convey("Then the body should have been signed with the svid", func() {
+				So(err, ShouldBeNil)
+				So(verifyDetachedSignature(receivedSig, receivedBody, svid.PrivateKey.(*ecdsa.PrivateKey).Public().(*ecdsa.PublicKey)), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a client without certificate", t, func() {
+
+		cl := NewClientWithTLS("https://midgard", &tls.Config{})
+
+		Convey("When I call IssueFromCertificate with OptSignRequest", func() {
+
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute, OptSignRequest())
+
+			Convey("Then err should be correct", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to sign request: no client certificate configured")
+			})
+		})
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.aporeto.io/gaia"
+)
+
+// IssueFromSPIFFEX509SVID issues a Midgard jwt from the given SPIFFE X.509-SVID
+// for the given validity duration. The SVID is presented as the client certificate
+// of the issue request, instead of the one of the client, and the token is issued
+// from the certificate realm.
+func (a *Client) IssueFromSPIFFEX509SVID(ctx context.Context, svid tls.Certificate, validity time.Duration, options ...Option) (string, error) {
+
+	if len(svid.Certificate) == 0 {
+		return "", fmt.Errorf("missing x509 svid")
+	}
+
+	opts := a.issueOptions(options)
+	opts.clientCertificate = &svid
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Realm = gaia.IssueRealmCertificate
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.spiffe.x509")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// IssueFromSPIFFEJWTSVID issues a Midgard jwt from the given SPIFFE JWT-SVID
+// for the given validity duration. The SVID must have been requested with
+// the audience expected by midgard.
+func (a *Client) IssueFromSPIFFEJWTSVID(ctx context.Context, svid string, validity time.Duration, options ...Option) (string, error) {
+
+	if svid == "" {
+		return "", fmt.Errorf("missing jwt svid")
+	}
+
+	opts := a.issueOptions(options)
+
+	issueRequest := gaia.NewIssue()
+	issueRequest.Metadata = map[string]interface{}{"token": svid}
+	issueRequest.Realm = IssueRealmSPIFFE
+	issueRequest.Validity = validity.String()
+
+	applyOptions(issueRequest, opts)
+
+	span, subctx := a.startSpan(ctx, "midgardlib.client.issue.spiffe.jwt")
+	defer span.Finish()
+
+	return a.sendRequest(subctx, issueRequest, opts)
+}
+
+// httpClientWithCertificate returns a copy of the given http client presenting
+// the given client certificate. Its transport is not shared, so connections
+// authenticated with the certificate are never reused by other requests.
+func httpClientWithCertificate(base *http.Client, cert tls.Certificate) (*http.Client, error) {
+
+	rt := base.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unable to set client certificate: unsupported transport %T", rt)
+	}
+
+	tr = tr.Clone()
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	tr.TLSClientConfig.GetClientCertificate = nil
+
+	c := *base
+	c.Transport = tr
+
+	return &c, nil
+}
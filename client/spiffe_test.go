@@ -0,0 +1,164 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_IssueFromSPIFFEX509SVID(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server requiring a client certificate", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+		var expectedCerts []*x509.Certificate
+
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			expectedCerts = r.TLS.PeerCertificates
+			fmt.Fprintln(w, `{"data": "","realm": "certificate","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		ts.TLS.ClientAuth = tls.RequestClientCert
+
+		svid, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		So(err, ShouldBeNil)
+
+		cl := NewClientWithTLS(ts.URL, &tls.Config{InsecureSkipVerify: true})
+
+		Convey("When I call IssueFromSPIFFEX509SVID", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromSPIFFEX509SVID(ctx, svid, 1*time.Minute, OptQuota(1))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the svid should have been sent", func() {
+				So(expectedCerts, ShouldHaveLength, 1)
+				So(expectedCerts[0].SerialNumber.String(), ShouldEqual, "135383296740973442198818964228093856486")
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "Certificate")
+				So(expectedRequest.Quota, ShouldEqual, 1)
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+
+			Convey("Then the svid should not be used by other requests", func() {
+				_, err := cl.IssueFromCertificate(ctx, 1*time.Minute)
+				So(err, ShouldBeNil)
+				So(expectedCerts, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I call IssueFromSPIFFEX509SVID without svid", func() {
+
+			_, err := cl.IssueFromSPIFFEX509SVID(context.Background(), tls.Certificate{}, 1*time.Minute)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing x509 svid")
+			})
+		})
+	})
+
+	Convey("Given I have a client with a custom round tripper", t, func() {
+
+		cl := NewClientWithOptions("https://midgard.com", OptionHTTPClient(&http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, fmt.Errorf("boom") }),
+		}))
+
+		svid, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		So(err, ShouldBeNil)
+
+		Convey("When I call IssueFromSPIFFEX509SVID", func() {
+
+			_, err := cl.IssueFromSPIFFEX509SVID(context.Background(), svid, 1*time.Minute)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to set client certificate: unsupported transport midgardclient.roundTripperFunc")
+			})
+		})
+	})
+}
+
+func TestClient_IssueFromSPIFFEJWTSVID(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "spiffe","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I call IssueFromSPIFFEJWTSVID", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromSPIFFEJWTSVID(ctx, "jwt-svid", 1*time.Minute, OptRestrictNamespace("/ns1"))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "SPIFFE")
+				So(expectedRequest.Metadata["token"], ShouldEqual, "jwt-svid")
+				So(expectedRequest.RestrictedNamespace, ShouldEqual, "/ns1")
+			})
+
+			Convey("Then token should be correct", func() {
+				So(token, ShouldEqual, "yeay!")
+			})
+		})
+
+		Convey("When I call IssueFromSPIFFEJWTSVID without svid", func() {
+
+			_, err := cl.IssueFromSPIFFEJWTSVID(context.Background(), "", 1*time.Minute)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "missing jwt svid")
+			})
+		})
+	})
+}
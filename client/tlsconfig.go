@@ -0,0 +1,94 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// SetTLSConfig replaces the TLS configuration of the client, for
+// instance after its credentials have been rotated. New requests use
+// the new configuration, while requests in flight complete with the
+// previous one. It returns an error if the client uses a transport
+// set with OptionHTTPClient that is not an *http.Transport.
+func (a *Client) SetTLSConfig(tlsConfig *tls.Config) error {
+
+	commit, err := a.prepareTLSConfig(tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	commit()
+
+	return nil
+}
+
+// prepareTLSConfig prepares the replacement of the TLS configuration
+// of the client. The returned function applies it, and cannot fail.
+func (a *Client) prepareTLSConfig(tlsConfig *tls.Config) (func(), error) {
+
+	current := a.currentHTTPClient()
+
+	rt := current.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unable to set tls config: unsupported transport %T", rt)
+	}
+
+	newTransport := tr.Clone()
+	newTransport.TLSClientConfig = tlsConfig
+
+	c := *current
+	c.Transport = newTransport
+
+	return func() {
+
+		// The derived clients must not be
+		// reused with the previous config.
+		a.serverNameClients.Lock()
+		a.tlsLock.Lock()
+		old := a.httpClient
+		a.httpClient = &c
+		a.tlsConfig = tlsConfig
+		a.serverNameClients.clients = nil
+		a.tlsLock.Unlock()
+		a.serverNameClients.Unlock()
+
+		if tr, ok := old.Transport.(*http.Transport); ok {
+			tr.CloseIdleConnections()
+		}
+	}, nil
+}
+
+// currentHTTPClient returns the http client to use.
+func (a *Client) currentHTTPClient() *http.Client {
+
+	a.tlsLock.RLock()
+	defer a.tlsLock.RUnlock()
+
+	return a.httpClient
+}
+
+// currentTLSConfig returns the TLS configuration of the client.
+func (a *Client) currentTLSConfig() *tls.Config {
+
+	a.tlsLock.RLock()
+	defer a.tlsLock.RUnlock()
+
+	return a.tlsConfig
+}
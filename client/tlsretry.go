@@ -0,0 +1,95 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"strings"
+
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/midgard-lib/logger"
+)
+
+// tlsHandshakeErrors are the TLS errors returned when the client
+// certificate is rejected during the handshake, or when the server
+// or a load balancer tries to renegotiate the connection, which can
+// happen when the client certificate is rotated while a connection
+// is open. The tls package does not export the alert types, so they
+// are matched on their message.
+var tlsHandshakeErrors = []string{
+	"remote error: tls: bad certificate",
+	"remote error: tls: unknown certificate",
+	"remote error: tls: certificate required",
+	"remote error: tls: certificate expired",
+	"remote error: tls: certificate revoked",
+	"remote error: tls: handshake failure",
+	"local error: tls: no renegotiation",
+}
+
+// isTLSHandshakeError returns true if the given error is
+// one of the tlsHandshakeErrors.
+func isTLSHandshakeError(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+	for _, e := range tlsHandshakeErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closeIdleConnections closes the idle connections of all the http
+// clients of the client, so the next requests perform a new handshake
+// with the latest TLS configuration.
+func (a *Client) closeIdleConnections() {
+
+	a.currentHTTPClient().CloseIdleConnections()
+
+	a.serverNameClients.Lock()
+	for _, c := range a.serverNameClients.clients {
+		c.CloseIdleConnections()
+	}
+	a.serverNameClients.Unlock()
+}
+
+// retryTLSHandshake returns true if the given error returned when issuing
+// the given request is caused by the client certificate being rejected during
+// the handshake. In that case, the idle connections are closed, so the request
+// can be sent again on a new connection using the latest certificate set with
+// SetTLSConfig or returned by the GetClientCertificate function of the TLS
+// configuration.
+func (a *Client) retryTLSHandshake(ctx context.Context, issueRequest *gaia.Issue, err error) bool {
+
+	if issueRequest.Realm != gaia.IssueRealmCertificate || !isTLSHandshakeError(err) || ctx.Err() != nil {
+		return false
+	}
+
+	a.config.log().Debug("Retrying certificate issue request after tls handshake error", logger.Err(err))
+
+	a.closeIdleConnections()
+
+	return true
+}
+
+// retryableTransportError returns false if the given error returned
+// by the http client for the given realm cannot be fixed by sending
+// the request again on the same http client.
+func retryableTransportError(err error, realm string) bool {
+
+	return realm != string(gaia.IssueRealmCertificate) || !isTLSHandshakeError(err)
+}
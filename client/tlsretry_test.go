@@ -0,0 +1,121 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_isTLSHandshakeError(t *testing.T) {
+
+	Convey("Given I have some errors", t, func() {
+
+		So(isTLSHandshakeError(nil), ShouldBeFalse)
+		So(isTLSHandshakeError(fmt.Errorf("boom")), ShouldBeFalse)
+		So(isTLSHandshakeError(fmt.Errorf("Post https://midgard/issue: remote error: tls: bad certificate")), ShouldBeTrue)
+		So(isTLSHandshakeError(fmt.Errorf("Post https://midgard/issue: remote error: tls: certificate required")), ShouldBeTrue)
+		So(isTLSHandshakeError(fmt.Errorf("Post https://midgard/issue: local error: tls: no renegotiation")), ShouldBeTrue)
+	})
+}
+
+func TestClient_IssueFromCertificateTLSHandshakeRetry(t *testing.T) {
+
+	Convey("Given I have a fake server requiring a client certificate", t, func() {
+
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"data": "","realm": "certificate","token": "yeay!"}`)
+		}))
+		ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		ts.StartTLS()
+		defer ts.Close()
+
+		cert, err := tls.LoadX509KeyPair("./fixtures/client-cert.pem", "./fixtures/client-key.pem")
+		So(err, ShouldBeNil)
+
+		policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+		Convey("When the certificate is rotated after the first handshake", func() {
+
+			var calls int32
+			cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(policy), OptionTLSConfig(&tls.Config{
+				InsecureSkipVerify: true,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					if atomic.AddInt32(&calls, 1) == 1 {
+						return &tls.Certificate{}, nil
+					}
+					return &cert, nil
+				},
+			}))
+
+			token, err := cl.IssueFromCertificate(context.Background(), time.Minute)
+
+			Convey("Then it should be retried once with the new certificate", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the certificate is set with SetTLSConfig after the first handshake", func() {
+
+			var cl *Client
+			var calls int32
+			cl = NewClientWithOptions(ts.URL, OptionRetryPolicy(policy), OptionTLSConfig(&tls.Config{
+				InsecureSkipVerify: true,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					atomic.AddInt32(&calls, 1)
+					if err := cl.SetTLSConfig(&tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}}); err != nil {
+						return nil, err
+					}
+					return &tls.Certificate{}, nil
+				},
+			}))
+
+			token, err := cl.IssueFromCertificate(context.Background(), time.Minute)
+
+			Convey("Then it should be retried with the new configuration", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the certificate is always rejected", func() {
+
+			var calls int32
+			cl := NewClientWithOptions(ts.URL, OptionRetryPolicy(policy), OptionTLSConfig(&tls.Config{
+				InsecureSkipVerify: true,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					atomic.AddInt32(&calls, 1)
+					return &tls.Certificate{}, nil
+				},
+			}))
+
+			_, err := cl.IssueFromCertificate(context.Background(), time.Minute)
+
+			Convey("Then it should fail after a single retry", func() {
+				So(err, ShouldNotBeNil)
+				So(isTLSHandshakeError(err), ShouldBeTrue)
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+			})
+		})
+	})
+}
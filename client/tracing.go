@@ -0,0 +1,110 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"net/http"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// A SpanTracer traces the client with a tracing library other than
+// opentracing, like OpenTelemetry, without the client depending on it.
+// With OpenTelemetry, Start wraps the Start method of a trace.Tracer
+// and Inject calls the Inject method of the TextMapPropagator with a
+// propagation.HeaderCarrier.
+type SpanTracer interface {
+
+	// Start starts the span of the given operation as a child of the
+	// span carried by ctx, and returns a context carrying the new span.
+	Start(ctx context.Context, operationName string) (context.Context, TracedSpan)
+
+	// Inject injects the trace context of the span carried by
+	// ctx in the headers of a request sent to midgard.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// A TracedSpan is a span started by a SpanTracer.
+type TracedSpan interface {
+
+	// RecordError records an error that occurred during the span.
+	RecordError(err error)
+
+	// End ends the span.
+	End()
+}
+
+// adaptedSpan is an opentracing.Span wrapping a TracedSpan,
+// so the client traces the same way whatever the tracer is.
+type adaptedSpan struct {
+	opentracing.Span
+	span TracedSpan
+}
+
+func newAdaptedSpan(span TracedSpan) *adaptedSpan {
+
+	return &adaptedSpan{
+		Span: opentracing.NoopTracer{}.StartSpan(""),
+		span: span,
+	}
+}
+
+func (s *adaptedSpan) Finish() {
+	s.span.End()
+}
+
+func (s *adaptedSpan) FinishWithOptions(opentracing.FinishOptions) {
+	s.span.End()
+}
+
+func (s *adaptedSpan) LogFields(fields ...log.Field) {
+
+	for _, f := range fields {
+		if err, ok := f.Value().(error); ok {
+			s.span.RecordError(err)
+		}
+	}
+}
+
+// startSpan starts a span using the tracer set by OptionSpanTracer or
+// OptionTracer, or the global opentracing tracer if none was set.
+func (a *Client) startSpan(ctx context.Context, operationName string) (opentracing.Span, context.Context) {
+
+	if a.config.spanTracer != nil {
+		subctx, span := a.config.spanTracer.Start(ctx, operationName)
+		return newAdaptedSpan(span), subctx
+	}
+
+	if a.config.tracer == nil {
+		return opentracing.StartSpanFromContext(ctx, operationName)
+	}
+
+	return opentracing.StartSpanFromContextWithTracer(ctx, a.config.tracer, operationName)
+}
+
+// injectSpan injects the trace context of the given
+// span, carried by ctx, in the given headers.
+func (a *Client) injectSpan(ctx context.Context, span opentracing.Span, header http.Header) error {
+
+	if a.config.spanTracer != nil {
+		a.config.spanTracer.Inject(ctx, header)
+		return nil
+	}
+
+	if t := span.Tracer(); t != nil {
+		return t.Inject(span.Context(), opentracing.TextMap, opentracing.HTTPHeadersCarrier(header))
+	}
+
+	return nil
+}
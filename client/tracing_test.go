@@ -0,0 +1,132 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	id     int
+	name   string
+	parent int
+	errs   []error
+	ended  bool
+}
+
+func (s *testSpan) RecordError(err error) { s.errs = append(s.errs, err) }
+func (s *testSpan) End()                  { s.ended = true }
+
+type testSpanTracer struct {
+	spans []*testSpan
+	sync.Mutex
+}
+
+func (t *testSpanTracer) Start(ctx context.Context, operationName string) (context.Context, TracedSpan) {
+
+	t.Lock()
+	defer t.Unlock()
+
+	span := &testSpan{id: len(t.spans) + 1, name: operationName}
+	if parent, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		span.parent = parent.id
+	}
+	t.spans = append(t.spans, span)
+
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (t *testSpanTracer) Inject(ctx context.Context, header http.Header) {
+
+	if span, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		header.Set("X-Test-Span", fmt.Sprintf("%d", span.id))
+	}
+}
+
+func TestClient_OptionSpanTracer(t *testing.T) {
+
+	Convey("Calling OptionSpanTracer with a nil tracer should make New return an error", t, func() {
+		So(optionError(OptionSpanTracer(nil)), ShouldEqual, "span tracer cannot be nil")
+	})
+
+	Convey("Given I have a server and a client with a span tracer", t, func() {
+
+		var header http.Header
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		tracer := &testSpanTracer{}
+		cl := NewClientWithOptions(ts.URL, OptionSpanTracer(tracer))
+
+		Convey("When I call IssueFromVince with a traced context", func() {
+
+			ctx, root := tracer.Start(context.Background(), "root")
+
+			_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute)
+			root.End()
+
+			Convey("Then the spans should be started by the tracer", func() {
+				So(err, ShouldBeNil)
+				So(tracer.spans, ShouldHaveLength, 3)
+				So(tracer.spans[1].name, ShouldEqual, "midgardlib.client.issue.vince")
+				So(tracer.spans[1].parent, ShouldEqual, tracer.spans[0].id)
+				So(tracer.spans[2].name, ShouldEqual, "midgardlib.client.send")
+				So(tracer.spans[2].parent, ShouldEqual, tracer.spans[1].id)
+				for _, s := range tracer.spans {
+					So(s.ended, ShouldBeTrue)
+				}
+			})
+
+			Convey("Then the trace context should be propagated to midgard", func() {
+				So(header.Get("X-Test-Span"), ShouldEqual, fmt.Sprintf("%d", tracer.spans[2].id))
+			})
+		})
+	})
+}
+
+func TestAdaptedSpan(t *testing.T) {
+
+	Convey("Given I have an adapted span", t, func() {
+
+		span := &testSpan{}
+		adapted := newAdaptedSpan(span)
+
+		Convey("When I log an error and finish it", func() {
+
+			err := errors.New("oops")
+			adapted.SetTag("error", true)
+			adapted.LogFields(log.String("event", "retry"), log.Error(err))
+			adapted.Finish()
+
+			Convey("Then the error should be recorded and the span ended", func() {
+				So(span.errs, ShouldResemble, []error{err})
+				So(span.ended, ShouldBeTrue)
+			})
+		})
+	})
+}
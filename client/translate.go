@@ -0,0 +1,80 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+// A TranslationRule maps a claim of a source token
+// to an opaque value of the translated token.
+type TranslationRule struct {
+
+	// ClaimKey is the key of the claim in the source
+	// token, like "organization" for @auth:organization.
+	ClaimKey string
+
+	// OpaqueKey is the opaque key that will hold the
+	// claim value in the translated token. If the claim
+	// has multiple values, they are joined with a comma.
+	OpaqueKey string
+
+	// Required makes the translation fail if the
+	// source token does not contain the claim.
+	Required bool
+}
+
+// TranslateToken takes a token issued by another environment and
+// re-issues an equivalent token from the midgard of this client, using
+// the Aporeto identity token realm. The given rules are applied to copy
+// claims of the source token into the opaque data of the new token.
+// The midgard of this client must trust the issuer of the source token.
+func (a *Client) TranslateToken(ctx context.Context, token string, validity time.Duration, rules []TranslationRule, options ...Option) (string, error) {
+
+	if len(rules) > 0 {
+
+		claims, err := UnsecureClaimsFromToken(token)
+		if err != nil {
+			return "", fmt.Errorf("unable to read source token claims: %s", err)
+		}
+
+		values := map[string][]string{}
+		for _, claim := range claims {
+			if t, err := verify.ParseTag(claim); err == nil {
+				values[t.Key] = append(values[t.Key], t.Value)
+			}
+		}
+
+		// Do not write into the backing array of the caller.
+		options = append([]Option{}, options...)
+
+		for _, rule := range rules {
+
+			v, ok := values[strings.ToLower(rule.ClaimKey)]
+			if !ok {
+				if rule.Required {
+					return "", fmt.Errorf("source token is missing required claim '%s'", rule.ClaimKey)
+				}
+				continue
+			}
+
+			options = append(options, OptOpaqueValue(rule.OpaqueKey, strings.Join(v, ",")))
+		}
+	}
+
+	return a.IssueFromAporetoIdentityToken(ctx, token, validity, options...)
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestClient_TranslateToken(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"token": "translated"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		source := makeToken(
+			&types.MidgardClaims{
+				Data:           map[string]string{"organization": "acme", "ou": "dev"},
+				StandardClaims: jwt.StandardClaims{Subject: "sub", Issuer: "midgard.env-a"},
+			},
+			jwt.SigningMethodES256,
+			key(signerKey),
+		)
+
+		Convey("When I call TranslateToken with rules", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.TranslateToken(ctx, source, time.Hour,
+				[]TranslationRule{
+					{ClaimKey: "organization", OpaqueKey: "sourceOrg"},
+					{ClaimKey: "missing", OpaqueKey: "missing"},
+				},
+				OptOpaque(map[string]string{"env": "b"}),
+			)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "translated")
+			})
+
+			Convey("Then the issue request should be correct", func() {
+				So(expectedRequest.Realm, ShouldEqual, "AporetoIdentityToken")
+				So(expectedRequest.Metadata["token"], ShouldEqual, source)
+				So(expectedRequest.Opaque, ShouldResemble, map[string]string{"env": "b", "sourceOrg": "acme"})
+			})
+		})
+
+		Convey("When I call TranslateToken with options having spare capacity", func() {
+
+			options := make([]Option, 1, 2)
+			options[0] = OptOpaque(map[string]string{"env": "b"})
+
+			_, err := cl.TranslateToken(context.Background(), source, time.Hour,
+				[]TranslationRule{{ClaimKey: "organization", OpaqueKey: "sourceOrg"}},
+				options...,
+			)
+
+			Convey("Then the options of the caller should not have been modified", func() {
+				So(err, ShouldBeNil)
+				So(options[:2][1], ShouldBeNil)
+			})
+		})
+
+		Convey("When I call TranslateToken with a required claim missing", func() {
+
+			_, err := cl.TranslateToken(context.Background(), source, time.Hour,
+				[]TranslationRule{{ClaimKey: "missing", OpaqueKey: "missing", Required: true}},
+			)
+
+			Convey("Then err should be correct", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "source token is missing required claim 'missing'")
+			})
+		})
+
+		Convey("When I call TranslateToken with an invalid token", func() {
+
+			_, err := cl.TranslateToken(context.Background(), "nope", time.Hour,
+				[]TranslationRule{{ClaimKey: "organization", OpaqueKey: "org"}},
+			)
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
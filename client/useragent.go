@@ -0,0 +1,57 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"runtime/debug"
+)
+
+const modulePath = "go.aporeto.io/midgard-lib"
+
+// libraryUserAgent is the part of the User-Agent identifying this library.
+var libraryUserAgent = "midgard-lib/" + libraryVersion()
+
+// libraryVersion returns the version of the library
+// as recorded in the build information of the binary.
+func libraryVersion() string {
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+
+	return "unknown"
+}
+
+// userAgent returns the User-Agent to use for the requests.
+func (o clientOpts) userAgent() string {
+
+	if o.appUserAgent == "" {
+		return libraryUserAgent
+	}
+
+	return libraryUserAgent + " " + o.appUserAgent
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient_UserAgent(t *testing.T) {
+
+	Convey("Calling OptionUserAgent with an empty app should make New return an error", t, func() {
+		So(optionError(OptionUserAgent("", "1.0")), ShouldEqual, "app cannot be empty")
+	})
+
+	Convey("Given I have a server recording the User-Agent", t, func() {
+
+		var ua string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ua = r.Header.Get("User-Agent")
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		Convey("When I use a client without user agent option", func() {
+
+			_, err := NewClient(ts.URL).IssueFromVince(ctx, "account", "password", "", time.Minute)
+			So(err, ShouldBeNil)
+
+			Convey("Then the User-Agent should contain the library version", func() {
+				So(strings.HasPrefix(ua, "midgard-lib/"), ShouldBeTrue)
+				So(ua, ShouldEqual, libraryUserAgent)
+			})
+		})
+
+		Convey("When I use a client with an application user agent", func() {
+
+			_, err := NewClientWithOptions(ts.URL, OptionUserAgent("apoctl", "1.2.3")).IssueFromVince(ctx, "account", "password", "", time.Minute)
+			So(err, ShouldBeNil)
+
+			Convey("Then the User-Agent should contain the application", func() {
+				So(ua, ShouldEqual, libraryUserAgent+" apoctl/1.2.3")
+			})
+		})
+
+		Convey("When I use a client with an application without version", func() {
+
+			_, err := NewClientWithOptions(ts.URL, OptionUserAgent("apoctl", "")).IssueFromVince(ctx, "account", "password", "", time.Minute)
+			So(err, ShouldBeNil)
+
+			Convey("Then the User-Agent should contain the application", func() {
+				So(ua, ShouldEqual, libraryUserAgent+" apoctl")
+			})
+		})
+	})
+}
@@ -12,22 +12,22 @@
 package midgardclient
 
 import (
-	"crypto/ecdsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"sort"
 	"strings"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"go.aporeto.io/gaia"
 	"go.aporeto.io/gaia/types"
+	"go.aporeto.io/midgard-lib/verify"
 	"go.aporeto.io/tg/tglib"
 )
 
+var defaultVerifier = verify.NewVerifier()
+
 // ParseCredentials parses the credential data.
 func ParseCredentials(data []byte) (creds *gaia.Credential, tlsConfig *tls.Config, err error) {
 
@@ -125,23 +125,7 @@ func VerifyTokenSignature(tokenString string, cert *x509.Certificate) ([]string,
 // VerifyToken verifies the jwt locally using the given certificate.
 func VerifyToken(tokenString string, cert *x509.Certificate) (*types.MidgardClaims, error) {
 
-	c := &types.MidgardClaims{}
-
-	token, err := jwt.ParseWithClaims(tokenString, c, func(token *jwt.Token) (interface{}, error) {
-
-		_, ok := token.Method.(*jwt.SigningMethodECDSA)
-		if !ok {
-			return nil, fmt.Errorf("unexpected signing method: %s", token.Header["alg"])
-		}
-
-		return cert.PublicKey.(*ecdsa.PublicKey), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return token.Claims.(*types.MidgardClaims), nil
+	return defaultVerifier.Verify(tokenString, cert)
 }
 
 // UnsecureClaimsFromToken gets a token and returns the Aporeto
@@ -150,41 +134,46 @@ func VerifyToken(tokenString string, cert *x509.Certificate) (*types.MidgardClai
 // first verified in order to use this function securely.
 func UnsecureClaimsFromToken(token string) ([]string, error) {
 
-	c := &types.MidgardClaims{}
-	p := jwt.Parser{}
-
-	if _, _, err := p.ParseUnverified(token, c); err != nil {
+	c, err := verify.UnsecureClaims(token)
+	if err != nil {
 		return nil, err
 	}
 
 	return NormalizeAuth(c), nil
 }
 
-// NormalizeAuth normalizes the response to a simple structure.
-func NormalizeAuth(c *types.MidgardClaims) (claims []string) {
+// UnsecureOpaqueFromToken returns the opaque data contained in the
+// given token. Like UnsecureClaimsFromToken, it doesn't verify the
+// token signature, so the token must be first verified in order to
+// use this function securely.
+func UnsecureOpaqueFromToken(token string) (map[string]string, error) {
 
-	if c == nil {
-		return
+	c, err := verify.UnsecureClaims(token)
+	if err != nil {
+		return nil, err
 	}
 
-	cache := map[string]struct{}{}
+	return OpaqueFromClaims(c), nil
+}
+
+// OpaqueFromClaims returns a copy of the opaque data contained in
+// the given claims, as returned by VerifyToken.
+func OpaqueFromClaims(c *types.MidgardClaims) map[string]string {
 
-	if c.Subject != "" {
-		cache["@auth:subject="+c.Subject] = struct{}{}
+	if c == nil || len(c.Opaque) == 0 {
+		return nil
 	}
 
-	for key, value := range c.Data {
-		if value != "" {
-			cache["@auth:"+strings.ToLower(key)+"="+value] = struct{}{}
-		}
+	out := make(map[string]string, len(c.Opaque))
+	for k, v := range c.Opaque {
+		out[k] = v
 	}
 
-	// remove duplicates
-	for key := range cache {
-		claims = append(claims, key)
-	}
+	return out
+}
 
-	sort.Strings(claims)
+// NormalizeAuth normalizes the response to a simple structure.
+func NormalizeAuth(c *types.MidgardClaims) (claims []string) {
 
-	return
+	return verify.Normalize(c)
 }
@@ -22,6 +22,7 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.aporeto.io/gaia"
+	"go.aporeto.io/gaia/types"
 )
 
 func TestUtils_extractJWT(t *testing.T) {
@@ -500,3 +501,67 @@ func TestVerifyTokenSignature(t *testing.T) {
 		})
 	})
 }
+
+func TestUnsecureOpaqueFromToken(t *testing.T) {
+
+	Convey("Given I have a token with opaque data", t, func() {
+
+		token := makeToken(
+			&types.MidgardClaims{
+				Opaque:         map[string]string{"deployment": "prod"},
+				StandardClaims: jwt.StandardClaims{Subject: "sub"},
+			},
+			jwt.SigningMethodES256,
+			key(signerKey),
+		)
+
+		Convey("When I call UnsecureOpaqueFromToken", func() {
+
+			opaque, err := UnsecureOpaqueFromToken(token)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then opaque should be correct", func() {
+				So(opaque, ShouldResemble, map[string]string{"deployment": "prod"})
+			})
+		})
+
+		Convey("When I verify the token and call OpaqueFromClaims", func() {
+
+			claims, err := VerifyToken(token, cert(signerCert))
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then opaque should be correct", func() {
+				So(OpaqueFromClaims(claims), ShouldResemble, map[string]string{"deployment": "prod"})
+			})
+		})
+	})
+
+	Convey("Given I have an invalid token", t, func() {
+
+		Convey("When I call UnsecureOpaqueFromToken", func() {
+
+			opaque, err := UnsecureOpaqueFromToken("nope")
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then opaque should be nil", func() {
+				So(opaque, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have nil claims", t, func() {
+
+		Convey("Then OpaqueFromClaims should return nil", func() {
+			So(OpaqueFromClaims(nil), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+)
+
+// maxValidityRegexp extracts a duration following "max validity" from
+// an error description, like "maximum validity is 720h.".
+var maxValidityRegexp = regexp.MustCompile(`(?i)max(?:imum|imal)?[^0-9]*validity[^0-9]*([0-9][0-9a-zµ.]*)`)
+
+// validityLimits holds the maximal validities per realm,
+// either configured or learned from the server responses.
+type validityLimits struct {
+	max map[string]time.Duration
+
+	sync.RWMutex
+}
+
+func newValidityLimits() *validityLimits {
+	return &validityLimits{
+		max: map[string]time.Duration{},
+	}
+}
+
+func (l *validityLimits) get(realm string) (time.Duration, bool) {
+
+	l.RLock()
+	defer l.RUnlock()
+
+	max, ok := l.max[realm]
+
+	return max, ok
+}
+
+func (l *validityLimits) set(realm string, max time.Duration) {
+
+	l.Lock()
+	l.max[realm] = max
+	l.Unlock()
+}
+
+// clamp lowers the validity of the given issue request to
+// the known maximal validity of its realm. It returns true
+// if the validity has been changed.
+func (l *validityLimits) clamp(issueRequest *gaia.Issue) bool {
+
+	if issueRequest.Validity == "" {
+		return false
+	}
+
+	max, ok := l.get(string(issueRequest.Realm))
+	if !ok {
+		return false
+	}
+
+	validity, err := time.ParseDuration(issueRequest.Validity)
+	if err != nil || validity <= max {
+		return false
+	}
+
+	issueRequest.Validity = max.String()
+
+	return true
+}
+
+// learn tries to extract the maximal validity from the given error
+// returned by midgard. If found, it is stored for the realm of the issue
+// request and the request validity is clamped. It returns true if the
+// request has been clamped and can be sent again.
+func (l *validityLimits) learn(issueRequest *gaia.Issue, err error) bool {
+
+	max, ok := extractMaxValidity(err)
+	if !ok {
+		return false
+	}
+
+	l.set(string(issueRequest.Realm), max)
+
+	return l.clamp(issueRequest)
+}
+
+// extractMaxValidity returns the maximal validity advertised
+// in a 422 error returned by midgard, if any. Neither the maxValidity
+// data key nor the wording of the description are a documented midgard
+// contract: they are best effort heuristics, and SetMaxValidity should
+// be used when the limits are known.
+func extractMaxValidity(err error) (time.Duration, bool) {
+
+	var errs elemental.Errors
+	if !errors.As(err, &errs) {
+		return 0, false
+	}
+
+	for _, e := range errs {
+
+		if e.Code != http.StatusUnprocessableEntity {
+			continue
+		}
+
+		if data, ok := e.Data.(map[string]interface{}); ok {
+			if s, ok := data["maxValidity"].(string); ok {
+				if d, err := time.ParseDuration(s); err == nil && d > 0 {
+					return d, true
+				}
+			}
+		}
+
+		if m := maxValidityRegexp.FindStringSubmatch(e.Description); len(m) == 2 {
+			if d, err := time.ParseDuration(strings.TrimRight(m[1], ".")); err == nil && d > 0 {
+				return d, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// MaxValidity returns the maximal validity known for the given realm.
+// The value is either set with SetMaxValidity or learned from midgard
+// when it rejects a request because of a too long validity.
+func (a *Client) MaxValidity(realm string) (time.Duration, bool) {
+
+	return a.validityLimits.get(realm)
+}
+
+// SetMaxValidity sets the maximal validity allowed for the given realm.
+// Issue requests for that realm asking for a longer validity will be
+// clamped to this value.
+func (a *Client) SetMaxValidity(realm string, max time.Duration) {
+
+	a.validityLimits.set(realm, max)
+}
+
+// jitterValidity randomly reduces the validity of the given
+// issue request by up to the given fraction of it.
+func jitterValidity(issueRequest *gaia.Issue, fraction float64) {
+
+	if fraction == 0 || issueRequest.Validity == "" {
+		return
+	}
+
+	validity, err := time.ParseDuration(issueRequest.Validity)
+	if err != nil {
+		return
+	}
+
+	validity -= time.Duration(rand.Float64() * fraction * float64(validity))
+	if validity > time.Second {
+		validity = validity.Truncate(time.Second)
+	}
+
+	issueRequest.Validity = validity.String()
+}
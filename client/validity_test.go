@@ -0,0 +1,214 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+)
+
+func TestValidity_extractMaxValidity(t *testing.T) {
+
+	Convey("Given I have a 422 error with maxValidity data", t, func() {
+
+		e := elemental.NewError("Invalid validity", "too long", "midgard", http.StatusUnprocessableEntity)
+		e.Data = map[string]interface{}{"maxValidity": "1h"}
+
+		Convey("Then extractMaxValidity should return it", func() {
+			d, ok := extractMaxValidity(elemental.Errors{e})
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, time.Hour)
+		})
+	})
+
+	Convey("Given I have a 422 error with the max validity in the description", t, func() {
+
+		e := elemental.NewError("Invalid validity", "Maximum validity is 720h0m0s", "midgard", http.StatusUnprocessableEntity)
+
+		Convey("Then extractMaxValidity should return it", func() {
+			d, ok := extractMaxValidity(elemental.Errors{e})
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 720*time.Hour)
+		})
+	})
+
+	Convey("Given I have a 422 error with the max validity at the end of a sentence", t, func() {
+
+		e := elemental.NewError("Invalid validity", "The maximum validity is 1.5h. Please ask for less.", "midgard", http.StatusUnprocessableEntity)
+
+		Convey("Then extractMaxValidity should return it", func() {
+			d, ok := extractMaxValidity(elemental.Errors{e})
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 90*time.Minute)
+		})
+	})
+
+	Convey("Given I have a 403 error", t, func() {
+
+		e := elemental.NewError("Forbidden", "Maximum validity is 1h", "midgard", http.StatusForbidden)
+
+		Convey("Then extractMaxValidity should return nothing", func() {
+			_, ok := extractMaxValidity(elemental.Errors{e})
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given I have a non elemental error", t, func() {
+
+		Convey("Then extractMaxValidity should return nothing", func() {
+			_, ok := extractMaxValidity(fmt.Errorf("max validity 1h"))
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestValidity_Negotiation(t *testing.T) {
+
+	Convey("Given I have a client and a server with a maximal validity", t, func() {
+
+		var validities []string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			req := gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				panic(err)
+			}
+			validities = append(validities, req.Validity)
+
+			if d, _ := time.ParseDuration(req.Validity); d > time.Hour {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintln(w, `[{"code": 422, "title": "Invalid validity", "description": "maximum validity is 1h0m0s", "subject": "midgard"}]`)
+				return
+			}
+
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		Convey("When I issue a token with a validity too long", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			token, err := cl.IssueFromCertificate(ctx, 24*time.Hour)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "yeay!")
+			})
+
+			Convey("Then the request should have been clamped", func() {
+				So(validities, ShouldResemble, []string{"24h0m0s", "1h0m0s"})
+			})
+
+			Convey("Then the max validity should be learned", func() {
+				d, ok := cl.MaxValidity("Certificate")
+				So(ok, ShouldBeTrue)
+				So(d, ShouldEqual, time.Hour)
+			})
+
+			Convey("When I issue another token with a validity too long", func() {
+
+				_, err := cl.IssueFromCertificate(ctx, 24*time.Hour)
+
+				Convey("Then the request should be clamped directly", func() {
+					So(err, ShouldBeNil)
+					So(validities, ShouldResemble, []string{"24h0m0s", "1h0m0s", "1h0m0s"})
+				})
+			})
+		})
+
+		Convey("When I set a max validity and issue a token", func() {
+
+			cl.SetMaxValidity("Certificate", 30*time.Minute)
+
+			_, err := cl.IssueFromCertificate(context.Background(), 24*time.Hour)
+
+			Convey("Then the request should be clamped", func() {
+				So(err, ShouldBeNil)
+				So(validities, ShouldResemble, []string{"30m0s"})
+			})
+		})
+	})
+}
+
+func TestValidity_jitterValidity(t *testing.T) {
+
+	Convey("Given I have an issue request", t, func() {
+
+		req := gaia.NewIssue()
+		req.Validity = "1h0m0s"
+
+		Convey("Then the validity should be reduced by at most the jitter", func() {
+			seen := map[string]struct{}{}
+			for i := 0; i < 100; i++ {
+				req.Validity = "1h0m0s"
+				jitterValidity(req, 0.1)
+				d, err := time.ParseDuration(req.Validity)
+				So(err, ShouldBeNil)
+				So(d, ShouldBeBetweenOrEqual, 54*time.Minute, time.Hour)
+				So(d%time.Second, ShouldEqual, 0)
+				seen[req.Validity] = struct{}{}
+			}
+			So(len(seen), ShouldBeGreaterThan, 1)
+		})
+
+		Convey("Then the validity should not change without jitter", func() {
+			jitterValidity(req, 0)
+			So(req.Validity, ShouldEqual, "1h0m0s")
+		})
+
+		Convey("Then an empty or invalid validity should not change", func() {
+			req.Validity = ""
+			jitterValidity(req, 0.5)
+			So(req.Validity, ShouldEqual, "")
+			req.Validity = "nope"
+			jitterValidity(req, 0.5)
+			So(req.Validity, ShouldEqual, "nope")
+		})
+	})
+
+	Convey("Given I have a server recording the requested validities", t, func() {
+
+		var validity string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := gaia.NewIssue()
+			_ = json.NewDecoder(r.Body).Decode(req)
+			validity = req.Validity
+			fmt.Fprintln(w, `{"token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I issue a token with a validity jitter", func() {
+
+			_, err := NewClientWithOptions(ts.URL).IssueFromVince(context.Background(), "account", "password", "", time.Hour, OptValidityJitter(0.5))
+
+			Convey("Then the requested validity should have been jittered", func() {
+				So(err, ShouldBeNil)
+				d, _ := time.ParseDuration(validity)
+				So(d, ShouldBeBetweenOrEqual, 30*time.Minute, time.Hour)
+			})
+		})
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"sync/atomic"
+)
+
+// With returns a shallow copy of the client applying the given options
+// to all its calls, before the options given to each call. The copy shares
+// the transport, the caches and the limits of the client, which is left
+// unchanged, so it is cheap to derive clients with a different timeout or
+// headers. Calling SetTLSConfig on the client does not affect the copies
+// already returned.
+func (a *Client) With(options ...Option) *Client {
+
+	return &Client{
+		TrackingType:   a.TrackingType,
+		url:            a.url,
+		tlsConfig:      a.currentTLSConfig(),
+		httpClient:     a.currentHTTPClient(),
+		config:         a.config,
+		validityLimits: a.validityLimits,
+		inflight:       a.inflight,
+		authentifies:   a.authentifies,
+		authCache:      a.authCache,
+		endpoints:      a.endpoints,
+		defaultOptions: append(append([]Option{}, a.defaultOptions...), options...),
+
+		msgpackUnsupported:      atomic.LoadInt32(&a.msgpackUnsupported),
+		gzipRequestsUnsupported: atomic.LoadInt32(&a.gzipRequestsUnsupported),
+		clockSkew:               atomic.LoadInt64(&a.clockSkew),
+	}
+}
+
+// issueOptions returns the issueOpts built from the default
+// options of the client followed by the given ones.
+func (a *Client) issueOptions(options []Option) issueOpts {
+
+	opts := issueOpts{}
+
+	for _, opt := range a.defaultOptions {
+		opt(&opts)
+	}
+
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return opts
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midgardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia"
+)
+
+func TestClient_With(t *testing.T) {
+
+	Convey("Given I have a client and a fake working server", t, func() {
+
+		var expectedHeader http.Header
+		expectedRequest := gaia.NewIssue()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expectedHeader = r.Header
+			expectedRequest = gaia.NewIssue()
+			if err := json.NewDecoder(r.Body).Decode(expectedRequest); err != nil {
+				panic(err)
+			}
+			fmt.Fprintln(w, `{"data": "","realm": "vince","token": "yeay!"}`)
+		}))
+		defer ts.Close()
+
+		cl := NewClient(ts.URL)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		Convey("When I derive a client with options", func() {
+
+			derived := cl.With(OptHeader("X-Namespace", "/a"), OptAudience("a"))
+
+			Convey("Then it should share the transport", func() {
+				So(derived.currentHTTPClient(), ShouldEqual, cl.currentHTTPClient())
+				So(derived.authentifies, ShouldEqual, cl.authentifies)
+			})
+
+			Convey("Then its calls should use the options", func() {
+				_, err := derived.IssueFromVince(ctx, "account", "password", "", time.Minute)
+				So(err, ShouldBeNil)
+				So(expectedHeader.Get("X-Namespace"), ShouldEqual, "/a")
+				So(expectedRequest.Audience, ShouldEqual, "a")
+			})
+
+			Convey("Then the options given to a call should take precedence", func() {
+				_, err := derived.IssueFromVince(ctx, "account", "password", "", time.Minute, OptAudience("b"))
+				So(err, ShouldBeNil)
+				So(expectedRequest.Audience, ShouldEqual, "b")
+			})
+
+			Convey("Then deriving it again should keep the options", func() {
+				_, err := derived.With(OptHeader("X-Other", "o")).IssueFromVince(ctx, "account", "password", "", time.Minute)
+				So(err, ShouldBeNil)
+				So(expectedHeader.Get("X-Namespace"), ShouldEqual, "/a")
+				So(expectedHeader.Get("X-Other"), ShouldEqual, "o")
+			})
+
+			Convey("Then the original client should be unchanged", func() {
+				_, err := cl.IssueFromVince(ctx, "account", "password", "", time.Minute)
+				So(err, ShouldBeNil)
+				So(expectedHeader.Get("X-Namespace"), ShouldBeEmpty)
+				So(expectedRequest.Audience, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I derive a client with a timeout", func() {
+
+			blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+			}))
+			defer blocked.Close()
+
+			_, err := NewClient(blocked.URL).With(OptTimeout(50*time.Millisecond)).IssueFromVince(ctx, "account", "password", "", time.Minute)
+
+			Convey("Then the call should time out", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
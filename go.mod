@@ -12,6 +12,8 @@ require (
 	cloud.google.com/go v0.82.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/opentracing/opentracing-go v1.1.0
+	github.com/sirupsen/logrus v1.8.1
 	github.com/smartystreets/goconvey v1.6.4
 	go.uber.org/zap v1.15.0
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -11,6 +11,11 @@
 
 package ldaputils
 
+import (
+	"fmt"
+	"strings"
+)
+
 // LDAP Key constant definitions.
 const (
 	LDAPAddressKey              = "address"
@@ -24,3 +29,40 @@ const (
 	LDAPPasswordKey             = "password"
 	LDAPBaseDNKey               = "baseDN"
 )
+
+// ConnSecurityProtocol is the protocol used to secure the connection to the LDAP server.
+type ConnSecurityProtocol string
+
+// Supported connection security protocols.
+const (
+	ConnSecurityProtocolNone      ConnSecurityProtocol = "None"
+	ConnSecurityProtocolTLS       ConnSecurityProtocol = "TLS"
+	ConnSecurityProtocolInbandTLS ConnSecurityProtocol = "InbandTLS"
+)
+
+// ConnSecurityProtocols returns the list of the supported connection security protocols.
+func ConnSecurityProtocols() []ConnSecurityProtocol {
+
+	return []ConnSecurityProtocol{
+		ConnSecurityProtocolNone,
+		ConnSecurityProtocolTLS,
+		ConnSecurityProtocolInbandTLS,
+	}
+}
+
+// ValidateConnSecurityProtocol returns an error listing the valid values
+// if the given connection security protocol is not supported.
+func ValidateConnSecurityProtocol(protocol string) error {
+
+	supported := ConnSecurityProtocols()
+	values := make([]string, len(supported))
+
+	for i, p := range supported {
+		if string(p) == protocol {
+			return nil
+		}
+		values[i] = string(p)
+	}
+
+	return fmt.Errorf("invalid %s '%s': must be one of %s", LDAPConnSecurityProtocolKey, protocol, strings.Join(values, ", "))
+}
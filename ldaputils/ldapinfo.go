@@ -80,6 +80,10 @@ func NewLDAPInfo(metadata map[string]interface{}) (*LDAPInfo, error) {
 		return nil, err
 	}
 
+	if err = ValidateConnSecurityProtocol(info.ConnSecurityProtocol); err != nil {
+		return nil, err
+	}
+
 	info.Username, err = findLDAPKey(LDAPUsernameKey, metadata)
 	if err != nil {
 		return nil, err
@@ -189,6 +189,31 @@ func TestLDAPUtils_LDAPInfoMissingKeys(t *testing.T) {
 		})
 	})
 
+	Convey("Given I create a new LDAPInfo with an invalid connSecurityProtocol", t, func() {
+
+		i, err := NewLDAPInfo(map[string]interface{}{
+			LDAPAddressKey:              "123:123",
+			LDAPBindPasswordKey:         "toto",
+			LDAPBindDNKey:               "cn=admin,dc=toto,dc=com",
+			LDAPBindSearchFilterKey:     "uid={USERNAME}",
+			LDAPConnSecurityProtocolKey: "SSL",
+			LDAPSubjectKey:              "uid",
+			LDAPIgnoredKeys:             []string{"a"},
+			LDAPUsernameKey:             "lskywalker",
+			LDAPPasswordKey:             "secret",
+			LDAPBaseDNKey:               "ou=zoupla,dc=toto,dc=com",
+		})
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid connSecurityProtocol 'SSL': must be one of None, TLS, InbandTLS")
+		})
+
+		Convey("Then info should be nil", func() {
+			So(i, ShouldBeNil)
+		})
+	})
+
 	Convey("Given I create a new LDAPInfo with metadata and missing ignoreKeys", t, func() {
 
 		i, err := NewLDAPInfo(map[string]interface{}{
@@ -497,3 +522,20 @@ func TestLDAPUtils_GetUserQueryString(t *testing.T) {
 		})
 	})
 }
+
+func TestLDAPUtils_ConnSecurityProtocol(t *testing.T) {
+
+	Convey("Given I have the supported protocols", t, func() {
+
+		Convey("Then they should all be valid", func() {
+			for _, p := range ConnSecurityProtocols() {
+				So(ValidateConnSecurityProtocol(string(p)), ShouldBeNil)
+			}
+		})
+
+		Convey("Then an unknown protocol should be invalid", func() {
+			So(ValidateConnSecurityProtocol("tls"), ShouldNotBeNil)
+			So(ValidateConnSecurityProtocol(""), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldaputils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Schema returns the JSON schema of the LDAP metadata accepted
+// by NewLDAPInfo. It is generated from the LDAPInfo structure.
+func Schema() map[string]interface{} {
+
+	t := reflect.TypeOf(LDAPInfo{})
+
+	properties := map[string]interface{}{}
+	required := make([]string, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+
+		switch name {
+
+		case LDAPIgnoredKeys:
+			properties[name] = map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			}
+
+		case LDAPConnSecurityProtocolKey:
+			protocols := ConnSecurityProtocols()
+			enum := make([]string, len(protocols))
+			for i, p := range protocols {
+				enum[i] = string(p)
+			}
+			properties[name] = map[string]interface{}{
+				"type": "string",
+				"enum": enum,
+			}
+
+		default:
+			properties[name] = map[string]interface{}{
+				"type":      "string",
+				"minLength": 1,
+			}
+		}
+
+		required = append(required, name)
+	}
+
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "LDAPInfo",
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// Validate validates the given JSON encoded LDAP metadata.
+// It returns an error if NewLDAPInfo would not accept them.
+func Validate(data []byte) error {
+
+	metadata := map[string]interface{}{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return fmt.Errorf("unable to decode ldap metadata: %s", err)
+	}
+
+	// JSON decodes lists as []interface{}, but NewLDAPInfo
+	// expects the ignored keys as a []string.
+	if l, ok := metadata[LDAPIgnoredKeys].([]interface{}); ok {
+		keys := make([]string, len(l))
+		for i, k := range l {
+			s, ok := k.(string)
+			if !ok {
+				return fmt.Errorf("metadata must be a list of strings for key '%s'", LDAPIgnoredKeys)
+			}
+			keys[i] = s
+		}
+		metadata[LDAPIgnoredKeys] = keys
+	}
+
+	_, err := NewLDAPInfo(metadata)
+
+	return err
+}
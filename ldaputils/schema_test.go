@@ -0,0 +1,139 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldaputils
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLDAPUtils_Schema(t *testing.T) {
+
+	Convey("Given I retrieve the schema", t, func() {
+
+		s := Schema()
+
+		Convey("Then it should be encodable", func() {
+			_, err := json.Marshal(s)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Then it should require all the keys", func() {
+			So(s["required"], ShouldResemble, []string{
+				LDAPAddressKey,
+				LDAPBindDNKey,
+				LDAPBindPasswordKey,
+				LDAPBindSearchFilterKey,
+				LDAPSubjectKey,
+				LDAPIgnoredKeys,
+				LDAPBaseDNKey,
+				LDAPConnSecurityProtocolKey,
+				LDAPUsernameKey,
+				LDAPPasswordKey,
+			})
+		})
+
+		Convey("Then it should describe the special keys", func() {
+			properties := s["properties"].(map[string]interface{})
+			So(properties, ShouldHaveLength, 10)
+			So(properties[LDAPIgnoredKeys].(map[string]interface{})["type"], ShouldEqual, "array")
+			So(properties[LDAPConnSecurityProtocolKey].(map[string]interface{})["enum"], ShouldResemble, []string{"None", "TLS", "InbandTLS"})
+			So(properties[LDAPAddressKey].(map[string]interface{})["type"], ShouldEqual, "string")
+		})
+	})
+}
+
+func TestLDAPUtils_Validate(t *testing.T) {
+
+	valid := map[string]interface{}{
+		LDAPAddressKey:              "123:123",
+		LDAPBindDNKey:               "cn=admin,dc=toto,dc=com",
+		LDAPBindPasswordKey:         "toto",
+		LDAPBindSearchFilterKey:     "uid={USERNAME}",
+		LDAPSubjectKey:              "uid",
+		LDAPIgnoredKeys:             []string{"a", "b"},
+		LDAPConnSecurityProtocolKey: "TLS",
+		LDAPUsernameKey:             "titi",
+		LDAPPasswordKey:             "tata",
+		LDAPBaseDNKey:               "dc=toto,dc=com",
+	}
+
+	encode := func(changes map[string]interface{}) []byte {
+		m := map[string]interface{}{}
+		for k, v := range valid {
+			m[k] = v
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(m, k)
+				continue
+			}
+			m[k] = v
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			panic(err)
+		}
+		return data
+	}
+
+	Convey("Given I validate valid metadata", t, func() {
+
+		err := Validate(encode(nil))
+
+		Convey("Then err should be nil", func() {
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I validate invalid json", t, func() {
+
+		err := Validate([]byte("nope"))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unable to decode ldap metadata: ")
+		})
+	})
+
+	Convey("Given I validate metadata with a missing key", t, func() {
+
+		err := Validate(encode(map[string]interface{}{LDAPBaseDNKey: nil}))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "metadata must contain the key 'baseDN'")
+		})
+	})
+
+	Convey("Given I validate metadata with invalid ignored keys", t, func() {
+
+		err := Validate(encode(map[string]interface{}{LDAPIgnoredKeys: []int{1}}))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "metadata must be a list of strings for key 'ignoredKeys'")
+		})
+	})
+
+	Convey("Given I validate metadata with an invalid protocol", t, func() {
+
+		err := Validate(encode(map[string]interface{}{LDAPConnSecurityProtocolKey: "SSL"}))
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid connSecurityProtocol 'SSL': must be one of None, TLS, InbandTLS")
+		})
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldaputils
+
+// ZeroBytes overwrites the given buffer with zeros. It is a best-effort
+// measure to limit the time secrets stay in memory.
+func ZeroBytes(b []byte) {
+
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// SetPassword sets the user password from the given buffer, which
+// is zeroed afterwards. The password is kept as a string in the
+// LDAPInfo as it must be sent to midgard, so Clear should be called
+// once the LDAPInfo is not needed anymore.
+func (i *LDAPInfo) SetPassword(password []byte) {
+
+	i.Password = string(password)
+	ZeroBytes(password)
+}
+
+// SetBindPassword sets the bind password from the given buffer, which
+// is zeroed afterwards. See SetPassword.
+func (i *LDAPInfo) SetBindPassword(password []byte) {
+
+	i.BindPassword = string(password)
+	ZeroBytes(password)
+}
+
+// Clear removes the passwords from the LDAPInfo. Go strings
+// cannot be overwritten, so this only drops the references
+// to let the garbage collector reclaim them.
+func (i *LDAPInfo) Clear() {
+
+	i.Password = ""
+	i.BindPassword = ""
+}
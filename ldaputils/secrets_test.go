@@ -0,0 +1,55 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldaputils
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLDAPUtils_Secrets(t *testing.T) {
+
+	Convey("Given I have an LDAPInfo", t, func() {
+
+		i := &LDAPInfo{}
+
+		Convey("When I set the passwords from buffers", func() {
+
+			password := []byte("secret")
+			bindPassword := []byte("bind")
+
+			i.SetPassword(password)
+			i.SetBindPassword(bindPassword)
+
+			Convey("Then the passwords should be set", func() {
+				So(i.Password, ShouldEqual, "secret")
+				So(i.BindPassword, ShouldEqual, "bind")
+			})
+
+			Convey("Then the buffers should be zeroed", func() {
+				So(password, ShouldResemble, make([]byte, 6))
+				So(bindPassword, ShouldResemble, make([]byte, 4))
+			})
+
+			Convey("When I call Clear", func() {
+
+				i.Clear()
+
+				Convey("Then the passwords should be removed", func() {
+					So(i.Password, ShouldBeEmpty)
+					So(i.BindPassword, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+}
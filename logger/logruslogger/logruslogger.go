@@ -0,0 +1,63 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logruslogger adapts a logrus.FieldLogger to a logger.Logger.
+package logruslogger // import "go.aporeto.io/midgard-lib/logger/logruslogger"
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.aporeto.io/midgard-lib/logger"
+)
+
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+// New returns a logger.Logger writing to the given logrus.FieldLogger.
+// If it is nil, the standard logrus logger is used.
+func New(l logrus.FieldLogger) logger.Logger {
+
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+
+	return &logrusLogger{logger: l}
+}
+
+func (l *logrusLogger) Debug(msg string, fields ...logger.Field) {
+	l.entry(fields).Debug(msg)
+}
+
+func (l *logrusLogger) Info(msg string, fields ...logger.Field) {
+	l.entry(fields).Info(msg)
+}
+
+func (l *logrusLogger) Warn(msg string, fields ...logger.Field) {
+	l.entry(fields).Warn(msg)
+}
+
+func (l *logrusLogger) Error(msg string, fields ...logger.Field) {
+	l.entry(fields).Error(msg)
+}
+
+func (l *logrusLogger) entry(fields []logger.Field) logrus.FieldLogger {
+
+	if len(fields) == 0 {
+		return l.logger
+	}
+
+	out := make(logrus.Fields, len(fields))
+	for _, f := range fields {
+		out[f.Key] = f.Value
+	}
+
+	return l.logger.WithFields(out)
+}
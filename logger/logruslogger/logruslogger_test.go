@@ -0,0 +1,70 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logruslogger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/midgard-lib/logger"
+)
+
+func TestLogrusLogger(t *testing.T) {
+
+	Convey("Given I have a logrus logger adapter", t, func() {
+
+		ll, hook := test.NewNullLogger()
+		ll.SetLevel(logrus.DebugLevel)
+		l := New(ll)
+
+		Convey("When I log messages at every level", func() {
+
+			l.Debug("debug", logger.F("k", "v"))
+			l.Info("info")
+			l.Warn("warn", logger.F("n", 42))
+			l.Error("error", logger.Err(fmt.Errorf("boom")))
+
+			Convey("Then they should be written to the logrus logger", func() {
+				entries := hook.AllEntries()
+				So(len(entries), ShouldEqual, 4)
+				So(entries[0].Level, ShouldEqual, logrus.DebugLevel)
+				So(entries[0].Message, ShouldEqual, "debug")
+				So(entries[0].Data["k"], ShouldEqual, "v")
+				So(entries[1].Level, ShouldEqual, logrus.InfoLevel)
+				So(entries[2].Level, ShouldEqual, logrus.WarnLevel)
+				So(entries[2].Data["n"], ShouldEqual, 42)
+				So(entries[3].Level, ShouldEqual, logrus.ErrorLevel)
+				So(entries[3].Data["error"].(error).Error(), ShouldEqual, "boom")
+			})
+		})
+	})
+
+	Convey("Given I have a logrus logger adapter using the standard logger", t, func() {
+
+		hook := test.NewLocal(logrus.StandardLogger())
+		defer hook.Reset()
+
+		l := New(nil)
+
+		Convey("When I log a message", func() {
+
+			l.Error("error")
+
+			Convey("Then it should be written to the standard logger", func() {
+				So(hook.LastEntry().Message, ShouldEqual, "error")
+			})
+		})
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package zaplogger adapts a zap.Logger to a logger.Logger.
+package zaplogger // import "go.aporeto.io/midgard-lib/logger/zaplogger"
+
+import (
+	"go.aporeto.io/midgard-lib/logger"
+	"go.uber.org/zap"
+)
+
+type zapLogger struct {
+	logger *zap.Logger
+}
+
+// New returns a logger.Logger writing to the given zap.Logger.
+// If it is nil, the global zap logger is used, and looked up on
+// each message so zap.ReplaceGlobals keeps working.
+func New(l *zap.Logger) logger.Logger {
+	return &zapLogger{logger: l}
+}
+
+func (l *zapLogger) Debug(msg string, fields ...logger.Field) {
+	l.zap().Debug(msg, toZap(fields)...)
+}
+
+func (l *zapLogger) Info(msg string, fields ...logger.Field) {
+	l.zap().Info(msg, toZap(fields)...)
+}
+
+func (l *zapLogger) Warn(msg string, fields ...logger.Field) {
+	l.zap().Warn(msg, toZap(fields)...)
+}
+
+func (l *zapLogger) Error(msg string, fields ...logger.Field) {
+	l.zap().Error(msg, toZap(fields)...)
+}
+
+func (l *zapLogger) zap() *zap.Logger {
+
+	if l.logger == nil {
+		return zap.L()
+	}
+
+	return l.logger
+}
+
+func toZap(fields []logger.Field) []zap.Field {
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	out := make([]zap.Field, len(fields))
+	for i, f := range fields {
+		if err, ok := f.Value.(error); ok {
+			out[i] = zap.NamedError(f.Key, err)
+			continue
+		}
+		out[i] = zap.Any(f.Key, f.Value)
+	}
+
+	return out
+}
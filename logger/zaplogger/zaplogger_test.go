@@ -0,0 +1,70 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zaplogger
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/midgard-lib/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZapLogger(t *testing.T) {
+
+	Convey("Given I have a zap logger adapter", t, func() {
+
+		core, logs := observer.New(zapcore.DebugLevel)
+		l := New(zap.New(core))
+
+		Convey("When I log messages at every level", func() {
+
+			l.Debug("debug", logger.F("k", "v"))
+			l.Info("info")
+			l.Warn("warn", logger.F("n", 42))
+			l.Error("error", logger.Err(fmt.Errorf("boom")))
+
+			Convey("Then they should be written to the zap logger", func() {
+				entries := logs.AllUntimed()
+				So(len(entries), ShouldEqual, 4)
+				So(entries[0].Level, ShouldEqual, zapcore.DebugLevel)
+				So(entries[0].ContextMap()["k"], ShouldEqual, "v")
+				So(entries[1].Level, ShouldEqual, zapcore.InfoLevel)
+				So(entries[2].Level, ShouldEqual, zapcore.WarnLevel)
+				So(entries[2].ContextMap()["n"], ShouldEqual, 42)
+				So(entries[3].Level, ShouldEqual, zapcore.ErrorLevel)
+				So(entries[3].ContextMap()["error"], ShouldEqual, "boom")
+			})
+		})
+	})
+
+	Convey("Given I have a zap logger adapter using the global logger", t, func() {
+
+		core, logs := observer.New(zapcore.DebugLevel)
+		restore := zap.ReplaceGlobals(zap.New(core))
+		defer restore()
+
+		l := New(nil)
+
+		Convey("When I log a message", func() {
+
+			l.Info("info")
+
+			Convey("Then it should be written to the global logger", func() {
+				So(logs.Len(), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChainIssuerFuncs returns a TokenIssuerFunc trying the given
+// TokenIssuerFuncs in order until one of them issues a token.
+// If all of them fail, the returned error contains the error
+// of each of them.
+func ChainIssuerFuncs(issuerFuncs ...TokenIssuerFunc) TokenIssuerFunc {
+
+	if len(issuerFuncs) == 0 {
+		panic("at least one issuerFunc is required")
+	}
+
+	for _, f := range issuerFuncs {
+		if f == nil {
+			panic("issuerFunc cannot be nil")
+		}
+	}
+
+	return func(ctx context.Context, validity time.Duration) (string, error) {
+
+		errs := make([]string, 0, len(issuerFuncs))
+
+		for i, f := range issuerFuncs {
+
+			token, err := f(ctx, validity)
+			if err == nil {
+				return token, nil
+			}
+
+			errs = append(errs, fmt.Sprintf("source %d: %s", i+1, err))
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		return "", fmt.Errorf("unable to issue token from any source: %s", strings.Join(errs, "; "))
+	}
+}
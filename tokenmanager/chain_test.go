@@ -0,0 +1,78 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChainIssuerFuncs(t *testing.T) {
+
+	failing := func(ctx context.Context, v time.Duration) (string, error) { return "", fmt.Errorf("boom") }
+	working := func(ctx context.Context, v time.Duration) (string, error) { return "token", nil }
+
+	Convey("Given I create a chain with invalid values", t, func() {
+
+		Convey("Then it should panic", func() {
+			So(func() { ChainIssuerFuncs() }, ShouldPanicWith, "at least one issuerFunc is required")
+			So(func() { ChainIssuerFuncs(working, nil) }, ShouldPanicWith, "issuerFunc cannot be nil")
+		})
+	})
+
+	Convey("Given I have a chain where the first source fails", t, func() {
+
+		f := ChainIssuerFuncs(failing, working)
+
+		Convey("When I issue a token", func() {
+
+			token, err := f(context.Background(), time.Minute)
+
+			Convey("Then the token should come from the next source", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "token")
+			})
+		})
+	})
+
+	Convey("Given I have a chain where all sources fail", t, func() {
+
+		f := ChainIssuerFuncs(failing, failing)
+
+		Convey("When I issue a token", func() {
+
+			_, err := f(context.Background(), time.Minute)
+
+			Convey("Then the error should contain the error of each source", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to issue token from any source: source 1: boom; source 2: boom")
+			})
+		})
+
+		Convey("When I issue a token with a canceled context", func() {
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := f(ctx, time.Minute)
+
+			Convey("Then it should stop after the first source", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to issue token from any source: source 1: boom")
+			})
+		})
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	midgardclient "go.aporeto.io/midgard-lib/client"
+)
+
+// Child returns a new TokenManager maintaining tokens of the given validity,
+// issued by exchanging the current token of m with the given issuer, using
+// the AporetoIdentityToken realm. The given options, like restrictions, are
+// applied to the child tokens, so several narrowly scoped tokens can be kept
+// from a single identity source. As midgard caps the expiration of a child
+// token to the one of its parent, the child token is also renewed every time
+// m renews its token. If m has no token yet, the child waits for it.
+func (m *TokenManager) Child(issuer midgardclient.Issuer, validity time.Duration, options ...midgardclient.Option) *TokenManager {
+
+	if issuer == nil {
+		panic("issuer cannot be nil")
+	}
+
+	var periodic *PeriodicTokenManager
+	periodic = NewPeriodicTokenManager(validity, func(ctx context.Context, v time.Duration) (string, error) {
+
+		token, err := m.waitToken(ctx)
+		if err != nil {
+			return "", fmt.Errorf("parent token manager has no token: %s", err)
+		}
+
+		child, err := issuer.IssueFromAporetoIdentityToken(ctx, token, v, options...)
+		if err != nil {
+			return "", err
+		}
+
+		periodic.parentToken = token
+
+		return child, nil
+	})
+
+	periodic.parentCh = m.Subscribe()
+
+	return NewTokenManager(periodic)
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	midgardclient "go.aporeto.io/midgard-lib/client"
+	"go.aporeto.io/midgard-lib/client/mock"
+)
+
+func TestTokenManager_Child(t *testing.T) {
+
+	Convey("Calling Child without issuer should panic", t, func() {
+		parent := NewTokenManager(NewPeriodicTokenManager(time.Hour, func(context.Context, time.Duration) (string, error) { return "", nil }))
+		So(func() { parent.Child(nil, time.Hour) }, ShouldPanicWith, "issuer cannot be nil")
+	})
+
+	Convey("Given I have a parent token manager and an issuer", t, func() {
+
+		parent := NewTokenManager(NewPeriodicTokenManager(time.Hour, func(context.Context, time.Duration) (string, error) {
+			return "parent-token", nil
+		}))
+
+		var receivedToken string
+		var receivedOptions int
+		issuer := &mock.Client{
+			IssueFromAporetoIdentityTokenFunc: func(ctx context.Context, token string, validity time.Duration, options ...midgardclient.Option) (string, error) {
+				receivedToken = token
+				receivedOptions = len(options)
+				return "child-token", nil
+			},
+		}
+
+		child := parent.Child(issuer, time.Minute, midgardclient.OptRestrictNamespace("/a/b"))
+
+		// Wait for the renewal jobs of the started managers
+		// to stop, so they do not outlive the test.
+		var started []<-chan string
+		var lock sync.Mutex
+		start := func(ctx context.Context, tm *TokenManager) error {
+			sub := tm.Subscribe()
+			err := tm.Start(ctx)
+			if err == nil {
+				lock.Lock()
+				started = append(started, sub)
+				lock.Unlock()
+			}
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer func() {
+			cancel()
+			for _, sub := range started {
+				for range sub {
+				}
+			}
+		}()
+
+		Convey("When I start the child before the parent", func() {
+
+			errCh := make(chan error, 1)
+			go func() { errCh <- start(ctx, child) }()
+
+			So(start(ctx, parent), ShouldBeNil)
+			err := <-errCh
+
+			Convey("Then the child should wait for the parent token", func() {
+				So(err, ShouldBeNil)
+				So(child.Token(), ShouldEqual, "child-token")
+				So(receivedToken, ShouldEqual, "parent-token")
+			})
+		})
+
+		Convey("When I start the child and its context is done before the parent has a token", func() {
+
+			subctx, subcancel := context.WithCancel(ctx)
+			subcancel()
+
+			err := start(subctx, child)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to issue initial token: parent token manager has no token: context canceled")
+			})
+		})
+
+		Convey("When I start the parent and then the child", func() {
+
+			So(start(ctx, parent), ShouldBeNil)
+			err := start(ctx, child)
+
+			Convey("Then the child token should be issued from the parent one", func() {
+				So(err, ShouldBeNil)
+				So(child.Token(), ShouldEqual, "child-token")
+				So(receivedToken, ShouldEqual, "parent-token")
+				So(receivedOptions, ShouldEqual, 1)
+			})
+
+			Convey("When the parent publishes a new token", func() {
+
+				sub := child.Subscribe()
+				parent.publish("parent-token-2")
+
+				Convey("Then the child token should be issued again from the new parent token", func() {
+					So(<-sub, ShouldEqual, "child-token")
+					So(receivedToken, ShouldEqual, "parent-token-2")
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// processIssueLimiter is the issueLimiter shared
+// by all the managers of the process.
+var processIssueLimiter = &issueLimiter{}
+
+// issueLimiter spaces out issue requests so that
+// at most a given number are sent per second.
+type issueLimiter struct {
+	interval time.Duration
+	next     time.Time
+
+	sync.Mutex
+}
+
+// sharedIssueLimiter returns the issueLimiter shared by all the
+// managers of the process, lowering its rate to the given number
+// of issue requests per second if needed, or nil if qps is 0.
+func sharedIssueLimiter(qps float64) *issueLimiter {
+
+	if qps == 0 {
+		return nil
+	}
+
+	interval := time.Duration(float64(time.Second) / qps)
+
+	processIssueLimiter.Lock()
+	if interval > processIssueLimiter.interval {
+		processIssueLimiter.interval = interval
+	}
+	processIssueLimiter.Unlock()
+
+	return processIssueLimiter
+}
+
+// wait blocks until an issue request can be sent,
+// or returns an error if the context is done before.
+func (l *issueLimiter) wait(ctx context.Context) error {
+
+	l.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
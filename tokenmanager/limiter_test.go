@@ -0,0 +1,74 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIssueLimiter(t *testing.T) {
+
+	Convey("Calling sharedIssueLimiter with no limit should return nil", t, func() {
+		So(sharedIssueLimiter(0), ShouldBeNil)
+	})
+
+	Convey("Calling sharedIssueLimiter with different limits should return the same limiter", t, func() {
+		So(sharedIssueLimiter(3), ShouldEqual, sharedIssueLimiter(4))
+	})
+
+	Convey("Calling sharedIssueLimiter with different limits should use the lowest one", t, func() {
+		sharedIssueLimiter(5)
+		So(sharedIssueLimiter(10).interval, ShouldEqual, time.Second/3)
+	})
+
+	Convey("Given I have two managers sharing a max QPS", t, func() {
+
+		tf := func(ctx context.Context, v time.Duration) (string, error) { return "token!", nil }
+		policy := RenewalPolicy{Validity: time.Hour, MaxQPS: 20}
+
+		tm1 := NewPeriodicTokenManagerWithPolicy(policy, tf)
+		tm2 := NewPeriodicTokenManagerWithPolicy(policy, tf)
+
+		Convey("When I issue tokens with both", func() {
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				_, err1 := tm1.Issue(context.Background())
+				_, err2 := tm2.Issue(context.Background())
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+			}
+
+			Convey("Then the issue requests should have been spaced out", func() {
+				So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 5*50*time.Millisecond)
+			})
+		})
+
+		Convey("When the context is done while waiting", func() {
+
+			_, _ = tm1.Issue(context.Background())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := tm2.Issue(ctx)
+
+			Convey("Then err should be the context error", func() {
+				So(err, ShouldEqual, context.Canceled)
+			})
+		})
+	})
+}
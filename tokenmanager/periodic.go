@@ -15,7 +15,8 @@ import (
 	"context"
 	"time"
 
-	"go.uber.org/zap"
+	"go.aporeto.io/midgard-lib/logger"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
 )
 
 var tickDuration = 1 * time.Minute
@@ -28,6 +29,15 @@ type TokenIssuerFunc func(context.Context, time.Duration) (string, error)
 type PeriodicTokenManager struct {
 	validity   time.Duration
 	issuerFunc TokenIssuerFunc
+	policy     RenewalPolicy
+	limiter    *issueLimiter
+	logger     logger.Logger
+
+	// parentCh receives the tokens of the parent of a child
+	// manager. The token is renewed when it differs from
+	// parentToken, the one the current token was issued from.
+	parentCh    <-chan string
+	parentToken string
 }
 
 // NewPeriodicTokenManager returns a new PeriodicTokenManager backed by midgard.
@@ -40,19 +50,80 @@ func NewPeriodicTokenManager(validity time.Duration, issuerFunc TokenIssuerFunc)
 	return &PeriodicTokenManager{
 		issuerFunc: issuerFunc,
 		validity:   validity,
+		policy:     RenewalPolicy{Validity: validity},
+		logger:     zaplogger.New(nil),
 	}
 }
 
-// Issue issues a token.
+// NewPeriodicTokenManagerWithPolicy returns a new PeriodicTokenManager
+// renewing tokens according to the given policy.
+func NewPeriodicTokenManagerWithPolicy(policy RenewalPolicy, issuerFunc TokenIssuerFunc) *PeriodicTokenManager {
+
+	if issuerFunc == nil {
+		panic("issuerFunc cannot be nil")
+	}
+
+	if err := policy.Validate(); err != nil {
+		panic(err.Error())
+	}
+
+	return &PeriodicTokenManager{
+		issuerFunc: issuerFunc,
+		validity:   policy.validity(),
+		policy:     policy,
+		limiter:    sharedIssueLimiter(policy.MaxQPS),
+		logger:     zaplogger.New(nil),
+	}
+}
+
+// SetLogger sets the Logger used to report renewal errors.
+// The default writes to the global zap logger. It must be
+// called before Run.
+func (m *PeriodicTokenManager) SetLogger(l logger.Logger) {
+
+	if l == nil {
+		panic("logger cannot be nil")
+	}
+
+	m.logger = l
+}
+
+// Issue issues a token. If the policy of the manager has a MaxQPS,
+// it waits until the issue request can be sent.
 func (m *PeriodicTokenManager) Issue(ctx context.Context) (token string, err error) {
 
+	if m.limiter != nil {
+		if err := m.limiter.wait(ctx); err != nil {
+			return "", err
+		}
+	}
+
 	return m.issuerFunc(ctx, m.validity)
 }
 
 // Run runs the token renewal job.
 func (m *PeriodicTokenManager) Run(ctx context.Context, tokenCh chan string) {
 
-	nextRefresh := time.Now().Add(m.validity / 2)
+	issued := time.Now()
+	nextRefresh := issued.Add(m.policy.renewalDelay())
+
+	renew := func(now time.Time) {
+
+		subctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		token, err := m.Issue(subctx)
+		cancel()
+
+		if err != nil {
+			m.logger.Error("Unable to renew token", logger.Err(err))
+			return
+		}
+
+		tokenCh <- token
+
+		issued = now
+		nextRefresh = now.Add(m.policy.renewalDelay())
+		m.logger.Info("Token renewed")
+	}
 
 	for {
 
@@ -65,19 +136,22 @@ func (m *PeriodicTokenManager) Run(ctx context.Context, tokenCh chan string) {
 				break
 			}
 
-			subctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			token, err := m.Issue(subctx)
-			cancel()
-
-			if err != nil {
-				zap.L().Error("Unable to renew token", zap.Error(err))
+			if m.policy.inBlackout(now) && issued.Add(m.validity).Sub(now) > m.policy.MinValidity {
 				break
 			}
 
-			tokenCh <- token
+			renew(now)
+
+		case token, ok := <-m.parentCh:
 
-			nextRefresh = now.Add(m.validity / 2)
-			zap.L().Info("Token renewed")
+			if !ok {
+				m.parentCh = nil
+				break
+			}
+
+			if token != m.parentToken {
+				renew(time.Now())
+			}
 
 		case <-ctx.Done():
 			return
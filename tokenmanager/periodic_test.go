@@ -19,6 +19,10 @@ import (
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestTokenManager_Issue(t *testing.T) {
@@ -30,6 +34,15 @@ func TestTokenManager_Issue(t *testing.T) {
 		})
 	})
 
+	Convey("Given I set a nil logger on a periodic token manager", t, func() {
+
+		tm := NewPeriodicTokenManager(10*time.Second, func(context.Context, time.Duration) (string, error) { return "", nil })
+
+		Convey("Then it should panic", func() {
+			So(func() { tm.SetLogger(nil) }, ShouldPanicWith, "logger cannot be nil")
+		})
+	})
+
 	Convey("Given I have TokenIssuerFunc that works and a token manager", t, func() {
 
 		tf := func(ctx context.Context, v time.Duration) (string, error) {
@@ -113,6 +126,9 @@ func TestTokenManager_Run(t *testing.T) {
 
 		tm := NewPeriodicTokenManager(2*time.Millisecond, tf)
 
+		core, logs := observer.New(zapcore.DebugLevel)
+		tm.SetLogger(zaplogger.New(zap.New(core)))
+
 		Convey("When I call Run and wait for a few", func() {
 
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -135,6 +151,10 @@ func TestTokenManager_Run(t *testing.T) {
 			Convey("Then the renew should have been called several times", func() {
 				So(atomic.LoadInt32(&called), ShouldBeGreaterThan, 0)
 			})
+
+			Convey("Then the errors should have been logged", func() {
+				So(logs.FilterMessage("Unable to renew token").Len(), ShouldBeGreaterThan, 0)
+			})
 		})
 	})
 }
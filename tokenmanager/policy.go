@@ -0,0 +1,167 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"fmt"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// A BlackoutWindow is a daily time window, in UTC, during which
+// tokens are not renewed. Start and End use the "15:04" format.
+// The window can span midnight.
+type BlackoutWindow struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// A RenewalPolicy describes how a PeriodicTokenManager renews tokens.
+type RenewalPolicy struct {
+
+	// Validity is the validity requested for the tokens.
+	Validity time.Duration `yaml:"validity"`
+
+	// MaxValidity caps the validity requested for the tokens, so a
+	// fleet wide maximum can be enforced whatever the Validity.
+	// 0 means no limit.
+	MaxValidity time.Duration `yaml:"maxValidity"`
+
+	// MinValidity is the remaining validity under which the token
+	// is renewed even during a blackout window.
+	MinValidity time.Duration `yaml:"minValidity"`
+
+	// RenewalFraction is the fraction of the validity after
+	// which the token is renewed. The default is 0.5.
+	RenewalFraction float64 `yaml:"renewalFraction"`
+
+	// Blackouts are the windows during which
+	// the token is not renewed.
+	Blackouts []BlackoutWindow `yaml:"blackouts"`
+
+	// MaxQPS is the maximum number of issue requests per second
+	// sent to midgard. The limit is shared by all the managers of
+	// the process having one, and the lowest configured MaxQPS
+	// applies to all of them. 0 means no limit.
+	MaxQPS float64 `yaml:"maxQPS"`
+}
+
+// ParseRenewalPolicy parses and validates the given YAML renewal policy.
+func ParseRenewalPolicy(data []byte) (RenewalPolicy, error) {
+
+	p := RenewalPolicy{}
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return RenewalPolicy{}, fmt.Errorf("unable to parse renewal policy: %s", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return RenewalPolicy{}, err
+	}
+
+	return p, nil
+}
+
+// Validate returns an error if the policy is invalid.
+func (p RenewalPolicy) Validate() error {
+
+	if p.Validity <= 0 {
+		return fmt.Errorf("invalid renewal policy: validity must be greater than 0")
+	}
+
+	if p.MaxValidity < 0 {
+		return fmt.Errorf("invalid renewal policy: maxValidity must be positive")
+	}
+
+	if p.MinValidity < 0 || p.MinValidity >= p.validity() {
+		return fmt.Errorf("invalid renewal policy: minValidity must be positive and less than validity")
+	}
+
+	if p.RenewalFraction < 0 || p.RenewalFraction >= 1 {
+		return fmt.Errorf("invalid renewal policy: renewalFraction must be between 0 and 1")
+	}
+
+	if p.MaxQPS < 0 {
+		return fmt.Errorf("invalid renewal policy: maxQPS must be positive")
+	}
+
+	for i, w := range p.Blackouts {
+		if _, _, err := w.bounds(); err != nil {
+			return fmt.Errorf("invalid renewal policy: blackout #%d: %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validity returns the validity to request,
+// capped by MaxValidity if set.
+func (p RenewalPolicy) validity() time.Duration {
+
+	if p.MaxValidity > 0 && p.Validity > p.MaxValidity {
+		return p.MaxValidity
+	}
+
+	return p.Validity
+}
+
+// renewalDelay returns the delay after which a new token must be renewed.
+func (p RenewalPolicy) renewalDelay() time.Duration {
+
+	fraction := p.RenewalFraction
+	if fraction == 0 {
+		fraction = 0.5
+	}
+
+	return time.Duration(float64(p.validity()) * fraction)
+}
+
+// inBlackout returns true if the given time is in a blackout window.
+func (p RenewalPolicy) inBlackout(t time.Time) bool {
+
+	t = t.UTC()
+	minute := t.Hour()*60 + t.Minute()
+
+	for _, w := range p.Blackouts {
+
+		start, end, err := w.bounds()
+		if err != nil {
+			continue
+		}
+
+		if start <= end && minute >= start && minute < end {
+			return true
+		}
+
+		if start > end && (minute >= start || minute < end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bounds returns the start and end of the window in minutes since midnight.
+func (w BlackoutWindow) bounds() (int, int, error) {
+
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start '%s'", w.Start)
+	}
+
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end '%s'", w.End)
+	}
+
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() {
+	tickDuration = 1 * time.Millisecond
+}
+
+func TestRenewalPolicy_Parse(t *testing.T) {
+
+	Convey("Given I have a valid YAML policy", t, func() {
+
+		p, err := ParseRenewalPolicy([]byte(`
+validity: 1h
+minValidity: 10m
+renewalFraction: 0.75
+maxQPS: 2
+blackouts:
+  - start: "23:00"
+    end: "01:00"
+`))
+
+		Convey("Then the policy should be correct", func() {
+			So(err, ShouldBeNil)
+			So(p.Validity, ShouldEqual, time.Hour)
+			So(p.MinValidity, ShouldEqual, 10*time.Minute)
+			So(p.renewalDelay(), ShouldEqual, 45*time.Minute)
+			So(p.MaxQPS, ShouldEqual, 2)
+			So(p.Blackouts, ShouldResemble, []BlackoutWindow{{Start: "23:00", End: "01:00"}})
+		})
+
+		Convey("Then blackout windows spanning midnight should work", func() {
+			So(p.inBlackout(time.Date(2020, 1, 1, 23, 30, 0, 0, time.UTC)), ShouldBeTrue)
+			So(p.inBlackout(time.Date(2020, 1, 1, 0, 30, 0, 0, time.UTC)), ShouldBeTrue)
+			So(p.inBlackout(time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)), ShouldBeFalse)
+			So(p.inBlackout(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given I have invalid policies", t, func() {
+
+		for data, expected := range map[string]string{
+			"validity: 0s":                                     "invalid renewal policy: validity must be greater than 0",
+			"validity: 1h\nminValidity: 2h":                    "invalid renewal policy: minValidity must be positive and less than validity",
+			"validity: 1h\nrenewalFraction: 1":                 "invalid renewal policy: renewalFraction must be between 0 and 1",
+			"validity: 1h\nmaxQPS: -1":                         "invalid renewal policy: maxQPS must be positive",
+			"validity: 1h\nmaxValidity: -1h":                   "invalid renewal policy: maxValidity must be positive",
+			"validity: 1h\nmaxValidity: 10m\nminValidity: 20m": "invalid renewal policy: minValidity must be positive and less than validity",
+			"validity: 1h\nblackouts: [{start: a}]":            "invalid renewal policy: blackout #0: invalid start 'a'",
+		} {
+			_, err := ParseRenewalPolicy([]byte(data))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, expected)
+		}
+
+		_, err := ParseRenewalPolicy([]byte("nope: 1"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestTokenManager_RunWithPolicy(t *testing.T) {
+
+	Convey("Given I create a token manager with an invalid policy", t, func() {
+
+		tf := func(ctx context.Context, v time.Duration) (string, error) { return "token!", nil }
+
+		Convey("Then it should panic", func() {
+			So(func() { NewPeriodicTokenManagerWithPolicy(RenewalPolicy{}, tf) }, ShouldPanicWith, "invalid renewal policy: validity must be greater than 0")
+			So(func() { NewPeriodicTokenManagerWithPolicy(RenewalPolicy{Validity: time.Hour}, nil) }, ShouldPanicWith, "issuerFunc cannot be nil")
+		})
+	})
+
+	Convey("Given I have a token manager with a policy in blackout all day", t, func() {
+
+		var called int32
+		var validity atomic.Value
+		tf := func(ctx context.Context, v time.Duration) (string, error) {
+			atomic.AddInt32(&called, 1)
+			validity.Store(v)
+			return "token!", nil
+		}
+
+		policy := RenewalPolicy{
+			Validity:        20 * time.Millisecond,
+			RenewalFraction: 0.01,
+			Blackouts:       []BlackoutWindow{{Start: "00:00", End: "23:59"}, {Start: "23:59", End: "00:00"}},
+		}
+
+		Convey("When I run it with a token that is far from expiration", func() {
+
+			policy.Validity = time.Hour
+			policy.RenewalFraction = 0.000001
+			tm := NewPeriodicTokenManagerWithPolicy(policy, tf)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			tm.Run(ctx, make(chan string, 100))
+
+			Convey("Then no token should have been issued", func() {
+				So(atomic.LoadInt32(&called), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I run it with a min validity", func() {
+
+			policy.MinValidity = 15 * time.Millisecond
+			tm := NewPeriodicTokenManagerWithPolicy(policy, tf)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			tokenCh := make(chan string, 100)
+			go tm.Run(ctx, tokenCh)
+
+			Convey("Then the token should be renewed when it is about to expire", func() {
+				select {
+				case token := <-tokenCh:
+					So(token, ShouldEqual, "token!")
+					So(validity.Load(), ShouldEqual, 20*time.Millisecond)
+				case <-ctx.Done():
+					So("no token", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+	Convey("Given I have a token manager with a policy capping the validity", t, func() {
+
+		var validity atomic.Value
+		tf := func(ctx context.Context, v time.Duration) (string, error) {
+			validity.Store(v)
+			return "token!", nil
+		}
+
+		tm := NewPeriodicTokenManagerWithPolicy(RenewalPolicy{Validity: 24 * time.Hour, MaxValidity: time.Hour}, tf)
+
+		Convey("When I issue a token", func() {
+
+			_, err := tm.Issue(context.Background())
+
+			Convey("Then the requested validity should be capped", func() {
+				So(err, ShouldBeNil)
+				So(validity.Load(), ShouldEqual, time.Hour)
+			})
+		})
+	})
+}
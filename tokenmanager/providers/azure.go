@@ -30,14 +30,49 @@ type AzureToken struct {
 	TokenType    string `json:"token_type"`
 }
 
+const (
+	// AzureDefaultResource is the resource for which the token is requested
+	// when AzureIdentityRequest.Resource is empty.
+	AzureDefaultResource = "https://management.azure.com"
+
+	// AzureDefaultAPIVersion is the api version of the Metadata Identity
+	// Service used when AzureIdentityRequest.APIVersion is empty.
+	AzureDefaultAPIVersion = "2018-02-01"
+)
+
 var (
 	azureServiceTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token" // #nosec
 )
 
+// AzureIdentityRequest describes the managed identity token to retrieve.
+type AzureIdentityRequest struct {
+
+	// ClientID is the client id of the user-assigned managed identity
+	// to use. If it is empty, the system-assigned identity is used.
+	ClientID string
+
+	// Resource is the resource, or audience, of the token.
+	// It defaults to AzureDefaultResource.
+	Resource string
+
+	// APIVersion is the api version of the Metadata Identity Service.
+	// It defaults to AzureDefaultAPIVersion.
+	APIVersion string
+}
+
 // AzureServiceIdentityToken will retrieve the service account token for
 // the VM using the Metadata Identity Service of Azure.
 func AzureServiceIdentityToken() (string, error) {
-	body, err := issueRequest(azureServiceTokenURL)
+
+	return AzureServiceIdentityTokenFor(AzureIdentityRequest{})
+}
+
+// AzureServiceIdentityTokenFor retrieves the token described by the given
+// request using the Metadata Identity Service of Azure. It allows to use
+// a user-assigned managed identity on VMs having several identities.
+func AzureServiceIdentityTokenFor(request AzureIdentityRequest) (string, error) {
+
+	body, err := issueRequest(azureServiceTokenURL, request)
 	if err != nil {
 		return "", err
 	}
@@ -53,16 +88,27 @@ func AzureServiceIdentityToken() (string, error) {
 	return token.AccessToken, nil
 }
 
-func issueRequest(baseuri string) ([]byte, error) {
+func issueRequest(baseuri string, request AzureIdentityRequest) ([]byte, error) {
 	var endpoint *url.URL
 	endpoint, err := url.Parse(baseuri)
 	if err != nil {
 		return nil, fmt.Errorf("unable to access the service account URL: %s", err)
 	}
 
+	if request.Resource == "" {
+		request.Resource = AzureDefaultResource
+	}
+
+	if request.APIVersion == "" {
+		request.APIVersion = AzureDefaultAPIVersion
+	}
+
 	parameters := url.Values{}
-	parameters.Add("api-version", "2018-02-01")
-	parameters.Add("resource", "https://management.azure.com")
+	parameters.Add("api-version", request.APIVersion)
+	parameters.Add("resource", request.Resource)
+	if request.ClientID != "" {
+		parameters.Add("client_id", request.ClientID)
+	}
 
 	endpoint.RawQuery = parameters.Encode()
 	req, err := http.NewRequest("GET", endpoint.String(), nil)
@@ -83,5 +129,11 @@ func issueRequest(baseuri string) ([]byte, error) {
 		return nil, fmt.Errorf("unable to read data: %s", err)
 	}
 
+	// The service returns an error when the requested identity
+	// is not assigned to the VM, or when the resource is invalid.
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service returned status code %d: %s", resp.StatusCode, string(body))
+	}
+
 	return body, nil
 }
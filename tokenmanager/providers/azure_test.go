@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -89,3 +90,64 @@ func Test_AzureServiceIdentityToken(t *testing.T) {
 	})
 
 }
+
+func Test_AzureServiceIdentityTokenFor(t *testing.T) {
+
+	Convey("Given I have a fake metadata identity service", t, func() {
+
+		var query url.Values
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			if query.Get("client_id") == "unknown" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_request","error_description":"Identity not found"}`)
+				return
+			}
+			fmt.Fprintln(w, newValidAzureToken())
+		}))
+		defer ts.Close()
+
+		azureServiceTokenURL = ts.URL
+
+		Convey("When I retrieve the token of the system-assigned identity", func() {
+
+			token, err := AzureServiceIdentityTokenFor(AzureIdentityRequest{})
+
+			Convey("Then the defaults should be requested", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "the role")
+				So(query.Get("resource"), ShouldEqual, AzureDefaultResource)
+				So(query.Get("api-version"), ShouldEqual, AzureDefaultAPIVersion)
+				So(query, ShouldNotContainKey, "client_id")
+			})
+		})
+
+		Convey("When I retrieve the token of a user-assigned identity", func() {
+
+			token, err := AzureServiceIdentityTokenFor(AzureIdentityRequest{
+				ClientID:   "client-id",
+				Resource:   "api://midgard",
+				APIVersion: "2019-08-01",
+			})
+
+			Convey("Then the request should be correct", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "the role")
+				So(query.Get("client_id"), ShouldEqual, "client-id")
+				So(query.Get("resource"), ShouldEqual, "api://midgard")
+				So(query.Get("api-version"), ShouldEqual, "2019-08-01")
+			})
+		})
+
+		Convey("When I retrieve the token of an unknown identity", func() {
+
+			_, err := AzureServiceIdentityTokenFor(AzureIdentityRequest{ClientID: "unknown"})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, `metadata service returned status code 400: {"error":"invalid_request","error_description":"Identity not found"}`)
+			})
+		})
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	gcpDefaultTokenURI = "https://oauth2.googleapis.com/token"
+	gcpDefaultAudience = "aporeto"
+	gcpJWTBearerGrant  = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// gcpServiceAccountKey is the subset of a GCP service account
+// JSON key needed to request identity tokens.
+type gcpServiceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// gcpIdentityTokenClaims are the claims of the self-signed JWT
+// exchanged at the Google token endpoint for an identity token.
+type gcpIdentityTokenClaims struct {
+	TargetAudience string `json:"target_audience"`
+
+	jwt.StandardClaims
+}
+
+// GCPServiceAccountKeyToken returns a GCP identity token for the service
+// account of the given JSON key, for workloads running outside of GCE or
+// GKE. A JWT signed with the key is exchanged at the Google token endpoint
+// for an identity token with the given audience. If the audience is empty,
+// the one used by GCPServiceAccountToken is used.
+func GCPServiceAccountKeyToken(ctx context.Context, keyJSON []byte, audience string) (string, error) {
+
+	key := &gcpServiceAccountKey{}
+	if err := json.Unmarshal(keyJSON, key); err != nil {
+		return "", fmt.Errorf("unable to decode service account key: %s", err)
+	}
+
+	if key.Type != "service_account" {
+		return "", fmt.Errorf("unable to decode service account key: invalid type '%s'", key.Type)
+	}
+
+	if key.ClientEmail == "" {
+		return "", fmt.Errorf("unable to decode service account key: missing client_email")
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("unable to decode service account key: %s", err)
+	}
+
+	if key.TokenURI == "" {
+		key.TokenURI = gcpDefaultTokenURI
+	}
+
+	if audience == "" {
+		audience = gcpDefaultAudience
+	}
+
+	now := time.Now()
+
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, &gcpIdentityTokenClaims{
+		TargetAudience: audience,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    key.ClientEmail,
+			Subject:   key.ClientEmail,
+			Audience:  key.TokenURI,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		},
+	})
+	assertion.Header["kid"] = key.PrivateKeyID
+
+	signed, err := assertion.SignedString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign service account assertion: %s", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", gcpJWTBearerGrant)
+	form.Set("assertion", signed)
+
+	req, err := http.NewRequest(http.MethodPost, key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve gcp identity token: %s", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve gcp identity token: %s", err)
+	}
+	defer resp.Body.Close() // nolint errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve gcp identity token: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to retrieve gcp identity token: unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	token := struct {
+		IDToken string `json:"id_token"`
+	}{}
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("invalid token returned by google: %s", err)
+	}
+
+	if token.IDToken == "" {
+		return "", fmt.Errorf("invalid token returned by google: missing id_token")
+	}
+
+	return token.IDToken, nil
+}
+
+// GCPServiceAccountKeyTokenFromFile is like GCPServiceAccountKeyToken,
+// using the JSON key stored in the given file.
+func GCPServiceAccountKeyTokenFromFile(ctx context.Context, path string, audience string) (string, error) {
+
+	data, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("unable to read service account key: %s", err)
+	}
+
+	return GCPServiceAccountKeyToken(ctx, data, audience)
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGCPServiceAccountKeyToken(t *testing.T) {
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		panic(err)
+	}
+
+	makeKey := func(tokenURI string) []byte {
+		data, _ := json.Marshal(map[string]string{
+			"type":           "service_account",
+			"client_email":   "sa@project.iam.gserviceaccount.com",
+			"private_key_id": "kid1",
+			"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			"token_uri":      tokenURI,
+		})
+		return data
+	}
+
+	Convey("Given I have a fake google token endpoint", t, func() {
+
+		var grantType string
+		claims := &gcpIdentityTokenClaims{}
+		var header map[string]interface{}
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				panic(err)
+			}
+			grantType = r.PostForm.Get("grant_type")
+			token, err := jwt.ParseWithClaims(r.PostForm.Get("assertion"), claims, func(*jwt.Token) (interface{}, error) {
+				return &privateKey.PublicKey, nil
+			})
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+				return
+			}
+			header = token.Header
+			fmt.Fprint(w, `{"id_token": "the-id-token"}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I retrieve a token for the default audience", func() {
+
+			token, err := GCPServiceAccountKeyToken(context.Background(), makeKey(ts.URL), "")
+
+			Convey("Then I should get the identity token", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "the-id-token")
+			})
+
+			Convey("Then the assertion should be correct", func() {
+				So(grantType, ShouldEqual, "urn:ietf:params:oauth:grant-type:jwt-bearer")
+				So(header["alg"], ShouldEqual, "RS256")
+				So(header["kid"], ShouldEqual, "kid1")
+				So(claims.Issuer, ShouldEqual, "sa@project.iam.gserviceaccount.com")
+				So(claims.Subject, ShouldEqual, "sa@project.iam.gserviceaccount.com")
+				So(claims.Audience, ShouldEqual, ts.URL)
+				So(claims.TargetAudience, ShouldEqual, "aporeto")
+				So(claims.ExpiresAt-claims.IssuedAt, ShouldEqual, 3600)
+			})
+		})
+
+		Convey("When I retrieve a token from a key file for another audience", func() {
+
+			dir, err := ioutil.TempDir("", "gcp")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir) // nolint: errcheck
+
+			path := filepath.Join(dir, "key.json")
+			So(ioutil.WriteFile(path, makeKey(ts.URL), 0600), ShouldBeNil)
+
+			token, err := GCPServiceAccountKeyTokenFromFile(context.Background(), path, "midgard")
+
+			Convey("Then I should get the identity token", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "the-id-token")
+				So(claims.TargetAudience, ShouldEqual, "midgard")
+			})
+		})
+	})
+
+	Convey("Given I have a failing google token endpoint", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+		}))
+		defer ts.Close()
+
+		Convey("When I retrieve a token", func() {
+
+			_, err := GCPServiceAccountKeyToken(context.Background(), makeKey(ts.URL), "")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, `unable to retrieve gcp identity token: unexpected status code 400: {"error":"invalid_grant"}`)
+			})
+		})
+	})
+
+	Convey("Given I have invalid keys", t, func() {
+
+		Convey("Then invalid json should be rejected", func() {
+			_, err := GCPServiceAccountKeyToken(context.Background(), []byte("nope"), "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unable to decode service account key: ")
+		})
+
+		Convey("Then another type of key should be rejected", func() {
+			_, err := GCPServiceAccountKeyToken(context.Background(), []byte(`{"type": "authorized_user"}`), "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unable to decode service account key: invalid type 'authorized_user'")
+		})
+
+		Convey("Then an invalid private key should be rejected", func() {
+			_, err := GCPServiceAccountKeyToken(context.Background(), []byte(`{"type": "service_account", "client_email": "a", "private_key": "nope"}`), "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unable to decode service account key: ")
+		})
+
+		Convey("Then a missing file should be rejected", func() {
+			_, err := GCPServiceAccountKeyTokenFromFile(context.Background(), filepath.Join(os.TempDir(), "does-not-exist.json"), "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unable to read service account key: ")
+		})
+	})
+}
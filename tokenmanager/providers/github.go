@@ -0,0 +1,89 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+const (
+	githubActionsTokenRequestURLEnv   = "ACTIONS_ID_TOKEN_REQUEST_URL"
+	githubActionsTokenRequestTokenEnv = "ACTIONS_ID_TOKEN_REQUEST_TOKEN" // #nosec
+)
+
+// GithubActionsOIDCToken retrieves the OIDC token of the current GitHub
+// Actions job for the given audience. If the audience is empty, GitHub
+// uses its default one. The job must be granted the id-token: write
+// permission.
+func GithubActionsOIDCToken(ctx context.Context, audience string) (string, error) {
+
+	requestURL := os.Getenv(githubActionsTokenRequestURLEnv)
+	requestToken := os.Getenv(githubActionsTokenRequestTokenEnv)
+
+	if requestURL == "" || requestToken == "" {
+		return "", fmt.Errorf("unable to retrieve github actions token: %s and %s must be set", githubActionsTokenRequestURLEnv, githubActionsTokenRequestTokenEnv)
+	}
+
+	endpoint, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve github actions token: invalid request url: %s", err)
+	}
+
+	if audience != "" {
+		query := endpoint.Query()
+		query.Set("audience", audience)
+		endpoint.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve github actions token: %s", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve github actions token: %s", err)
+	}
+	defer resp.Body.Close() // nolint errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve github actions token: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to retrieve github actions token: unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	token := struct {
+		Value string `json:"value"`
+	}{}
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("invalid token returned by github actions: %s", err)
+	}
+
+	if token.Value == "" {
+		return "", fmt.Errorf("invalid token returned by github actions: empty token")
+	}
+
+	return token.Value, nil
+}
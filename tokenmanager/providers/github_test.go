@@ -0,0 +1,134 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGithubActionsOIDCToken(t *testing.T) {
+
+	setEnv := func(requestURL string, requestToken string) func() {
+		oldURL, oldToken := os.Getenv(githubActionsTokenRequestURLEnv), os.Getenv(githubActionsTokenRequestTokenEnv)
+		os.Setenv(githubActionsTokenRequestURLEnv, requestURL)     // nolint: errcheck
+		os.Setenv(githubActionsTokenRequestTokenEnv, requestToken) // nolint: errcheck
+		return func() {
+			os.Setenv(githubActionsTokenRequestURLEnv, oldURL)     // nolint: errcheck
+			os.Setenv(githubActionsTokenRequestTokenEnv, oldToken) // nolint: errcheck
+		}
+	}
+
+	Convey("Given I have a fake github actions token service", t, func() {
+
+		var query url.Values
+		var authorization string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprintln(w, `{"count": 1, "value": "the-token"}`)
+		}))
+		defer ts.Close()
+
+		defer setEnv(ts.URL+"/token?api-version=2.0", "request-token")()
+
+		Convey("When I retrieve a token for an audience", func() {
+
+			token, err := GithubActionsOIDCToken(context.Background(), "midgard")
+
+			Convey("Then I should get the token", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "the-token")
+			})
+
+			Convey("Then the request should be correct", func() {
+				So(authorization, ShouldEqual, "Bearer request-token")
+				So(query.Get("api-version"), ShouldEqual, "2.0")
+				So(query.Get("audience"), ShouldEqual, "midgard")
+			})
+		})
+
+		Convey("When I retrieve a token without audience", func() {
+
+			_, err := GithubActionsOIDCToken(context.Background(), "")
+
+			Convey("Then no audience should be requested", func() {
+				So(err, ShouldBeNil)
+				So(query, ShouldNotContainKey, "audience")
+			})
+		})
+	})
+
+	Convey("Given I have a failing github actions token service", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "nope")
+		}))
+		defer ts.Close()
+
+		defer setEnv(ts.URL, "request-token")()
+
+		Convey("When I retrieve a token", func() {
+
+			_, err := GithubActionsOIDCToken(context.Background(), "midgard")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to retrieve github actions token: unexpected status code 403: nope")
+			})
+		})
+	})
+
+	Convey("Given I have a github actions token service returning invalid data", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"count": 0}`)
+		}))
+		defer ts.Close()
+
+		defer setEnv(ts.URL, "request-token")()
+
+		Convey("When I retrieve a token", func() {
+
+			_, err := GithubActionsOIDCToken(context.Background(), "midgard")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid token returned by github actions: empty token")
+			})
+		})
+	})
+
+	Convey("Given I am not running in github actions", t, func() {
+
+		defer setEnv("", "")()
+
+		Convey("When I retrieve a token", func() {
+
+			_, err := GithubActionsOIDCToken(context.Background(), "midgard")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to retrieve github actions token: ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN must be set")
+			})
+		})
+	})
+}
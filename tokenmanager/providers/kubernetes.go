@@ -0,0 +1,47 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var (
+	kubernetesServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token" // #nosec
+)
+
+// KubernetesServiceAccountToken reads the service account token
+// of the pod from the default mount path.
+func KubernetesServiceAccountToken() (string, error) {
+
+	return KubernetesServiceAccountTokenFromFile(kubernetesServiceAccountTokenPath)
+}
+
+// KubernetesServiceAccountTokenFromFile reads the service account token
+// from the given file, like the path of a projected service account token
+// volume. The file is read on every call, as the kubelet rotates it.
+func KubernetesServiceAccountTokenFromFile(path string) (string, error) {
+
+	data, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("unable to read service account token: %s", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("unable to read service account token: %s is empty", path)
+	}
+
+	return token, nil
+}
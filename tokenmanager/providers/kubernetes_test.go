@@ -0,0 +1,66 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKubernetesServiceAccountToken(t *testing.T) {
+
+	Convey("Given I have a service account token file", t, func() {
+
+		dir, err := ioutil.TempDir("", "kubernetes")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "token")
+		So(ioutil.WriteFile(path, []byte("the-token\n"), 0600), ShouldBeNil)
+
+		Convey("When I read it from the default path", func() {
+
+			kubernetesServiceAccountTokenPath = path
+			token, err := KubernetesServiceAccountToken()
+
+			Convey("Then I should get the token", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "the-token")
+			})
+		})
+
+		Convey("When the file is empty", func() {
+
+			So(ioutil.WriteFile(path, nil, 0600), ShouldBeNil)
+			_, err := KubernetesServiceAccountTokenFromFile(path)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to read service account token: "+path+" is empty")
+			})
+		})
+
+		Convey("When the file does not exist", func() {
+
+			_, err := KubernetesServiceAccountTokenFromFile(filepath.Join(dir, "nope"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to read service account token: ")
+			})
+		})
+	})
+}
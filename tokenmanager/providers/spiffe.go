@@ -0,0 +1,79 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// SPIFFEX509SVIDFromFiles loads the X.509-SVID from the given PEM
+// encoded certificate and key files, like the ones written by the
+// SPIRE agent or the spiffe-helper. The files are read on every call,
+// as the SVID is rotated.
+func SPIFFEX509SVIDFromFiles(certPath string, keyPath string) (tls.Certificate, error) {
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load x509 svid: %s", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load x509 svid: %s", err)
+	}
+
+	if _, err := SPIFFEID(leaf); err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load x509 svid: %s", err)
+	}
+
+	cert.Leaf = leaf
+
+	return cert, nil
+}
+
+// SPIFFEJWTSVIDFromFile reads the JWT-SVID from the given file.
+// The file is read on every call, as the SVID is rotated.
+func SPIFFEJWTSVIDFromFile(path string) (string, error) {
+
+	data, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("unable to read jwt svid: %s", err)
+	}
+
+	svid := strings.TrimSpace(string(data))
+	if svid == "" {
+		return "", fmt.Errorf("unable to read jwt svid: %s is empty", path)
+	}
+
+	return svid, nil
+}
+
+// SPIFFEID returns the SPIFFE ID of the given X.509-SVID. As
+// required by the X.509-SVID specification, the certificate must have
+// exactly one URI SAN, using the spiffe scheme.
+func SPIFFEID(cert *x509.Certificate) (string, error) {
+
+	if len(cert.URIs) != 1 {
+		return "", fmt.Errorf("certificate must have exactly one uri san, got %d", len(cert.URIs))
+	}
+
+	u := cert.URIs[0]
+	if u.Scheme != "spiffe" || u.Host == "" {
+		return "", fmt.Errorf("invalid spiffe id '%s'", u)
+	}
+
+	return u.String(), nil
+}
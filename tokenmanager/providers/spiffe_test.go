@@ -0,0 +1,180 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func writeTestSVID(dir string, uris ...string) (certPath string, keyPath string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "workload"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			panic(err)
+		}
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+
+	certPath = filepath.Join(dir, "svid.pem")
+	keyPath = filepath.Join(dir, "svid_key.pem")
+
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		panic(err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestSPIFFEX509SVIDFromFiles(t *testing.T) {
+
+	Convey("Given I have a temporary directory", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		Convey("When I load a valid svid", func() {
+
+			certPath, keyPath := writeTestSVID(dir, "spiffe://example.org/workload")
+			cert, err := SPIFFEX509SVIDFromFiles(certPath, keyPath)
+
+			Convey("Then I should get the certificate", func() {
+				So(err, ShouldBeNil)
+				So(cert.Leaf, ShouldNotBeNil)
+				So(cert.Leaf.URIs[0].String(), ShouldEqual, "spiffe://example.org/workload")
+			})
+		})
+
+		Convey("When I load a certificate without spiffe id", func() {
+
+			certPath, keyPath := writeTestSVID(dir)
+			_, err := SPIFFEX509SVIDFromFiles(certPath, keyPath)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to load x509 svid: certificate must have exactly one uri san, got 0")
+			})
+		})
+
+		Convey("When the files do not exist", func() {
+
+			_, err := SPIFFEX509SVIDFromFiles(filepath.Join(dir, "nope"), filepath.Join(dir, "nope"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to load x509 svid: ")
+			})
+		})
+	})
+}
+
+func TestSPIFFEJWTSVIDFromFile(t *testing.T) {
+
+	Convey("Given I have a jwt svid file", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "jwt_svid.token")
+		So(ioutil.WriteFile(path, []byte("the-svid\n"), 0600), ShouldBeNil)
+
+		Convey("When I read it", func() {
+
+			svid, err := SPIFFEJWTSVIDFromFile(path)
+
+			Convey("Then I should get the svid", func() {
+				So(err, ShouldBeNil)
+				So(svid, ShouldEqual, "the-svid")
+			})
+		})
+
+		Convey("When the file is empty", func() {
+
+			So(ioutil.WriteFile(path, nil, 0600), ShouldBeNil)
+			_, err := SPIFFEJWTSVIDFromFile(path)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to read jwt svid: "+path+" is empty")
+			})
+		})
+	})
+}
+
+func TestSPIFFEID(t *testing.T) {
+
+	Convey("Given I have certificates with various uri sans", t, func() {
+
+		parse := func(s string) *url.URL {
+			u, _ := url.Parse(s)
+			return u
+		}
+
+		Convey("Then a spiffe uri should be accepted", func() {
+			id, err := SPIFFEID(&x509.Certificate{URIs: []*url.URL{parse("spiffe://example.org/a")}})
+			So(err, ShouldBeNil)
+			So(id, ShouldEqual, "spiffe://example.org/a")
+		})
+
+		Convey("Then another scheme should be rejected", func() {
+			_, err := SPIFFEID(&x509.Certificate{URIs: []*url.URL{parse("https://example.org/a")}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid spiffe id 'https://example.org/a'")
+		})
+
+		Convey("Then several uris should be rejected", func() {
+			_, err := SPIFFEID(&x509.Certificate{URIs: []*url.URL{parse("spiffe://a/b"), parse("spiffe://a/c")}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "certificate must have exactly one uri san, got 2")
+		})
+	})
+}
@@ -0,0 +1,331 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	spiffeEndpointSocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+	// maxWorkloadAPIMessage is the maximum size of a message
+	// accepted from the workload api.
+	maxWorkloadAPIMessage = 4 << 20
+)
+
+// SPIFFEWorkloadX509SVID fetches the default X.509-SVID of the workload
+// from the SPIFFE Workload API exposed by the SPIRE agent on the given
+// socket. The socket can be given as a path or as a unix:// url. If it
+// is empty, the SPIFFE_ENDPOINT_SOCKET environment variable is used.
+func SPIFFEWorkloadX509SVID(ctx context.Context, socket string) (tls.Certificate, error) {
+
+	data, err := workloadAPICall(ctx, socket, "FetchX509SVID", nil)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: %s", err)
+	}
+
+	var svid []byte
+	if err := protoFields(data, func(field int, value []byte) error {
+		if field == 1 && svid == nil {
+			svid = value
+		}
+		return nil
+	}); err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: invalid response: %s", err)
+	}
+
+	if svid == nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: no svid returned")
+	}
+
+	var chain, key []byte
+	if err := protoFields(svid, func(field int, value []byte) error {
+		switch field {
+		case 2:
+			chain = value
+		case 3:
+			key = value
+		}
+		return nil
+	}); err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: invalid response: %s", err)
+	}
+
+	certs, err := x509.ParseCertificates(chain)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: %s", err)
+	}
+	if len(certs) == 0 {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: empty certificate chain")
+	}
+
+	pkey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: %s", err)
+	}
+
+	if _, err := SPIFFEID(certs[0]); err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch x509 svid: %s", err)
+	}
+
+	cert := tls.Certificate{
+		PrivateKey: pkey,
+		Leaf:       certs[0],
+	}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return cert, nil
+}
+
+// SPIFFEWorkloadJWTSVID fetches a JWT-SVID for the given audience from
+// the SPIFFE Workload API exposed by the SPIRE agent on the given
+// socket. The socket is resolved like in SPIFFEWorkloadX509SVID.
+func SPIFFEWorkloadJWTSVID(ctx context.Context, socket string, audience ...string) (string, error) {
+
+	if len(audience) == 0 {
+		return "", fmt.Errorf("unable to fetch jwt svid: at least one audience is required")
+	}
+
+	var req []byte
+	for _, aud := range audience {
+		req = protoAppendString(req, 1, aud)
+	}
+
+	data, err := workloadAPICall(ctx, socket, "FetchJWTSVID", req)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch jwt svid: %s", err)
+	}
+
+	var svid []byte
+	if err := protoFields(data, func(field int, value []byte) error {
+		if field == 1 && svid == nil {
+			svid = value
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("unable to fetch jwt svid: invalid response: %s", err)
+	}
+
+	var token string
+	if err := protoFields(svid, func(field int, value []byte) error {
+		if field == 2 {
+			token = string(value)
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("unable to fetch jwt svid: invalid response: %s", err)
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("unable to fetch jwt svid: no svid returned")
+	}
+
+	return token, nil
+}
+
+// workloadAPISocketPath returns the path of the workload api socket.
+func workloadAPISocketPath(socket string) (string, error) {
+
+	if socket == "" {
+		socket = os.Getenv(spiffeEndpointSocketEnv)
+	}
+
+	if socket == "" {
+		return "", fmt.Errorf("no socket given and %s is not set", spiffeEndpointSocketEnv)
+	}
+
+	if !strings.Contains(socket, "://") {
+		return socket, nil
+	}
+
+	path := strings.TrimPrefix(socket, "unix://")
+	if path == socket || path == "" {
+		return "", fmt.Errorf("unsupported workload api address '%s'", socket)
+	}
+
+	return path, nil
+}
+
+// workloadAPICall calls the given method of the workload api and
+// returns the first message it sends back. The workload api is a gRPC
+// service, so the request and the response are protobuf encoded and
+// framed as gRPC messages.
+func workloadAPICall(ctx context.Context, socket string, method string, msg []byte) ([]byte, error) {
+
+	path, err := workloadAPISocketPath(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := workloadHTTPClient(path)
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	// The x509 call is a stream the server keeps open, so
+	// we cancel it once we got the first message.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/SpiffeWorkloadAPI/"+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("workload.spiffe.io", "true")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// A failed call may only send headers.
+	if err := grpcStatusError(resp.Header); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(resp.Body, header); err != nil {
+		if err == io.EOF {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			if err := grpcStatusError(resp.Trailer); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("no message returned")
+		}
+		return nil, err
+	}
+
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxWorkloadAPIMessage {
+		return nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// grpcStatusError returns the error described by the grpc-status
+// and grpc-message entries of the given headers, if any.
+func grpcStatusError(h http.Header) error {
+
+	status := h.Get("Grpc-Status")
+	if status == "" || status == "0" {
+		return nil
+	}
+
+	return fmt.Errorf("workload api error %s: %s", status, h.Get("Grpc-Message"))
+}
+
+// protoAppendString appends the given string as the
+// given protobuf field.
+func protoAppendString(b []byte, field int, s string) []byte {
+
+	b = protoAppendVarint(b, uint64(field)<<3|2)
+	b = protoAppendVarint(b, uint64(len(s)))
+
+	return append(b, s...)
+}
+
+func protoAppendVarint(b []byte, v uint64) []byte {
+
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+// protoFields calls fn for every length delimited field of the given
+// protobuf message. Other fields are skipped.
+func protoFields(b []byte, fn func(field int, value []byte) error) error {
+
+	for len(b) > 0 {
+
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("invalid field tag")
+		}
+		b = b[n:]
+
+		field := int(tag >> 3)
+
+		switch tag & 7 {
+
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("invalid varint in field %d", field)
+			}
+			b = b[n:]
+
+		case 1:
+			if len(b) < 8 {
+				return fmt.Errorf("truncated field %d", field)
+			}
+			b = b[8:]
+
+		case 5:
+			if len(b) < 4 {
+				return fmt.Errorf("truncated field %d", field)
+			}
+			b = b[4:]
+
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return fmt.Errorf("truncated field %d", field)
+			}
+			b = b[n:]
+
+			if err := fn(field, b[:size]); err != nil {
+				return err
+			}
+			b = b[size:]
+
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", tag&7, field)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.24
+// +build go1.24
+
+package providers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestWorkloadSVID(uri string) (certDER []byte, keyDER []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		panic(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "workload"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{u},
+	}
+
+	certDER, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	keyDER, err = x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return certDER, keyDER
+}
+
+// startTestWorkloadAPI serves the given handler as a
+// workload api on a unix socket in the given directory.
+func startTestWorkloadAPI(dir string, handler http.HandlerFunc) (socket string, stop func()) {
+
+	socket = filepath.Join(dir, "agent.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		panic(err)
+	}
+
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &http.Server{Handler: handler, Protocols: protocols}
+	go srv.Serve(l) // nolint: errcheck
+
+	return "unix://" + socket, func() { _ = srv.Close() }
+}
+
+func writeGRPCMessage(w http.ResponseWriter, msg []byte) {
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status")
+
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, _ = w.Write(append(frame, msg...))
+
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func readGRPCMessage(r *http.Request) []byte {
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil || len(data) < 5 {
+		return nil
+	}
+
+	return data[5:]
+}
+
+func TestSPIFFEWorkloadX509SVID(t *testing.T) {
+
+	Convey("Given I have a workload api", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		certDER, keyDER := newTestWorkloadSVID("spiffe://example.org/workload")
+
+		var path, securityHeader string
+		socket, stop := startTestWorkloadAPI(dir, func(w http.ResponseWriter, r *http.Request) {
+
+			path = r.URL.Path
+			securityHeader = r.Header.Get("workload.spiffe.io")
+
+			var svid []byte
+			svid = protoAppendString(svid, 1, "spiffe://example.org/workload")
+			svid = protoAppendString(svid, 2, string(certDER))
+			svid = protoAppendString(svid, 3, string(keyDER))
+
+			writeGRPCMessage(w, protoAppendString(nil, 1, string(svid)))
+			w.(http.Flusher).Flush()
+
+			// The x509 call is a stream.
+			<-r.Context().Done()
+		})
+		defer stop()
+
+		Convey("When I fetch the x509 svid", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cert, err := SPIFFEWorkloadX509SVID(ctx, socket)
+
+			Convey("Then I should get the certificate", func() {
+				So(err, ShouldBeNil)
+				So(path, ShouldEqual, "/SpiffeWorkloadAPI/FetchX509SVID")
+				So(securityHeader, ShouldEqual, "true")
+				So(cert.Leaf, ShouldNotBeNil)
+				So(cert.Leaf.URIs[0].String(), ShouldEqual, "spiffe://example.org/workload")
+				So(cert.Certificate, ShouldResemble, [][]byte{certDER})
+				So(cert.PrivateKey, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+			})
+		})
+	})
+
+	Convey("Given I have a workload api that has no identity for me", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		socket, stop := startTestWorkloadAPI(dir, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "7")
+			w.Header().Set("Grpc-Message", "no identity issued")
+		})
+		defer stop()
+
+		Convey("When I fetch the x509 svid", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := SPIFFEWorkloadX509SVID(ctx, socket)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to fetch x509 svid: workload api error 7: no identity issued")
+			})
+		})
+	})
+
+	Convey("Given I have no workload api", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		Convey("When I fetch the x509 svid", func() {
+
+			_, err := SPIFFEWorkloadX509SVID(context.Background(), filepath.Join(dir, "agent.sock"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to fetch x509 svid: ")
+			})
+		})
+	})
+}
+
+func TestSPIFFEWorkloadJWTSVID(t *testing.T) {
+
+	Convey("Given I have a workload api", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		var path string
+		var audiences []string
+		socket, stop := startTestWorkloadAPI(dir, func(w http.ResponseWriter, r *http.Request) {
+
+			path = r.URL.Path
+			_ = protoFields(readGRPCMessage(r), func(field int, value []byte) error {
+				if field == 1 {
+					audiences = append(audiences, string(value))
+				}
+				return nil
+			})
+
+			var svid []byte
+			svid = protoAppendString(svid, 1, "spiffe://example.org/workload")
+			svid = protoAppendString(svid, 2, "the-svid")
+
+			writeGRPCMessage(w, protoAppendString(nil, 1, string(svid)))
+		})
+		defer stop()
+
+		Convey("When I fetch a jwt svid", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			svid, err := SPIFFEWorkloadJWTSVID(ctx, socket, "midgard", "other")
+
+			Convey("Then I should get the svid", func() {
+				So(err, ShouldBeNil)
+				So(svid, ShouldEqual, "the-svid")
+				So(path, ShouldEqual, "/SpiffeWorkloadAPI/FetchJWTSVID")
+				So(audiences, ShouldResemble, []string{"midgard", "other"})
+			})
+		})
+
+		Convey("When I fetch a jwt svid without audience", func() {
+
+			_, err := SPIFFEWorkloadJWTSVID(context.Background(), socket)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to fetch jwt svid: at least one audience is required")
+			})
+		})
+	})
+
+	Convey("Given I have a workload api that returns nothing", t, func() {
+
+		dir, err := ioutil.TempDir("", "spiffe")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		socket, stop := startTestWorkloadAPI(dir, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(ioutil.Discard, r.Body)
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "audience must be specified")
+		})
+		defer stop()
+
+		Convey("When I fetch a jwt svid", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := SPIFFEWorkloadJWTSVID(ctx, socket, "midgard")
+
+			Convey("Then it should fail with the status from the trailers", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to fetch jwt svid: workload api error 3: audience must be specified")
+			})
+		})
+	})
+}
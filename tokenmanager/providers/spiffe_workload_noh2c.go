@@ -0,0 +1,26 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !go1.24
+// +build !go1.24
+
+package providers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// workloadHTTPClient fails, as HTTP/2 without TLS is
+// only available in net/http starting with go1.24.
+func workloadHTTPClient(string) (*http.Client, error) {
+	return nil, fmt.Errorf("the workload api client requires go1.24 or later")
+}
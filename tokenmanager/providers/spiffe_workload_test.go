@@ -0,0 +1,95 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWorkloadAPISocketPath(t *testing.T) {
+
+	Convey("Given I have various workload api addresses", t, func() {
+
+		Convey("Then a path should be used as is", func() {
+			path, err := workloadAPISocketPath("/tmp/agent.sock")
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/tmp/agent.sock")
+		})
+
+		Convey("Then a unix url should be accepted", func() {
+			path, err := workloadAPISocketPath("unix:///tmp/agent.sock")
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/tmp/agent.sock")
+		})
+
+		Convey("Then a tcp url should be rejected", func() {
+			_, err := workloadAPISocketPath("tcp://127.0.0.1:8081")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unsupported workload api address 'tcp://127.0.0.1:8081'")
+		})
+
+		Convey("Then the environment should be used when empty", func() {
+			So(os.Setenv(spiffeEndpointSocketEnv, "unix:///run/spire/agent.sock"), ShouldBeNil)
+			defer os.Unsetenv(spiffeEndpointSocketEnv) // nolint: errcheck
+
+			path, err := workloadAPISocketPath("")
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/run/spire/agent.sock")
+		})
+
+		Convey("Then it should fail when empty and not in the environment", func() {
+			So(os.Unsetenv(spiffeEndpointSocketEnv), ShouldBeNil)
+
+			_, err := workloadAPISocketPath("")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "no socket given and SPIFFE_ENDPOINT_SOCKET is not set")
+		})
+	})
+}
+
+func TestProtoFields(t *testing.T) {
+
+	Convey("Given I have an encoded message", t, func() {
+
+		msg := protoAppendString(nil, 1, "a")
+		msg = protoAppendVarint(msg, 2<<3) // varint field 2
+		msg = protoAppendVarint(msg, 300)
+		msg = protoAppendString(msg, 3, "bc")
+
+		Convey("When I read its fields", func() {
+
+			fields := map[int]string{}
+			err := protoFields(msg, func(field int, value []byte) error {
+				fields[field] = string(value)
+				return nil
+			})
+
+			Convey("Then I should get the length delimited ones", func() {
+				So(err, ShouldBeNil)
+				So(fields, ShouldResemble, map[int]string{1: "a", 3: "bc"})
+			})
+		})
+
+		Convey("When I read a truncated message", func() {
+
+			err := protoFields(msg[:len(msg)-1], func(int, []byte) error { return nil })
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "truncated field 3")
+			})
+		})
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// A TokenManager keeps a valid token at hand. It issues a token
+// when started, then renews it in the background using the given
+// PeriodicTokenManager, which can wrap any issuance method.
+type TokenManager struct {
+	periodic    *PeriodicTokenManager
+	token       string
+	subscribers []chan string
+	started     bool
+	ready       chan struct{}
+
+	sync.RWMutex
+}
+
+// NewTokenManager returns a new TokenManager renewing
+// tokens with the given PeriodicTokenManager.
+func NewTokenManager(periodic *PeriodicTokenManager) *TokenManager {
+
+	if periodic == nil {
+		panic("periodic cannot be nil")
+	}
+
+	return &TokenManager{
+		periodic: periodic,
+		ready:    make(chan struct{}),
+	}
+}
+
+// Start issues the first token, then renews it in the background
+// until the given context is done. It returns an error if the first
+// token cannot be issued.
+func (m *TokenManager) Start(ctx context.Context) error {
+
+	m.Lock()
+	if m.started {
+		m.Unlock()
+		return fmt.Errorf("token manager already started")
+	}
+	m.started = true
+	m.Unlock()
+
+	token, err := m.periodic.Issue(ctx)
+	if err != nil {
+		m.Lock()
+		m.started = false
+		m.Unlock()
+		return fmt.Errorf("unable to issue initial token: %s", err)
+	}
+
+	m.publish(token)
+
+	tokenCh := make(chan string)
+	done := make(chan struct{})
+
+	go func() {
+		m.periodic.Run(ctx, tokenCh)
+		close(done)
+	}()
+
+	go func() {
+		for {
+			select {
+			case token := <-tokenCh:
+				m.publish(token)
+			case <-done:
+				m.closeSubscribers()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Token returns the current token.
+func (m *TokenManager) Token() string {
+
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.token
+}
+
+// waitToken returns the current token, waiting
+// for the first one to be issued if needed.
+func (m *TokenManager) waitToken(ctx context.Context) (string, error) {
+
+	select {
+	case <-m.ready:
+		return m.Token(), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Subscribe returns a channel receiving the new tokens. Slow
+// subscribers only receive the latest token. The channel is
+// closed when the context given to Start is done.
+func (m *TokenManager) Subscribe() <-chan string {
+
+	ch := make(chan string, 1)
+
+	m.Lock()
+	m.subscribers = append(m.subscribers, ch)
+	m.Unlock()
+
+	return ch
+}
+
+func (m *TokenManager) publish(token string) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	select {
+	case <-m.ready:
+	default:
+		close(m.ready)
+	}
+
+	m.token = token
+
+	for _, ch := range m.subscribers {
+
+		// Drop the previous token if it has not been received.
+		select {
+		case <-ch:
+		default:
+		}
+
+		ch <- token
+	}
+}
+
+func (m *TokenManager) closeSubscribers() {
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, ch := range m.subscribers {
+		close(ch)
+	}
+
+	m.subscribers = nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenManager(t *testing.T) {
+
+	Convey("Given I create a token manager without periodic manager", t, func() {
+
+		Convey("Then it should panic", func() {
+			So(func() { NewTokenManager(nil) }, ShouldPanicWith, "periodic cannot be nil")
+		})
+	})
+
+	Convey("Given I have a token manager renewing tokens", t, func() {
+
+		var called int32
+		tm := NewTokenManager(NewPeriodicTokenManager(2*time.Millisecond, func(ctx context.Context, v time.Duration) (string, error) {
+			return fmt.Sprintf("token-%d", atomic.AddInt32(&called, 1)), nil
+		}))
+
+		sub := tm.Subscribe()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		Convey("When I start it", func() {
+
+			err := tm.Start(ctx)
+
+			Convey("Then the first token should be available", func() {
+				So(err, ShouldBeNil)
+				So(tm.Token(), ShouldStartWith, "token-")
+			})
+
+			Convey("Then subscribers should receive renewed tokens", func() {
+				var last string
+				for i := 0; i < 3; i++ {
+					select {
+					case last = <-sub:
+					case <-time.After(time.Second):
+						So("no token received", ShouldBeEmpty)
+					}
+				}
+				So(last, ShouldNotEqual, "token-1")
+			})
+
+			Convey("Then starting it again should fail", func() {
+				So(tm.Start(ctx), ShouldNotBeNil)
+			})
+
+			Convey("Then subscribers should be closed when the context is done", func() {
+				cancel()
+				for {
+					select {
+					case _, ok := <-sub:
+						if !ok {
+							return
+						}
+					case <-time.After(time.Second):
+						So("subscriber not closed", ShouldBeEmpty)
+						return
+					}
+				}
+			})
+		})
+	})
+
+	Convey("Given I have a token manager that cannot issue tokens", t, func() {
+
+		tm := NewTokenManager(NewPeriodicTokenManager(time.Hour, func(ctx context.Context, v time.Duration) (string, error) {
+			return "", fmt.Errorf("boom")
+		}))
+
+		Convey("When I start it", func() {
+
+			err := tm.Start(context.Background())
+
+			Convey("Then err should be correct", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to issue initial token: boom")
+				So(tm.Token(), ShouldBeEmpty)
+			})
+		})
+	})
+}
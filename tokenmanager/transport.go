@@ -0,0 +1,212 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.aporeto.io/midgard-lib/logger"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+// statusAuthenticationTimeout is the non standard status code
+// returned by some services when a token has expired or was revoked.
+const statusAuthenticationTimeout = 419
+
+// A Transport is an http.RoundTripper adding a token issued by
+// a TokenIssuerFunc to the requests it sends. Before each request,
+// the remaining validity of the token is checked and the token is
+// renewed synchronously if it is below the renewal threshold, so
+// requests are not sent with a token about to expire.
+//
+// If a request is rejected with a 401 or a 419, for instance because
+// the token was revoked, a new token is issued from the TokenIssuerFunc
+// and the request is sent again once, if its body can be replayed.
+// ChainIssuerFuncs can be used to fall back to other identity sources.
+type Transport struct {
+	base        http.RoundTripper
+	validity    time.Duration
+	renewBefore time.Duration
+	issuerFunc  TokenIssuerFunc
+	logger      logger.Logger
+	skewFunc    func() time.Duration
+
+	token     string
+	expiresAt time.Time
+
+	sync.Mutex
+}
+
+// NewTransport returns a new Transport sending requests with the given
+// base http.RoundTripper, or http.DefaultTransport if nil. Tokens are issued
+// with the given validity, and renewed when their remaining validity is
+// below renewBefore.
+func NewTransport(base http.RoundTripper, validity time.Duration, renewBefore time.Duration, issuerFunc TokenIssuerFunc) *Transport {
+
+	if issuerFunc == nil {
+		panic("issuerFunc cannot be nil")
+	}
+
+	if renewBefore >= validity {
+		panic("renewBefore must be less than validity")
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		base:        base,
+		validity:    validity,
+		renewBefore: renewBefore,
+		issuerFunc:  issuerFunc,
+		logger:      zaplogger.New(nil),
+	}
+}
+
+// SetLogger sets the Logger used to report renewal errors.
+// The default writes to the global zap logger. It must be
+// called before the Transport is used.
+func (t *Transport) SetLogger(l logger.Logger) {
+
+	if l == nil {
+		panic("logger cannot be nil")
+	}
+
+	t.logger = l
+}
+
+// SetClockSkewFunc sets the function returning the difference between
+// the clock of midgard and the local one, like midgardclient.Client.ClockSkew.
+// It is used to convert the expiration time of the tokens into local time,
+// so they are not renewed too early or too late when the local clock is
+// skewed. It must be called before the Transport is used.
+func (t *Transport) SetClockSkewFunc(f func() time.Duration) {
+
+	if f == nil {
+		panic("skewFunc cannot be nil")
+	}
+
+	t.skewFunc = f
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	token, err := t.currentToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isRejected(resp.StatusCode) {
+		return resp, nil
+	}
+
+	t.invalidate(token)
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	token, err = t.currentToken(req)
+	if err != nil {
+		t.logger.Warn("Unable to issue a new token after rejection", logger.Err(err))
+		return resp, nil
+	}
+
+	r = req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	if req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	resp.Body.Close() // nolint: errcheck
+
+	resp, err = t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if isRejected(resp.StatusCode) {
+		t.invalidate(token)
+	}
+
+	return resp, nil
+}
+
+// isRejected returns true if the given status code
+// means the token has been rejected.
+func isRejected(code int) bool {
+
+	return code == http.StatusUnauthorized || code == statusAuthenticationTimeout
+}
+
+// currentToken returns the token to use, renewing it if needed.
+func (t *Transport) currentToken(req *http.Request) (string, error) {
+
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	if t.token != "" && t.expiresAt.Sub(now) > t.renewBefore {
+		return t.token, nil
+	}
+
+	token, err := t.issuerFunc(req.Context(), t.validity)
+	if err != nil {
+
+		// We can still use the current token if it's not expired.
+		if t.token != "" && now.Before(t.expiresAt) {
+			t.logger.Warn("Unable to renew token before expiration", logger.Err(err))
+			return t.token, nil
+		}
+
+		return "", fmt.Errorf("unable to issue token: %s", err)
+	}
+
+	t.token = token
+	t.expiresAt = now.Add(t.validity)
+	if c, err := verify.UnsecureClaims(token); err == nil && c.ExpiresAt != 0 {
+		t.expiresAt = time.Unix(c.ExpiresAt, 0)
+		if t.skewFunc != nil {
+			t.expiresAt = t.expiresAt.Add(-t.skewFunc())
+		}
+	}
+
+	return t.token, nil
+}
+
+// invalidate discards the given token if it is still the current one.
+func (t *Transport) invalidate(token string) {
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.token == token {
+		t.token = ""
+	}
+}
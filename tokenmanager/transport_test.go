@@ -0,0 +1,226 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransport(t *testing.T) {
+
+	Convey("Given I create a transport with invalid values", t, func() {
+
+		Convey("Then it should panic", func() {
+			So(func() { NewTransport(nil, time.Hour, time.Minute, nil) }, ShouldPanicWith, "issuerFunc cannot be nil")
+			So(func() {
+				NewTransport(nil, time.Minute, time.Hour, func(context.Context, time.Duration) (string, error) { return "", nil })
+			}, ShouldPanicWith, "renewBefore must be less than validity")
+		})
+	})
+
+	Convey("Given I have a transport and a server", t, func() {
+
+		var status int32 = http.StatusOK
+		var lastAuth atomic.Value
+		var revoked atomic.Value
+		var received int32
+		revoked.Store("")
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&received, 1)
+			lastAuth.Store(r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") == revoked.Load() {
+				w.WriteHeader(419)
+				return
+			}
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+		}))
+		defer ts.Close()
+
+		var issued int32
+		var failing int32
+		tr := NewTransport(nil, time.Hour, time.Minute, func(ctx context.Context, v time.Duration) (string, error) {
+			if atomic.LoadInt32(&failing) == 1 {
+				return "", fmt.Errorf("boom")
+			}
+			return fmt.Sprintf("token-%d", atomic.AddInt32(&issued, 1)), nil
+		})
+
+		cl := &http.Client{Transport: tr}
+
+		send := func() error {
+			resp, err := cl.Get(ts.URL)
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		}
+
+		Convey("When I send two requests", func() {
+
+			So(send(), ShouldBeNil)
+			So(send(), ShouldBeNil)
+
+			Convey("Then the token should have been issued once", func() {
+				So(atomic.LoadInt32(&issued), ShouldEqual, 1)
+				So(lastAuth.Load(), ShouldEqual, "Bearer token-1")
+			})
+		})
+
+		Convey("When the token is close to expiration", func() {
+
+			So(send(), ShouldBeNil)
+			tr.expiresAt = time.Now().Add(30 * time.Second)
+			So(send(), ShouldBeNil)
+
+			Convey("Then the token should have been renewed before the request", func() {
+				So(atomic.LoadInt32(&issued), ShouldEqual, 2)
+				So(lastAuth.Load(), ShouldEqual, "Bearer token-2")
+			})
+		})
+
+		Convey("When the renewal fails while the token is still valid", func() {
+
+			So(send(), ShouldBeNil)
+			tr.expiresAt = time.Now().Add(30 * time.Second)
+			atomic.StoreInt32(&failing, 1)
+
+			Convey("Then the current token should be used", func() {
+				So(send(), ShouldBeNil)
+				So(lastAuth.Load(), ShouldEqual, "Bearer token-1")
+			})
+		})
+
+		Convey("When the renewal fails and the token is expired", func() {
+
+			So(send(), ShouldBeNil)
+			tr.expiresAt = time.Now().Add(-time.Second)
+			atomic.StoreInt32(&failing, 1)
+
+			Convey("Then the request should fail", func() {
+				err := send()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unable to issue token: boom")
+			})
+		})
+
+		Convey("When the server revokes the current token", func() {
+
+			So(send(), ShouldBeNil)
+			revoked.Store("Bearer token-1")
+
+			resp, err := cl.Post(ts.URL, "text/plain", strings.NewReader("hello"))
+
+			Convey("Then the request should have been sent again with a new token", func() {
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+				So(resp.Body.Close(), ShouldBeNil)
+				So(atomic.LoadInt32(&issued), ShouldEqual, 2)
+				So(atomic.LoadInt32(&received), ShouldEqual, 3)
+				So(lastAuth.Load(), ShouldEqual, "Bearer token-2")
+			})
+		})
+
+		Convey("When the server keeps returning 401", func() {
+
+			atomic.StoreInt32(&status, http.StatusUnauthorized)
+			resp, err := cl.Get(ts.URL)
+
+			Convey("Then the request should have been sent again only once", func() {
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+				So(resp.Body.Close(), ShouldBeNil)
+				So(atomic.LoadInt32(&received), ShouldEqual, 2)
+				So(atomic.LoadInt32(&issued), ShouldEqual, 2)
+			})
+
+			Convey("Then the next request should use a new token", func() {
+				atomic.StoreInt32(&status, http.StatusOK)
+				So(send(), ShouldBeNil)
+				So(atomic.LoadInt32(&issued), ShouldEqual, 3)
+				So(lastAuth.Load(), ShouldEqual, "Bearer token-3")
+			})
+		})
+
+		Convey("When the token is rejected and no new token can be issued", func() {
+
+			So(send(), ShouldBeNil)
+			revoked.Store("Bearer token-1")
+			atomic.StoreInt32(&failing, 1)
+
+			resp, err := cl.Get(ts.URL)
+
+			Convey("Then the rejection should be returned", func() {
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, 419)
+				So(resp.Body.Close(), ShouldBeNil)
+				So(atomic.LoadInt32(&received), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestTransport_SetClockSkewFunc(t *testing.T) {
+
+	Convey("Calling SetClockSkewFunc with a nil func should panic", t, func() {
+		tr := NewTransport(nil, time.Hour, time.Minute, func(context.Context, time.Duration) (string, error) { return "", nil })
+		So(func() { tr.SetClockSkewFunc(nil) }, ShouldPanicWith, "skewFunc cannot be nil")
+	})
+
+	Convey("Given I have a transport and midgard with a clock 30 minutes ahead", t, func() {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer ts.Close()
+
+		serverNow := time.Now().Add(30 * time.Minute)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{ExpiresAt: serverNow.Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+		So(err, ShouldBeNil)
+
+		tr := NewTransport(nil, time.Hour, time.Minute, func(ctx context.Context, v time.Duration) (string, error) {
+			return token, nil
+		})
+
+		send := func() {
+			resp, err := (&http.Client{Transport: tr}).Get(ts.URL)
+			So(err, ShouldBeNil)
+			So(resp.Body.Close(), ShouldBeNil)
+		}
+
+		Convey("When I send a request with the clock skew set", func() {
+
+			tr.SetClockSkewFunc(func() time.Duration { return 30 * time.Minute })
+			send()
+
+			Convey("Then the expiration should be converted to local time", func() {
+				So(tr.expiresAt, ShouldHappenWithin, 2*time.Second, time.Now().Add(time.Hour))
+			})
+		})
+
+		Convey("When I send a request without the clock skew set", func() {
+
+			send()
+
+			Convey("Then the expiration should be the server one", func() {
+				So(tr.expiresAt, ShouldHappenWithin, 2*time.Second, serverNow.Add(time.Hour))
+			})
+		})
+	})
+}
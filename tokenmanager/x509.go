@@ -17,15 +17,18 @@ import (
 	"time"
 
 	midgardclient "go.aporeto.io/midgard-lib/client"
+	"go.aporeto.io/midgard-lib/logger/zaplogger"
 )
 
 // NewX509TokenManager returns a new X509TokenManager.
 func NewX509TokenManager(url string, validity time.Duration, tlsConfig *tls.Config) *PeriodicTokenManager {
 
-	cl := midgardclient.NewClientWithTLS(url, tlsConfig)
+	cl := midgardclient.NewClientWithTLS(url, tlsConfig) // nolint: staticcheck
 
 	return &PeriodicTokenManager{
 		validity: validity,
+		policy:   RenewalPolicy{Validity: validity},
+		logger:   zaplogger.New(nil),
 		issuerFunc: func(ctx context.Context, v time.Duration) (string, error) {
 			return cl.IssueFromCertificate(ctx, v)
 		},
@@ -0,0 +1,251 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokens
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/gaia/types"
+	"go.aporeto.io/midgard-lib/verify"
+)
+
+const redacted = "<redacted>"
+
+// FormatOptions holds the options of Format.
+type FormatOptions struct {
+
+	// Now is the time used to compute the expiration countdown
+	// and the warnings. The default is the current time.
+	Now time.Time
+
+	// Redact hides the subject, the identity and the opaque values,
+	// so the output can be attached to a support ticket.
+	Redact bool
+}
+
+// Format returns a human readable description of the given token,
+// with its header, claims, restrictions and the warnings about its
+// security. The signature of the token is not verified.
+func Format(token string, opts FormatOptions) (string, error) {
+
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	c := &types.MidgardClaims{}
+	t, parts, err := (&jwt.Parser{}).ParseUnverified(token, c)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse token: %s", err)
+	}
+
+	raw, err := rawClaims(parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+
+	section(buf, "Header", func(w *tabwriter.Writer) {
+		row(w, "Algorithm", t.Method.Alg())
+		row(w, "Type", headerString(t.Header, "typ"))
+		row(w, "Key ID", headerString(t.Header, "kid"))
+	})
+
+	section(buf, "Claims", func(w *tabwriter.Writer) {
+		row(w, "Realm", c.Realm)
+		row(w, "Subject", redact(c.Subject, opts.Redact))
+		row(w, "Issuer", c.Issuer)
+		row(w, "Audience", c.Audience)
+		row(w, "ID", c.Id)
+		row(w, "Issued At", formatTime(c.IssuedAt, opts.Now))
+		row(w, "Not Before", formatTime(c.NotBefore, opts.Now))
+		row(w, "Expires At", formatTime(c.ExpiresAt, opts.Now))
+		if c.Quota > 0 {
+			row(w, "Quota", fmt.Sprintf("%d", c.Quota))
+		}
+	})
+
+	section(buf, "Identity", func(w *tabwriter.Writer) {
+		for _, claim := range verify.Normalize(c) {
+			if opts.Redact {
+				claim = claim[:strings.Index(claim, "=")+1] + redacted
+			}
+			fmt.Fprintf(w, "  %s\n", claim)
+		}
+	})
+
+	section(buf, "Opaque", func(w *tabwriter.Writer) {
+		for _, k := range sortedKeys(c.Opaque) {
+			row(w, k, redact(c.Opaque[k], opts.Redact))
+		}
+	})
+
+	section(buf, "Restrictions", func(w *tabwriter.Writer) {
+		restrictions, _ := raw["restrictions"].(map[string]interface{})
+		keys := make([]string, 0, len(restrictions))
+		for k := range restrictions {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			row(w, k, formatValue(restrictions[k]))
+		}
+		if len(keys) == 0 {
+			fmt.Fprintln(w, "  none")
+		}
+	})
+
+	section(buf, "Warnings", func(w *tabwriter.Writer) {
+		for _, warning := range warnings(t, c, opts.Now) {
+			fmt.Fprintf(w, "  - %s\n", warning)
+		}
+	})
+
+	return buf.String(), nil
+}
+
+// warnings returns the security warnings about the given token.
+func warnings(t *jwt.Token, c *types.MidgardClaims, now time.Time) []string {
+
+	var out []string
+
+	switch alg := t.Method.Alg(); {
+	case alg == "none":
+		out = append(out, "token is not signed")
+	case !strings.HasPrefix(alg, "ES"):
+		out = append(out, fmt.Sprintf("token is signed with %s: midgard signs tokens with ECDSA", alg))
+	}
+
+	if c.ExpiresAt == 0 {
+		out = append(out, "token never expires")
+	} else if now.After(time.Unix(c.ExpiresAt, 0)) {
+		out = append(out, "token is expired")
+	}
+
+	if c.NotBefore != 0 && now.Before(time.Unix(c.NotBefore, 0)) {
+		out = append(out, "token is not valid yet")
+	}
+
+	if c.IssuedAt != 0 && now.Before(time.Unix(c.IssuedAt, 0)) {
+		out = append(out, "token is issued in the future: check the clocks")
+	}
+
+	return out
+}
+
+// section writes a titled section, skipping it if it is empty.
+func section(buf *bytes.Buffer, title string, f func(*tabwriter.Writer)) {
+
+	content := &bytes.Buffer{}
+	w := tabwriter.NewWriter(content, 0, 0, 2, ' ', 0)
+	f(w)
+	w.Flush() // nolint: errcheck
+
+	if content.Len() == 0 {
+		return
+	}
+
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+
+	buf.WriteString(title + ":\n")
+	buf.Write(content.Bytes())
+}
+
+// row writes a key value row, skipping empty values.
+func row(w *tabwriter.Writer, key string, value string) {
+
+	if value == "" {
+		return
+	}
+
+	fmt.Fprintf(w, "  %s\t%s\n", key, value)
+}
+
+func rawClaims(segment string) (map[string]interface{}, error) {
+
+	data, err := jwt.DecodeSegment(segment)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode token claims: %s", err)
+	}
+
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unable to decode token claims: %s", err)
+	}
+
+	return raw, nil
+}
+
+func headerString(header map[string]interface{}, key string) string {
+
+	s, _ := header[key].(string)
+	return s
+}
+
+func formatTime(ts int64, now time.Time) string {
+
+	if ts == 0 {
+		return ""
+	}
+
+	t := time.Unix(ts, 0).UTC()
+	d := t.Sub(now).Round(time.Second)
+
+	if d >= 0 {
+		return fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), d)
+	}
+
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), -d)
+}
+
+func formatValue(v interface{}) string {
+
+	switch v := v.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprintf("%v", item)
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func redact(s string, enabled bool) string {
+
+	if enabled && s != "" {
+		return redacted
+	}
+
+	return s
+}
+
+func sortedKeys(m map[string]string) []string {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokens
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func makeToken(claims jwt.Claims, method jwt.SigningMethod, key interface{}) string {
+
+	t, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestFormat(t *testing.T) {
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Given I have a token with restrictions", t, func() {
+
+		token := makeToken(jwt.MapClaims{
+			"realm":  "Vince",
+			"sub":    "user@acme.com",
+			"iss":    "https://midgard",
+			"iat":    now.Add(-time.Hour).Unix(),
+			"exp":    now.Add(90 * time.Minute).Unix(),
+			"quota":  3,
+			"data":   map[string]string{"account": "acme", "organization": "Acme"},
+			"opaque": map[string]string{"app": "ui"},
+			"restrictions": map[string]interface{}{
+				"namespace": "/acme/prod",
+				"networks":  []string{"10.0.0.0/8", "192.168.0.0/16"},
+			},
+		}, jwt.SigningMethodES256, ecKey)
+
+		Convey("When I format it", func() {
+
+			out, err := Format(token, FormatOptions{Now: now})
+
+			Convey("Then the output should be correct", func() {
+				So(err, ShouldBeNil)
+				So(out, ShouldEqual, `Header:
+  Algorithm  ES256
+  Type       JWT
+
+Claims:
+  Realm       Vince
+  Subject     user@acme.com
+  Issuer      https://midgard
+  Issued At   2019-12-31T23:00:00Z (1h0m0s ago)
+  Expires At  2020-01-01T01:30:00Z (in 1h30m0s)
+  Quota       3
+
+Identity:
+  @auth:account=acme
+  @auth:organization=Acme
+  @auth:subject=user@acme.com
+
+Opaque:
+  app  ui
+
+Restrictions:
+  namespace  /acme/prod
+  networks   10.0.0.0/8, 192.168.0.0/16
+`)
+			})
+		})
+
+		Convey("When I format it with redaction", func() {
+
+			out, err := Format(token, FormatOptions{Now: now, Redact: true})
+
+			Convey("Then the sensitive values should be hidden", func() {
+				So(err, ShouldBeNil)
+				So(out, ShouldNotContainSubstring, "user@acme.com")
+				So(out, ShouldNotContainSubstring, "=acme")
+				So(out, ShouldContainSubstring, "@auth:account=<redacted>")
+				So(out, ShouldContainSubstring, "app  <redacted>")
+				So(out, ShouldContainSubstring, "namespace  /acme/prod")
+			})
+		})
+	})
+
+	Convey("Given I have an expired token signed with HMAC", t, func() {
+
+		token := makeToken(jwt.MapClaims{
+			"realm": "Vince",
+			"exp":   now.Add(-time.Minute).Unix(),
+			"iat":   now.Add(time.Hour).Unix(),
+		}, jwt.SigningMethodHS256, []byte("secret"))
+
+		Convey("When I format it", func() {
+
+			out, err := Format(token, FormatOptions{Now: now})
+
+			Convey("Then the warnings should be reported", func() {
+				So(err, ShouldBeNil)
+				So(out, ShouldContainSubstring, "Restrictions:\n  none\n")
+				So(out, ShouldEndWith, `Warnings:
+  - token is signed with HS256: midgard signs tokens with ECDSA
+  - token is expired
+  - token is issued in the future: check the clocks
+`)
+			})
+		})
+	})
+
+	Convey("Given I have an unsigned token without expiration", t, func() {
+
+		token := makeToken(jwt.MapClaims{"realm": "Vince"}, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType)
+
+		Convey("When I format it", func() {
+
+			out, err := Format(token, FormatOptions{Now: now})
+
+			Convey("Then the warnings should be reported", func() {
+				So(err, ShouldBeNil)
+				So(out, ShouldContainSubstring, "  - token is not signed\n")
+				So(out, ShouldContainSubstring, "  - token never expires\n")
+			})
+		})
+	})
+
+	Convey("Given I have an invalid token", t, func() {
+
+		Convey("When I format it", func() {
+
+			_, err := Format("not a token", FormatOptions{})
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to parse token: ")
+			})
+		})
+	})
+}
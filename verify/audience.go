@@ -0,0 +1,105 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"go.aporeto.io/gaia/types"
+)
+
+// AudienceMode defines how the audience of a token is checked.
+type AudienceMode int
+
+const (
+	// AudienceEnforce rejects tokens whose audience
+	// does not match the expected audience.
+	AudienceEnforce AudienceMode = iota
+
+	// AudienceInspect accepts tokens whose audience does not
+	// match the expected audience, and records the mismatch
+	// in the result. It must only be used by intermediaries
+	// inspecting tokens forwarded to other services, like
+	// tracing sidecars, and never to authorize requests.
+	AudienceInspect
+)
+
+// A Result contains the result of a verification.
+type Result struct {
+
+	// Claims are the claims of the token.
+	Claims *types.MidgardClaims
+
+	// AudienceMismatch is true if the token audience did not
+	// match the expected audience in AudienceInspect mode.
+	AudienceMismatch bool
+}
+
+// VerifyAudience verifies the given token like Verify and checks that
+// its audience matches the given audience according to the given mode.
+// The token audience can be a comma separated list of audiences. Tokens
+// without audience match any audience.
+func (v *Verifier) VerifyAudience(tokenString string, cert *x509.Certificate, audience string, mode AudienceMode) (Result, error) {
+
+	c, err := v.Verify(tokenString, cert)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if audienceMatches(c.Audience, audience) {
+		return Result{Claims: c}, nil
+	}
+
+	if mode == AudienceInspect {
+		return Result{Claims: c, AudienceMismatch: true}, nil
+	}
+
+	return Result{}, fmt.Errorf("token audience '%s' does not match '%s'", c.Audience, audience)
+}
+
+// Audiences returns the audiences of the given token audience claim,
+// which can be a comma separated list of audiences. It returns nil if
+// the token has no audience.
+func Audiences(tokenAudience string) []string {
+
+	if tokenAudience == "" {
+		return nil
+	}
+
+	parts := strings.Split(tokenAudience, ",")
+	audiences := make([]string, 0, len(parts))
+
+	for _, aud := range parts {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audiences = append(audiences, aud)
+		}
+	}
+
+	return audiences
+}
+
+func audienceMatches(tokenAudience string, audience string) bool {
+
+	if tokenAudience == "" {
+		return true
+	}
+
+	for _, aud := range Audiences(tokenAudience) {
+		if aud == audience {
+			return true
+		}
+	}
+
+	return false
+}
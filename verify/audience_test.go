@@ -0,0 +1,113 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestVerifier_VerifyAudience(t *testing.T) {
+
+	makeAudienceToken := func(aud string) string {
+		return makeToken(
+			&types.MidgardClaims{
+				StandardClaims: jwt.StandardClaims{
+					Subject:   "sub",
+					Audience:  aud,
+					ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+			jwt.SigningMethodES256,
+			key(signerKey),
+		)
+	}
+
+	Convey("Given I have a verifier", t, func() {
+
+		v := NewVerifier()
+		c := cert(signerCert)
+
+		Convey("When I verify a token for the expected audience", func() {
+
+			r, err := v.VerifyAudience(makeAudienceToken("api, ui"), c, "ui", AudienceEnforce)
+
+			Convey("Then it should be accepted", func() {
+				So(err, ShouldBeNil)
+				So(r.Claims.Subject, ShouldEqual, "sub")
+				So(r.AudienceMismatch, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I verify a token without audience", func() {
+
+			r, err := v.VerifyAudience(makeAudienceToken(""), c, "ui", AudienceEnforce)
+
+			Convey("Then it should be accepted", func() {
+				So(err, ShouldBeNil)
+				So(r.AudienceMismatch, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I verify a token for another audience in enforce mode", func() {
+
+			_, err := v.VerifyAudience(makeAudienceToken("downstream"), c, "sidecar", AudienceEnforce)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "token audience 'downstream' does not match 'sidecar'")
+			})
+		})
+
+		Convey("When I verify a token for another audience in inspect mode", func() {
+
+			r, err := v.VerifyAudience(makeAudienceToken("downstream"), c, "sidecar", AudienceInspect)
+
+			Convey("Then the mismatch should be recorded", func() {
+				So(err, ShouldBeNil)
+				So(r.Claims.Audience, ShouldEqual, "downstream")
+				So(r.AudienceMismatch, ShouldBeTrue)
+			})
+		})
+
+		Convey("When I verify an invalid token in inspect mode", func() {
+
+			_, err := v.VerifyAudience(makeAudienceToken("downstream")+"x", c, "sidecar", AudienceInspect)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestAudiences(t *testing.T) {
+
+	Convey("Given I parse audience claims", t, func() {
+
+		Convey("Then an empty claim should have no audience", func() {
+			So(Audiences(""), ShouldBeNil)
+		})
+
+		Convey("Then a single audience should be returned", func() {
+			So(Audiences("api"), ShouldResemble, []string{"api"})
+		})
+
+		Convey("Then a list of audiences should be split and trimmed", func() {
+			So(Audiences("api, ui,,gateway "), ShouldResemble, []string{"api", "ui", "gateway"})
+		})
+	})
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/gaia/types"
+)
+
+// The names of the files of a bundle loaded by LoadBundle.
+const (
+	BundleManifestFile     = "manifest.json"
+	BundleSignatureFile    = "manifest.sig"
+	BundleCertificatesFile = "certificates.pem"
+)
+
+const bundleManifestVersion = 1
+
+// bundleManifest is the signed manifest of a Bundle.
+type bundleManifest struct {
+	Version      int       `json:"version"`
+	Issued       time.Time `json:"issued"`
+	Expires      time.Time `json:"expires"`
+	Certificates []string  `json:"certificates"`
+}
+
+// A Bundle is a set of trusted token signer certificates distributed
+// out-of-band, for instance to verify tokens in air-gapped environments
+// that cannot reach midgard. It is made of a manifest listing the SHA256
+// fingerprints of the certificates with the validity period of the bundle,
+// signed by a trust anchor, and of the PEM encoded certificates.
+type Bundle struct {
+	Certificates []*x509.Certificate
+	Issued       time.Time
+	Expires      time.Time
+}
+
+// ParseBundle parses the given manifest, detached signature of the manifest
+// and PEM encoded certificates. The manifest must be signed by one of the
+// given anchors, using SHA256 and their key algorithm, and the bundle must
+// not be expired. The certificates must be exactly the ones listed in the
+// manifest, and must have an ECDSA public key, as Verify requires.
+func ParseBundle(manifest []byte, signature []byte, certificates []byte, anchors ...*x509.Certificate) (*Bundle, error) {
+
+	if err := checkBundleSignature(manifest, signature, anchors); err != nil {
+		return nil, err
+	}
+
+	m := bundleManifest{}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %s", err)
+	}
+
+	if m.Version != bundleManifestVersion {
+		return nil, fmt.Errorf("invalid bundle manifest: unsupported version %d", m.Version)
+	}
+
+	if !m.Expires.After(m.Issued) {
+		return nil, fmt.Errorf("invalid bundle manifest: expires before it is issued")
+	}
+
+	b := &Bundle{
+		Issued:  m.Issued,
+		Expires: m.Expires,
+	}
+
+	if err := b.check(jwt.TimeFunc()); err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(m.Certificates))
+	for _, fp := range m.Certificates {
+		listed[fp] = false
+	}
+
+	for {
+		var block *pem.Block
+		if block, certificates = pem.Decode(certificates); block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle certificate: %s", err)
+		}
+
+		sum := sha256.Sum256(cert.Raw)
+		fp := hex.EncodeToString(sum[:])
+
+		seen, ok := listed[fp]
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle: certificate %s is not listed in the manifest", fp)
+		}
+
+		// The verifier only supports ecdsa signers, so another key
+		// type would make VerifyTrusted fail for every token.
+		if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+			return nil, fmt.Errorf("invalid bundle: certificate %s has an unsupported public key type: %T", fp, cert.PublicKey)
+		}
+
+		if !seen {
+			listed[fp] = true
+			b.Certificates = append(b.Certificates, cert)
+		}
+	}
+
+	for fp, seen := range listed {
+		if !seen {
+			return nil, fmt.Errorf("invalid bundle: certificate %s listed in the manifest is missing", fp)
+		}
+	}
+
+	if len(b.Certificates) == 0 {
+		return nil, fmt.Errorf("invalid bundle: no certificate")
+	}
+
+	return b, nil
+}
+
+// LoadBundle loads the Bundle stored in the given directory, in the
+// BundleManifestFile, BundleSignatureFile and BundleCertificatesFile
+// files, and parses it with ParseBundle.
+func LoadBundle(dir string, anchors ...*x509.Certificate) (*Bundle, error) {
+
+	var data [3][]byte
+
+	for i, name := range []string{BundleManifestFile, BundleSignatureFile, BundleCertificatesFile} {
+
+		d, err := ioutil.ReadFile(filepath.Join(dir, name)) // #nosec
+		if err != nil {
+			return nil, fmt.Errorf("unable to load bundle: %s", err)
+		}
+
+		data[i] = d
+	}
+
+	return ParseBundle(data[0], data[1], data[2], anchors...)
+}
+
+// check returns an error if the bundle is not valid at the given time.
+func (b *Bundle) check(now time.Time) error {
+
+	if now.Before(b.Issued) {
+		return fmt.Errorf("bundle is not valid before %s", b.Issued.UTC().Format(time.RFC3339))
+	}
+
+	if !now.Before(b.Expires) {
+		return fmt.Errorf("bundle expired at %s", b.Expires.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// checkBundleSignature returns an error if the given signature of the
+// manifest was not made by one of the given anchors.
+func checkBundleSignature(manifest []byte, signature []byte, anchors []*x509.Certificate) error {
+
+	if len(anchors) == 0 {
+		return fmt.Errorf("unable to verify bundle signature: no trust anchor")
+	}
+
+	for _, anchor := range anchors {
+
+		var algo x509.SignatureAlgorithm
+		switch anchor.PublicKeyAlgorithm {
+		case x509.ECDSA:
+			algo = x509.ECDSAWithSHA256
+		case x509.RSA:
+			algo = x509.SHA256WithRSA
+		case x509.Ed25519:
+			algo = x509.PureEd25519
+		default:
+			continue
+		}
+
+		if anchor.CheckSignature(algo, manifest, signature) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid bundle signature")
+}
+
+// SetBundle sets the Bundle of trusted signers used by VerifyTrusted. It
+// can be called again when a new bundle is received out-of-band, but a
+// bundle issued before the current one is refused, so an older bundle
+// cannot be replayed to trust signers that have since been removed.
+func (v *Verifier) SetBundle(b *Bundle) error {
+
+	if b == nil {
+		panic("bundle cannot be nil")
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	if v.bundle != nil && b.Issued.Before(v.bundle.Issued) {
+		return fmt.Errorf("bundle issued at %s is older than the current one issued at %s",
+			b.Issued.UTC().Format(time.RFC3339),
+			v.bundle.Issued.UTC().Format(time.RFC3339),
+		)
+	}
+
+	v.bundle = b
+
+	return nil
+}
+
+// VerifyTrusted verifies the given token using the certificates of the
+// Bundle set with SetBundle and returns the claims it contains. It fails
+// if the bundle has expired.
+func (v *Verifier) VerifyTrusted(tokenString string) (*types.MidgardClaims, error) {
+
+	v.RLock()
+	b := v.bundle
+	v.RUnlock()
+
+	if b == nil {
+		return nil, fmt.Errorf("no trusted signer bundle")
+	}
+
+	if err := b.check(jwt.TimeFunc()); err != nil {
+		return nil, fmt.Errorf("untrusted signer bundle: %s", err)
+	}
+
+	var err error
+	for _, cert := range b.Certificates {
+
+		var claims *types.MidgardClaims
+		if claims, err = v.Verify(tokenString, cert); err == nil {
+			return claims, nil
+		}
+
+		// Only a signature error means the token may
+		// have been signed by another certificate.
+		if verr, ok := err.(*jwt.ValidationError); !ok || verr.Errors&jwt.ValidationErrorSignatureInvalid == 0 {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,312 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func makeAnchor() (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bundle-signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bundle-signer"},
+	}, &k.PublicKey, k)
+	if err != nil {
+		panic(err)
+	}
+
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	return c, k
+}
+
+func makeBundle(k *ecdsa.PrivateKey, issued time.Time, expires time.Time, listed []*x509.Certificate, included []*x509.Certificate) ([]byte, []byte, []byte) {
+
+	fps := []string{}
+	for _, c := range listed {
+		sum := sha256.Sum256(c.Raw)
+		fps = append(fps, hex.EncodeToString(sum[:]))
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"version":      1,
+		"issued":       issued,
+		"expires":      expires,
+		"certificates": fps,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	digest := sha256.Sum256(manifest)
+	signature, err := k.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		panic(err)
+	}
+
+	certs := []byte{}
+	for _, c := range included {
+		certs = append(certs, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+
+	return manifest, signature, certs
+}
+
+func TestBundle_ParseBundle(t *testing.T) {
+
+	Convey("Given I have a trust anchor and a signer certificate", t, func() {
+
+		anchor, anchorKey := makeAnchor()
+		signer := cert(signerCert)
+		now := time.Now()
+
+		Convey("When I parse a valid bundle", func() {
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+			b, err := ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should work", func() {
+				So(err, ShouldBeNil)
+				So(b.Certificates, ShouldHaveLength, 1)
+				So(b.Certificates[0].Equal(signer), ShouldBeTrue)
+				So(b.Expires.Unix(), ShouldEqual, now.Add(time.Hour).Unix())
+			})
+		})
+
+		Convey("When I load a valid bundle from a directory", func() {
+
+			dir, err := ioutil.TempDir("", "bundle")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir) // nolint: errcheck
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+			So(ioutil.WriteFile(filepath.Join(dir, BundleManifestFile), m, 0600), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, BundleSignatureFile), s, 0600), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, BundleCertificatesFile), c, 0600), ShouldBeNil)
+
+			b, err := LoadBundle(dir, anchor)
+
+			Convey("Then it should work", func() {
+				So(err, ShouldBeNil)
+				So(b.Certificates, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When I load a bundle from a missing directory", func() {
+
+			_, err := LoadBundle(filepath.Join(os.TempDir(), "does-not-exist"), anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "unable to load bundle: ")
+			})
+		})
+
+		Convey("When I parse a bundle signed by another key", func() {
+
+			_, otherKey := makeAnchor()
+			m, s, c := makeBundle(otherKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+			_, err := ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid bundle signature")
+			})
+		})
+
+		Convey("When I parse a bundle with a tampered manifest", func() {
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+			m = append(m, ' ')
+			_, err := ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "invalid bundle signature")
+			})
+		})
+
+		Convey("When I parse a bundle without anchor", func() {
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+			_, err := ParseBundle(m, s, c)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unable to verify bundle signature: no trust anchor")
+			})
+		})
+
+		Convey("When I parse an expired bundle", func() {
+
+			m, s, c := makeBundle(anchorKey, now.Add(-2*time.Hour), now.Add(-time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+			_, err := ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "bundle expired at ")
+			})
+		})
+
+		Convey("When I parse a bundle with a certificate that is not listed", func() {
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer, anchor})
+			_, err := ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEndWith, "is not listed in the manifest")
+			})
+		})
+
+		Convey("When I parse a bundle with a certificate that is not ecdsa", func() {
+
+			rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			So(err, ShouldBeNil)
+
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(2),
+				Subject:      pkix.Name{CommonName: "rsa-signer"},
+				NotBefore:    now.Add(-time.Hour),
+				NotAfter:     now.Add(time.Hour),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &rsaKey.PublicKey, rsaKey)
+			So(err, ShouldBeNil)
+			rsaCert, err := x509.ParseCertificate(der)
+			So(err, ShouldBeNil)
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{rsaCert, signer}, []*x509.Certificate{rsaCert, signer})
+			_, err = ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEndWith, "has an unsupported public key type: *rsa.PublicKey")
+			})
+		})
+
+		Convey("When I parse a bundle with a missing certificate", func() {
+
+			m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{signer, anchor}, []*x509.Certificate{signer})
+			_, err := ParseBundle(m, s, c, anchor)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEndWith, "listed in the manifest is missing")
+			})
+		})
+	})
+}
+
+func TestVerifier_VerifyTrusted(t *testing.T) {
+
+	Convey("Given I have a verifier and a bundle", t, func() {
+
+		anchor, anchorKey := makeAnchor()
+		other, _ := makeAnchor()
+		signer := cert(signerCert)
+		now := time.Now()
+
+		m, s, c := makeBundle(anchorKey, now.Add(-time.Hour), now.Add(time.Hour), []*x509.Certificate{other, signer}, []*x509.Certificate{other, signer})
+		b, err := ParseBundle(m, s, c, anchor)
+		So(err, ShouldBeNil)
+
+		v := NewVerifier()
+
+		Convey("When I verify a token without bundle", func() {
+
+			_, err := v.VerifyTrusted("token")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "no trusted signer bundle")
+			})
+		})
+
+		Convey("When I set the bundle", func() {
+
+			So(v.SetBundle(b), ShouldBeNil)
+
+			Convey("Then a token signed by a trusted signer should be verified", func() {
+				claims, err := v.VerifyTrusted(makeToken(&jwt.StandardClaims{Subject: "sub"}, jwt.SigningMethodES256, key(signerKey)))
+				So(err, ShouldBeNil)
+				So(claims.Subject, ShouldEqual, "sub")
+			})
+
+			Convey("Then a token signed by another signer should be rejected", func() {
+				_, err := v.VerifyTrusted(makeToken(&jwt.StandardClaims{Subject: "sub"}, jwt.SigningMethodES256, key(wrongSignerKey)))
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then an expired token should be rejected", func() {
+				_, err := v.VerifyTrusted(makeToken(&jwt.StandardClaims{Subject: "sub", ExpiresAt: now.Add(-time.Minute).Unix()}, jwt.SigningMethodES256, key(signerKey)))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "token is expired by ")
+			})
+
+			Convey("Then an older bundle should be refused", func() {
+				m, s, c := makeBundle(anchorKey, now.Add(-2*time.Hour), now.Add(time.Hour), []*x509.Certificate{signer}, []*x509.Certificate{signer})
+				older, err := ParseBundle(m, s, c, anchor)
+				So(err, ShouldBeNil)
+
+				err = v.SetBundle(older)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "is older than the current one")
+			})
+
+			Convey("Then the bundle should not be trusted once expired", func() {
+				defer func() { jwt.TimeFunc = time.Now }()
+				jwt.TimeFunc = func() time.Time { return now.Add(2 * time.Hour) }
+
+				_, err := v.VerifyTrusted(makeToken(&jwt.StandardClaims{Subject: "sub"}, jwt.SigningMethodES256, key(signerKey)))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "untrusted signer bundle: bundle expired at ")
+			})
+		})
+
+		Convey("Then setting a nil bundle should panic", func() {
+			So(func() { _ = v.SetBundle(nil) }, ShouldPanicWith, "bundle cannot be nil")
+		})
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"go.aporeto.io/gaia/types"
+)
+
+type cacheEntry struct {
+	key       [sha256.Size]byte
+	claims    *types.MidgardClaims
+	expiresAt time.Time
+}
+
+// resultCache is a bounded LRU cache of successfully verified
+// tokens. Entries are kept until the expiration of their token.
+type resultCache struct {
+	size    int
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+
+	sync.Mutex
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{
+		size:    size,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// cacheKeyFor returns the key of the given token verified
+// with the certificate of the given fingerprint.
+func cacheKeyFor(token string, fp [sha256.Size]byte) [sha256.Size]byte {
+
+	h := sha256.New()
+	_, _ = h.Write(fp[:])
+	_, _ = h.Write([]byte(token))
+
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	return key
+}
+
+// get returns a copy of the cached claims for the given key.
+func (c *resultCache) get(key [sha256.Size]byte, now time.Time) (*types.MidgardClaims, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return copyClaims(entry.claims), true
+}
+
+// set stores a copy of the given claims, evicting the
+// least recently used entry if the cache is full.
+func (c *resultCache) set(key [sha256.Size]byte, claims *types.MidgardClaims) {
+
+	entry := &cacheEntry{
+		key:    key,
+		claims: copyClaims(claims),
+	}
+
+	if claims.ExpiresAt != 0 {
+		entry.expiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// len returns the number of entries in the cache.
+func (c *resultCache) len() int {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.order.Len()
+}
+
+func copyClaims(c *types.MidgardClaims) *types.MidgardClaims {
+
+	out := *c
+
+	if c.Data != nil {
+		out.Data = make(map[string]string, len(c.Data))
+		for k, v := range c.Data {
+			out.Data[k] = v
+		}
+	}
+
+	if c.Opaque != nil {
+		out.Opaque = make(map[string]string, len(c.Opaque))
+		for k, v := range c.Opaque {
+			out.Opaque[k] = v
+		}
+	}
+
+	return &out
+}
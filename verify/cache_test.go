@@ -0,0 +1,153 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestVerifier_SetCacheSize(t *testing.T) {
+
+	Convey("Calling SetCacheSize with a size of 0 should panic", t, func() {
+		So(func() { NewVerifier().SetCacheSize(0) }, ShouldPanicWith, "cache size must be greater than 0")
+	})
+
+	Convey("Given I have a verifier caching 2 tokens", t, func() {
+
+		v := NewVerifier()
+		v.SetCacheSize(2)
+
+		now := time.Now()
+		mkToken := func(sub string, exp time.Time) string {
+			return makeToken(
+				&types.MidgardClaims{
+					Data:           map[string]string{"sub": sub},
+					StandardClaims: jwt.StandardClaims{Subject: sub, ExpiresAt: exp.Unix()},
+				},
+				jwt.SigningMethodES256,
+				key(signerKey),
+			)
+		}
+
+		Convey("When I verify a valid token twice", func() {
+
+			token := mkToken("a", now.Add(time.Hour))
+
+			claims1, err1 := v.Verify(token, cert(signerCert))
+			claims1.Data["sub"] = "modified"
+			claims2, err2 := v.Verify(token, cert(signerCert))
+
+			Convey("Then it should be cached and returned as a copy", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(v.cache.len(), ShouldEqual, 1)
+				So(claims2.Subject, ShouldEqual, "a")
+				So(claims2.Data["sub"], ShouldEqual, "a")
+			})
+		})
+
+		Convey("When I verify more tokens than the cache can hold", func() {
+
+			ta, tb, tc := mkToken("a", now.Add(time.Hour)), mkToken("b", now.Add(time.Hour)), mkToken("c", now.Add(time.Hour))
+
+			_, _ = v.Verify(ta, cert(signerCert))
+			_, _ = v.Verify(tb, cert(signerCert))
+			_, _ = v.Verify(ta, cert(signerCert))
+			_, _ = v.Verify(tc, cert(signerCert))
+
+			Convey("Then the least recently used token should be evicted", func() {
+				So(v.cache.len(), ShouldEqual, 2)
+				_, ok := v.cache.get(cacheKeyFor(ta, sha(signerCert)), now)
+				So(ok, ShouldBeTrue)
+				_, ok = v.cache.get(cacheKeyFor(tb, sha(signerCert)), now)
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a cached token expires", func() {
+
+			token := mkToken("a", now.Add(time.Hour))
+			_, _ = v.Verify(token, cert(signerCert))
+
+			_, ok := v.cache.get(cacheKeyFor(token, sha(signerCert)), now.Add(2*time.Hour))
+
+			Convey("Then it should not be served anymore", func() {
+				So(ok, ShouldBeFalse)
+				So(v.cache.len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I verify an invalid token", func() {
+
+			token := makeToken(&jwt.StandardClaims{Subject: "sub"}, jwt.SigningMethodES256, key(wrongSignerKey))
+
+			_, err := v.Verify(token, cert(signerCert))
+
+			Convey("Then it should not be cached", func() {
+				So(err, ShouldNotBeNil)
+				So(v.cache.len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I verify a token only accepted thanks to the leeway", func() {
+
+			v.SetLeewayFunc(func() time.Duration { return 10 * time.Minute })
+			token := mkToken("a", now.Add(-5*time.Minute))
+
+			_, err := v.Verify(token, cert(signerCert))
+
+			Convey("Then it should not be cached", func() {
+				So(err, ShouldBeNil)
+				So(v.cache.len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func BenchmarkVerifier_Verify(b *testing.B) {
+
+	token := makeToken(&jwt.StandardClaims{Subject: "sub", ExpiresAt: time.Now().Add(time.Hour).Unix()}, jwt.SigningMethodES256, key(signerKey))
+	c := cert(signerCert)
+
+	b.Run("uncached", func(b *testing.B) {
+		v := NewVerifier(c)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := v.Verify(token, c); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		v := NewVerifier(c)
+		v.SetCacheSize(1024)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := v.Verify(token, c); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func sha(data []byte) [32]byte {
+	return sha256.Sum256(cert(data).Raw)
+}
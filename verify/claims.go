@@ -0,0 +1,64 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"sort"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/gaia/types"
+)
+
+// UnsecureClaims returns the claims contained in the given token
+// without verifying its signature. The token must be first verified
+// in order to use the claims securely.
+func UnsecureClaims(token string) (*types.MidgardClaims, error) {
+
+	c := &types.MidgardClaims{}
+	p := jwt.Parser{}
+
+	if _, _, err := p.ParseUnverified(token, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Normalize returns the given claims as a sorted list of
+// tags like "@auth:subject=xxx".
+func Normalize(c *types.MidgardClaims) (claims []string) {
+
+	if c == nil {
+		return
+	}
+
+	cache := map[string]struct{}{}
+
+	if c.Subject != "" {
+		cache[FormatTag(TagKeySubject, c.Subject)] = struct{}{}
+	}
+
+	for key, value := range c.Data {
+		if value != "" {
+			cache[FormatTag(key, value)] = struct{}{}
+		}
+	}
+
+	// remove duplicates
+	for key := range cache {
+		claims = append(claims, key)
+	}
+
+	sort.Strings(claims)
+
+	return
+}
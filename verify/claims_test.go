@@ -0,0 +1,67 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestUnsecureClaims(t *testing.T) {
+
+	Convey("Given I have a token", t, func() {
+
+		token := makeToken(
+			&types.MidgardClaims{
+				Data:           map[string]string{"Organization": "acme", "empty": ""},
+				StandardClaims: jwt.StandardClaims{Subject: "sub"},
+			},
+			jwt.SigningMethodES256,
+			key(signerKey),
+		)
+
+		Convey("When I call UnsecureClaims", func() {
+
+			c, err := UnsecureClaims(token)
+
+			Convey("Then err should be nil", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then the normalized claims should be correct", func() {
+				So(Normalize(c), ShouldResemble, []string{
+					"@auth:organization=acme",
+					"@auth:subject=sub",
+				})
+			})
+		})
+	})
+
+	Convey("Given I have an invalid token", t, func() {
+
+		_, err := UnsecureClaims("nope")
+
+		Convey("Then err should not be nil", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given I have nil claims", t, func() {
+
+		Convey("Then Normalize should return nil", func() {
+			So(Normalize(nil), ShouldBeNil)
+		})
+	})
+}
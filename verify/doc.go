@@ -0,0 +1,23 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package verify contains helpers to verify Midgard
+// tokens locally at high throughput.
+//
+// The package only depends on pure Go code and
+// compiles under js/wasm, so the same verification
+// and introspection code can be used in browsers.
+//
+// The file testdata/vectors.json contains canonical test vectors
+// giving, for each token, the expected normalized claims and the
+// expected verification result against the given certificate.
+// Other implementations should validate against them.
+package verify // import "go.aporeto.io/midgard-lib/verify"
@@ -0,0 +1,185 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.aporeto.io/gaia/types"
+)
+
+// ErrPoolStopped is the error of the verifications submitted
+// to a Pool whose Run has returned, or still pending when it did.
+var ErrPoolStopped = errors.New("verification pool stopped")
+
+// A Func is the type of function used to verify a token.
+type Func func(token string) (*types.MidgardClaims, error)
+
+// A Future holds the pending result of a token
+// verification submitted to a Pool.
+type Future struct {
+	done   chan struct{}
+	claims *types.MidgardClaims
+	err    error
+}
+
+func newFuture() *Future {
+	return &Future{
+		done: make(chan struct{}),
+	}
+}
+
+func (f *Future) resolve(claims *types.MidgardClaims, err error) {
+	f.claims = claims
+	f.err = err
+	close(f.done)
+}
+
+// Done returns a channel that is closed when
+// the verification is complete.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the verification to complete and returns its
+// result. If the context is canceled before, the context error
+// is returned.
+func (f *Future) Wait(ctx context.Context) (*types.MidgardClaims, error) {
+
+	select {
+	case <-f.done:
+		return f.claims, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type job struct {
+	token  string
+	future *Future
+}
+
+// A Pool verifies tokens using a bounded number of
+// worker goroutines. This amortizes the cost of the
+// signature verifications for components verifying
+// a lot of tokens concurrently.
+type Pool struct {
+	workers    int
+	verifyFunc Func
+	jobs       chan job
+	stopping   chan struct{}
+	stopped    bool
+
+	sync.RWMutex
+}
+
+// NewPool returns a new Pool that will use the given number of workers
+// to verify tokens using the given Func. Run must be called for the pool
+// to start processing the submitted tokens.
+func NewPool(workers int, verifyFunc Func) *Pool {
+
+	if workers <= 0 {
+		panic("workers must be greater than 0")
+	}
+
+	if verifyFunc == nil {
+		panic("verifyFunc cannot be nil")
+	}
+
+	return &Pool{
+		workers:    workers,
+		verifyFunc: verifyFunc,
+		jobs:       make(chan job, workers),
+		stopping:   make(chan struct{}),
+	}
+}
+
+// Run starts the workers and blocks until the given context is canceled.
+// The verifications still queued are then resolved with ErrPoolStopped,
+// as are the ones submitted afterwards. Run must only be called once.
+func (p *Pool) Run(ctx context.Context) {
+
+	var wg sync.WaitGroup
+	wg.Add(p.workers)
+
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case j := <-p.jobs:
+					if ctx.Err() != nil {
+						j.future.resolve(nil, ErrPoolStopped)
+						return
+					}
+					j.future.resolve(p.verifyFunc(j.token))
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Unblock the pending Submit calls, and wait for
+	// them to return before draining the queue.
+	close(p.stopping)
+
+	p.Lock()
+	p.stopped = true
+	p.Unlock()
+
+	for {
+		select {
+		case j := <-p.jobs:
+			j.future.resolve(nil, ErrPoolStopped)
+		default:
+			return
+		}
+	}
+}
+
+// Submit queues the given token for verification and returns a Future
+// holding the result. If the context is canceled before the token could
+// be queued, the Future is resolved with the context error. If the pool
+// is stopped, the Future is resolved with ErrPoolStopped.
+func (p *Pool) Submit(ctx context.Context, token string) *Future {
+
+	f := newFuture()
+
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.stopped {
+		f.resolve(nil, ErrPoolStopped)
+		return f
+	}
+
+	select {
+	case p.jobs <- job{token: token, future: f}:
+	case <-ctx.Done():
+		f.resolve(nil, ctx.Err())
+	case <-p.stopping:
+		f.resolve(nil, ErrPoolStopped)
+	}
+
+	return f
+}
+
+// Verify submits the given token and waits for the verification result.
+func (p *Pool) Verify(ctx context.Context, token string) (*types.MidgardClaims, error) {
+
+	return p.Submit(ctx, token).Wait(ctx)
+}
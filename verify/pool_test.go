@@ -0,0 +1,164 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestPool_NewPool(t *testing.T) {
+
+	Convey("Given I create a pool without verify func", t, func() {
+
+		Convey("Then it should panic", func() {
+			So(func() { NewPool(1, nil) }, ShouldPanicWith, "verifyFunc cannot be nil")
+		})
+	})
+
+	Convey("Given I create a pool without workers", t, func() {
+
+		Convey("Then it should panic", func() {
+			So(func() { NewPool(0, func(string) (*types.MidgardClaims, error) { return nil, nil }) }, ShouldPanicWith, "workers must be greater than 0")
+		})
+	})
+}
+
+func TestPool_Verify(t *testing.T) {
+
+	Convey("Given I have a running pool", t, func() {
+
+		var inflight, maxInflight int32
+
+		f := func(token string) (*types.MidgardClaims, error) {
+
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+
+			for {
+				m := atomic.LoadInt32(&maxInflight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInflight, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+
+			if token == "bad" {
+				return nil, fmt.Errorf("bad token")
+			}
+
+			return &types.MidgardClaims{StandardClaims: jwt.StandardClaims{Subject: token}}, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p := NewPool(2, f)
+		go p.Run(ctx)
+
+		Convey("When I verify a lot of tokens concurrently", func() {
+
+			var wg sync.WaitGroup
+			var failures int32
+
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					token := fmt.Sprintf("token-%d", i)
+					claims, err := p.Verify(ctx, token)
+					if err != nil || claims.Subject != token {
+						atomic.AddInt32(&failures, 1)
+					}
+				}(i)
+			}
+
+			wg.Wait()
+
+			Convey("Then all verifications should succeed", func() {
+				So(atomic.LoadInt32(&failures), ShouldEqual, 0)
+			})
+
+			Convey("Then concurrency should have been bounded", func() {
+				So(atomic.LoadInt32(&maxInflight), ShouldBeLessThanOrEqualTo, 2)
+			})
+		})
+
+		Convey("When I verify a bad token", func() {
+
+			claims, err := p.Submit(ctx, "bad").Wait(ctx)
+
+			Convey("Then err should not be nil", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "bad token")
+			})
+
+			Convey("Then claims should be nil", func() {
+				So(claims, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I have a pool that is not running", t, func() {
+
+		p := NewPool(1, func(string) (*types.MidgardClaims, error) { return nil, nil })
+
+		Convey("When I submit more tokens than the queue can hold", func() {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			p.Submit(ctx, "a")
+			f := p.Submit(ctx, "b")
+
+			<-f.Done()
+			_, err := f.Wait(context.Background())
+
+			Convey("Then the future should be resolved with the context error", func() {
+				So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given I have a pool with a queued verification", t, func() {
+
+		p := NewPool(1, func(string) (*types.MidgardClaims, error) { return nil, nil })
+		queued := p.Submit(context.Background(), "a")
+
+		Convey("When I run the pool until its context is canceled", func() {
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			p.Run(ctx)
+
+			Convey("Then the queued verification should be resolved", func() {
+				_, err := queued.Wait(context.Background())
+				So(err, ShouldEqual, ErrPoolStopped)
+			})
+
+			Convey("Then a new verification should fail immediately", func() {
+				_, err := p.Verify(context.Background(), "b")
+				So(err, ShouldEqual, ErrPoolStopped)
+			})
+		})
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"go.aporeto.io/gaia/types"
+)
+
+// ErrRealmNotAllowed is returned when a token
+// has been issued from a realm that is not allowed.
+type ErrRealmNotAllowed struct {
+	Realm string
+}
+
+func (e ErrRealmNotAllowed) Error() string {
+	return fmt.Sprintf("tokens issued from realm '%s' are not allowed", e.Realm)
+}
+
+// CheckRealm returns an ErrRealmNotAllowed if the given claims
+// have not been issued from one of the given realms. Realms are
+// compared case insensitively. If no realm is given, all realms
+// are allowed.
+func CheckRealm(c *types.MidgardClaims, allowed ...string) error {
+
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	if c == nil {
+		return ErrRealmNotAllowed{}
+	}
+
+	for _, realm := range allowed {
+		if strings.EqualFold(string(c.Realm), realm) {
+			return nil
+		}
+	}
+
+	return ErrRealmNotAllowed{Realm: string(c.Realm)}
+}
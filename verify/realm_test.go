@@ -0,0 +1,48 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+func TestCheckRealm(t *testing.T) {
+
+	Convey("Given I have claims issued from LDAP", t, func() {
+
+		c := &types.MidgardClaims{Realm: "LDAP"}
+
+		Convey("Then it should be allowed if LDAP is allowed", func() {
+			So(CheckRealm(c, "certificate", "ldap"), ShouldBeNil)
+		})
+
+		Convey("Then it should be allowed if no realm is given", func() {
+			So(CheckRealm(c), ShouldBeNil)
+		})
+
+		Convey("Then it should not be allowed if LDAP is not allowed", func() {
+			err := CheckRealm(c, "certificate")
+			So(err, ShouldResemble, ErrRealmNotAllowed{Realm: "LDAP"})
+			So(err.Error(), ShouldEqual, "tokens issued from realm 'LDAP' are not allowed")
+		})
+	})
+
+	Convey("Given I have no claims", t, func() {
+
+		Convey("Then it should not be allowed", func() {
+			So(CheckRealm(nil, "certificate"), ShouldResemble, ErrRealmNotAllowed{})
+		})
+	})
+}
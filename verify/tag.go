@@ -0,0 +1,110 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TagPrefix is the prefix of the claim tags.
+const TagPrefix = "@auth:"
+
+// Well known claim tag keys.
+const (
+	TagKeySubject = "subject"
+	TagKeyRealm   = "realm"
+)
+
+// A Tag is a claim tag like "@auth:subject=xxx".
+//
+// The key of a tag is lowercase and cannot be empty, nor
+// contain '=', spaces or control characters. The value
+// cannot be empty nor contain control characters.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// ParseTag parses the given string as a Tag.
+func ParseTag(s string) (Tag, error) {
+
+	if !strings.HasPrefix(s, TagPrefix) {
+		return Tag{}, fmt.Errorf("invalid tag '%s': missing %s prefix", s, TagPrefix)
+	}
+
+	kv := strings.SplitN(strings.TrimPrefix(s, TagPrefix), "=", 2)
+	if len(kv) != 2 {
+		return Tag{}, fmt.Errorf("invalid tag '%s': missing '='", s)
+	}
+
+	t := Tag{Key: kv[0], Value: kv[1]}
+	if err := t.Validate(); err != nil {
+		return Tag{}, fmt.Errorf("invalid tag '%s': %s", s, err)
+	}
+
+	return t, nil
+}
+
+// ParseTags parses the given strings as Tags.
+func ParseTags(tags []string) ([]Tag, error) {
+
+	out := make([]Tag, len(tags))
+
+	for i, s := range tags {
+		t, err := ParseTag(s)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = t
+	}
+
+	return out, nil
+}
+
+// FormatTag returns the tag string for the given key and value.
+// The key is lowercased, but no other validation is performed.
+func FormatTag(key string, value string) string {
+	return TagPrefix + strings.ToLower(key) + "=" + value
+}
+
+// String returns the tag string of the Tag.
+func (t Tag) String() string {
+	return FormatTag(t.Key, t.Value)
+}
+
+// Validate returns an error if the Tag is not valid.
+func (t Tag) Validate() error {
+
+	if t.Key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	for _, r := range t.Key {
+		if r == '=' || unicode.IsSpace(r) || unicode.IsControl(r) || unicode.IsUpper(r) {
+			return fmt.Errorf("invalid character '%c' in key", r)
+		}
+	}
+
+	if t.Value == "" {
+		return fmt.Errorf("empty value")
+	}
+
+	for _, r := range t.Value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("invalid character %q in value", r)
+		}
+	}
+
+	return nil
+}
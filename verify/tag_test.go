@@ -0,0 +1,92 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTag_ParseTag(t *testing.T) {
+
+	Convey("Parsing a valid tag should work", t, func() {
+		tag, err := ParseTag("@auth:organization=Aporeto Inc.=x")
+		So(err, ShouldBeNil)
+		So(tag, ShouldResemble, Tag{Key: "organization", Value: "Aporeto Inc.=x"})
+		So(tag.String(), ShouldEqual, "@auth:organization=Aporeto Inc.=x")
+	})
+
+	Convey("Parsing a tag without prefix should fail", t, func() {
+		_, err := ParseTag("organization=aporeto")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag 'organization=aporeto': missing @auth: prefix")
+	})
+
+	Convey("Parsing a tag without value should fail", t, func() {
+		_, err := ParseTag("@auth:organization")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag '@auth:organization': missing '='")
+	})
+
+	Convey("Parsing a tag with an empty key should fail", t, func() {
+		_, err := ParseTag("@auth:=aporeto")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag '@auth:=aporeto': empty key")
+	})
+
+	Convey("Parsing a tag with an empty value should fail", t, func() {
+		_, err := ParseTag("@auth:organization=")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag '@auth:organization=': empty value")
+	})
+
+	Convey("Parsing a tag with an uppercase key should fail", t, func() {
+		_, err := ParseTag("@auth:Organization=aporeto")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag '@auth:Organization=aporeto': invalid character 'O' in key")
+	})
+
+	Convey("Parsing a tag with a space in the key should fail", t, func() {
+		_, err := ParseTag("@auth:org unit=aporeto")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag '@auth:org unit=aporeto': invalid character ' ' in key")
+	})
+
+	Convey("Parsing a tag with a control character in the value should fail", t, func() {
+		_, err := ParseTag("@auth:organization=apo\nreto")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid tag '@auth:organization=apo\nreto': invalid character '\\n' in value")
+	})
+}
+
+func TestTag_ParseTags(t *testing.T) {
+
+	Convey("Parsing valid tags should work", t, func() {
+		tags, err := ParseTags([]string{"@auth:subject=bob", "@auth:realm=vince"})
+		So(err, ShouldBeNil)
+		So(tags, ShouldResemble, []Tag{{Key: TagKeySubject, Value: "bob"}, {Key: TagKeyRealm, Value: "vince"}})
+	})
+
+	Convey("Parsing an invalid tag should fail", t, func() {
+		tags, err := ParseTags([]string{"@auth:subject=bob", "nope"})
+		So(err, ShouldNotBeNil)
+		So(tags, ShouldBeNil)
+	})
+}
+
+func TestTag_FormatTag(t *testing.T) {
+
+	Convey("Formatting a tag should lowercase the key", t, func() {
+		So(FormatTag("commonName", "Bob"), ShouldEqual, "@auth:commonname=Bob")
+	})
+}
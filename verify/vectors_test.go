@@ -0,0 +1,206 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/gaia/types"
+)
+
+// The test vectors in testdata/vectors.json are meant to be shared with
+// the other implementations of the token verification. Run
+//
+//	go test ./verify -run TestVectors -update
+//
+// to regenerate them after changing the definitions below.
+var update = flag.Bool("update", false, "regenerate the golden test vectors")
+
+const vectorsPath = "testdata/vectors.json"
+
+const (
+	reasonMalformed            = "malformed"
+	reasonExpired              = "expired"
+	reasonNotValidYet          = "not-valid-yet"
+	reasonInvalidSignature     = "invalid-signature"
+	reasonUnsupportedAlgorithm = "unsupported-algorithm"
+)
+
+type vector struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Claims []string `json:"claims"`
+	Valid  bool     `json:"valid"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+type vectors struct {
+	Certificate string   `json:"certificate"`
+	Vectors     []vector `json:"vectors"`
+}
+
+// year2100 is used as expiration of the valid tokens.
+const year2100 = 4102444800
+
+func generateVectors() vectors {
+
+	c := func(sub string, data map[string]string, exp int64, nbf int64) *types.MidgardClaims {
+		return &types.MidgardClaims{
+			Realm: "Vince",
+			Data:  data,
+			StandardClaims: jwt.StandardClaims{
+				Subject:   sub,
+				Issuer:    "https://midgard",
+				IssuedAt:  1514764800,
+				ExpiresAt: exp,
+				NotBefore: nbf,
+			},
+		}
+	}
+
+	valid := c("user@acme.com", map[string]string{"account": "acme", "Organization": "Acme"}, year2100, 0)
+
+	v := vectors{
+		Certificate: string(signerCert),
+		Vectors: []vector{
+			{
+				Name:  "valid",
+				Token: makeToken(valid, jwt.SigningMethodES256, key(signerKey)),
+				Valid: true,
+			},
+			{
+				Name:  "valid-with-empty-values",
+				Token: makeToken(c("", map[string]string{"account": "acme", "empty": ""}, year2100, 0), jwt.SigningMethodES256, key(signerKey)),
+				Valid: true,
+			},
+			{
+				Name:   "expired",
+				Token:  makeToken(c("user@acme.com", map[string]string{"account": "acme"}, 1514768400, 0), jwt.SigningMethodES256, key(signerKey)),
+				Reason: reasonExpired,
+			},
+			{
+				Name:   "not-valid-yet",
+				Token:  makeToken(c("user@acme.com", map[string]string{"account": "acme"}, year2100+3600, year2100), jwt.SigningMethodES256, key(signerKey)),
+				Reason: reasonNotValidYet,
+			},
+			{
+				Name:   "wrong-signer",
+				Token:  makeToken(valid, jwt.SigningMethodES256, key(wrongSignerKey)),
+				Reason: reasonInvalidSignature,
+			},
+			{
+				Name:   "hmac-algorithm",
+				Token:  makeToken(valid, jwt.SigningMethodHS256, []byte("secret")),
+				Reason: reasonUnsupportedAlgorithm,
+			},
+			{
+				Name:   "malformed",
+				Token:  "not.a.token",
+				Reason: reasonMalformed,
+			},
+		},
+	}
+
+	for i, vec := range v.Vectors {
+		if uc, err := UnsecureClaims(vec.Token); err == nil {
+			v.Vectors[i].Claims = Normalize(uc)
+		}
+	}
+
+	return v
+}
+
+// reasonFromError returns the reason code of the given verification error.
+func reasonFromError(err error) string {
+
+	verr, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return ""
+	}
+
+	switch {
+	case verr.Errors&jwt.ValidationErrorMalformed != 0:
+		return reasonMalformed
+	case verr.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return reasonUnsupportedAlgorithm
+	case verr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return reasonInvalidSignature
+	case verr.Errors&jwt.ValidationErrorExpired != 0:
+		return reasonExpired
+	case verr.Errors&jwt.ValidationErrorNotValidYet != 0:
+		return reasonNotValidYet
+	default:
+		return ""
+	}
+}
+
+func TestVectors(t *testing.T) {
+
+	if *update {
+		data, err := json.MarshalIndent(generateVectors(), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(vectorsPath, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given I load the golden test vectors", t, func() {
+
+		data, err := ioutil.ReadFile(vectorsPath)
+		So(err, ShouldBeNil)
+
+		v := vectors{}
+		So(json.Unmarshal(data, &v), ShouldBeNil)
+		So(len(v.Vectors), ShouldBeGreaterThan, 0)
+
+		verifier := NewVerifier()
+		signer := cert([]byte(v.Certificate))
+
+		for _, vec := range v.Vectors {
+
+			vec := vec
+
+			Convey("When I verify the vector "+vec.Name, func() {
+
+				c, err := verifier.Verify(vec.Token, signer)
+
+				Convey("Then the verification result should be the expected one", func() {
+					if vec.Valid {
+						So(err, ShouldBeNil)
+						So(Normalize(c), ShouldResemble, vec.Claims)
+					} else {
+						So(err, ShouldNotBeNil)
+						So(reasonFromError(err), ShouldEqual, vec.Reason)
+					}
+				})
+
+				Convey("Then the unsecure claims should be the expected ones", func() {
+					uc, err := UnsecureClaims(vec.Token)
+					if vec.Reason == reasonMalformed {
+						So(err, ShouldNotBeNil)
+						So(vec.Claims, ShouldBeNil)
+					} else {
+						So(err, ShouldBeNil)
+						So(Normalize(uc), ShouldResemble, vec.Claims)
+					}
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 Aporeto Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/gaia/types"
+)
+
+// timeValidationErrors are the validation errors
+// related to the times of the claims.
+const timeValidationErrors = jwt.ValidationErrorExpired | jwt.ValidationErrorNotValidYet | jwt.ValidationErrorIssuedAt
+
+// A Verifier verifies tokens locally using the public key of
+// the signer certificate.
+type Verifier struct {
+	leewayFunc func() time.Duration
+	cache      *resultCache
+	bundle     *Bundle
+
+	sync.RWMutex
+}
+
+// NewVerifier returns a new Verifier. The keys of the given
+// certificates are checked immediately.
+func NewVerifier(certs ...*x509.Certificate) *Verifier {
+
+	v := &Verifier{}
+
+	for _, cert := range certs {
+		if _, err := v.publicKey(cert); err != nil {
+			panic(fmt.Sprintf("invalid signer certificate: %s", err))
+		}
+	}
+
+	return v
+}
+
+// SetLeewayFunc sets the function returning the leeway tolerated when
+// checking the expiration, not before and issued at times of tokens.
+// A negative duration is used as its absolute value, so the clock skew
+// measured by a midgard client can be used directly to accept tokens
+// on devices whose clock is skewed.
+func (v *Verifier) SetLeewayFunc(f func() time.Duration) {
+
+	if f == nil {
+		panic("leewayFunc cannot be nil")
+	}
+
+	v.Lock()
+	v.leewayFunc = f
+	v.Unlock()
+}
+
+// SetCacheSize enables the caching of the successfully verified
+// tokens, keeping at most size of them until their expiration.
+// The least recently used tokens are evicted first. Tokens only
+// accepted thanks to the leeway are never cached.
+func (v *Verifier) SetCacheSize(size int) {
+
+	if size <= 0 {
+		panic("cache size must be greater than 0")
+	}
+
+	v.Lock()
+	v.cache = newResultCache(size)
+	v.Unlock()
+}
+
+// Verify verifies the given token using the given certificate
+// and returns the claims it contains.
+func (v *Verifier) Verify(tokenString string, cert *x509.Certificate) (*types.MidgardClaims, error) {
+
+	key, err := v.publicKey(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	v.RLock()
+	cache := v.cache
+	v.RUnlock()
+
+	var cacheKey [sha256.Size]byte
+	if cache != nil {
+		cacheKey = cacheKeyFor(tokenString, sha256.Sum256(cert.Raw))
+		if claims, ok := cache.get(cacheKey, jwt.TimeFunc()); ok {
+			return claims, nil
+		}
+	}
+
+	c := &types.MidgardClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, c, func(token *jwt.Token) (interface{}, error) {
+
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %s", token.Header["alg"])
+		}
+
+		return key, nil
+	})
+
+	if err != nil {
+		if token == nil || !v.tolerated(err, c) {
+			return nil, err
+		}
+		return token.Claims.(*types.MidgardClaims), nil
+	}
+
+	if cache != nil {
+		cache.set(cacheKey, c)
+	}
+
+	return token.Claims.(*types.MidgardClaims), nil
+}
+
+// Func returns a Func verifying tokens with the given
+// certificate, that can be used with a Pool.
+func (v *Verifier) Func(cert *x509.Certificate) Func {
+
+	return func(token string) (*types.MidgardClaims, error) {
+		return v.Verify(token, cert)
+	}
+}
+
+func (v *Verifier) publicKey(cert *x509.Certificate) (*ecdsa.PublicKey, error) {
+
+	if cert == nil {
+		return nil, fmt.Errorf("missing signer certificate")
+	}
+
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signer public key type: %T", cert.PublicKey)
+	}
+
+	return key, nil
+}
+
+// tolerated returns true if the given error is only due to the
+// times of the claims, and they are valid within the leeway.
+func (v *Verifier) tolerated(err error, c *types.MidgardClaims) bool {
+
+	verr, ok := err.(*jwt.ValidationError)
+	if !ok || verr.Errors&^timeValidationErrors != 0 {
+		return false
+	}
+
+	v.RLock()
+	f := v.leewayFunc
+	v.RUnlock()
+
+	if f == nil {
+		return false
+	}
+
+	leeway := f()
+	if leeway < 0 {
+		leeway = -leeway
+	}
+
+	now := jwt.TimeFunc()
+
+	return c.VerifyExpiresAt(now.Add(-leeway).Unix(), false) &&
+		c.VerifyNotBefore(now.Add(leeway).Unix(), false) &&
+		c.VerifyIssuedAt(now.Add(leeway).Unix(), false)
+}